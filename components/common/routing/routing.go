@@ -0,0 +1,513 @@
+// Package routing generates and reconciles the objects that expose a
+// workload's Service under a URL prefix of the cluster gateway. The same
+// Route can be rendered as an Istio VirtualService or as a Gateway API
+// HTTPRoute, so controllers don't need to know which one the cluster uses.
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Mode selects the kind of object generated for a Route.
+type Mode string
+
+const (
+	// ModeNone disables routing, only the Service is created.
+	ModeNone Mode = "none"
+	// ModeIstio generates networking.istio.io VirtualServices.
+	ModeIstio Mode = "istio"
+	// ModeGatewayAPI generates gateway.networking.k8s.io HTTPRoutes.
+	ModeGatewayAPI Mode = "gateway-api"
+)
+
+const (
+	IstioAPIVersion = "networking.istio.io/v1alpha3"
+	IstioKind       = "VirtualService"
+
+	GatewayAPIGroup      = "gateway.networking.k8s.io"
+	GatewayAPIVersion    = GatewayAPIGroup + "/v1"
+	GatewayAPIKind       = "HTTPRoute"
+	GatewayAPIParentKind = "Gateway"
+
+	// TCPRoutes are only part of the experimental channel of the Gateway API
+	GatewayAPITCPVersion = GatewayAPIGroup + "/v1alpha2"
+	GatewayAPITCPKind    = "TCPRoute"
+
+	DefaultClusterDomain = "cluster.local"
+)
+
+// Config holds the cluster wide routing settings of a controller.
+type Config struct {
+	Mode Mode
+	// Gateway is the "namespace/name" of the Istio Gateway or of the
+	// Gateway API Gateway the generated routes attach to.
+	Gateway string
+	// SectionName optionally restricts HTTPRoutes to a single listener of
+	// the Gateway. It is ignored by Istio.
+	SectionName string
+	// ClusterDomain is used to build the FQDN of the backend Service.
+	ClusterDomain string
+}
+
+// Route describes how requests under Prefix reach a Service.
+type Route struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+
+	// Prefix is the path prefix to match, e.g. /notebook/ns/name/.
+	Prefix string
+	// Rewrite replaces Prefix before the request is forwarded. An empty
+	// value leaves the path untouched.
+	Rewrite string
+	// RequestHeaders are set on the request before it is forwarded. A nil
+	// map leaves the headers section out of VirtualServices altogether.
+	RequestHeaders map[string]string
+	// Timeout is the request timeout as a duration string, e.g. 300s.
+	Timeout string
+
+	ServiceName string
+	ServicePort int32
+}
+
+// TCPRoute describes how the connections to a port of the gateway reach a
+// Service, e.g. for protocols that can't be routed by path like SSH. The
+// gateway must listen on GatewayPort.
+type TCPRoute struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+
+	GatewayPort int32
+
+	ServiceName string
+	ServicePort int32
+}
+
+// ParseMode parses the value of the ROUTING_MODE environment variable.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case ModeNone, ModeIstio, ModeGatewayAPI:
+		return m, nil
+	case "":
+		return ModeNone, nil
+	default:
+		return "", fmt.Errorf("unknown routing mode %q, must be one of %q, %q or %q",
+			s, ModeNone, ModeIstio, ModeGatewayAPI)
+	}
+}
+
+// ConfigFromEnv overrides the given defaults with the ROUTING_MODE,
+// GATEWAY (or the older ISTIO_GATEWAY), GATEWAY_SECTION_NAME and
+// CLUSTER_DOMAIN environment variables. Empty variables are ignored.
+func ConfigFromEnv(defaults Config) (Config, error) {
+	cfg := defaults
+	if v := os.Getenv("ROUTING_MODE"); v != "" {
+		mode, err := ParseMode(v)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Mode = mode
+	}
+	if v := os.Getenv("GATEWAY"); v != "" {
+		cfg.Gateway = v
+	} else if v := os.Getenv("ISTIO_GATEWAY"); v != "" {
+		cfg.Gateway = v
+	}
+	if v := os.Getenv("GATEWAY_SECTION_NAME"); v != "" {
+		cfg.SectionName = v
+	}
+	if v := os.Getenv("CLUSTER_DOMAIN"); v != "" {
+		cfg.ClusterDomain = v
+	}
+	if cfg.ClusterDomain == "" {
+		cfg.ClusterDomain = DefaultClusterDomain
+	}
+	return cfg, nil
+}
+
+// Enabled returns whether routes should be generated at all.
+func (c Config) Enabled() bool {
+	return c.Mode == ModeIstio || c.Mode == ModeGatewayAPI
+}
+
+// Object returns an empty object of the kind generated in this mode, to be
+// used with Owns() or Get(). It returns nil if routing is disabled.
+func (c Config) Object() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	switch c.Mode {
+	case ModeIstio:
+		obj.SetAPIVersion(IstioAPIVersion)
+		obj.SetKind(IstioKind)
+	case ModeGatewayAPI:
+		obj.SetAPIVersion(GatewayAPIVersion)
+		obj.SetKind(GatewayAPIKind)
+	default:
+		return nil
+	}
+	return obj
+}
+
+// TCPObject returns an empty object of the kind generated for TCPRoutes in
+// this mode. Istio VirtualServices route TCP too. It returns nil if routing is
+// disabled.
+func (c Config) TCPObject() *unstructured.Unstructured {
+	if c.Mode != ModeGatewayAPI {
+		return c.Object()
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(GatewayAPITCPVersion)
+	obj.SetKind(GatewayAPITCPKind)
+	return obj
+}
+
+// Generate renders the route as the object of the configured mode.
+func Generate(cfg Config, route Route) (*unstructured.Unstructured, error) {
+	obj := cfg.Object()
+	if obj == nil {
+		return nil, fmt.Errorf("routing is disabled")
+	}
+	if cfg.Gateway == "" {
+		return nil, fmt.Errorf("no gateway configured for routing mode %q", cfg.Mode)
+	}
+	obj.SetName(route.Name)
+	obj.SetNamespace(route.Namespace)
+	if len(route.Labels) > 0 {
+		obj.SetLabels(route.Labels)
+	}
+
+	clusterDomain := cfg.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+
+	var spec map[string]interface{}
+	var err error
+	switch cfg.Mode {
+	case ModeIstio:
+		spec = virtualServiceSpec(cfg.Gateway, clusterDomain, route)
+	case ModeGatewayAPI:
+		spec, err = httpRouteSpec(cfg.Gateway, cfg.SectionName, route)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+		return nil, fmt.Errorf("set .spec error: %v", err)
+	}
+	return obj, nil
+}
+
+// GenerateTCP renders the TCP route as the object of the configured mode.
+func GenerateTCP(cfg Config, route TCPRoute) (*unstructured.Unstructured, error) {
+	obj := cfg.TCPObject()
+	if obj == nil {
+		return nil, fmt.Errorf("routing is disabled")
+	}
+	if cfg.Gateway == "" {
+		return nil, fmt.Errorf("no gateway configured for routing mode %q", cfg.Mode)
+	}
+	obj.SetName(route.Name)
+	obj.SetNamespace(route.Namespace)
+	if len(route.Labels) > 0 {
+		obj.SetLabels(route.Labels)
+	}
+
+	clusterDomain := cfg.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+
+	var spec map[string]interface{}
+	var err error
+	switch cfg.Mode {
+	case ModeIstio:
+		spec = tcpVirtualServiceSpec(cfg.Gateway, clusterDomain, route)
+	case ModeGatewayAPI:
+		spec, err = tcpRouteSpec(cfg.Gateway, route)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+		return nil, fmt.Errorf("set .spec error: %v", err)
+	}
+	return obj, nil
+}
+
+func virtualServiceSpec(gateway, clusterDomain string, route Route) map[string]interface{} {
+	host := fmt.Sprintf("%s.%s.svc.%s", route.ServiceName, route.Namespace, clusterDomain)
+
+	http := map[string]interface{}{
+		"match": []interface{}{
+			map[string]interface{}{
+				"uri": map[string]interface{}{
+					"prefix": route.Prefix,
+				},
+			},
+		},
+		"route": []interface{}{
+			map[string]interface{}{
+				"destination": map[string]interface{}{
+					"host": host,
+					"port": map[string]interface{}{
+						"number": int64(route.ServicePort),
+					},
+				},
+			},
+		},
+	}
+	if route.Rewrite != "" {
+		http["rewrite"] = map[string]interface{}{
+			"uri": route.Rewrite,
+		}
+	}
+	if route.RequestHeaders != nil {
+		set := make(map[string]interface{}, len(route.RequestHeaders))
+		for k, v := range route.RequestHeaders {
+			set[k] = v
+		}
+		http["headers"] = map[string]interface{}{
+			"request": map[string]interface{}{
+				"set": set,
+			},
+		}
+	}
+	if route.Timeout != "" {
+		http["timeout"] = route.Timeout
+	}
+
+	return map[string]interface{}{
+		"hosts":    []interface{}{"*"},
+		"gateways": []interface{}{gateway},
+		"http":     []interface{}{http},
+	}
+}
+
+func tcpVirtualServiceSpec(gateway, clusterDomain string, route TCPRoute) map[string]interface{} {
+	host := fmt.Sprintf("%s.%s.svc.%s", route.ServiceName, route.Namespace, clusterDomain)
+
+	tcp := map[string]interface{}{
+		"match": []interface{}{
+			map[string]interface{}{
+				"port": int64(route.GatewayPort),
+			},
+		},
+		"route": []interface{}{
+			map[string]interface{}{
+				"destination": map[string]interface{}{
+					"host": host,
+					"port": map[string]interface{}{
+						"number": int64(route.ServicePort),
+					},
+				},
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"hosts":    []interface{}{"*"},
+		"gateways": []interface{}{gateway},
+		"tcp":      []interface{}{tcp},
+	}
+}
+
+// tcpRouteSpec attaches the TCPRoute to the listener of the Gateway on the
+// gateway port. Like httpRouteSpec, it spells out the defaulted fields.
+func tcpRouteSpec(gateway string, route TCPRoute) (map[string]interface{}, error) {
+	parts := strings.Split(gateway, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("gateway %q must have the form namespace/name", gateway)
+	}
+	parentRef := map[string]interface{}{
+		"group":     GatewayAPIGroup,
+		"kind":      GatewayAPIParentKind,
+		"namespace": parts[0],
+		"name":      parts[1],
+		"port":      int64(route.GatewayPort),
+	}
+
+	rule := map[string]interface{}{
+		"backendRefs": []interface{}{
+			map[string]interface{}{
+				"group":  "",
+				"kind":   "Service",
+				"name":   route.ServiceName,
+				"port":   int64(route.ServicePort),
+				"weight": int64(1),
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"rules":      []interface{}{rule},
+	}, nil
+}
+
+// httpRouteSpec spells out every field the API server would default, so that
+// the generated spec compares equal to the one read back from the cluster.
+func httpRouteSpec(gateway, sectionName string, route Route) (map[string]interface{}, error) {
+	parts := strings.Split(gateway, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("gateway %q must have the form namespace/name", gateway)
+	}
+	parentRef := map[string]interface{}{
+		"group":     GatewayAPIGroup,
+		"kind":      GatewayAPIParentKind,
+		"namespace": parts[0],
+		"name":      parts[1],
+	}
+	if sectionName != "" {
+		parentRef["sectionName"] = sectionName
+	}
+
+	filters := []interface{}{}
+	if route.Rewrite != "" {
+		filters = append(filters, map[string]interface{}{
+			"type": "URLRewrite",
+			"urlRewrite": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":               "ReplacePrefixMatch",
+					"replacePrefixMatch": route.Rewrite,
+				},
+			},
+		})
+	}
+	if len(route.RequestHeaders) > 0 {
+		// The API server keeps the list as-is, sort it to get a stable spec.
+		names := make([]string, 0, len(route.RequestHeaders))
+		for k := range route.RequestHeaders {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		set := make([]interface{}, 0, len(names))
+		for _, k := range names {
+			set = append(set, map[string]interface{}{
+				"name":  k,
+				"value": route.RequestHeaders[k],
+			})
+		}
+		filters = append(filters, map[string]interface{}{
+			"type": "RequestHeaderModifier",
+			"requestHeaderModifier": map[string]interface{}{
+				"set": set,
+			},
+		})
+	}
+
+	rule := map[string]interface{}{
+		"matches": []interface{}{
+			map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":  "PathPrefix",
+					"value": route.Prefix,
+				},
+			},
+		},
+		"backendRefs": []interface{}{
+			map[string]interface{}{
+				"group":  "",
+				"kind":   "Service",
+				"name":   route.ServiceName,
+				"port":   int64(route.ServicePort),
+				"weight": int64(1),
+			},
+		},
+	}
+	if len(filters) > 0 {
+		rule["filters"] = filters
+	}
+	if route.Timeout != "" {
+		rule["timeouts"] = map[string]interface{}{
+			"request": route.Timeout,
+		}
+	}
+
+	return map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"rules":      []interface{}{rule},
+	}, nil
+}
+
+// ErrNotControlled is returned by Reconcile when a route object of the same
+// name exists, but isn't controlled by the controller of the generated one.
+var ErrNotControlled = errors.New("not controlled by the owner of the route")
+
+// Reconcile creates the generated route object, or updates the existing
+// one if its labels or spec differ. If the generated object has a controller,
+// existing objects controlled by another one are left as they are and
+// ErrNotControlled is returned.
+func Reconcile(ctx context.Context, r client.Client, route *unstructured.Unstructured, log logr.Logger) error {
+	found := &unstructured.Unstructured{}
+	found.SetGroupVersionKind(route.GroupVersionKind())
+	kind := route.GetKind()
+	if err := r.Get(ctx, types.NamespacedName{Name: route.GetName(), Namespace: route.GetNamespace()}, found); err != nil {
+		if !apierrs.IsNotFound(err) {
+			log.Error(err, "error getting "+kind)
+			return err
+		}
+		log.Info("Creating "+kind, "namespace", route.GetNamespace(), "name", route.GetName())
+		if err := r.Create(ctx, route); err != nil {
+			log.Error(err, "unable to create "+kind)
+			return err
+		}
+		return nil
+	}
+	if owner := metav1.GetControllerOf(route); owner != nil {
+		if foundOwner := metav1.GetControllerOf(found); foundOwner == nil || foundOwner.UID != owner.UID {
+			return fmt.Errorf("%s %s/%s is %w", kind, route.GetNamespace(), route.GetName(), ErrNotControlled)
+		}
+	}
+	if CopyRouteFields(route, found) {
+		log.Info("Updating "+kind, "namespace", route.GetNamespace(), "name", route.GetName())
+		if err := r.Update(ctx, found); err != nil {
+			log.Error(err, "unable to update "+kind)
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyRouteFields copies the owned fields from one route object to another.
+// Returns true if the fields copied from don't match to.
+func CopyRouteFields(from, to *unstructured.Unstructured) bool {
+	requireUpdate := false
+	labels := to.GetLabels()
+	for k, v := range from.GetLabels() {
+		if labels[k] != v {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[k] = v
+			requireUpdate = true
+		}
+	}
+	if requireUpdate {
+		to.SetLabels(labels)
+	}
+
+	fromSpec, found, err := unstructured.NestedMap(from.Object, "spec")
+	if !found || err != nil {
+		return requireUpdate
+	}
+	toSpec, found, err := unstructured.NestedMap(to.Object, "spec")
+	if !found || err != nil || !reflect.DeepEqual(fromSpec, toSpec) {
+		unstructured.SetNestedMap(to.Object, fromSpec, "spec")
+		requireUpdate = true
+	}
+	return requireUpdate
+}
@@ -0,0 +1,374 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testRoute() Route {
+	return Route{
+		Name:           "notebook-ns-nb",
+		Namespace:      "ns",
+		Labels:         map[string]string{"notebook-name": "nb"},
+		Prefix:         "/notebook/ns/nb/",
+		Rewrite:        "/",
+		RequestHeaders: map[string]string{"X-B": "b", "X-A": "a"},
+		Timeout:        "300s",
+		ServiceName:    "nb",
+		ServicePort:    80,
+	}
+}
+
+func testTCPRoute() TCPRoute {
+	return TCPRoute{
+		Name:        "nb-ssh",
+		Namespace:   "ns",
+		GatewayPort: 2200,
+		ServiceName: "nb-ssh",
+		ServicePort: 22,
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	testCases := []struct {
+		testName string
+		cfg      Config
+		route    Route
+		kind     string
+		spec     map[string]interface{}
+		err      string
+	}{
+		{
+			testName: "Istio",
+			cfg:      Config{Mode: ModeIstio, Gateway: "kubeflow/kubeflow-gateway"},
+			route:    testRoute(),
+			kind:     IstioKind,
+			spec: map[string]interface{}{
+				"hosts":    []interface{}{"*"},
+				"gateways": []interface{}{"kubeflow/kubeflow-gateway"},
+				"http": []interface{}{map[string]interface{}{
+					"match": []interface{}{map[string]interface{}{
+						"uri": map[string]interface{}{"prefix": "/notebook/ns/nb/"},
+					}},
+					"rewrite": map[string]interface{}{"uri": "/"},
+					"headers": map[string]interface{}{
+						"request": map[string]interface{}{
+							"set": map[string]interface{}{"X-A": "a", "X-B": "b"},
+						},
+					},
+					"timeout": "300s",
+					"route": []interface{}{map[string]interface{}{
+						"destination": map[string]interface{}{
+							"host": "nb.ns.svc.cluster.local",
+							"port": map[string]interface{}{"number": int64(80)},
+						},
+					}},
+				}},
+			},
+		},
+		{
+			testName: "Gateway API",
+			cfg:      Config{Mode: ModeGatewayAPI, Gateway: "kubeflow/kubeflow-gateway", SectionName: "https"},
+			route:    testRoute(),
+			kind:     GatewayAPIKind,
+			spec: map[string]interface{}{
+				"parentRefs": []interface{}{map[string]interface{}{
+					"group":       GatewayAPIGroup,
+					"kind":        GatewayAPIParentKind,
+					"namespace":   "kubeflow",
+					"name":        "kubeflow-gateway",
+					"sectionName": "https",
+				}},
+				"rules": []interface{}{map[string]interface{}{
+					"matches": []interface{}{map[string]interface{}{
+						"path": map[string]interface{}{"type": "PathPrefix", "value": "/notebook/ns/nb/"},
+					}},
+					"filters": []interface{}{
+						map[string]interface{}{
+							"type": "URLRewrite",
+							"urlRewrite": map[string]interface{}{
+								"path": map[string]interface{}{
+									"type":               "ReplacePrefixMatch",
+									"replacePrefixMatch": "/",
+								},
+							},
+						},
+						map[string]interface{}{
+							"type": "RequestHeaderModifier",
+							"requestHeaderModifier": map[string]interface{}{
+								"set": []interface{}{
+									map[string]interface{}{"name": "X-A", "value": "a"},
+									map[string]interface{}{"name": "X-B", "value": "b"},
+								},
+							},
+						},
+					},
+					"timeouts": map[string]interface{}{"request": "300s"},
+					"backendRefs": []interface{}{map[string]interface{}{
+						"group":  "",
+						"kind":   "Service",
+						"name":   "nb",
+						"port":   int64(80),
+						"weight": int64(1),
+					}},
+				}},
+			},
+		},
+		{
+			testName: "Disabled",
+			cfg:      Config{Mode: ModeNone, Gateway: "kubeflow/kubeflow-gateway"},
+			route:    testRoute(),
+			err:      "routing is disabled",
+		},
+		{
+			testName: "No gateway",
+			cfg:      Config{Mode: ModeIstio},
+			route:    testRoute(),
+			err:      "no gateway configured",
+		},
+		{
+			testName: "Gateway without namespace",
+			cfg:      Config{Mode: ModeGatewayAPI, Gateway: "kubeflow-gateway"},
+			route:    testRoute(),
+			err:      "must have the form namespace/name",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			obj, err := Generate(c.cfg, c.route)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("Got the error %v, Expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if obj.GetKind() != c.kind || obj.GetName() != "notebook-ns-nb" || obj.GetNamespace() != "ns" ||
+				obj.GetLabels()["notebook-name"] != "nb" {
+				t.Errorf("Got the object %+v", obj.Object)
+			}
+			if spec := obj.Object["spec"]; !reflect.DeepEqual(spec, c.spec) {
+				t.Errorf("Got the spec %+v, Expected %+v", spec, c.spec)
+			}
+		})
+	}
+}
+
+func TestGenerateTCP(t *testing.T) {
+	testCases := []struct {
+		testName   string
+		cfg        Config
+		apiVersion string
+		kind       string
+		spec       map[string]interface{}
+		err        string
+	}{
+		{
+			testName:   "Istio",
+			cfg:        Config{Mode: ModeIstio, Gateway: "kubeflow/kubeflow-gateway", ClusterDomain: "example.org"},
+			apiVersion: IstioAPIVersion,
+			kind:       IstioKind,
+			spec: map[string]interface{}{
+				"hosts":    []interface{}{"*"},
+				"gateways": []interface{}{"kubeflow/kubeflow-gateway"},
+				"tcp": []interface{}{map[string]interface{}{
+					"match": []interface{}{map[string]interface{}{"port": int64(2200)}},
+					"route": []interface{}{map[string]interface{}{
+						"destination": map[string]interface{}{
+							"host": "nb-ssh.ns.svc.example.org",
+							"port": map[string]interface{}{"number": int64(22)},
+						},
+					}},
+				}},
+			},
+		},
+		{
+			testName:   "Gateway API",
+			cfg:        Config{Mode: ModeGatewayAPI, Gateway: "kubeflow/kubeflow-gateway", SectionName: "https"},
+			apiVersion: GatewayAPITCPVersion,
+			kind:       GatewayAPITCPKind,
+			spec: map[string]interface{}{
+				"parentRefs": []interface{}{map[string]interface{}{
+					"group":     GatewayAPIGroup,
+					"kind":      GatewayAPIParentKind,
+					"namespace": "kubeflow",
+					"name":      "kubeflow-gateway",
+					"port":      int64(2200),
+				}},
+				"rules": []interface{}{map[string]interface{}{
+					"backendRefs": []interface{}{map[string]interface{}{
+						"group":  "",
+						"kind":   "Service",
+						"name":   "nb-ssh",
+						"port":   int64(22),
+						"weight": int64(1),
+					}},
+				}},
+			},
+		},
+		{
+			testName: "Disabled",
+			cfg:      Config{Gateway: "kubeflow/kubeflow-gateway"},
+			err:      "routing is disabled",
+		},
+		{
+			testName: "Gateway without namespace",
+			cfg:      Config{Mode: ModeGatewayAPI, Gateway: "/kubeflow-gateway"},
+			err:      "must have the form namespace/name",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			obj, err := GenerateTCP(c.cfg, testTCPRoute())
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("Got the error %v, Expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if obj.GetAPIVersion() != c.apiVersion || obj.GetKind() != c.kind || obj.GetName() != "nb-ssh" {
+				t.Errorf("Got the object %+v", obj.Object)
+			}
+			if spec := obj.Object["spec"]; !reflect.DeepEqual(spec, c.spec) {
+				t.Errorf("Got the spec %+v, Expected %+v", spec, c.spec)
+			}
+		})
+	}
+}
+
+func TestCopyRouteFields(t *testing.T) {
+	newObject := func(labels map[string]string, prefix string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"prefix": prefix},
+		}}
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	testCases := []struct {
+		testName string
+		from     *unstructured.Unstructured
+		to       *unstructured.Unstructured
+		update   bool
+		labels   map[string]string
+	}{
+		{
+			testName: "Unchanged",
+			from:     newObject(map[string]string{"app": "nb"}, "/a/"),
+			to:       newObject(map[string]string{"app": "nb", "team": "ml"}, "/a/"),
+			update:   false,
+			labels:   map[string]string{"app": "nb", "team": "ml"},
+		},
+		{
+			testName: "Labels changed",
+			from:     newObject(map[string]string{"app": "nb"}, "/a/"),
+			to:       newObject(map[string]string{"app": "other", "team": "ml"}, "/a/"),
+			update:   true,
+			labels:   map[string]string{"app": "nb", "team": "ml"},
+		},
+		{
+			testName: "Labels added",
+			from:     newObject(map[string]string{"app": "nb"}, "/a/"),
+			to:       newObject(nil, "/a/"),
+			update:   true,
+			labels:   map[string]string{"app": "nb"},
+		},
+		{
+			testName: "Spec changed",
+			from:     newObject(nil, "/b/"),
+			to:       newObject(map[string]string{"team": "ml"}, "/a/"),
+			update:   true,
+			labels:   map[string]string{"team": "ml"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			if update := CopyRouteFields(c.from, c.to); update != c.update {
+				t.Errorf("Got %v, Expected %v", update, c.update)
+			}
+			if labels := c.to.GetLabels(); !reflect.DeepEqual(labels, c.labels) {
+				t.Errorf("Got the labels %v, Expected %v", labels, c.labels)
+			}
+			if !reflect.DeepEqual(c.to.Object["spec"], c.from.Object["spec"]) {
+				t.Errorf("Got the spec %v, Expected %v", c.to.Object["spec"], c.from.Object["spec"])
+			}
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	cfg := Config{Mode: ModeIstio, Gateway: "kubeflow/kubeflow-gateway"}
+	owner := func(uid string) metav1.OwnerReference {
+		controller := true
+		return metav1.OwnerReference{
+			APIVersion: "kubeflow.org/v1beta1",
+			Kind:       "Notebook",
+			Name:       "nb",
+			UID:        types.UID("uid-" + uid),
+			Controller: &controller,
+		}
+	}
+	generate := func(prefix string) *unstructured.Unstructured {
+		route := testRoute()
+		route.Prefix = prefix
+		obj, err := Generate(cfg, route)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		obj.SetOwnerReferences([]metav1.OwnerReference{owner("nb")})
+		return obj
+	}
+	c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
+	get := func() *unstructured.Unstructured {
+		found := cfg.Object()
+		if err := c.Get(context.TODO(), client.ObjectKey{Name: "notebook-ns-nb", Namespace: "ns"}, found); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return found
+	}
+
+	if err := Reconcile(context.TODO(), c, generate("/a/"), ctrl.Log); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found := get(); !reflect.DeepEqual(found.Object["spec"], generate("/a/").Object["spec"]) {
+		t.Errorf("Expected the route to be created, got %+v", found.Object["spec"])
+	}
+
+	// The spec of the existing route is updated
+	if err := Reconcile(context.TODO(), c, generate("/b/"), ctrl.Log); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found := get(); !reflect.DeepEqual(found.Object["spec"], generate("/b/").Object["spec"]) {
+		t.Errorf("Expected the route to be updated, got %+v", found.Object["spec"])
+	}
+
+	// A route controlled by another object is left alone
+	other := generate("/c/")
+	other.SetOwnerReferences([]metav1.OwnerReference{owner("other")})
+	err := Reconcile(context.TODO(), c, other, ctrl.Log)
+	if !errors.Is(err, ErrNotControlled) {
+		t.Fatalf("Got the error %v, Expected ErrNotControlled", err)
+	}
+	if found := get(); !reflect.DeepEqual(found.Object["spec"], generate("/b/").Object["spec"]) {
+		t.Errorf("Expected the route to be left alone, got %+v", found.Object["spec"])
+	}
+}
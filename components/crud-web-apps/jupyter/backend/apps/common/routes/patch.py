@@ -1,5 +1,3 @@
-import datetime as dt
-
 from flask import request
 from werkzeug import exceptions
 
@@ -52,16 +50,14 @@ def start_stop_notebook(namespace, notebook, request_body):
             )
 
         log.info("Stopping Notebook Server '%s/%s'", namespace, notebook)
-        now = dt.datetime.now(dt.timezone.utc)
-        timestamp = now.strftime("%Y-%m-%dT%H:%M:%SZ")
-
-        patch_body = {
-            "metadata": {"annotations": {status.STOP_ANNOTATION: timestamp}}
-        }
+        patch_body = {"spec": {"state": status.STATE_STOPPED}}
     else:
         log.info("Starting Notebook Server '%s/%s'", namespace, notebook)
+        # Also remove the deprecated stop annotation, in case the Notebook
+        # was stopped by an older client
         patch_body = {
-            "metadata": {"annotations": {status.STOP_ANNOTATION: None}}
+            "spec": {"state": status.STATE_RUNNING},
+            "metadata": {"annotations": {status.STOP_ANNOTATION: None}},
         }
 
     log.info(
@@ -75,6 +71,5 @@ def notebook_is_stopped(namespace, notebook):
         "Checking if Notebook %s/%s is already stopped", namespace, notebook,
     )
     notebook = api.get_notebook(notebook, namespace)
-    annotations = notebook.get("metadata", {}).get("annotations", {})
 
-    return status.STOP_ANNOTATION in annotations
+    return status.is_stopped(notebook)
@@ -4,6 +4,9 @@ from kubeflow.kubeflow.crud_backend import api, status
 
 EVENT_TYPE_WARNING = "Warning"
 STOP_ANNOTATION = "kubeflow-resource-stopped"
+STATE_STOPPED = "Stopped"
+STATE_RUNNING = "Running"
+CONDITION_DEGRADED = "Degraded"
 
 
 def process_status(notebook):
@@ -60,7 +63,7 @@ def process_status(notebook):
 def get_empty_status(notebook):
     creation_timestamp = notebook["metadata"]["creationTimestamp"]
     container_state = notebook["status"]["containerState"]
-    conditions = notebook["status"]["conditions"]
+    conditions = notebook["status"].get("conditions", [])
 
     # Convert a date string of a format to datetime object
     nb_creation_time = dt.datetime.strptime(
@@ -79,12 +82,21 @@ def get_empty_status(notebook):
     return None, None
 
 
+def is_stopped(notebook):
+    """
+    A Notebook is stopped if its spec.state is Stopped or if it still has the
+    deprecated stop annotation.
+    """
+    state = notebook.get("spec", {}).get("state")
+    annotations = notebook.get("metadata", {}).get("annotations", {})
+
+    return state == STATE_STOPPED or STOP_ANNOTATION in annotations
+
+
 def get_stopped_status(notebook):
     ready_replicas = notebook.get("status", {}).get("readyReplicas", 0)
-    metadata = notebook.get("metadata", {})
-    annotations = metadata.get("annotations", {})
 
-    if STOP_ANNOTATION in annotations:
+    if is_stopped(notebook):
         # If the Notebook is stopped, the status will be stopped
         if ready_replicas == 0:
             status_phase = status.STATUS_PHASE.STOPPED
@@ -149,9 +161,11 @@ def get_status_from_conditions(notebook):
 
     for condition in conditions:
         # The status will be warning with a "reason: message" showing on hover
-        if "reason" in condition:
+        if (condition.get("type") == CONDITION_DEGRADED
+                and condition.get("status") == "True"):
             status_phase = status.STATUS_PHASE.WARNING
-            status_message = condition["reason"] + ': ' + condition["message"]
+            status_message = (condition.get("reason", "") + ': '
+                              + condition.get("message", ""))
             return status_phase, status_message
 
     return None, None
@@ -115,6 +115,11 @@ def get_storage_class(vol):
 
 # Functions for transforming the data from k8s api
 def get_notebook_last_activity(notebook):
+    idleness = notebook.get("status", {}).get("idleness", {})
+    if idleness.get("lastActivity"):
+        return idleness["lastActivity"]
+
+    # Older controllers report the last activity in an annotation
     annotations = notebook["metadata"].get("annotations", {})
     return annotations.get(LAST_ACTIVITY_ANNOTATION, "")
 
@@ -71,14 +71,27 @@ const specObject = {
 };
 
 const conditionsObject: Condition[] = [
-  { lastProbeTime: '2022-08-10T07:19:14Z', type: 'Running' },
   {
-    lastProbeTime: '2022-08-10T07:17:42Z',
-    message: 'Completed',
-    reason: 'Completed',
-    type: 'Terminated',
+    lastTransitionTime: '2022-08-10T07:19:14Z',
+    message: 'Notebook is ready',
+    reason: 'PodReady',
+    status: 'True',
+    type: 'Ready',
+  },
+  {
+    lastTransitionTime: '2022-08-10T07:19:14Z',
+    message: '',
+    reason: 'Complete',
+    status: 'False',
+    type: 'Progressing',
+  },
+  {
+    lastTransitionTime: '2022-08-09T15:55:50Z',
+    message: '',
+    reason: 'AsExpected',
+    status: 'False',
+    type: 'Degraded',
   },
-  { lastProbeTime: '2022-08-09T15:55:50Z', type: 'Running' },
 ];
 
 const containerStateObject: V1ContainerState = {
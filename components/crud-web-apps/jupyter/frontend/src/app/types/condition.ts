@@ -1,6 +1,7 @@
 export interface Condition {
   type?: string;
-  lastProbeTime?: string;
+  status?: string;
+  lastTransitionTime?: string;
   reason?: string;
   message?: string;
 }
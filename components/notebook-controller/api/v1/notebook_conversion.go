@@ -24,20 +24,95 @@ import (
 // ConvertTo converts this Notebook to the Hub version (v1beta1).
 func (src *Notebook) ConvertTo(dstRaw conversion.Hub) error {
 	dst := dstRaw.(*nbv1beta1.Notebook)
-	dst.Spec.Template.Spec = src.Spec.Template.Spec
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Template = nbv1beta1.NotebookTemplateSpec{
+		Metadata: (*nbv1beta1.NotebookTemplateMetadata)(src.Spec.Template.Metadata),
+		Spec:     src.Spec.Template.Spec,
+	}
+	dst.Spec.State = nbv1beta1.NotebookState(src.Spec.State)
+	dst.Spec.UpdateStrategy = nbv1beta1.NotebookUpdateStrategy(src.Spec.UpdateStrategy)
+	dst.Spec.CloneFrom = (*nbv1beta1.NotebookCloneSource)(src.Spec.CloneFrom)
+	dst.Spec.RemoteAccess = (*nbv1beta1.NotebookRemoteAccess)(src.Spec.RemoteAccess)
+	dst.Status.RemoteAccess = (*nbv1beta1.NotebookRemoteAccessStatus)(src.Status.RemoteAccess)
+	dst.Spec.Apps = nil
+	for _, app := range src.Spec.Apps {
+		dst.Spec.Apps = append(dst.Spec.Apps, nbv1beta1.NotebookApp(app))
+	}
+	dst.Status.Apps = nil
+	for _, app := range src.Status.Apps {
+		dst.Status.Apps = append(dst.Status.Apps, nbv1beta1.NotebookAppStatus(app))
+	}
+	dst.Spec.NetworkPolicy = nil
+	if src.Spec.NetworkPolicy != nil {
+		dst.Spec.NetworkPolicy = &nbv1beta1.NotebookNetworkPolicy{}
+		for _, peer := range src.Spec.NetworkPolicy.Ingress {
+			dst.Spec.NetworkPolicy.Ingress = append(dst.Spec.NetworkPolicy.Ingress, nbv1beta1.NotebookNetworkPeer(peer))
+		}
+		for _, peer := range src.Spec.NetworkPolicy.Egress {
+			dst.Spec.NetworkPolicy.Egress = append(dst.Spec.NetworkPolicy.Egress, nbv1beta1.NotebookNetworkPeer(peer))
+		}
+	}
 	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
 	dst.Status.ContainerState = src.Status.ContainerState
-	conditions := []nbv1beta1.NotebookCondition{}
-	for _, c := range src.Status.Conditions {
-		newc := nbv1beta1.NotebookCondition{
-			Type:          c.Type,
-			LastProbeTime: c.LastProbeTime,
-			Reason:        c.Reason,
-			Message:       c.Message,
+	dst.Status.StoppedAt = src.Status.StoppedAt
+	dst.Status.StopReason = nbv1beta1.NotebookStopReason(src.Status.StopReason)
+	dst.Spec.Culling = convertCullingSettingsToHub(src.Spec.Culling)
+	dst.Spec.Workers = nil
+	if src.Spec.Workers != nil {
+		dst.Spec.Workers = &nbv1beta1.NotebookWorkersSpec{
+			Replicas: src.Spec.Workers.Replicas,
+			Template: nbv1beta1.NotebookTemplateSpec{
+				Metadata: (*nbv1beta1.NotebookTemplateMetadata)(src.Spec.Workers.Template.Metadata),
+				Spec:     src.Spec.Workers.Template.Spec,
+			},
+		}
+	}
+	dst.Spec.VolumeClaimTemplates = nil
+	for _, t := range src.Spec.VolumeClaimTemplates {
+		dst.Spec.VolumeClaimTemplates = append(dst.Spec.VolumeClaimTemplates, nbv1beta1.NotebookVolumeClaimTemplate{
+			Name:            t.Name,
+			Labels:          t.Labels,
+			Annotations:     t.Annotations,
+			Spec:            t.Spec,
+			RetentionPolicy: nbv1beta1.VolumeClaimRetentionPolicy(t.RetentionPolicy),
+		})
+	}
+	dst.Status.VolumeClaims = nil
+	for _, c := range src.Status.VolumeClaims {
+		dst.Status.VolumeClaims = append(dst.Status.VolumeClaims, nbv1beta1.NotebookVolumeClaimStatus(c))
+	}
+	dst.Status.Workers = nil
+	if src.Status.Workers != nil {
+		dst.Status.Workers = &nbv1beta1.NotebookWorkersStatus{
+			ServiceName:   src.Status.Workers.ServiceName,
+			Replicas:      src.Status.Workers.Replicas,
+			ReadyReplicas: src.Status.Workers.ReadyReplicas,
+		}
+		for _, pod := range src.Status.Workers.Pods {
+			dst.Status.Workers.Pods = append(dst.Status.Workers.Pods, nbv1beta1.NotebookReplicaStatus(pod))
+		}
+	}
+	dst.Status.Culling = nil
+	if src.Status.Culling != nil {
+		dst.Status.Culling = &nbv1beta1.NotebookCullingStatus{
+			PolicyName:        src.Status.Culling.PolicyName,
+			ScheduledStopTime: src.Status.Culling.ScheduledStopTime,
+			CullingSettings:   *convertCullingSettingsToHub(&src.Status.Culling.CullingSettings),
+		}
+	}
+	dst.Status.Idleness = nil
+	if src.Status.Idleness != nil {
+		dst.Status.Idleness = &nbv1beta1.NotebookIdlenessStatus{
+			LastActivity:  src.Status.Idleness.LastActivity,
+			LastCheckTime: src.Status.Idleness.LastCheckTime,
+			Probe:         nbv1beta1.IdlenessProbeType(src.Status.Idleness.Probe),
+			Busy:          src.Status.Idleness.Busy,
+			Kernels:       src.Status.Idleness.Kernels,
+			BusyKernels:   src.Status.Idleness.BusyKernels,
 		}
-		conditions = append(conditions, newc)
 	}
-	dst.Status.Conditions = conditions
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
 
 	return nil
 }
@@ -50,20 +125,201 @@ Most of the conversion is straightforward copying, except for converting our cha
 // ConvertFrom converts from the Hub version (v1beta1) to this version.
 func (dst *Notebook) ConvertFrom(srcRaw conversion.Hub) error {
 	src := srcRaw.(*nbv1beta1.Notebook)
-	dst.Spec.Template.Spec = src.Spec.Template.Spec
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Template = NotebookTemplateSpec{
+		Metadata: (*NotebookTemplateMetadata)(src.Spec.Template.Metadata),
+		Spec:     src.Spec.Template.Spec,
+	}
+	dst.Spec.State = NotebookState(src.Spec.State)
+	dst.Spec.UpdateStrategy = NotebookUpdateStrategy(src.Spec.UpdateStrategy)
+	dst.Spec.CloneFrom = (*NotebookCloneSource)(src.Spec.CloneFrom)
+	dst.Spec.RemoteAccess = (*NotebookRemoteAccess)(src.Spec.RemoteAccess)
+	dst.Status.RemoteAccess = (*NotebookRemoteAccessStatus)(src.Status.RemoteAccess)
+	dst.Spec.Apps = nil
+	for _, app := range src.Spec.Apps {
+		dst.Spec.Apps = append(dst.Spec.Apps, NotebookApp(app))
+	}
+	dst.Status.Apps = nil
+	for _, app := range src.Status.Apps {
+		dst.Status.Apps = append(dst.Status.Apps, NotebookAppStatus(app))
+	}
+	dst.Spec.NetworkPolicy = nil
+	if src.Spec.NetworkPolicy != nil {
+		dst.Spec.NetworkPolicy = &NotebookNetworkPolicy{}
+		for _, peer := range src.Spec.NetworkPolicy.Ingress {
+			dst.Spec.NetworkPolicy.Ingress = append(dst.Spec.NetworkPolicy.Ingress, NotebookNetworkPeer(peer))
+		}
+		for _, peer := range src.Spec.NetworkPolicy.Egress {
+			dst.Spec.NetworkPolicy.Egress = append(dst.Spec.NetworkPolicy.Egress, NotebookNetworkPeer(peer))
+		}
+	}
 	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
 	dst.Status.ContainerState = src.Status.ContainerState
-	conditions := []NotebookCondition{}
-	for _, c := range src.Status.Conditions {
-		newc := NotebookCondition{
-			Type:          c.Type,
-			LastProbeTime: c.LastProbeTime,
-			Reason:        c.Reason,
-			Message:       c.Message,
+	dst.Status.StoppedAt = src.Status.StoppedAt
+	dst.Status.StopReason = NotebookStopReason(src.Status.StopReason)
+	dst.Spec.Culling = convertCullingSettingsFromHub(src.Spec.Culling)
+	dst.Spec.Workers = nil
+	if src.Spec.Workers != nil {
+		dst.Spec.Workers = &NotebookWorkersSpec{
+			Replicas: src.Spec.Workers.Replicas,
+			Template: NotebookTemplateSpec{
+				Metadata: (*NotebookTemplateMetadata)(src.Spec.Workers.Template.Metadata),
+				Spec:     src.Spec.Workers.Template.Spec,
+			},
+		}
+	}
+	dst.Spec.VolumeClaimTemplates = nil
+	for _, t := range src.Spec.VolumeClaimTemplates {
+		dst.Spec.VolumeClaimTemplates = append(dst.Spec.VolumeClaimTemplates, NotebookVolumeClaimTemplate{
+			Name:            t.Name,
+			Labels:          t.Labels,
+			Annotations:     t.Annotations,
+			Spec:            t.Spec,
+			RetentionPolicy: VolumeClaimRetentionPolicy(t.RetentionPolicy),
+		})
+	}
+	dst.Status.VolumeClaims = nil
+	for _, c := range src.Status.VolumeClaims {
+		dst.Status.VolumeClaims = append(dst.Status.VolumeClaims, NotebookVolumeClaimStatus(c))
+	}
+	dst.Status.Workers = nil
+	if src.Status.Workers != nil {
+		dst.Status.Workers = &NotebookWorkersStatus{
+			ServiceName:   src.Status.Workers.ServiceName,
+			Replicas:      src.Status.Workers.Replicas,
+			ReadyReplicas: src.Status.Workers.ReadyReplicas,
+		}
+		for _, pod := range src.Status.Workers.Pods {
+			dst.Status.Workers.Pods = append(dst.Status.Workers.Pods, NotebookReplicaStatus(pod))
+		}
+	}
+	dst.Status.Culling = nil
+	if src.Status.Culling != nil {
+		dst.Status.Culling = &NotebookCullingStatus{
+			PolicyName:        src.Status.Culling.PolicyName,
+			ScheduledStopTime: src.Status.Culling.ScheduledStopTime,
+			CullingSettings:   *convertCullingSettingsFromHub(&src.Status.Culling.CullingSettings),
+		}
+	}
+	dst.Status.Idleness = nil
+	if src.Status.Idleness != nil {
+		dst.Status.Idleness = &NotebookIdlenessStatus{
+			LastActivity:  src.Status.Idleness.LastActivity,
+			LastCheckTime: src.Status.Idleness.LastCheckTime,
+			Probe:         IdlenessProbeType(src.Status.Idleness.Probe),
+			Busy:          src.Status.Idleness.Busy,
+			Kernels:       src.Status.Idleness.Kernels,
+			BusyKernels:   src.Status.Idleness.BusyKernels,
 		}
-		conditions = append(conditions, newc)
 	}
-	dst.Status.Conditions = conditions
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
 
 	return nil
 }
+
+func convertCullingSettingsToHub(src *CullingSettings) *nbv1beta1.CullingSettings {
+	if src == nil {
+		return nil
+	}
+	dst := &nbv1beta1.CullingSettings{
+		IdleTime:    src.IdleTime,
+		CheckPeriod: src.CheckPeriod,
+		Exempt:      src.Exempt,
+		GracePeriod: src.GracePeriod,
+	}
+	if src.Warning != nil {
+		dst.Warning = &nbv1beta1.CullingWarning{
+			NotebookPath: src.Warning.NotebookPath,
+		}
+	}
+	for _, w := range src.WorkingHours {
+		window := nbv1beta1.CullingWindow{
+			Start:    w.Start,
+			End:      w.End,
+			TimeZone: w.TimeZone,
+		}
+		for _, d := range w.Days {
+			window.Days = append(window.Days, nbv1beta1.Weekday(d))
+		}
+		dst.WorkingHours = append(dst.WorkingHours, window)
+	}
+	if src.Probe != nil {
+		dst.Probe = &nbv1beta1.IdlenessProbe{
+			Type: nbv1beta1.IdlenessProbeType(src.Probe.Type),
+		}
+		if src.Probe.HTTP != nil {
+			dst.Probe.HTTP = &nbv1beta1.HTTPIdlenessProbe{
+				Path:              src.Probe.HTTP.Path,
+				Port:              src.Probe.HTTP.Port,
+				LastActivityField: src.Probe.HTTP.LastActivityField,
+			}
+		}
+		if src.Probe.Prometheus != nil {
+			dst.Probe.Prometheus = &nbv1beta1.PrometheusIdlenessProbe{
+				Query:     src.Probe.Prometheus.Query,
+				Threshold: src.Probe.Prometheus.Threshold,
+			}
+		}
+		if src.Probe.Auth != nil {
+			dst.Probe.Auth = &nbv1beta1.IdlenessProbeAuth{
+				Type:       nbv1beta1.IdlenessProbeAuthType(src.Probe.Auth.Type),
+				SecretName: src.Probe.Auth.SecretName,
+			}
+		}
+	}
+	return dst
+}
+
+func convertCullingSettingsFromHub(src *nbv1beta1.CullingSettings) *CullingSettings {
+	if src == nil {
+		return nil
+	}
+	dst := &CullingSettings{
+		IdleTime:    src.IdleTime,
+		CheckPeriod: src.CheckPeriod,
+		Exempt:      src.Exempt,
+		GracePeriod: src.GracePeriod,
+	}
+	if src.Warning != nil {
+		dst.Warning = &CullingWarning{
+			NotebookPath: src.Warning.NotebookPath,
+		}
+	}
+	for _, w := range src.WorkingHours {
+		window := CullingWindow{
+			Start:    w.Start,
+			End:      w.End,
+			TimeZone: w.TimeZone,
+		}
+		for _, d := range w.Days {
+			window.Days = append(window.Days, Weekday(d))
+		}
+		dst.WorkingHours = append(dst.WorkingHours, window)
+	}
+	if src.Probe != nil {
+		dst.Probe = &IdlenessProbe{
+			Type: IdlenessProbeType(src.Probe.Type),
+		}
+		if src.Probe.HTTP != nil {
+			dst.Probe.HTTP = &HTTPIdlenessProbe{
+				Path:              src.Probe.HTTP.Path,
+				Port:              src.Probe.HTTP.Port,
+				LastActivityField: src.Probe.HTTP.LastActivityField,
+			}
+		}
+		if src.Probe.Prometheus != nil {
+			dst.Probe.Prometheus = &PrometheusIdlenessProbe{
+				Query:     src.Probe.Prometheus.Query,
+				Threshold: src.Probe.Prometheus.Threshold,
+			}
+		}
+		if src.Probe.Auth != nil {
+			dst.Probe.Auth = &IdlenessProbeAuth{
+				Type:       IdlenessProbeAuthType(src.Probe.Auth.Type),
+				SecretName: src.Probe.Auth.SecretName,
+			}
+		}
+	}
+	return dst
+}
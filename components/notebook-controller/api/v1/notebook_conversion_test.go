@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	nbv1beta1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func TestNotebookConversionRoundTrip(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("Fuzzing with seed %d", seed)
+	f := fuzzer.FuzzerFor(metafuzzer.Funcs, rand.NewSource(seed), serializer.NewCodecFactory(runtime.NewScheme()))
+
+	t.Run("v1 to v1beta1 and back", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			nb := &Notebook{}
+			f.Fuzz(nb)
+			nb.TypeMeta = metav1.TypeMeta{}
+
+			hub := &nbv1beta1.Notebook{}
+			if err := nb.ConvertTo(hub); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			converted := &Notebook{}
+			if err := converted.ConvertFrom(hub); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(nb, converted) {
+				t.Fatalf("Notebook changed in the round trip: %s", diff.ObjectReflectDiff(nb, converted))
+			}
+		}
+	})
+
+	t.Run("v1beta1 to v1 and back", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			hub := &nbv1beta1.Notebook{}
+			f.Fuzz(hub)
+			hub.TypeMeta = metav1.TypeMeta{}
+
+			nb := &Notebook{}
+			if err := nb.ConvertFrom(hub); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			converted := &nbv1beta1.Notebook{}
+			if err := nb.ConvertTo(converted); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(hub, converted) {
+				t.Fatalf("Notebook changed in the round trip: %s", diff.ObjectReflectDiff(hub, converted))
+			}
+		}
+	})
+}
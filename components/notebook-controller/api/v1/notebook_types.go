@@ -17,6 +17,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,41 +28,591 @@ import (
 type NotebookSpec struct {
 	// Template describes the notebooks that will be created.
 	Template NotebookTemplateSpec `json:"template,omitempty"`
+	// State is the desired state of the notebook. Setting it to Stopped
+	// scales the underlying StatefulSet down to zero replicas. An empty
+	// value is treated as Running.
+	// +optional
+	State NotebookState `json:"state,omitempty"`
+	// Culling overrides the culling settings of the CullingPolicy that
+	// matches the notebook.
+	// +optional
+	Culling *CullingSettings `json:"culling,omitempty"`
+	// Workers are Pods that run beside the notebook, e.g. the workers of a
+	// Dask or Ray cluster whose head runs in the notebook. The notebook and
+	// its workers find each other through a headless Service.
+	// +optional
+	Workers *NotebookWorkersSpec `json:"workers,omitempty"`
+	// VolumeClaimTemplates are PVCs the controller creates for the
+	// notebook. Each PVC is named <notebook>-<name>, and is added to the
+	// notebook Pod as a volume with the name of its template, which the
+	// containers can mount.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	VolumeClaimTemplates []NotebookVolumeClaimTemplate `json:"volumeClaimTemplates,omitempty"`
+	// UpdateStrategy is when changes to the pod template are applied to a
+	// running notebook, which restarts it. Defaults to Immediate.
+	// +optional
+	UpdateStrategy NotebookUpdateStrategy `json:"updateStrategy,omitempty"`
+	// CloneFrom creates the notebook as a copy of another Notebook of the
+	// namespace. The controller copies the pod template, the labels and the
+	// volume claim templates of the source into the notebook once, when it
+	// is created, and can clone the PVCs of the source.
+	// +optional
+	CloneFrom *NotebookCloneSource `json:"cloneFrom,omitempty"`
+	// NetworkPolicy isolates the notebook Pod with a NetworkPolicy. Only
+	// the ingress gateway, the notebook-controller, the workers of the
+	// notebook and the sources it lists can reach it.
+	// +optional
+	NetworkPolicy *NotebookNetworkPolicy `json:"networkPolicy,omitempty"`
+	// RemoteAccess runs an SSH server beside the notebook, e.g. to attach
+	// VS Code Remote or to rsync the workspace.
+	// +optional
+	RemoteAccess *NotebookRemoteAccess `json:"remoteAccess,omitempty"`
+	// Apps are HTTP apps that run in the notebook Pod beside the notebook
+	// server, e.g. TensorBoard or a Streamlit dashboard. The Service of the
+	// Notebook exposes each of them on its port, and they are routed under
+	// /notebook-apps/<namespace>/<name>/<app>/, outside of the prefix of the
+	// notebook server.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Apps []NotebookApp `json:"apps,omitempty"`
+}
+
+// NotebookApp is an HTTP app that runs in the notebook Pod.
+type NotebookApp struct {
+	// Name is the name of the app in its path prefix and in the name of its
+	// Service port.
+	Name string `json:"name"`
+	// Port is the port the app listens on.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// RewritePath strips the path prefix from the requests to the app, for
+	// apps that can't be served under a base path. Otherwise the app must
+	// serve its path prefix, e.g. with the --path_prefix flag of
+	// TensorBoard.
+	// +optional
+	RewritePath bool `json:"rewritePath,omitempty"`
+}
+
+// NotebookRemoteAccess describes the SSH server of a Notebook.
+type NotebookRemoteAccess struct {
+	// AuthorizedKeysSecretName is the name of a Secret of the namespace
+	// whose authorized_keys key holds the public keys allowed to log in.
+	AuthorizedKeysSecretName string `json:"authorizedKeysSecretName"`
+}
+
+// NotebookNetworkPolicy describes the traffic allowed to and from the notebook
+// Pod.
+type NotebookNetworkPolicy struct {
+	// Ingress are the other sources allowed to reach the notebook.
+	// +optional
+	Ingress []NotebookNetworkPeer `json:"ingress,omitempty"`
+	// Egress are the destinations the notebook is allowed to reach, besides
+	// DNS and its workers. If it is empty, the egress of the notebook isn't
+	// restricted.
+	// +optional
+	Egress []NotebookNetworkPeer `json:"egress,omitempty"`
+}
+
+// NotebookNetworkPeer is a block of IP addresses or a namespace. Exactly one
+// of its fields must be set.
+type NotebookNetworkPeer struct {
+	// CIDR is a block of IP addresses, e.g. 10.0.0.0/16.
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+	// Namespace is the name of a namespace, whose Pods are all allowed.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NotebookCloneSource is the Notebook a Notebook is cloned from.
+type NotebookCloneSource struct {
+	// Name is the name of the source Notebook.
+	Name string `json:"name"`
+	// CloneVolumes clones the PVCs mounted by the source notebook through
+	// CSI volume cloning, instead of mounting the PVCs of its pod template
+	// and creating empty PVCs from its volume claim templates. The notebook
+	// is started once the clones are bound. The clones of the pod template's
+	// PVCs are deleted along with the notebook.
+	// +optional
+	CloneVolumes bool `json:"cloneVolumes,omitempty"`
 }
 
+// NotebookUpdateStrategy is when changes to the pod template of a Notebook
+// are applied to its Pod.
+// +kubebuilder:validation:Enum=Immediate;OnStop;Manual
+type NotebookUpdateStrategy string
+
+const (
+	// NotebookUpdateImmediate restarts the notebook as soon as its pod
+	// template changes.
+	NotebookUpdateImmediate NotebookUpdateStrategy = "Immediate"
+	// NotebookUpdateOnStop holds the changes until the notebook is stopped,
+	// by a user, a schedule or the culler.
+	NotebookUpdateOnStop NotebookUpdateStrategy = "OnStop"
+	// NotebookUpdateManual holds the changes until a user requests them with
+	// the notebooks.kubeflow.org/apply-update annotation.
+	NotebookUpdateManual NotebookUpdateStrategy = "Manual"
+)
+
+// NotebookVolumeClaimTemplate describes a PVC created for a Notebook.
+type NotebookVolumeClaimTemplate struct {
+	// Name is the name of the volume in the notebook Pod.
+	Name string `json:"name"`
+	// Labels are added to the PVC.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the PVC.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec is the spec of the PVC. Changes to it only apply to PVCs that
+	// are created afterwards, except for larger storage requests, which
+	// expand the existing PVC.
+	Spec corev1.PersistentVolumeClaimSpec `json:"spec"`
+	// RetentionPolicy is what happens to the PVC when the notebook is
+	// deleted. Defaults to Retain.
+	// +optional
+	RetentionPolicy VolumeClaimRetentionPolicy `json:"retentionPolicy,omitempty"`
+}
+
+// VolumeClaimRetentionPolicy is what happens to the PVC of a volume claim
+// template when its Notebook is deleted.
+// +kubebuilder:validation:Enum=Retain;Delete
+type VolumeClaimRetentionPolicy string
+
+const (
+	// VolumeClaimRetain keeps the PVC, so it can be used by a new notebook.
+	VolumeClaimRetain VolumeClaimRetentionPolicy = "Retain"
+	// VolumeClaimDelete deletes the PVC along with the notebook.
+	VolumeClaimDelete VolumeClaimRetentionPolicy = "Delete"
+)
+
+// NotebookWorkersSpec describes the worker Pods of a Notebook.
+type NotebookWorkersSpec struct {
+	// Replicas is the number of workers. The workers are stopped along with
+	// the notebook.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// Template describes the workers.
+	Template NotebookTemplateSpec `json:"template"`
+}
+
+// NotebookState is the desired run state of a Notebook.
+// +kubebuilder:validation:Enum=Running;Stopped
+type NotebookState string
+
+const (
+	// NotebookStateRunning keeps the notebook Pod running.
+	NotebookStateRunning NotebookState = "Running"
+	// NotebookStateStopped stops the notebook Pod while keeping the Notebook
+	// and its volumes around.
+	NotebookStateStopped NotebookState = "Stopped"
+)
+
+// NotebookStopReason describes why a Notebook was stopped.
+type NotebookStopReason string
+
+const (
+	// NotebookStopReasonUserRequested means spec.state was set to Stopped
+	// by a user or a client acting on their behalf.
+	NotebookStopReasonUserRequested NotebookStopReason = "UserRequested"
+	// NotebookStopReasonCulled means the culler stopped an idle notebook.
+	NotebookStopReasonCulled NotebookStopReason = "Culled"
+	// NotebookStopReasonStopAnnotation means the notebook was stopped through
+	// the deprecated kubeflow-resource-stopped annotation.
+	NotebookStopReasonStopAnnotation NotebookStopReason = "StopAnnotation"
+	// NotebookStopReasonScheduled means a NotebookSchedule stopped the
+	// notebook.
+	NotebookStopReasonScheduled NotebookStopReason = "Scheduled"
+)
+
 type NotebookTemplateSpec struct {
-	Spec corev1.PodSpec `json:"spec,omitempty"`
+	// Metadata holds the labels and annotations of the Pods. They are set
+	// on top of the ones propagated from the Notebook, and aren't filtered.
+	// +optional
+	Metadata *NotebookTemplateMetadata `json:"metadata,omitempty"`
+	Spec     corev1.PodSpec            `json:"spec,omitempty"`
+}
+
+// NotebookTemplateMetadata is the metadata of the Pods of a Notebook.
+type NotebookTemplateMetadata struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // NotebookStatus defines the observed state of Notebook
 type NotebookStatus struct {
-	// Conditions is an array of current conditions
-	Conditions []NotebookCondition `json:"conditions"`
+	// Conditions are the current conditions of the notebook: Ready,
+	// Progressing, Degraded, Stopped, Culled and PendingUpdate, which are
+	// computed by the controller, and CullingScheduled, which is set by the
+	// culler.
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions" patchStrategy:"merge" patchMergeKey:"type"`
+	// ObservedGeneration is the generation of the notebook the status was
+	// computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// ReadyReplicas is the number of Pods created by the StatefulSet controller that have a Ready Condition.
 	ReadyReplicas int32 `json:"readyReplicas"`
 	// ContainerState is the state of underlying container.
 	ContainerState corev1.ContainerState `json:"containerState"`
+	// StoppedAt is the time at which the notebook was stopped. It is unset
+	// while the notebook is running.
+	// +optional
+	StoppedAt *metav1.Time `json:"stoppedAt,omitempty"`
+	// StopReason describes why the notebook was stopped.
+	// +optional
+	StopReason NotebookStopReason `json:"stopReason,omitempty"`
+	// Culling is the culling policy in effect for the notebook.
+	// +optional
+	Culling *NotebookCullingStatus `json:"culling,omitempty"`
+	// Idleness is the activity of the notebook, as last probed by the
+	// culler. It is unset while the notebook is stopped or exempt from
+	// culling.
+	// +optional
+	Idleness *NotebookIdlenessStatus `json:"idleness,omitempty"`
+	// Workers reports the workers of the notebook, if it has any.
+	// +optional
+	Workers *NotebookWorkersStatus `json:"workers,omitempty"`
+	// VolumeClaims is the state of the PVCs of the volume claim templates.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	VolumeClaims []NotebookVolumeClaimStatus `json:"volumeClaims,omitempty"`
+	// RemoteAccess reports how to connect to the SSH server of the
+	// notebook, if it has one.
+	// +optional
+	RemoteAccess *NotebookRemoteAccessStatus `json:"remoteAccess,omitempty"`
+	// Apps are the addresses of the apps of the notebook.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Apps []NotebookAppStatus `json:"apps,omitempty"`
+}
+
+// NotebookAppStatus reports the addresses of an app of a Notebook.
+type NotebookAppStatus struct {
+	// Name is the name of the app.
+	Name string `json:"name"`
+	// URL is the path of the app on the cluster gateway, e.g.
+	// /notebook-apps/ns/name/tensorboard/. It is unset if routing is
+	// disabled.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// ServiceURL is the URL of the app inside the cluster.
+	ServiceURL string `json:"serviceURL"`
+}
+
+// NotebookRemoteAccessStatus reports how to connect to the SSH server of a
+// Notebook.
+type NotebookRemoteAccessStatus struct {
+	// ServiceName is the name of the Service of the SSH server.
+	ServiceName string `json:"serviceName"`
+	// GatewayPort is the port of the cluster gateway that is routed to the
+	// SSH server. It is unset if the SSH server isn't routed through the
+	// gateway.
+	// +optional
+	GatewayPort int32 `json:"gatewayPort,omitempty"`
+	// ConnectionString is the ssh command that connects to the notebook,
+	// e.g. ssh -p 2201 jovyan@kubeflow.example.com.
+	ConnectionString string `json:"connectionString"`
+}
+
+// NotebookVolumeClaimStatus is the state of the PVC of a volume claim
+// template.
+type NotebookVolumeClaimStatus struct {
+	// Name is the name of the volume claim template.
+	Name string `json:"name"`
+	// ClaimName is the name of the PVC.
+	ClaimName string `json:"claimName"`
+	// Phase is the phase of the PVC. It is empty if the PVC doesn't exist.
+	// +optional
+	Phase corev1.PersistentVolumeClaimPhase `json:"phase,omitempty"`
+	// Capacity is the storage capacity of the bound volume.
+	// +optional
+	Capacity *resource.Quantity `json:"capacity,omitempty"`
+}
+
+// NotebookWorkersStatus reports the worker Pods of a Notebook.
+type NotebookWorkersStatus struct {
+	// ServiceName is the name of the headless Service of the notebook and
+	// its workers.
+	ServiceName string `json:"serviceName"`
+	// Replicas is the number of workers that should be running.
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of workers that are ready.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Pods is the state of each worker Pod.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Pods []NotebookReplicaStatus `json:"pods,omitempty"`
+}
+
+// NotebookReplicaStatus is the state of a worker Pod of a Notebook.
+type NotebookReplicaStatus struct {
+	// Name is the name of the Pod.
+	Name string `json:"name"`
+	// Ready is true if the Pod is ready.
+	Ready bool `json:"ready"`
+	// Phase is the phase of the Pod.
+	// +optional
+	Phase corev1.PodPhase `json:"phase,omitempty"`
+}
+
+// NotebookIdlenessStatus reports the activity of a Notebook, as observed by
+// the idleness probe of the culler.
+type NotebookIdlenessStatus struct {
+	// LastActivity is when the Notebook was last active. The Notebook is
+	// culled once it has been idle for the idle time since then.
+	// +optional
+	LastActivity *metav1.Time `json:"lastActivity,omitempty"`
+	// LastCheckTime is when the culler last probed the Notebook.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+	// Probe is the type of the idleness probe that reported the activity.
+	// +optional
+	Probe IdlenessProbeType `json:"probe,omitempty"`
+	// Busy is true if the Notebook was active when it was last probed, e.g.
+	// because one of its kernels was busy.
+	// +optional
+	Busy bool `json:"busy,omitempty"`
+	// Kernels is the number of kernels of the Notebook. It is only reported
+	// by the JupyterKernels probe.
+	// +optional
+	Kernels *int32 `json:"kernels,omitempty"`
+	// BusyKernels is the number of kernels that were busy. It is only
+	// reported by the JupyterKernels probe.
+	// +optional
+	BusyKernels *int32 `json:"busyKernels,omitempty"`
+}
+
+// NotebookCullingStatus reports the effective culling settings of a Notebook,
+// after the controller defaults, the matching CullingPolicy and the Notebook's
+// own overrides have been merged.
+type NotebookCullingStatus struct {
+	// PolicyName is the name of the CullingPolicy that matched the notebook.
+	// It is empty if no policy matched.
+	// +optional
+	PolicyName string `json:"policyName,omitempty"`
+	// ScheduledStopTime is when the culler will stop the idle Notebook, if
+	// it stays idle.
+	// +optional
+	ScheduledStopTime *metav1.Time `json:"scheduledStopTime,omitempty"`
+
+	CullingSettings `json:",inline"`
 }
 
-type NotebookCondition struct {
-	// Type is the type of the condition. Possible values are Running|Waiting|Terminated
-	Type string `json:"type"`
-	// Status is the status of the condition. Can be True, False, Unknown.
-	Status string `json:"status"`
-	// Last time we probed the condition.
+// CullingSettings holds the settings of the culler. Unset fields fall back to
+// the next level, in order: the Notebook's spec.culling, the matching
+// CullingPolicy and the controller-wide defaults.
+type CullingSettings struct {
+	// IdleTime is how long a Notebook has to be idle before it gets culled.
+	// It must be positive.
+	// +kubebuilder:validation:Pattern=`^((([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*([0-9]*[1-9][0-9]*(\.[0-9]*)?|[0-9]*\.[0-9]*[1-9][0-9]*)(ns|us|µs|ms|s|m|h)(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*)$`
+	// +optional
+	IdleTime *metav1.Duration `json:"idleTime,omitempty"`
+	// CheckPeriod is how often the culler checks the Notebook's activity.
+	// It must be positive.
+	// +kubebuilder:validation:Pattern=`^((([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*([0-9]*[1-9][0-9]*(\.[0-9]*)?|[0-9]*\.[0-9]*[1-9][0-9]*)(ns|us|µs|ms|s|m|h)(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*)$`
+	// +optional
+	CheckPeriod *metav1.Duration `json:"checkPeriod,omitempty"`
+	// Exempt disables culling.
+	// +optional
+	Exempt *bool `json:"exempt,omitempty"`
+	// WorkingHours are windows during which Notebooks are never culled.
+	// Notebooks that became idle during working hours are culled once the
+	// window is over.
 	// +optional
-	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
-	// Last time the condition transitioned from one status to another.
+	WorkingHours []CullingWindow `json:"workingHours,omitempty"`
+	// Probe is how the culler finds out when the Notebook was last active.
+	// Defaults to the JupyterKernels probe.
 	// +optional
-	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
-	// (brief) reason the container is in the current state
+	Probe *IdlenessProbe `json:"probe,omitempty"`
+	// GracePeriod is how long the culler waits between warning that an idle
+	// Notebook will be stopped and stopping it. Any activity during the
+	// grace period cancels the stop. Zero stops idle Notebooks right away.
+	// +kubebuilder:validation:Pattern=`^(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
 	// +optional
-	Reason string `json:"reason,omitempty"`
-	// Message regarding why the container is in the current state.
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+	// Warning configures where the warning is sent to, besides the Events
+	// and the CullingScheduled condition of the Notebook.
 	// +optional
-	Message string `json:"message,omitempty"`
+	Warning *CullingWarning `json:"warning,omitempty"`
 }
 
+// CullingWarning describes how users are warned about an upcoming stop
+type CullingWarning struct {
+	// NotebookPath is a path of the Notebook's Service the warning is POSTed
+	// to, e.g. an endpoint of a Jupyter server extension that shows it to
+	// the user. $(NB_PREFIX) is replaced with the URL prefix of the
+	// Notebook.
+	// +optional
+	NotebookPath string `json:"notebookPath,omitempty"`
+}
+
+// CullingWindow is a recurring window of time, e.g. weekdays from 08:00 to 18:00
+type CullingWindow struct {
+	// Days are the days of the week the window applies to. An empty list
+	// means every day.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+	// Start is the start of the window, in the 24-hour HH:MM format.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// End is the end of the window, in the 24-hour HH:MM format. A window
+	// that ends before it starts spans midnight.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+	// TimeZone is the IANA name of the time zone of the window, e.g.
+	// Europe/Berlin. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Weekday is a day of the week
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type Weekday string
+
+// IdlenessProbeType is the kind of an idleness probe
+// +kubebuilder:validation:Enum=JupyterKernels;JupyterStatus;CodeServer;HTTP;Prometheus
+type IdlenessProbeType string
+
+const (
+	// IdlenessProbeJupyterKernels reads the execution state and last activity
+	// of the kernels from the Jupyter /api/kernels endpoint.
+	IdlenessProbeJupyterKernels IdlenessProbeType = "JupyterKernels"
+	// IdlenessProbeJupyterStatus reads the last activity of the server from
+	// the Jupyter /api/status endpoint, and of the terminals from the
+	// /api/terminals endpoint.
+	IdlenessProbeJupyterStatus IdlenessProbeType = "JupyterStatus"
+	// IdlenessProbeCodeServer reads the last heartbeat of code-server, as
+	// reported by its /healthz endpoint. code-server touches its heartbeat
+	// file on activity and reports its time there, so the probe doesn't read
+	// the file from the container, which would require exec access to the
+	// Pods.
+	IdlenessProbeCodeServer IdlenessProbeType = "CodeServer"
+	// IdlenessProbeHTTP reads the last activity from a field of the JSON
+	// document served by the Notebook at a given path.
+	IdlenessProbeHTTP IdlenessProbeType = "HTTP"
+	// IdlenessProbePrometheus considers the Notebook active while the CPU
+	// usage of its Pod, as reported by Prometheus, is above a threshold.
+	IdlenessProbePrometheus IdlenessProbeType = "Prometheus"
+)
+
+// IdlenessProbe describes how the activity of a Notebook is probed
+type IdlenessProbe struct {
+	// Type of the probe.
+	// +optional
+	Type IdlenessProbeType `json:"type,omitempty"`
+	// HTTP configures the endpoint of the JupyterKernels, JupyterStatus,
+	// CodeServer and HTTP probes. It is required by the HTTP probe.
+	// +optional
+	HTTP *HTTPIdlenessProbe `json:"http,omitempty"`
+	// Prometheus configures the Prometheus probe.
+	// +optional
+	Prometheus *PrometheusIdlenessProbe `json:"prometheus,omitempty"`
+	// Auth is how the JupyterKernels, JupyterStatus, CodeServer and HTTP
+	// probes authenticate to the Notebook. Defaults to None.
+	// +optional
+	Auth *IdlenessProbeAuth `json:"auth,omitempty"`
+}
+
+// IdlenessProbeAuthType is how the culler authenticates to a Notebook
+// +kubebuilder:validation:Enum=None;Token
+type IdlenessProbeAuthType string
+
+const (
+	// IdlenessProbeAuthNone sends unauthenticated requests, which only
+	// reach Notebooks that don't require authentication for the probed
+	// endpoints.
+	IdlenessProbeAuthNone IdlenessProbeAuthType = "None"
+	// IdlenessProbeAuthToken generates a token for the Notebook, stores it
+	// in a Secret and sets it as the JUPYTER_TOKEN of the notebook
+	// container. The culler sends it in an "Authorization: token" header.
+	IdlenessProbeAuthToken IdlenessProbeAuthType = "Token"
+)
+
+// IdlenessProbeAuth describes how the culler authenticates to a Notebook
+type IdlenessProbeAuth struct {
+	// Type of the authentication.
+	// +optional
+	Type IdlenessProbeAuthType `json:"type,omitempty"`
+	// SecretName is the Secret that holds the token of the Token
+	// authentication, in its "token" key. The controller generates it if it
+	// doesn't exist. Defaults to <notebook>-culler-token.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// HTTPIdlenessProbe describes an HTTP endpoint of the Notebook's Service
+type HTTPIdlenessProbe struct {
+	// Path of the endpoint. $(NB_PREFIX) is replaced with the URL prefix of
+	// the Notebook, i.e. /notebook/<namespace>/<name>. Defaults to the
+	// endpoint of the probe's type, e.g. $(NB_PREFIX)/api/kernels.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Port of the Notebook's Service. Defaults to 80.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// LastActivityField is the top-level field of the JSON response that
+	// holds the time of the last activity, either as an RFC 3339 string or
+	// as seconds since the epoch. Only used by the HTTP probe. Defaults to
+	// last_activity.
+	// +optional
+	LastActivityField string `json:"lastActivityField,omitempty"`
+}
+
+// PrometheusIdlenessProbe describes a Prometheus query for the CPU usage of a
+// Notebook. The Prometheus server is configured in the controller.
+type PrometheusIdlenessProbe struct {
+	// Query returns the CPU usage of the Notebook, in cores. $(NAMESPACE) and
+	// $(NAME) are replaced with the namespace and the name of the Notebook.
+	// Defaults to the rate of container_cpu_usage_seconds_total of the
+	// Notebook's Pod over the last 5 minutes. The query runs with the
+	// access of the controller, so it can only be set in a CullingPolicy,
+	// and is ignored in the spec.culling of a Notebook.
+	// +optional
+	Query string `json:"query,omitempty"`
+	// Threshold is the CPU usage above which the Notebook is considered
+	// active. Defaults to 10m.
+	// +optional
+	Threshold *resource.Quantity `json:"threshold,omitempty"`
+}
+
+// The types of the conditions of a Notebook
+const (
+	// NotebookConditionReady is True when the notebook's Pod is ready
+	NotebookConditionReady = "Ready"
+	// NotebookConditionProgressing is True while the notebook is starting,
+	// stopping or being updated
+	NotebookConditionProgressing = "Progressing"
+	// NotebookConditionDegraded is True when the notebook can't run, e.g.
+	// because its image can't be pulled or its volumes are missing
+	NotebookConditionDegraded = "Degraded"
+	// NotebookConditionStopped is True when the notebook is stopped
+	NotebookConditionStopped = "Stopped"
+	// NotebookConditionCulled is True when the notebook was stopped by the
+	// culler
+	NotebookConditionCulled = "Culled"
+	// NotebookConditionCullingScheduled is set by the culler while an idle
+	// notebook is about to be stopped
+	NotebookConditionCullingScheduled = "CullingScheduled"
+	// NotebookConditionPendingUpdate is True while changes to the pod
+	// template are held by the update strategy of the notebook
+	NotebookConditionPendingUpdate = "PendingUpdate"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
@@ -16,30 +16,104 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 
 	nbv1beta1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
 )
 
+// ConversionDataAnnotation holds, as JSON, the fields of a Notebook that are
+// lost when it is converted to or from v1alpha1, so that they survive a round
+// trip. On v1alpha1 Notebooks it holds the fields v1alpha1 lacks, on v1beta1
+// and v1 Notebooks the fields only v1alpha1 has.
+const ConversionDataAnnotation = "notebooks.kubeflow.org/conversion-data"
+
+type notebookConversionData struct {
+	State                nbv1beta1.NotebookState                 `json:"state,omitempty"`
+	TemplateMetadata     *nbv1beta1.NotebookTemplateMetadata     `json:"templateMetadata,omitempty"`
+	Culling              *nbv1beta1.CullingSettings              `json:"culling,omitempty"`
+	Workers              *nbv1beta1.NotebookWorkersSpec          `json:"workers,omitempty"`
+	VolumeClaimTemplates []nbv1beta1.NotebookVolumeClaimTemplate `json:"volumeClaimTemplates,omitempty"`
+	UpdateStrategy       nbv1beta1.NotebookUpdateStrategy        `json:"updateStrategy,omitempty"`
+	CloneFrom            *nbv1beta1.NotebookCloneSource          `json:"cloneFrom,omitempty"`
+	NetworkPolicy        *nbv1beta1.NotebookNetworkPolicy        `json:"networkPolicy,omitempty"`
+	RemoteAccess         *nbv1beta1.NotebookRemoteAccess         `json:"remoteAccess,omitempty"`
+	Apps                 []nbv1beta1.NotebookApp                 `json:"apps,omitempty"`
+	StoppedAt            *metav1.Time                            `json:"stoppedAt,omitempty"`
+	StopReason           nbv1beta1.NotebookStopReason            `json:"stopReason,omitempty"`
+	CullingStatus        *nbv1beta1.NotebookCullingStatus        `json:"cullingStatus,omitempty"`
+	Idleness             *nbv1beta1.NotebookIdlenessStatus       `json:"idleness,omitempty"`
+	WorkersStatus        *nbv1beta1.NotebookWorkersStatus        `json:"workersStatus,omitempty"`
+	VolumeClaims         []nbv1beta1.NotebookVolumeClaimStatus   `json:"volumeClaims,omitempty"`
+	RemoteAccessStatus   *nbv1beta1.NotebookRemoteAccessStatus   `json:"remoteAccessStatus,omitempty"`
+	AppsStatus           []nbv1beta1.NotebookAppStatus           `json:"appsStatus,omitempty"`
+	ObservedGeneration   int64                                   `json:"observedGeneration,omitempty"`
+	// ConditionGenerations are the observedGenerations of the conditions,
+	// by type
+	ConditionGenerations map[string]int64 `json:"conditionGenerations,omitempty"`
+	// ConditionProbeTimes are the lastProbeTimes of the v1alpha1
+	// conditions, by type
+	ConditionProbeTimes map[string]metav1.Time `json:"conditionProbeTimes,omitempty"`
+}
+
 // ConvertTo converts this Notebook to the Hub version (v1beta1).
 func (src *Notebook) ConvertTo(dstRaw conversion.Hub) error {
 	dst := dstRaw.(*nbv1beta1.Notebook)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	data, err := popConversionData(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
 	dst.Spec.Template.Spec = src.Spec.Template.Spec
+	dst.Spec.Template.Metadata = data.TemplateMetadata
+	dst.Spec.State = data.State
+	dst.Spec.Culling = data.Culling
+	dst.Spec.Workers = data.Workers
+	dst.Spec.VolumeClaimTemplates = data.VolumeClaimTemplates
+	dst.Spec.UpdateStrategy = data.UpdateStrategy
+	dst.Spec.CloneFrom = data.CloneFrom
+	dst.Spec.NetworkPolicy = data.NetworkPolicy
+	dst.Spec.RemoteAccess = data.RemoteAccess
+	dst.Spec.Apps = data.Apps
 	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
 	dst.Status.ContainerState = src.Status.ContainerState
-	conditions := []nbv1beta1.NotebookCondition{}
+	dst.Status.StoppedAt = data.StoppedAt
+	dst.Status.StopReason = data.StopReason
+	dst.Status.Culling = data.CullingStatus
+	dst.Status.Idleness = data.Idleness
+	dst.Status.Workers = data.WorkersStatus
+	dst.Status.VolumeClaims = data.VolumeClaims
+	dst.Status.RemoteAccess = data.RemoteAccessStatus
+	dst.Status.Apps = data.AppsStatus
+	dst.Status.ObservedGeneration = data.ObservedGeneration
+	dst.Status.Conditions = []metav1.Condition{}
 	for _, c := range src.Status.Conditions {
-		newc := nbv1beta1.NotebookCondition{
-			Type:          c.Type,
-			LastProbeTime: c.LastProbeTime,
-			Reason:        c.Reason,
-			Message:       c.Message,
+		newc := metav1.Condition{
+			Type:               c.Type,
+			Status:             metav1.ConditionStatus(c.Status),
+			ObservedGeneration: data.ConditionGenerations[c.Type],
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
 		}
-		conditions = append(conditions, newc)
+		dst.Status.Conditions = append(dst.Status.Conditions, newc)
 	}
-	dst.Status.Conditions = conditions
 
-	return nil
+	// Keep the fields the Hub lacks
+	lost := notebookConversionData{}
+	for _, c := range src.Status.Conditions {
+		if !c.LastProbeTime.IsZero() {
+			if lost.ConditionProbeTimes == nil {
+				lost.ConditionProbeTimes = map[string]metav1.Time{}
+			}
+			lost.ConditionProbeTimes[c.Type] = c.LastProbeTime
+		}
+	}
+	return setConversionData(&dst.ObjectMeta, lost)
 }
 
 /*
@@ -50,20 +124,92 @@ Most of the conversion is straightforward copying, except for converting our cha
 // ConvertFrom converts from the Hub version (v1beta1) to this version.
 func (dst *Notebook) ConvertFrom(srcRaw conversion.Hub) error {
 	src := srcRaw.(*nbv1beta1.Notebook)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	data, err := popConversionData(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
 	dst.Spec.Template.Spec = src.Spec.Template.Spec
 	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
 	dst.Status.ContainerState = src.Status.ContainerState
-	conditions := []NotebookCondition{}
+	dst.Status.Conditions = []NotebookCondition{}
 	for _, c := range src.Status.Conditions {
 		newc := NotebookCondition{
-			Type:          c.Type,
-			LastProbeTime: c.LastProbeTime,
-			Reason:        c.Reason,
-			Message:       c.Message,
+			Type:               c.Type,
+			Status:             string(c.Status),
+			LastProbeTime:      data.ConditionProbeTimes[c.Type],
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
+		}
+		dst.Status.Conditions = append(dst.Status.Conditions, newc)
+	}
+
+	// Keep the fields this version lacks
+	lost := notebookConversionData{
+		State:                src.Spec.State,
+		TemplateMetadata:     src.Spec.Template.Metadata,
+		Culling:              src.Spec.Culling,
+		Workers:              src.Spec.Workers,
+		VolumeClaimTemplates: src.Spec.VolumeClaimTemplates,
+		UpdateStrategy:       src.Spec.UpdateStrategy,
+		CloneFrom:            src.Spec.CloneFrom,
+		NetworkPolicy:        src.Spec.NetworkPolicy,
+		RemoteAccess:         src.Spec.RemoteAccess,
+		Apps:                 src.Spec.Apps,
+		StoppedAt:            src.Status.StoppedAt,
+		StopReason:           src.Status.StopReason,
+		CullingStatus:        src.Status.Culling,
+		Idleness:             src.Status.Idleness,
+		WorkersStatus:        src.Status.Workers,
+		VolumeClaims:         src.Status.VolumeClaims,
+		RemoteAccessStatus:   src.Status.RemoteAccess,
+		AppsStatus:           src.Status.Apps,
+		ObservedGeneration:   src.Status.ObservedGeneration,
+	}
+	for _, c := range src.Status.Conditions {
+		if c.ObservedGeneration != 0 {
+			if lost.ConditionGenerations == nil {
+				lost.ConditionGenerations = map[string]int64{}
+			}
+			lost.ConditionGenerations[c.Type] = c.ObservedGeneration
 		}
-		conditions = append(conditions, newc)
 	}
-	dst.Status.Conditions = conditions
+	return setConversionData(&dst.ObjectMeta, lost)
+}
 
+// popConversionData removes the ConversionDataAnnotation and returns the
+// fields it holds
+func popConversionData(meta *metav1.ObjectMeta) (notebookConversionData, error) {
+	data := notebookConversionData{}
+	value, ok := meta.Annotations[ConversionDataAnnotation]
+	if !ok {
+		return data, nil
+	}
+	delete(meta.Annotations, ConversionDataAnnotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return data, fmt.Errorf("invalid %s annotation: %v", ConversionDataAnnotation, err)
+	}
+	return data, nil
+}
+
+// setConversionData stores the fields in the ConversionDataAnnotation, unless
+// there is nothing to keep
+func setConversionData(meta *metav1.ObjectMeta, data notebookConversionData) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if string(value) == "{}" {
+		return nil
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[ConversionDataAnnotation] = string(value)
 	return nil
 }
@@ -0,0 +1,244 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CullingPolicySpec defines the culling settings of the Notebooks in a namespace
+type CullingPolicySpec struct {
+	// Selector restricts the policy to the Notebooks with matching labels.
+	// An empty selector matches every Notebook in the namespace.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Priority decides which policy is used when more than one policy
+	// matches a Notebook. The policy with the highest priority wins, ties
+	// are broken by name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// WebhookURL receives a POST with the warning of every Notebook the
+	// policy is about to cull. It can only be set in a CullingPolicy, since
+	// policies are managed by administrators.
+	// +optional
+	WebhookURL string `json:"webhookURL,omitempty"`
+
+	CullingSettings `json:",inline"`
+}
+
+// CullingSettings holds the settings of the culler. Unset fields fall back to
+// the next level, in order: the Notebook's spec.culling, the matching
+// CullingPolicy and the controller-wide defaults.
+type CullingSettings struct {
+	// IdleTime is how long a Notebook has to be idle before it gets culled.
+	// It must be positive.
+	// +kubebuilder:validation:Pattern=`^((([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*([0-9]*[1-9][0-9]*(\.[0-9]*)?|[0-9]*\.[0-9]*[1-9][0-9]*)(ns|us|µs|ms|s|m|h)(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*)$`
+	// +optional
+	IdleTime *metav1.Duration `json:"idleTime,omitempty"`
+	// CheckPeriod is how often the culler checks the Notebook's activity.
+	// It must be positive.
+	// +kubebuilder:validation:Pattern=`^((([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*([0-9]*[1-9][0-9]*(\.[0-9]*)?|[0-9]*\.[0-9]*[1-9][0-9]*)(ns|us|µs|ms|s|m|h)(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*)$`
+	// +optional
+	CheckPeriod *metav1.Duration `json:"checkPeriod,omitempty"`
+	// Exempt disables culling.
+	// +optional
+	Exempt *bool `json:"exempt,omitempty"`
+	// WorkingHours are windows during which Notebooks are never culled.
+	// Notebooks that became idle during working hours are culled once the
+	// window is over.
+	// +optional
+	WorkingHours []CullingWindow `json:"workingHours,omitempty"`
+	// Probe is how the culler finds out when the Notebook was last active.
+	// Defaults to the JupyterKernels probe.
+	// +optional
+	Probe *IdlenessProbe `json:"probe,omitempty"`
+	// GracePeriod is how long the culler waits between warning that an idle
+	// Notebook will be stopped and stopping it. Any activity during the
+	// grace period cancels the stop. Zero stops idle Notebooks right away.
+	// +kubebuilder:validation:Pattern=`^(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+	// Warning configures where the warning is sent to, besides the Events
+	// and the CullingScheduled condition of the Notebook.
+	// +optional
+	Warning *CullingWarning `json:"warning,omitempty"`
+}
+
+// CullingWarning describes how users are warned about an upcoming stop
+type CullingWarning struct {
+	// NotebookPath is a path of the Notebook's Service the warning is POSTed
+	// to, e.g. an endpoint of a Jupyter server extension that shows it to
+	// the user. $(NB_PREFIX) is replaced with the URL prefix of the
+	// Notebook.
+	// +optional
+	NotebookPath string `json:"notebookPath,omitempty"`
+}
+
+// CullingWindow is a recurring window of time, e.g. weekdays from 08:00 to 18:00
+type CullingWindow struct {
+	// Days are the days of the week the window applies to. An empty list
+	// means every day.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+	// Start is the start of the window, in the 24-hour HH:MM format.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// End is the end of the window, in the 24-hour HH:MM format. A window
+	// that ends before it starts spans midnight.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+	// TimeZone is the IANA name of the time zone of the window, e.g.
+	// Europe/Berlin. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Weekday is a day of the week
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type Weekday string
+
+// IdlenessProbeType is the kind of an idleness probe
+// +kubebuilder:validation:Enum=JupyterKernels;JupyterStatus;CodeServer;HTTP;Prometheus
+type IdlenessProbeType string
+
+const (
+	// IdlenessProbeJupyterKernels reads the execution state and last activity
+	// of the kernels from the Jupyter /api/kernels endpoint.
+	IdlenessProbeJupyterKernels IdlenessProbeType = "JupyterKernels"
+	// IdlenessProbeJupyterStatus reads the last activity of the server from
+	// the Jupyter /api/status endpoint, and of the terminals from the
+	// /api/terminals endpoint.
+	IdlenessProbeJupyterStatus IdlenessProbeType = "JupyterStatus"
+	// IdlenessProbeCodeServer reads the last heartbeat of code-server, as
+	// reported by its /healthz endpoint. code-server touches its heartbeat
+	// file on activity and reports its time there, so the probe doesn't read
+	// the file from the container, which would require exec access to the
+	// Pods.
+	IdlenessProbeCodeServer IdlenessProbeType = "CodeServer"
+	// IdlenessProbeHTTP reads the last activity from a field of the JSON
+	// document served by the Notebook at a given path.
+	IdlenessProbeHTTP IdlenessProbeType = "HTTP"
+	// IdlenessProbePrometheus considers the Notebook active while the CPU
+	// usage of its Pod, as reported by Prometheus, is above a threshold.
+	IdlenessProbePrometheus IdlenessProbeType = "Prometheus"
+)
+
+// IdlenessProbe describes how the activity of a Notebook is probed
+type IdlenessProbe struct {
+	// Type of the probe.
+	// +optional
+	Type IdlenessProbeType `json:"type,omitempty"`
+	// HTTP configures the endpoint of the JupyterKernels, JupyterStatus,
+	// CodeServer and HTTP probes. It is required by the HTTP probe.
+	// +optional
+	HTTP *HTTPIdlenessProbe `json:"http,omitempty"`
+	// Prometheus configures the Prometheus probe.
+	// +optional
+	Prometheus *PrometheusIdlenessProbe `json:"prometheus,omitempty"`
+	// Auth is how the JupyterKernels, JupyterStatus, CodeServer and HTTP
+	// probes authenticate to the Notebook. Defaults to None.
+	// +optional
+	Auth *IdlenessProbeAuth `json:"auth,omitempty"`
+}
+
+// IdlenessProbeAuthType is how the culler authenticates to a Notebook
+// +kubebuilder:validation:Enum=None;Token
+type IdlenessProbeAuthType string
+
+const (
+	// IdlenessProbeAuthNone sends unauthenticated requests, which only
+	// reach Notebooks that don't require authentication for the probed
+	// endpoints.
+	IdlenessProbeAuthNone IdlenessProbeAuthType = "None"
+	// IdlenessProbeAuthToken generates a token for the Notebook, stores it
+	// in a Secret and sets it as the JUPYTER_TOKEN of the notebook
+	// container. The culler sends it in an "Authorization: token" header.
+	IdlenessProbeAuthToken IdlenessProbeAuthType = "Token"
+)
+
+// IdlenessProbeAuth describes how the culler authenticates to a Notebook
+type IdlenessProbeAuth struct {
+	// Type of the authentication.
+	// +optional
+	Type IdlenessProbeAuthType `json:"type,omitempty"`
+	// SecretName is the Secret that holds the token of the Token
+	// authentication, in its "token" key. The controller generates it if it
+	// doesn't exist. Defaults to <notebook>-culler-token.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// HTTPIdlenessProbe describes an HTTP endpoint of the Notebook's Service
+type HTTPIdlenessProbe struct {
+	// Path of the endpoint. $(NB_PREFIX) is replaced with the URL prefix of
+	// the Notebook, i.e. /notebook/<namespace>/<name>. Defaults to the
+	// endpoint of the probe's type, e.g. $(NB_PREFIX)/api/kernels.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Port of the Notebook's Service. Defaults to 80.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// LastActivityField is the top-level field of the JSON response that
+	// holds the time of the last activity, either as an RFC 3339 string or
+	// as seconds since the epoch. Only used by the HTTP probe. Defaults to
+	// last_activity.
+	// +optional
+	LastActivityField string `json:"lastActivityField,omitempty"`
+}
+
+// PrometheusIdlenessProbe describes a Prometheus query for the CPU usage of a
+// Notebook. The Prometheus server is configured in the controller.
+type PrometheusIdlenessProbe struct {
+	// Query returns the CPU usage of the Notebook, in cores. $(NAMESPACE) and
+	// $(NAME) are replaced with the namespace and the name of the Notebook.
+	// Defaults to the rate of container_cpu_usage_seconds_total of the
+	// Notebook's Pod over the last 5 minutes. The query runs with the
+	// access of the controller, so it can only be set in a CullingPolicy,
+	// and is ignored in the spec.culling of a Notebook.
+	// +optional
+	Query string `json:"query,omitempty"`
+	// Threshold is the CPU usage above which the Notebook is considered
+	// active. Defaults to 10m.
+	// +optional
+	Threshold *resource.Quantity `json:"threshold,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=cullingpolicies,singular=cullingpolicy,scope=Namespaced
+
+// CullingPolicy is the Schema for the cullingpolicies API
+type CullingPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CullingPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CullingPolicyList contains a list of CullingPolicy
+type CullingPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CullingPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CullingPolicy{}, &CullingPolicyList{})
+}
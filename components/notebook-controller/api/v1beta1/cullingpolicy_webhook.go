@@ -0,0 +1,82 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (r *CullingPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-kubeflow-org-v1beta1-cullingpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubeflow.org,resources=cullingpolicies,verbs=create;update,versions=v1beta1,name=vcullingpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &CullingPolicy{}
+
+// validateCullingSettings checks the durations of the culling settings, which
+// the CRDs check too, since the culler can't work with non-positive ones
+func validateCullingSettings(fldPath *field.Path, s *CullingSettings) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if s == nil {
+		return allErrs
+	}
+	if s.IdleTime != nil && s.IdleTime.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("idleTime"), s.IdleTime.Duration.String(),
+			"must be greater than 0"))
+	}
+	if s.CheckPeriod != nil && s.CheckPeriod.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("checkPeriod"), s.CheckPeriod.Duration.String(),
+			"must be greater than 0"))
+	}
+	if s.GracePeriod != nil && s.GracePeriod.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("gracePeriod"), s.GracePeriod.Duration.String(),
+			"must not be negative"))
+	}
+	return allErrs
+}
+
+func (r *CullingPolicy) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("CullingPolicy").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *CullingPolicy) ValidateCreate() error {
+	notebooklog.Info("validate create", "cullingpolicy", r.Name)
+
+	return r.invalid(validateCullingSettings(field.NewPath("spec"), &r.Spec.CullingSettings))
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *CullingPolicy) ValidateUpdate(old runtime.Object) error {
+	notebooklog.Info("validate update", "cullingpolicy", r.Name)
+
+	return r.invalid(validateCullingSettings(field.NewPath("spec"), &r.Spec.CullingSettings))
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *CullingPolicy) ValidateDelete() error {
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	fuzz "github.com/google/gofuzz"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	nbv1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1"
+	nbv1alpha1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1alpha1"
+	nbv1beta1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+// notebookVersion converts Notebooks of one version to and from the Hub
+type notebookVersion struct {
+	name    string
+	new     func() client.Object
+	fromHub func(hub *nbv1beta1.Notebook) client.Object
+	toHub   func(obj client.Object) *nbv1beta1.Notebook
+}
+
+var notebookVersions = []notebookVersion{
+	{
+		name: "v1alpha1",
+		new:  func() client.Object { return &nbv1alpha1.Notebook{} },
+		fromHub: func(hub *nbv1beta1.Notebook) client.Object {
+			nb := &nbv1alpha1.Notebook{}
+			Expect(nb.ConvertFrom(hub)).To(Succeed())
+			return nb
+		},
+		toHub: func(obj client.Object) *nbv1beta1.Notebook {
+			hub := &nbv1beta1.Notebook{}
+			Expect(obj.(*nbv1alpha1.Notebook).ConvertTo(hub)).To(Succeed())
+			return hub
+		},
+	},
+	{
+		name: "v1beta1",
+		new:  func() client.Object { return &nbv1beta1.Notebook{} },
+		fromHub: func(hub *nbv1beta1.Notebook) client.Object {
+			return hub.DeepCopy()
+		},
+		toHub: func(obj client.Object) *nbv1beta1.Notebook {
+			return obj.(*nbv1beta1.Notebook).DeepCopy()
+		},
+	},
+	{
+		name: "v1",
+		new:  func() client.Object { return &nbv1.Notebook{} },
+		fromHub: func(hub *nbv1beta1.Notebook) client.Object {
+			nb := &nbv1.Notebook{}
+			Expect(nb.ConvertFrom(hub)).To(Succeed())
+			return nb
+		},
+		toHub: func(obj client.Object) *nbv1beta1.Notebook {
+			hub := &nbv1beta1.Notebook{}
+			Expect(obj.(*nbv1.Notebook).ConvertTo(hub)).To(Succeed())
+			return hub
+		},
+	},
+}
+
+// notebookFuzzerFuncs fuzz only valid Notebooks, that the API server accepts
+func notebookFuzzerFuncs(_ runtimeserializer.CodecFactory) []interface{} {
+	return []interface{}{
+		func(m *metav1.ObjectMeta, c fuzz.Continue) {
+			m.Name = fmt.Sprintf("nb-%d", c.Uint32())
+			m.Namespace = "default"
+			if c.RandBool() {
+				m.Annotations = map[string]string{"notebooks.kubeflow.org/test": c.RandString()}
+			}
+		},
+		func(s *corev1.PodSpec, c fuzz.Continue) {
+			s.Containers = []corev1.Container{
+				{Name: "notebook", Image: fmt.Sprintf("jupyter:%d", c.Uint32())},
+			}
+		},
+		func(s *nbv1beta1.NotebookStatus, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			// Conditions are required
+			if s.Conditions == nil {
+				s.Conditions = []metav1.Condition{}
+			}
+		},
+		func(s *nbv1beta1.NotebookState, c fuzz.Continue) {
+			*s = []nbv1beta1.NotebookState{"", nbv1beta1.NotebookStateRunning, nbv1beta1.NotebookStateStopped}[c.Intn(3)]
+		},
+		func(w *nbv1beta1.CullingWindow, c fuzz.Continue) {
+			w.Days = []nbv1beta1.Weekday{[]nbv1beta1.Weekday{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}[c.Intn(7)]}
+			w.Start = fmt.Sprintf("%02d:%02d", c.Intn(24), c.Intn(60))
+			w.End = fmt.Sprintf("%02d:%02d", c.Intn(24), c.Intn(60))
+			w.TimeZone = []string{"", "UTC", "Europe/Berlin"}[c.Intn(3)]
+		},
+		func(t *nbv1beta1.IdlenessProbeType, c fuzz.Continue) {
+			*t = []nbv1beta1.IdlenessProbeType{
+				nbv1beta1.IdlenessProbeJupyterKernels,
+				nbv1beta1.IdlenessProbeJupyterStatus,
+				nbv1beta1.IdlenessProbeCodeServer,
+				nbv1beta1.IdlenessProbeHTTP,
+				nbv1beta1.IdlenessProbePrometheus,
+			}[c.Intn(5)]
+		},
+		func(t *nbv1beta1.IdlenessProbeAuthType, c fuzz.Continue) {
+			*t = []nbv1beta1.IdlenessProbeAuthType{
+				nbv1beta1.IdlenessProbeAuthNone,
+				nbv1beta1.IdlenessProbeAuthToken,
+			}[c.Intn(2)]
+		},
+		func(p *nbv1beta1.HTTPIdlenessProbe, c fuzz.Continue) {
+			c.FuzzNoCustom(p)
+			p.Port = 1 + c.Int31n(65535)
+		},
+		func(cond *metav1.Condition, c fuzz.Continue) {
+			cond.Type = []string{
+				nbv1beta1.NotebookConditionReady,
+				nbv1beta1.NotebookConditionDegraded,
+				nbv1beta1.NotebookConditionCullingScheduled,
+			}[c.Intn(3)]
+			cond.Status = []metav1.ConditionStatus{metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionUnknown}[c.Intn(3)]
+			cond.ObservedGeneration = c.Int63n(100)
+			c.Fuzz(&cond.LastTransitionTime)
+			cond.Reason = fmt.Sprintf("Reason%d", c.Uint32())
+			cond.Message = c.RandString()
+		},
+	}
+}
+
+var _ = Describe("Notebook conversion webhook", func() {
+	f := fuzzer.FuzzerFor(
+		fuzzer.MergeFuzzerFuncs(metafuzzer.Funcs, notebookFuzzerFuncs),
+		rand.NewSource(GinkgoRandomSeed()),
+		runtimeserializer.NewCodecFactory(runtime.NewScheme()))
+
+	for _, version := range notebookVersions {
+		version := version
+		It(fmt.Sprintf("Should serve consistent Notebooks written in %s", version.name), func() {
+			for i := 0; i < 20; i++ {
+				hub := &nbv1beta1.Notebook{}
+				f.Fuzz(hub)
+				hub.TypeMeta = metav1.TypeMeta{}
+				// Pass the validation and defaulting of the admission
+				// webhooks, which would change the Notebook
+				hub.Spec.Template.Spec.Containers[0].Name = hub.Name
+				Expect((&nbv1beta1.NotebookDefaulter{AddFSGroup: true}).Default(context.TODO(), hub)).To(Succeed())
+				written := version.fromHub(hub)
+				if nb, ok := written.(*nbv1alpha1.Notebook); ok {
+					// Fields only v1alpha1 has
+					for i := range nb.Status.Conditions {
+						f.Fuzz(&nb.Status.Conditions[i].LastProbeTime)
+					}
+				}
+
+				By(fmt.Sprintf("Creating Notebook %s in %s", written.GetName(), version.name))
+				// The status is dropped on create, so it has to be updated
+				// separately
+				obj := written.DeepCopyObject().(client.Object)
+				Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+				status := written.DeepCopyObject().(client.Object)
+				status.SetResourceVersion(obj.GetResourceVersion())
+				Expect(k8sClient.Status().Update(ctx, status)).To(Succeed())
+
+				expected := version.toHub(written)
+				key := client.ObjectKeyFromObject(written)
+				for _, other := range notebookVersions {
+					By(fmt.Sprintf("Reading Notebook %s in %s", key.Name, other.name))
+					found := other.new()
+					Expect(k8sClient.Get(ctx, key, found)).To(Succeed())
+					if other.name == version.name {
+						Expect(apiequality.Semantic.DeepEqual(found.GetAnnotations(), written.GetAnnotations())).To(BeTrue(),
+							diff.ObjectReflectDiff(written.GetAnnotations(), found.GetAnnotations()))
+					}
+
+					hub := other.toHub(found)
+					Expect(apiequality.Semantic.DeepEqual(hub.Annotations, expected.Annotations)).To(BeTrue(),
+						diff.ObjectReflectDiff(expected.Annotations, hub.Annotations))
+					Expect(apiequality.Semantic.DeepEqual(hub.Spec, expected.Spec)).To(BeTrue(),
+						diff.ObjectReflectDiff(expected.Spec, hub.Spec))
+					Expect(apiequality.Semantic.DeepEqual(hub.Status, expected.Status)).To(BeTrue(),
+						diff.ObjectReflectDiff(expected.Status, hub.Status))
+				}
+
+				Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+			}
+		})
+	}
+})
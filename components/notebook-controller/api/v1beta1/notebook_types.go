@@ -17,6 +17,7 @@ package v1beta1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,41 +28,412 @@ import (
 type NotebookSpec struct {
 	// Template describes the notebooks that will be created.
 	Template NotebookTemplateSpec `json:"template,omitempty"`
+	// State is the desired state of the notebook. Setting it to Stopped
+	// scales the underlying StatefulSet down to zero replicas. An empty
+	// value is treated as Running.
+	// +optional
+	State NotebookState `json:"state,omitempty"`
+	// Culling overrides the culling settings of the CullingPolicy that
+	// matches the notebook.
+	// +optional
+	Culling *CullingSettings `json:"culling,omitempty"`
+	// Workers are Pods that run beside the notebook, e.g. the workers of a
+	// Dask or Ray cluster whose head runs in the notebook. The notebook and
+	// its workers find each other through a headless Service.
+	// +optional
+	Workers *NotebookWorkersSpec `json:"workers,omitempty"`
+	// VolumeClaimTemplates are PVCs the controller creates for the
+	// notebook. Each PVC is named <notebook>-<name>, and is added to the
+	// notebook Pod as a volume with the name of its template, which the
+	// containers can mount.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	VolumeClaimTemplates []NotebookVolumeClaimTemplate `json:"volumeClaimTemplates,omitempty"`
+	// UpdateStrategy is when changes to the pod template are applied to a
+	// running notebook, which restarts it. Defaults to Immediate.
+	// +optional
+	UpdateStrategy NotebookUpdateStrategy `json:"updateStrategy,omitempty"`
+	// CloneFrom creates the notebook as a copy of another Notebook of the
+	// namespace. The controller copies the pod template, the labels and the
+	// volume claim templates of the source into the notebook once, when it
+	// is created, and can clone the PVCs of the source.
+	// +optional
+	CloneFrom *NotebookCloneSource `json:"cloneFrom,omitempty"`
+	// NetworkPolicy isolates the notebook Pod with a NetworkPolicy. Only
+	// the ingress gateway, the notebook-controller, the workers of the
+	// notebook and the sources it lists can reach it.
+	// +optional
+	NetworkPolicy *NotebookNetworkPolicy `json:"networkPolicy,omitempty"`
+	// RemoteAccess runs an SSH server beside the notebook, e.g. to attach
+	// VS Code Remote or to rsync the workspace.
+	// +optional
+	RemoteAccess *NotebookRemoteAccess `json:"remoteAccess,omitempty"`
+	// Apps are HTTP apps that run in the notebook Pod beside the notebook
+	// server, e.g. TensorBoard or a Streamlit dashboard. The Service of the
+	// Notebook exposes each of them on its port, and they are routed under
+	// /notebook-apps/<namespace>/<name>/<app>/, outside of the prefix of the
+	// notebook server.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Apps []NotebookApp `json:"apps,omitempty"`
+}
+
+// NotebookApp is an HTTP app that runs in the notebook Pod.
+type NotebookApp struct {
+	// Name is the name of the app in its path prefix and in the name of its
+	// Service port.
+	Name string `json:"name"`
+	// Port is the port the app listens on.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// RewritePath strips the path prefix from the requests to the app, for
+	// apps that can't be served under a base path. Otherwise the app must
+	// serve its path prefix, e.g. with the --path_prefix flag of
+	// TensorBoard.
+	// +optional
+	RewritePath bool `json:"rewritePath,omitempty"`
+}
+
+// NotebookRemoteAccess describes the SSH server of a Notebook.
+type NotebookRemoteAccess struct {
+	// AuthorizedKeysSecretName is the name of a Secret of the namespace
+	// whose authorized_keys key holds the public keys allowed to log in.
+	AuthorizedKeysSecretName string `json:"authorizedKeysSecretName"`
+}
+
+// NotebookNetworkPolicy describes the traffic allowed to and from the notebook
+// Pod.
+type NotebookNetworkPolicy struct {
+	// Ingress are the other sources allowed to reach the notebook.
+	// +optional
+	Ingress []NotebookNetworkPeer `json:"ingress,omitempty"`
+	// Egress are the destinations the notebook is allowed to reach, besides
+	// DNS and its workers. If it is empty, the egress of the notebook isn't
+	// restricted.
+	// +optional
+	Egress []NotebookNetworkPeer `json:"egress,omitempty"`
+}
+
+// NotebookNetworkPeer is a block of IP addresses or a namespace. Exactly one
+// of its fields must be set.
+type NotebookNetworkPeer struct {
+	// CIDR is a block of IP addresses, e.g. 10.0.0.0/16.
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+	// Namespace is the name of a namespace, whose Pods are all allowed.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NotebookCloneSource is the Notebook a Notebook is cloned from.
+type NotebookCloneSource struct {
+	// Name is the name of the source Notebook.
+	Name string `json:"name"`
+	// CloneVolumes clones the PVCs mounted by the source notebook through
+	// CSI volume cloning, instead of mounting the PVCs of its pod template
+	// and creating empty PVCs from its volume claim templates. The notebook
+	// is started once the clones are bound. The clones of the pod template's
+	// PVCs are deleted along with the notebook.
+	// +optional
+	CloneVolumes bool `json:"cloneVolumes,omitempty"`
 }
 
+// NotebookUpdateStrategy is when changes to the pod template of a Notebook
+// are applied to its Pod.
+// +kubebuilder:validation:Enum=Immediate;OnStop;Manual
+type NotebookUpdateStrategy string
+
+const (
+	// NotebookUpdateImmediate restarts the notebook as soon as its pod
+	// template changes.
+	NotebookUpdateImmediate NotebookUpdateStrategy = "Immediate"
+	// NotebookUpdateOnStop holds the changes until the notebook is stopped,
+	// by a user, a schedule or the culler.
+	NotebookUpdateOnStop NotebookUpdateStrategy = "OnStop"
+	// NotebookUpdateManual holds the changes until a user requests them with
+	// the notebooks.kubeflow.org/apply-update annotation.
+	NotebookUpdateManual NotebookUpdateStrategy = "Manual"
+)
+
+// NotebookVolumeClaimTemplate describes a PVC created for a Notebook.
+type NotebookVolumeClaimTemplate struct {
+	// Name is the name of the volume in the notebook Pod.
+	Name string `json:"name"`
+	// Labels are added to the PVC.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the PVC.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec is the spec of the PVC. Changes to it only apply to PVCs that
+	// are created afterwards, except for larger storage requests, which
+	// expand the existing PVC.
+	Spec corev1.PersistentVolumeClaimSpec `json:"spec"`
+	// RetentionPolicy is what happens to the PVC when the notebook is
+	// deleted. Defaults to Retain.
+	// +optional
+	RetentionPolicy VolumeClaimRetentionPolicy `json:"retentionPolicy,omitempty"`
+}
+
+// VolumeClaimRetentionPolicy is what happens to the PVC of a volume claim
+// template when its Notebook is deleted.
+// +kubebuilder:validation:Enum=Retain;Delete
+type VolumeClaimRetentionPolicy string
+
+const (
+	// VolumeClaimRetain keeps the PVC, so it can be used by a new notebook.
+	VolumeClaimRetain VolumeClaimRetentionPolicy = "Retain"
+	// VolumeClaimDelete deletes the PVC along with the notebook.
+	VolumeClaimDelete VolumeClaimRetentionPolicy = "Delete"
+)
+
+// NotebookWorkersSpec describes the worker Pods of a Notebook.
+type NotebookWorkersSpec struct {
+	// Replicas is the number of workers. The workers are stopped along with
+	// the notebook.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// Template describes the workers.
+	Template NotebookTemplateSpec `json:"template"`
+}
+
+// NotebookState is the desired run state of a Notebook.
+// +kubebuilder:validation:Enum=Running;Stopped
+type NotebookState string
+
+const (
+	// NotebookStateRunning keeps the notebook Pod running.
+	NotebookStateRunning NotebookState = "Running"
+	// NotebookStateStopped stops the notebook Pod while keeping the Notebook
+	// and its volumes around.
+	NotebookStateStopped NotebookState = "Stopped"
+)
+
+// NotebookStopReason describes why a Notebook was stopped.
+type NotebookStopReason string
+
+const (
+	// NotebookStopReasonUserRequested means spec.state was set to Stopped
+	// by a user or a client acting on their behalf.
+	NotebookStopReasonUserRequested NotebookStopReason = "UserRequested"
+	// NotebookStopReasonCulled means the culler stopped an idle notebook.
+	NotebookStopReasonCulled NotebookStopReason = "Culled"
+	// NotebookStopReasonStopAnnotation means the notebook was stopped through
+	// the deprecated kubeflow-resource-stopped annotation.
+	NotebookStopReasonStopAnnotation NotebookStopReason = "StopAnnotation"
+	// NotebookStopReasonScheduled means a NotebookSchedule stopped the
+	// notebook.
+	NotebookStopReasonScheduled NotebookStopReason = "Scheduled"
+)
+
 type NotebookTemplateSpec struct {
-	Spec corev1.PodSpec `json:"spec,omitempty"`
+	// Metadata holds the labels and annotations of the Pods. They are set
+	// on top of the ones propagated from the Notebook, and aren't filtered.
+	// +optional
+	Metadata *NotebookTemplateMetadata `json:"metadata,omitempty"`
+	Spec     corev1.PodSpec            `json:"spec,omitempty"`
+}
+
+// NotebookTemplateMetadata is the metadata of the Pods of a Notebook.
+type NotebookTemplateMetadata struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // NotebookStatus defines the observed state of Notebook
 type NotebookStatus struct {
-	// Conditions is an array of current conditions
-	Conditions []NotebookCondition `json:"conditions"`
+	// Conditions are the current conditions of the notebook: Ready,
+	// Progressing, Degraded, Stopped, Culled and PendingUpdate, which are
+	// computed by the controller, and CullingScheduled, which is set by the
+	// culler.
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions" patchStrategy:"merge" patchMergeKey:"type"`
+	// ObservedGeneration is the generation of the notebook the status was
+	// computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// ReadyReplicas is the number of Pods created by the StatefulSet controller that have a Ready Condition.
 	ReadyReplicas int32 `json:"readyReplicas"`
 	// ContainerState is the state of underlying container.
 	ContainerState corev1.ContainerState `json:"containerState"`
+	// StoppedAt is the time at which the notebook was stopped. It is unset
+	// while the notebook is running.
+	// +optional
+	StoppedAt *metav1.Time `json:"stoppedAt,omitempty"`
+	// StopReason describes why the notebook was stopped.
+	// +optional
+	StopReason NotebookStopReason `json:"stopReason,omitempty"`
+	// Culling is the culling policy in effect for the notebook.
+	// +optional
+	Culling *NotebookCullingStatus `json:"culling,omitempty"`
+	// Idleness is the activity of the notebook, as last probed by the
+	// culler. It is unset while the notebook is stopped or exempt from
+	// culling.
+	// +optional
+	Idleness *NotebookIdlenessStatus `json:"idleness,omitempty"`
+	// Workers reports the workers of the notebook, if it has any.
+	// +optional
+	Workers *NotebookWorkersStatus `json:"workers,omitempty"`
+	// VolumeClaims is the state of the PVCs of the volume claim templates.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	VolumeClaims []NotebookVolumeClaimStatus `json:"volumeClaims,omitempty"`
+	// RemoteAccess reports how to connect to the SSH server of the
+	// notebook, if it has one.
+	// +optional
+	RemoteAccess *NotebookRemoteAccessStatus `json:"remoteAccess,omitempty"`
+	// Apps are the addresses of the apps of the notebook.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Apps []NotebookAppStatus `json:"apps,omitempty"`
+}
+
+// NotebookAppStatus reports the addresses of an app of a Notebook.
+type NotebookAppStatus struct {
+	// Name is the name of the app.
+	Name string `json:"name"`
+	// URL is the path of the app on the cluster gateway, e.g.
+	// /notebook-apps/ns/name/tensorboard/. It is unset if routing is
+	// disabled.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// ServiceURL is the URL of the app inside the cluster.
+	ServiceURL string `json:"serviceURL"`
+}
+
+// NotebookRemoteAccessStatus reports how to connect to the SSH server of a
+// Notebook.
+type NotebookRemoteAccessStatus struct {
+	// ServiceName is the name of the Service of the SSH server.
+	ServiceName string `json:"serviceName"`
+	// GatewayPort is the port of the cluster gateway that is routed to the
+	// SSH server. It is unset if the SSH server isn't routed through the
+	// gateway.
+	// +optional
+	GatewayPort int32 `json:"gatewayPort,omitempty"`
+	// ConnectionString is the ssh command that connects to the notebook,
+	// e.g. ssh -p 2201 jovyan@kubeflow.example.com.
+	ConnectionString string `json:"connectionString"`
 }
 
-type NotebookCondition struct {
-	// Type is the type of the condition. Possible values are Running|Waiting|Terminated
-	Type string `json:"type"`
-	// Status is the status of the condition. Can be True, False, Unknown.
-	Status string `json:"status"`
-	// Last time we probed the condition.
+// NotebookVolumeClaimStatus is the state of the PVC of a volume claim
+// template.
+type NotebookVolumeClaimStatus struct {
+	// Name is the name of the volume claim template.
+	Name string `json:"name"`
+	// ClaimName is the name of the PVC.
+	ClaimName string `json:"claimName"`
+	// Phase is the phase of the PVC. It is empty if the PVC doesn't exist.
 	// +optional
-	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
-	// Last time the condition transitioned from one status to another.
+	Phase corev1.PersistentVolumeClaimPhase `json:"phase,omitempty"`
+	// Capacity is the storage capacity of the bound volume.
 	// +optional
-	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
-	// (brief) reason the container is in the current state
+	Capacity *resource.Quantity `json:"capacity,omitempty"`
+}
+
+// NotebookWorkersStatus reports the worker Pods of a Notebook.
+type NotebookWorkersStatus struct {
+	// ServiceName is the name of the headless Service of the notebook and
+	// its workers.
+	ServiceName string `json:"serviceName"`
+	// Replicas is the number of workers that should be running.
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of workers that are ready.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Pods is the state of each worker Pod.
+	// +listType=map
+	// +listMapKey=name
 	// +optional
-	Reason string `json:"reason,omitempty"`
-	// Message regarding why the container is in the current state.
+	Pods []NotebookReplicaStatus `json:"pods,omitempty"`
+}
+
+// NotebookReplicaStatus is the state of a worker Pod of a Notebook.
+type NotebookReplicaStatus struct {
+	// Name is the name of the Pod.
+	Name string `json:"name"`
+	// Ready is true if the Pod is ready.
+	Ready bool `json:"ready"`
+	// Phase is the phase of the Pod.
 	// +optional
-	Message string `json:"message,omitempty"`
+	Phase corev1.PodPhase `json:"phase,omitempty"`
 }
 
+// NotebookIdlenessStatus reports the activity of a Notebook, as observed by
+// the idleness probe of the culler.
+type NotebookIdlenessStatus struct {
+	// LastActivity is when the Notebook was last active. The Notebook is
+	// culled once it has been idle for the idle time since then.
+	// +optional
+	LastActivity *metav1.Time `json:"lastActivity,omitempty"`
+	// LastCheckTime is when the culler last probed the Notebook.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+	// Probe is the type of the idleness probe that reported the activity.
+	// +optional
+	Probe IdlenessProbeType `json:"probe,omitempty"`
+	// Busy is true if the Notebook was active when it was last probed, e.g.
+	// because one of its kernels was busy.
+	// +optional
+	Busy bool `json:"busy,omitempty"`
+	// Kernels is the number of kernels of the Notebook. It is only reported
+	// by the JupyterKernels probe.
+	// +optional
+	Kernels *int32 `json:"kernels,omitempty"`
+	// BusyKernels is the number of kernels that were busy. It is only
+	// reported by the JupyterKernels probe.
+	// +optional
+	BusyKernels *int32 `json:"busyKernels,omitempty"`
+}
+
+// NotebookCullingStatus reports the effective culling settings of a Notebook,
+// after the controller defaults, the matching CullingPolicy and the Notebook's
+// own overrides have been merged.
+type NotebookCullingStatus struct {
+	// PolicyName is the name of the CullingPolicy that matched the notebook.
+	// It is empty if no policy matched.
+	// +optional
+	PolicyName string `json:"policyName,omitempty"`
+	// ScheduledStopTime is when the culler will stop the idle Notebook, if
+	// it stays idle.
+	// +optional
+	ScheduledStopTime *metav1.Time `json:"scheduledStopTime,omitempty"`
+
+	CullingSettings `json:",inline"`
+}
+
+// The types of the conditions of a Notebook
+const (
+	// NotebookConditionReady is True when the notebook's Pod is ready
+	NotebookConditionReady = "Ready"
+	// NotebookConditionProgressing is True while the notebook is starting,
+	// stopping or being updated
+	NotebookConditionProgressing = "Progressing"
+	// NotebookConditionDegraded is True when the notebook can't run, e.g.
+	// because its image can't be pulled or its volumes are missing
+	NotebookConditionDegraded = "Degraded"
+	// NotebookConditionStopped is True when the notebook is stopped
+	NotebookConditionStopped = "Stopped"
+	// NotebookConditionCulled is True when the notebook was stopped by the
+	// culler
+	NotebookConditionCulled = "Culled"
+	// NotebookConditionCullingScheduled is set by the culler while an idle
+	// notebook is about to be stopped
+	NotebookConditionCullingScheduled = "CullingScheduled"
+	// NotebookConditionPendingUpdate is True while changes to the pod
+	// template are held by the update strategy of the notebook
+	NotebookConditionPendingUpdate = "PendingUpdate"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -16,17 +16,413 @@ limitations under the License.
 package v1beta1
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
+const (
+	// DefaultContainerPort is the port the notebook server listens on, if the
+	// notebook container doesn't declare any ports
+	DefaultContainerPort = 8888
+	// DefaultServingPort is the port of the Service of the Notebook that
+	// serves the notebook server
+	DefaultServingPort = 80
+	// DefaultWorkingDir is the working directory of the notebook container
+	DefaultWorkingDir = "/home/jovyan"
+	// The default fsGroup of PodSecurityContext.
+	// https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.11/#podsecuritycontext-v1-core
+	DefaultFSGroup = int64(100)
+
+	// AnnotationRewriteURI is the URI the requests to the Notebook are
+	// rewritten to
+	AnnotationRewriteURI = "notebooks.kubeflow.org/http-rewrite-uri"
+	// AnnotationHeadersRequestSet is a JSON object with the headers set on the
+	// requests to the Notebook
+	AnnotationHeadersRequestSet = "notebooks.kubeflow.org/http-headers-request-set"
+
+	// MaxNameLength is the longest name of a Notebook. The StatefulSet
+	// controller labels the Pods with the name of the StatefulSet and an
+	// 11 character revision hash, and label values can't be longer than 63
+	// characters.
+	MaxNameLength = 52
+	// WorkersNameSuffix is appended to the name of a Notebook to name the
+	// StatefulSet of its workers
+	WorkersNameSuffix = "-worker"
+)
+
+// headerNameRegexp matches the valid names of HTTP headers, i.e. tokens
+// https://www.rfc-editor.org/rfc/rfc7230#section-3.2
+var headerNameRegexp = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
 // log is for logging in this package.
 var notebooklog = logf.Log.WithName("notebook-resource")
 
-func (r *Notebook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+func (r *Notebook) SetupWebhookWithManager(mgr ctrl.Manager, defaulter *NotebookDefaulter) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithDefaulter(defaulter).
 		Complete()
 }
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+//+kubebuilder:webhook:path=/mutate-kubeflow-org-v1beta1-notebook,mutating=true,failurePolicy=fail,sideEffects=None,groups=kubeflow.org,resources=notebooks,verbs=create;update,versions=v1beta1,name=mnotebook.kb.io,admissionReviewVersions=v1
+
+// NotebookDefaulter fills in the defaults the controller applies to the
+// notebook container, so the stored Notebook shows what will actually run.
+type NotebookDefaulter struct {
+	// AddFSGroup sets the fsGroup of the notebook Pods that have no security
+	// context, like the controller does with the same configuration.
+	AddFSGroup bool
+}
+
+var _ webhook.CustomDefaulter = &NotebookDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered
+// for the type
+func (d *NotebookDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	nb, ok := obj.(*Notebook)
+	if !ok {
+		return fmt.Errorf("expected a Notebook, got %T", obj)
+	}
+	nb.setDefaults(d.AddFSGroup)
+	return nil
+}
+
+func (r *Notebook) setDefaults(addFSGroup bool) {
+	notebooklog.Info("default", "name", r.Name)
+
+	if r.Spec.UpdateStrategy == "" {
+		r.Spec.UpdateStrategy = NotebookUpdateImmediate
+	}
+	for i := range r.Spec.VolumeClaimTemplates {
+		if r.Spec.VolumeClaimTemplates[i].RetentionPolicy == "" {
+			r.Spec.VolumeClaimTemplates[i].RetentionPolicy = VolumeClaimRetain
+		}
+	}
+
+	podSpec := &r.Spec.Template.Spec
+	if len(podSpec.Containers) == 0 {
+		// Rejected by the validating webhook
+		return
+	}
+
+	container := &podSpec.Containers[0]
+	if container.WorkingDir == "" {
+		container.WorkingDir = DefaultWorkingDir
+	}
+	if container.Ports == nil {
+		container.Ports = []corev1.ContainerPort{
+			{
+				ContainerPort: DefaultContainerPort,
+				Name:          "notebook-port",
+				Protocol:      "TCP",
+			},
+		}
+	}
+
+	// For some platforms (like OpenShift), adding fsGroup: 100 is troublesome.
+	// This allows for those platforms to bypass the automatic addition of the fsGroup
+	if addFSGroup {
+		if podSpec.SecurityContext == nil {
+			fsGroup := DefaultFSGroup
+			podSpec.SecurityContext = &corev1.PodSecurityContext{
+				FSGroup: &fsGroup,
+			}
+		}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-kubeflow-org-v1beta1-notebook,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubeflow.org,resources=notebooks,verbs=create;update,versions=v1beta1,name=vnotebook.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Notebook{}
+
+func (r *Notebook) validate() field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	namePath := field.NewPath("metadata", "name")
+	if len(r.Name) > MaxNameLength {
+		allErrs = append(allErrs, field.TooLong(namePath, r.Name, MaxNameLength))
+	}
+	// The Service of the Notebook has the same name
+	for _, msg := range validation.IsDNS1035Label(r.Name) {
+		allErrs = append(allErrs, field.Invalid(namePath, r.Name, msg))
+	}
+
+	containersPath := field.NewPath("spec", "template", "spec", "containers")
+	containers := r.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		// The controller copies the template of the source of a clone
+		if r.Spec.CloneFrom == nil {
+			allErrs = append(allErrs, field.Required(containersPath, "a Notebook needs at least one container"))
+		}
+	} else if containers[0].Name != r.Name {
+		allErrs = append(allErrs, field.Invalid(containersPath.Index(0).Child("name"), containers[0].Name,
+			fmt.Sprintf("the first container runs the notebook and must be named after the Notebook, %q", r.Name)))
+	}
+
+	if r.Spec.Workers != nil {
+		// The StatefulSet of the workers is named after the Notebook
+		if maxLength := MaxNameLength - len(WorkersNameSuffix); len(r.Name) > maxLength {
+			allErrs = append(allErrs, field.TooLong(namePath, r.Name, maxLength))
+		}
+		workersPath := field.NewPath("spec", "workers", "template", "spec", "containers")
+		if len(r.Spec.Workers.Template.Spec.Containers) == 0 {
+			allErrs = append(allErrs, field.Required(workersPath, "workers need at least one container"))
+		}
+	}
+
+	allErrs = append(allErrs, validateTemplateMetadata(field.NewPath("spec", "template", "metadata"),
+		r.Spec.Template.Metadata)...)
+	if r.Spec.Workers != nil {
+		allErrs = append(allErrs, validateTemplateMetadata(field.NewPath("spec", "workers", "template", "metadata"),
+			r.Spec.Workers.Template.Metadata)...)
+	}
+	allErrs = append(allErrs, r.validateVolumeClaimTemplates()...)
+	allErrs = append(allErrs, validateCullingSettings(field.NewPath("spec", "culling"), r.Spec.Culling)...)
+	allErrs = append(allErrs, r.validateProbeAuth()...)
+	if p := r.Spec.Culling; p != nil && p.Probe != nil && p.Probe.Prometheus != nil && p.Probe.Prometheus.Query != "" {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "culling", "probe", "prometheus", "query"),
+			"can only be set in a CullingPolicy"))
+	}
+	allErrs = append(allErrs, r.validateCloneFrom()...)
+	allErrs = append(allErrs, r.validateApps()...)
+	if r.Spec.NetworkPolicy != nil {
+		policyPath := field.NewPath("spec", "networkPolicy")
+		allErrs = append(allErrs, validateNetworkPeers(policyPath.Child("ingress"), r.Spec.NetworkPolicy.Ingress)...)
+		allErrs = append(allErrs, validateNetworkPeers(policyPath.Child("egress"), r.Spec.NetworkPolicy.Egress)...)
+	}
+
+	if r.Spec.RemoteAccess != nil {
+		secretPath := field.NewPath("spec", "remoteAccess", "authorizedKeysSecretName")
+		name := r.Spec.RemoteAccess.AuthorizedKeysSecretName
+		if name == "" {
+			allErrs = append(allErrs, field.Required(secretPath, "the Secret with the public keys allowed to log in"))
+		} else {
+			for _, msg := range validation.IsDNS1123Subdomain(name) {
+				allErrs = append(allErrs, field.Invalid(secretPath, name, msg))
+			}
+		}
+	}
+
+	annotationsPath := field.NewPath("metadata", "annotations")
+	if rewrite := r.Annotations[AnnotationRewriteURI]; rewrite != "" && !strings.HasPrefix(rewrite, "/") {
+		allErrs = append(allErrs, field.Invalid(annotationsPath.Key(AnnotationRewriteURI), rewrite,
+			"must be an absolute path"))
+	}
+	if headers := r.Annotations[AnnotationHeadersRequestSet]; headers != "" {
+		allErrs = append(allErrs, validateHeaders(annotationsPath.Key(AnnotationHeadersRequestSet), headers)...)
+	}
+
+	return allErrs
+}
+
+// validateTemplateMetadata checks that the labels and annotations of a pod
+// template are valid
+func validateTemplateMetadata(fldPath *field.Path, metadata *NotebookTemplateMetadata) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if metadata == nil {
+		return allErrs
+	}
+	allErrs = append(allErrs, metav1validation.ValidateLabels(metadata.Labels, fldPath.Child("labels"))...)
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(metadata.Annotations, fldPath.Child("annotations"))...)
+	return allErrs
+}
+
+// validateVolumeClaimTemplates checks that the volume claim templates are
+// valid volume names that don't clash with the volumes of the pod template
+func (r *Notebook) validateVolumeClaimTemplates() field.ErrorList {
+	allErrs := field.ErrorList{}
+	volumes := map[string]bool{}
+	for _, v := range r.Spec.Template.Spec.Volumes {
+		volumes[v.Name] = true
+	}
+	templatesPath := field.NewPath("spec", "volumeClaimTemplates")
+	for i, t := range r.Spec.VolumeClaimTemplates {
+		namePath := templatesPath.Index(i).Child("name")
+		for _, msg := range validation.IsDNS1123Label(t.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, t.Name, msg))
+		}
+		if volumes[t.Name] {
+			allErrs = append(allErrs, field.Duplicate(namePath, t.Name))
+		}
+		volumes[t.Name] = true
+	}
+	return allErrs
+}
+
+// validateProbeAuth checks that the authentication of the idleness probe
+// applies to the probe
+func (r *Notebook) validateProbeAuth() field.ErrorList {
+	allErrs := field.ErrorList{}
+	if r.Spec.Culling == nil || r.Spec.Culling.Probe == nil || r.Spec.Culling.Probe.Auth == nil {
+		return allErrs
+	}
+	probe := r.Spec.Culling.Probe
+	authPath := field.NewPath("spec", "culling", "probe", "auth")
+	if probe.Type == IdlenessProbePrometheus {
+		allErrs = append(allErrs, field.Forbidden(authPath, "the Prometheus probe doesn't reach the Notebook"))
+	}
+	if name := probe.Auth.SecretName; name != "" {
+		if probe.Auth.Type != IdlenessProbeAuthToken {
+			allErrs = append(allErrs, field.Forbidden(authPath.Child("secretName"),
+				"only used by the Token authentication"))
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			allErrs = append(allErrs, field.Invalid(authPath.Child("secretName"), name, msg))
+		}
+	}
+	return allErrs
+}
+
+// validateCloneFrom checks that the source of a clone is another Notebook
+func (r *Notebook) validateCloneFrom() field.ErrorList {
+	allErrs := field.ErrorList{}
+	if r.Spec.CloneFrom == nil {
+		return allErrs
+	}
+	namePath := field.NewPath("spec", "cloneFrom", "name")
+	name := r.Spec.CloneFrom.Name
+	if name == "" {
+		return append(allErrs, field.Required(namePath, "the name of the Notebook to clone"))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		allErrs = append(allErrs, field.Invalid(namePath, name, msg))
+	}
+	if name == r.Name {
+		allErrs = append(allErrs, field.Invalid(namePath, name, "a Notebook can't be cloned from itself"))
+	}
+	return allErrs
+}
+
+// validateApps checks that the apps have distinct names and ports, which
+// don't clash with the port of the notebook server on the Service
+func (r *Notebook) validateApps() field.ErrorList {
+	allErrs := field.ErrorList{}
+	notebookPort := int32(DefaultContainerPort)
+	if containers := r.Spec.Template.Spec.Containers; len(containers) > 0 && len(containers[0].Ports) > 0 {
+		notebookPort = containers[0].Ports[0].ContainerPort
+	}
+	names := map[string]bool{}
+	ports := map[int32]bool{DefaultServingPort: true, notebookPort: true}
+	appsPath := field.NewPath("spec", "apps")
+	for i, app := range r.Spec.Apps {
+		namePath := appsPath.Index(i).Child("name")
+		// The app is the "http-<name>" port of the Service
+		if msgs := validation.IsDNS1123Label("http-" + app.Name); app.Name == "" || len(msgs) > 0 {
+			allErrs = append(allErrs, field.Invalid(namePath, app.Name,
+				"must be a DNS label of at most 58 characters"))
+		}
+		// The notebook server is the "http-<notebook>" port of the Service
+		if names[app.Name] || app.Name == r.Name {
+			allErrs = append(allErrs, field.Duplicate(namePath, app.Name))
+		}
+		names[app.Name] = true
+		if ports[app.Port] {
+			allErrs = append(allErrs, field.Duplicate(appsPath.Index(i).Child("port"), app.Port))
+		}
+		ports[app.Port] = true
+	}
+	return allErrs
+}
+
+// validateNetworkPeers checks that each peer is either a valid CIDR or a
+// valid namespace name
+func validateNetworkPeers(fldPath *field.Path, peers []NotebookNetworkPeer) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, peer := range peers {
+		peerPath := fldPath.Index(i)
+		switch {
+		case peer.CIDR == "" && peer.Namespace == "":
+			allErrs = append(allErrs, field.Required(peerPath, "one of cidr or namespace must be set"))
+		case peer.CIDR != "" && peer.Namespace != "":
+			allErrs = append(allErrs, field.Forbidden(peerPath, "only one of cidr or namespace can be set"))
+		case peer.CIDR != "":
+			if _, _, err := net.ParseCIDR(peer.CIDR); err != nil {
+				allErrs = append(allErrs, field.Invalid(peerPath.Child("cidr"), peer.CIDR, err.Error()))
+			}
+		default:
+			for _, msg := range validation.IsDNS1123Label(peer.Namespace) {
+				allErrs = append(allErrs, field.Invalid(peerPath.Child("namespace"), peer.Namespace, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateHeaders validates a JSON object of HTTP header names and values
+func validateHeaders(fldPath *field.Path, value string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	headers := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return append(allErrs, field.Invalid(fldPath, value,
+			fmt.Sprintf("must be a JSON object of header names and values: %v", err)))
+	}
+	for name, v := range headers {
+		if !headerNameRegexp.MatchString(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath, value,
+				fmt.Sprintf("invalid header name %q", name)))
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			allErrs = append(allErrs, field.Invalid(fldPath, value,
+				fmt.Sprintf("the value of header %q must not contain line breaks", name)))
+		}
+	}
+	return allErrs
+}
+
+func (r *Notebook) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Notebook").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Notebook) ValidateCreate() error {
+	notebooklog.Info("validate create", "name", r.Name)
+
+	return r.invalid(r.validate())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// Errors the old Notebook already had are ignored, so that Notebooks created
+// before the webhook existed can still be updated, e.g. stopped.
+func (r *Notebook) ValidateUpdate(old runtime.Object) error {
+	notebooklog.Info("validate update", "name", r.Name)
+
+	oldErrs := map[string]bool{}
+	if oldNotebook, ok := old.(*Notebook); ok {
+		for _, err := range oldNotebook.validate() {
+			oldErrs[err.Field+"/"+string(err.Type)] = true
+		}
+	}
+	allErrs := field.ErrorList{}
+	for _, err := range r.validate() {
+		if !oldErrs[err.Field+"/"+string(err.Type)] {
+			allErrs = append(allErrs, err)
+		}
+	}
+	return r.invalid(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Notebook) ValidateDelete() error {
+	notebooklog.Info("validate delete", "name", r.Name)
+
+	// We have not registered our webhook to validate delete operations.
+	return nil
+}
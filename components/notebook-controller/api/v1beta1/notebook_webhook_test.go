@@ -0,0 +1,490 @@
+package v1beta1
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+)
+
+func testNotebook(name string) *Notebook {
+	return &Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Spec: NotebookSpec{
+			Template: NotebookTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: name, Image: "jupyter"}},
+				},
+			},
+		},
+	}
+}
+
+func TestNotebookDefault(t *testing.T) {
+	fsGroup := DefaultFSGroup
+	customFSGroup := int64(1000)
+	testCases := []struct {
+		testName   string
+		addFSGroup string
+		podSpec    corev1.PodSpec
+		expected   corev1.PodSpec
+	}{
+		{
+			testName: "Defaults are filled in",
+			podSpec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "nb"}},
+			},
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:       "nb",
+						WorkingDir: DefaultWorkingDir,
+						Ports: []corev1.ContainerPort{
+							{ContainerPort: DefaultContainerPort, Name: "notebook-port", Protocol: "TCP"},
+						},
+					},
+				},
+				SecurityContext: &corev1.PodSecurityContext{FSGroup: &fsGroup},
+			},
+		},
+		{
+			testName: "Explicit values are kept",
+			podSpec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:       "nb",
+						WorkingDir: "/workspace",
+						Ports:      []corev1.ContainerPort{{ContainerPort: 8080}},
+					},
+				},
+				SecurityContext: &corev1.PodSecurityContext{FSGroup: &customFSGroup},
+			},
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:       "nb",
+						WorkingDir: "/workspace",
+						Ports:      []corev1.ContainerPort{{ContainerPort: 8080}},
+					},
+				},
+				SecurityContext: &corev1.PodSecurityContext{FSGroup: &customFSGroup},
+			},
+		},
+		{
+			testName:   "fsGroup is disabled",
+			addFSGroup: "false",
+			podSpec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "nb", WorkingDir: "/workspace", Ports: []corev1.ContainerPort{}}},
+			},
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "nb", WorkingDir: "/workspace", Ports: []corev1.ContainerPort{}}},
+			},
+		},
+		{
+			testName: "No containers",
+			podSpec:  corev1.PodSpec{},
+			expected: corev1.PodSpec{},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			nb := &Notebook{Spec: NotebookSpec{Template: NotebookTemplateSpec{Spec: c.podSpec}}}
+			defaulter := &NotebookDefaulter{AddFSGroup: c.addFSGroup != "false"}
+			if err := defaulter.Default(context.TODO(), nb); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(nb.Spec.Template.Spec, c.expected) {
+				t.Errorf("Unexpected defaults: %s", diff.ObjectReflectDiff(c.expected, nb.Spec.Template.Spec))
+			}
+		})
+	}
+}
+
+func TestNotebookDefaultRetentionPolicy(t *testing.T) {
+	nb := testNotebook("nb")
+	nb.Spec.VolumeClaimTemplates = []NotebookVolumeClaimTemplate{
+		{Name: "workspace"},
+		{Name: "scratch", RetentionPolicy: VolumeClaimDelete},
+	}
+	nb.setDefaults(true)
+	if policy := nb.Spec.VolumeClaimTemplates[0].RetentionPolicy; policy != VolumeClaimRetain {
+		t.Errorf("Got retention policy %q, Expected %q", policy, VolumeClaimRetain)
+	}
+	if policy := nb.Spec.VolumeClaimTemplates[1].RetentionPolicy; policy != VolumeClaimDelete {
+		t.Errorf("Got retention policy %q, Expected %q", policy, VolumeClaimDelete)
+	}
+}
+
+func TestNotebookDefaultUpdateStrategy(t *testing.T) {
+	nb := testNotebook("nb")
+	nb.setDefaults(true)
+	if strategy := nb.Spec.UpdateStrategy; strategy != NotebookUpdateImmediate {
+		t.Errorf("Got update strategy %q, Expected %q", strategy, NotebookUpdateImmediate)
+	}
+
+	nb = testNotebook("nb")
+	nb.Spec.UpdateStrategy = NotebookUpdateOnStop
+	nb.setDefaults(true)
+	if strategy := nb.Spec.UpdateStrategy; strategy != NotebookUpdateOnStop {
+		t.Errorf("Got update strategy %q, Expected %q", strategy, NotebookUpdateOnStop)
+	}
+}
+
+func TestNotebookValidateCreate(t *testing.T) {
+	testCases := []struct {
+		testName string
+		notebook func() *Notebook
+		errors   []string
+	}{
+		{
+			testName: "Valid Notebook",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Annotations = map[string]string{
+					AnnotationRewriteURI:        "/",
+					AnnotationHeadersRequestSet: `{"X-RStudio-Root-Path":"/notebook/ns/nb/"}`,
+				}
+				return nb
+			},
+		},
+		{
+			testName: "No containers",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Template.Spec.Containers = nil
+				return nb
+			},
+			errors: []string{"spec.template.spec.containers: Required value"},
+		},
+		{
+			testName: "Container not named after the Notebook",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Template.Spec.Containers[0].Name = "jupyter"
+				return nb
+			},
+			errors: []string{"spec.template.spec.containers[0].name: Invalid value"},
+		},
+		{
+			testName: "Name too long",
+			notebook: func() *Notebook { return testNotebook(strings.Repeat("a", MaxNameLength+1)) },
+			errors:   []string{"metadata.name: Too long"},
+		},
+		{
+			testName: "Name isn't a DNS label",
+			notebook: func() *Notebook { return testNotebook("1nb") },
+			errors:   []string{"metadata.name: Invalid value"},
+		},
+		{
+			testName: "Workers without containers",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Workers = &NotebookWorkersSpec{Replicas: 2}
+				return nb
+			},
+			errors: []string{"spec.workers.template.spec.containers: Required value"},
+		},
+		{
+			testName: "Name too long for workers",
+			notebook: func() *Notebook {
+				nb := testNotebook(strings.Repeat("a", MaxNameLength))
+				nb.Spec.Workers = &NotebookWorkersSpec{
+					Replicas: 2,
+					Template: NotebookTemplateSpec{
+						Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "worker", Image: "dask"}}},
+					},
+				}
+				return nb
+			},
+			errors: []string{"metadata.name: Too long"},
+		},
+		{
+			testName: "Volume claim template clashes with a volume",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Template.Spec.Volumes = []corev1.Volume{{Name: "workspace"}}
+				nb.Spec.VolumeClaimTemplates = []NotebookVolumeClaimTemplate{{Name: "workspace"}}
+				return nb
+			},
+			errors: []string{"spec.volumeClaimTemplates[0].name: Duplicate value"},
+		},
+		{
+			testName: "Volume claim template name isn't a DNS label",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.VolumeClaimTemplates = []NotebookVolumeClaimTemplate{{Name: "Work_Space"}}
+				return nb
+			},
+			errors: []string{"spec.volumeClaimTemplates[0].name: Invalid value"},
+		},
+		{
+			testName: "Probe authentication of the Prometheus probe",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Culling = &CullingSettings{Probe: &IdlenessProbe{
+					Type: IdlenessProbePrometheus,
+					Auth: &IdlenessProbeAuth{Type: IdlenessProbeAuthToken},
+				}}
+				return nb
+			},
+			errors: []string{"spec.culling.probe.auth: Forbidden"},
+		},
+		{
+			testName: "Non-positive culling durations",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Culling = &CullingSettings{
+					IdleTime:    &metav1.Duration{Duration: -time.Hour},
+					CheckPeriod: &metav1.Duration{},
+					GracePeriod: &metav1.Duration{Duration: -time.Minute},
+				}
+				return nb
+			},
+			errors: []string{
+				"spec.culling.idleTime: Invalid value",
+				"spec.culling.checkPeriod: Invalid value",
+				"spec.culling.gracePeriod: Invalid value",
+			},
+		},
+		{
+			testName: "Zero grace period",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Culling = &CullingSettings{GracePeriod: &metav1.Duration{}}
+				return nb
+			},
+		},
+		{
+			testName: "Prometheus query of a Notebook",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Culling = &CullingSettings{Probe: &IdlenessProbe{
+					Type:       IdlenessProbePrometheus,
+					Prometheus: &PrometheusIdlenessProbe{Query: "up"},
+				}}
+				return nb
+			},
+			errors: []string{"spec.culling.probe.prometheus.query: Forbidden"},
+		},
+		{
+			testName: "Secret without the Token probe authentication",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Culling = &CullingSettings{Probe: &IdlenessProbe{
+					Auth: &IdlenessProbeAuth{Type: IdlenessProbeAuthNone, SecretName: "token"},
+				}}
+				return nb
+			},
+			errors: []string{"spec.culling.probe.auth.secretName: Forbidden"},
+		},
+		{
+			testName: "Clone without containers",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Template.Spec.Containers = nil
+				nb.Spec.CloneFrom = &NotebookCloneSource{Name: "source", CloneVolumes: true}
+				return nb
+			},
+		},
+		{
+			testName: "Clone of itself",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.CloneFrom = &NotebookCloneSource{Name: "nb"}
+				return nb
+			},
+			errors: []string{"spec.cloneFrom.name: Invalid value"},
+		},
+		{
+			testName: "Clone without a source",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.CloneFrom = &NotebookCloneSource{}
+				return nb
+			},
+			errors: []string{"spec.cloneFrom.name: Required value"},
+		},
+		{
+			testName: "Network policy",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.NetworkPolicy = &NotebookNetworkPolicy{
+					Ingress: []NotebookNetworkPeer{{Namespace: "monitoring"}},
+					Egress:  []NotebookNetworkPeer{{CIDR: "10.0.0.0/16"}, {Namespace: "kubeflow"}},
+				}
+				return nb
+			},
+		},
+		{
+			testName: "Invalid network peers",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.NetworkPolicy = &NotebookNetworkPolicy{
+					Ingress: []NotebookNetworkPeer{{}},
+					Egress: []NotebookNetworkPeer{
+						{CIDR: "10.0.0.0"},
+						{CIDR: "10.0.0.0/16", Namespace: "kubeflow"},
+					},
+				}
+				return nb
+			},
+			errors: []string{
+				"spec.networkPolicy.ingress[0]: Required value",
+				"spec.networkPolicy.egress[0].cidr: Invalid value",
+				"spec.networkPolicy.egress[1]: Forbidden",
+			},
+		},
+		{
+			testName: "Invalid pod template metadata",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Template.Metadata = &NotebookTemplateMetadata{
+					Labels:      map[string]string{"team": "data science"},
+					Annotations: map[string]string{"example.com/owner/name": "alice"},
+				}
+				return nb
+			},
+			errors: []string{
+				"spec.template.metadata.labels: Invalid value",
+				"spec.template.metadata.annotations: Invalid value",
+			},
+		},
+		{
+			testName: "Apps",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Apps = []NotebookApp{{Name: "tensorboard", Port: 6006}, {Name: "streamlit", Port: 8501}}
+				return nb
+			},
+		},
+		{
+			testName: "Apps with clashing names and ports",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Apps = []NotebookApp{
+					{Name: "dash", Port: 8050},
+					{Name: "dash", Port: 8888},
+					{Name: "Dash_App", Port: 8050},
+				}
+				return nb
+			},
+			errors: []string{
+				"spec.apps[1].name: Duplicate value",
+				"spec.apps[1].port: Duplicate value",
+				"spec.apps[2].name: Invalid value",
+				"spec.apps[2].port: Duplicate value",
+			},
+		},
+		{
+			testName: "App named like the Notebook",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.Apps = []NotebookApp{{Name: "nb", Port: 8050}}
+				return nb
+			},
+			errors: []string{"spec.apps[0].name: Duplicate value"},
+		},
+		{
+			testName: "Remote access without authorized keys",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Spec.RemoteAccess = &NotebookRemoteAccess{}
+				return nb
+			},
+			errors: []string{"spec.remoteAccess.authorizedKeysSecretName: Required value"},
+		},
+		{
+			testName: "Relative rewrite URI",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Annotations = map[string]string{AnnotationRewriteURI: "notebook"}
+				return nb
+			},
+			errors: []string{"metadata.annotations[notebooks.kubeflow.org/http-rewrite-uri]: Invalid value"},
+		},
+		{
+			testName: "Headers aren't JSON",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Annotations = map[string]string{AnnotationHeadersRequestSet: "X-Header: value"}
+				return nb
+			},
+			errors: []string{"metadata.annotations[notebooks.kubeflow.org/http-headers-request-set]: Invalid value"},
+		},
+		{
+			testName: "Invalid header",
+			notebook: func() *Notebook {
+				nb := testNotebook("nb")
+				nb.Annotations = map[string]string{AnnotationHeadersRequestSet: `{"X Header":"value\n"}`}
+				return nb
+			},
+			errors: []string{
+				`invalid header name "X Header"`,
+				`the value of header "X Header" must not contain line breaks`,
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			err := c.notebook().ValidateCreate()
+			if len(c.errors) == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected an error for case: %s", c.testName)
+			}
+			for _, expected := range c.errors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error %q, got %v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNotebookValidateUpdate(t *testing.T) {
+	// Created before the webhook existed
+	old := testNotebook("nb")
+	old.Spec.Template.Spec.Containers[0].Name = "jupyter"
+
+	stopped := old.DeepCopy()
+	stopped.Spec.State = NotebookStateStopped
+	if err := stopped.ValidateUpdate(old); err != nil {
+		t.Errorf("Expected existing errors to be ignored, got %v", err)
+	}
+
+	invalid := stopped.DeepCopy()
+	invalid.Annotations = map[string]string{AnnotationHeadersRequestSet: "{"}
+	if err := invalid.ValidateUpdate(old); err == nil {
+		t.Errorf("Expected new errors to be reported")
+	}
+}
+
+func TestCullingPolicyValidateCreate(t *testing.T) {
+	policy := &CullingPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "ns"},
+		Spec: CullingPolicySpec{CullingSettings: CullingSettings{
+			IdleTime:    &metav1.Duration{Duration: time.Hour},
+			GracePeriod: &metav1.Duration{},
+		}},
+	}
+	if err := policy.ValidateCreate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	policy.Spec.CheckPeriod = &metav1.Duration{Duration: -time.Minute}
+	err := policy.ValidateCreate()
+	if err == nil || !strings.Contains(err.Error(), "spec.checkPeriod: Invalid value") {
+		t.Errorf("Expected an invalid checkPeriod, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotebookScheduleSpec defines when the Notebooks in a namespace are started
+// and stopped
+type NotebookScheduleSpec struct {
+	// Selector restricts the schedule to the Notebooks with matching labels.
+	// An empty selector matches every Notebook in the namespace.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Start is a cron expression, in the standard five field format or one
+	// of the @daily style descriptors, at which the matching Notebooks are
+	// started, e.g. "0 8 * * 1-5" for weekdays at 08:00.
+	// +optional
+	Start string `json:"start,omitempty"`
+	// Stop is a cron expression at which the matching Notebooks are stopped,
+	// e.g. "0 20 * * 1-5" for weekdays at 20:00.
+	// +optional
+	Stop string `json:"stop,omitempty"`
+	// TimeZone is the IANA name of the time zone of the cron expressions,
+	// e.g. Europe/Berlin. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// Suspend stops the schedule from starting or stopping Notebooks.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// NotebookScheduleStatus defines the observed state of NotebookSchedule
+type NotebookScheduleStatus struct {
+	// LastStartTime is the last time the schedule started Notebooks.
+	// +optional
+	LastStartTime *metav1.Time `json:"lastStartTime,omitempty"`
+	// LastStopTime is the last time the schedule stopped Notebooks.
+	// +optional
+	LastStopTime *metav1.Time `json:"lastStopTime,omitempty"`
+	// NextStartTime is the next time the schedule will start Notebooks.
+	// +optional
+	NextStartTime *metav1.Time `json:"nextStartTime,omitempty"`
+	// NextStopTime is the next time the schedule will stop Notebooks.
+	// +optional
+	NextStopTime *metav1.Time `json:"nextStopTime,omitempty"`
+	// Message explains why the schedule isn't active, e.g. because of an
+	// invalid cron expression.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=notebookschedules,singular=notebookschedule,scope=Namespaced
+// +kubebuilder:printcolumn:name="Start",type=string,JSONPath=`.spec.start`
+// +kubebuilder:printcolumn:name="Stop",type=string,JSONPath=`.spec.stop`
+// +kubebuilder:printcolumn:name="Time Zone",type=string,JSONPath=`.spec.timeZone`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// NotebookSchedule is the Schema for the notebookschedules API
+type NotebookSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NotebookScheduleSpec   `json:"spec,omitempty"`
+	Status NotebookScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NotebookScheduleList contains a list of NotebookSchedule
+type NotebookScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NotebookSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NotebookSchedule{}, &NotebookScheduleList{})
+}
@@ -0,0 +1,163 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// NotebookSnapshotMode is what a NotebookSnapshot does
+// +kubebuilder:validation:Enum=Snapshot;Restore
+type NotebookSnapshotMode string
+
+const (
+	// NotebookSnapshotModeSnapshot takes a VolumeSnapshot of every PVC
+	// mounted by the Notebook.
+	NotebookSnapshotModeSnapshot NotebookSnapshotMode = "Snapshot"
+	// NotebookSnapshotModeRestore creates a new Notebook, and its PVCs, from
+	// the VolumeSnapshots of another NotebookSnapshot.
+	NotebookSnapshotModeRestore NotebookSnapshotMode = "Restore"
+)
+
+// NotebookSnapshotSpec defines the desired state of NotebookSnapshot
+type NotebookSnapshotSpec struct {
+	// Mode is either Snapshot or Restore. Defaults to Snapshot.
+	// +kubebuilder:default=Snapshot
+	// +optional
+	Mode NotebookSnapshotMode `json:"mode,omitempty"`
+	// NotebookName is the Notebook, in the namespace of the
+	// NotebookSnapshot, whose volumes are snapshotted in Snapshot mode, or
+	// which is created in Restore mode.
+	// +kubebuilder:validation:MinLength=1
+	NotebookName string `json:"notebookName"`
+	// Online takes the snapshots while the Notebook keeps running, which
+	// needs a CSI driver that supports it and only gives crash consistent
+	// snapshots. Otherwise the Notebook is stopped until the snapshots are
+	// taken and started again, if it was running. Only used in Snapshot mode.
+	// +optional
+	Online bool `json:"online,omitempty"`
+	// VolumeSnapshotClassName is the class of the VolumeSnapshots. Defaults
+	// to the default VolumeSnapshotClass of the cluster. Only used in
+	// Snapshot mode.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+	// SourceSnapshotName is the NotebookSnapshot, in Snapshot mode, that is
+	// restored. Required in Restore mode.
+	// +optional
+	SourceSnapshotName string `json:"sourceSnapshotName,omitempty"`
+}
+
+// NotebookSnapshotPhase is the progress of a NotebookSnapshot
+type NotebookSnapshotPhase string
+
+const (
+	// NotebookSnapshotPhasePending means the NotebookSnapshot wasn't
+	// processed yet, or waits for its source NotebookSnapshot.
+	NotebookSnapshotPhasePending NotebookSnapshotPhase = "Pending"
+	// NotebookSnapshotPhaseStopping means the Notebook is being stopped
+	// before its volumes are snapshotted.
+	NotebookSnapshotPhaseStopping NotebookSnapshotPhase = "Stopping"
+	// NotebookSnapshotPhaseSnapshotting means the VolumeSnapshots were
+	// created and aren't ready to use yet.
+	NotebookSnapshotPhaseSnapshotting NotebookSnapshotPhase = "Snapshotting"
+	// NotebookSnapshotPhaseReady means the VolumeSnapshots are ready to use,
+	// or that the Notebook was restored.
+	NotebookSnapshotPhaseReady NotebookSnapshotPhase = "Ready"
+	// NotebookSnapshotPhaseFailed means the snapshot or the restore failed,
+	// see the message for the reason.
+	NotebookSnapshotPhaseFailed NotebookSnapshotPhase = "Failed"
+)
+
+// NotebookSnapshotStatus defines the observed state of NotebookSnapshot
+type NotebookSnapshotStatus struct {
+	// +optional
+	Phase NotebookSnapshotPhase `json:"phase,omitempty"`
+	// Message is a human readable explanation of the phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Volumes are the PVC volumes of the Notebook and their VolumeSnapshots.
+	// +optional
+	Volumes []NotebookSnapshotVolume `json:"volumes,omitempty"`
+	// Template is the spec.template of the Notebook when it was
+	// snapshotted. It is used to restore the Notebook.
+	// +optional
+	Template *runtime.RawExtension `json:"template,omitempty"`
+	// StoppedNotebook is true while the controller keeps the Notebook
+	// stopped to snapshot it, so that it is started again afterwards.
+	// +optional
+	StoppedNotebook bool `json:"stoppedNotebook,omitempty"`
+	// CompletionTime is when the NotebookSnapshot became Ready or Failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// NotebookSnapshotVolume is a PVC volume of a Notebook and its VolumeSnapshot
+type NotebookSnapshotVolume struct {
+	// Name of the volume in the pod spec of the Notebook.
+	Name string `json:"name"`
+	// ClaimName is the PVC the volume mounts.
+	ClaimName string `json:"claimName"`
+	// VolumeSnapshotName is the VolumeSnapshot of the PVC.
+	VolumeSnapshotName string `json:"volumeSnapshotName"`
+	// ReadyToUse mirrors the readiness of the VolumeSnapshot.
+	// +optional
+	ReadyToUse bool `json:"readyToUse,omitempty"`
+	// StorageClassName, AccessModes and Size are copied from the PVC, so
+	// that it can be restored even if it was deleted in the meantime.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+	// RestoredClaimName is the PVC created from the VolumeSnapshot, in
+	// Restore mode.
+	// +optional
+	RestoredClaimName string `json:"restoredClaimName,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=notebooksnapshots,singular=notebooksnapshot,scope=Namespaced
+// +kubebuilder:printcolumn:name="Notebook",type=string,JSONPath=`.spec.notebookName`
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// NotebookSnapshot is the Schema for the notebooksnapshots API
+type NotebookSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NotebookSnapshotSpec   `json:"spec,omitempty"`
+	Status NotebookSnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NotebookSnapshotList contains a list of NotebookSnapshot
+type NotebookSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NotebookSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NotebookSnapshot{}, &NotebookSnapshotList{})
+}
@@ -0,0 +1,79 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	nbv1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1"
+	nbv1beta1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+var _ = Describe("Notebook admission webhooks", func() {
+	It("Should default the notebook container", func() {
+		nb := &nbv1.Notebook{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaulted", Namespace: "default"},
+			Spec: nbv1.NotebookSpec{
+				Template: nbv1.NotebookTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "defaulted", Image: "jupyter"}},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, nb)).To(Succeed())
+
+		found := &nbv1beta1.Notebook{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(nb), found)).To(Succeed())
+		container := found.Spec.Template.Spec.Containers[0]
+		Expect(container.WorkingDir).To(Equal(nbv1beta1.DefaultWorkingDir))
+		Expect(container.Ports).To(HaveLen(1))
+		Expect(container.Ports[0].ContainerPort).To(BeEquivalentTo(nbv1beta1.DefaultContainerPort))
+		Expect(found.Spec.Template.Spec.SecurityContext.FSGroup).To(Equal(pointerTo(nbv1beta1.DefaultFSGroup)))
+
+		Expect(k8sClient.Delete(ctx, nb)).To(Succeed())
+	})
+
+	It("Should reject invalid Notebooks", func() {
+		nb := &nbv1beta1.Notebook{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "invalid",
+				Namespace:   "default",
+				Annotations: map[string]string{nbv1beta1.AnnotationHeadersRequestSet: "X-Header: value"},
+			},
+			Spec: nbv1beta1.NotebookSpec{
+				Template: nbv1beta1.NotebookTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "jupyter", Image: "jupyter"}},
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, nb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an Invalid error, got %v", err)
+		Expect(err.Error()).To(ContainSubstring("spec.template.spec.containers[0].name"))
+		Expect(err.Error()).To(ContainSubstring(nbv1beta1.AnnotationHeadersRequestSet))
+	})
+})
+
+func pointerTo(i int64) *int64 {
+	return &i
+}
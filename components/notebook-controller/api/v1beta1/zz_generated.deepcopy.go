@@ -21,9 +21,238 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CullingPolicy) DeepCopyInto(out *CullingPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CullingPolicy.
+func (in *CullingPolicy) DeepCopy() *CullingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CullingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CullingPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CullingPolicyList) DeepCopyInto(out *CullingPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CullingPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CullingPolicyList.
+func (in *CullingPolicyList) DeepCopy() *CullingPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(CullingPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CullingPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CullingPolicySpec) DeepCopyInto(out *CullingPolicySpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.CullingSettings.DeepCopyInto(&out.CullingSettings)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CullingPolicySpec.
+func (in *CullingPolicySpec) DeepCopy() *CullingPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CullingPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CullingSettings) DeepCopyInto(out *CullingSettings) {
+	*out = *in
+	if in.IdleTime != nil {
+		in, out := &in.IdleTime, &out.IdleTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CheckPeriod != nil {
+		in, out := &in.CheckPeriod, &out.CheckPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Exempt != nil {
+		in, out := &in.Exempt, &out.Exempt
+		*out = new(bool)
+		**out = **in
+	}
+	if in.WorkingHours != nil {
+		in, out := &in.WorkingHours, &out.WorkingHours
+		*out = make([]CullingWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Probe != nil {
+		in, out := &in.Probe, &out.Probe
+		*out = new(IdlenessProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GracePeriod != nil {
+		in, out := &in.GracePeriod, &out.GracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Warning != nil {
+		in, out := &in.Warning, &out.Warning
+		*out = new(CullingWarning)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CullingSettings.
+func (in *CullingSettings) DeepCopy() *CullingSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(CullingSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CullingWarning) DeepCopyInto(out *CullingWarning) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CullingWarning.
+func (in *CullingWarning) DeepCopy() *CullingWarning {
+	if in == nil {
+		return nil
+	}
+	out := new(CullingWarning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CullingWindow) DeepCopyInto(out *CullingWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CullingWindow.
+func (in *CullingWindow) DeepCopy() *CullingWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(CullingWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPIdlenessProbe) DeepCopyInto(out *HTTPIdlenessProbe) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPIdlenessProbe.
+func (in *HTTPIdlenessProbe) DeepCopy() *HTTPIdlenessProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPIdlenessProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdlenessProbe) DeepCopyInto(out *IdlenessProbe) {
+	*out = *in
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPIdlenessProbe)
+		**out = **in
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PrometheusIdlenessProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(IdlenessProbeAuth)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdlenessProbe.
+func (in *IdlenessProbe) DeepCopy() *IdlenessProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(IdlenessProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdlenessProbeAuth) DeepCopyInto(out *IdlenessProbeAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdlenessProbeAuth.
+func (in *IdlenessProbeAuth) DeepCopy() *IdlenessProbeAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(IdlenessProbeAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Notebook) DeepCopyInto(out *Notebook) {
 	*out = *in
@@ -33,18 +262,278 @@ func (in *Notebook) DeepCopyInto(out *Notebook) {
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notebook.
-func (in *Notebook) DeepCopy() *Notebook {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notebook.
+func (in *Notebook) DeepCopy() *Notebook {
+	if in == nil {
+		return nil
+	}
+	out := new(Notebook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Notebook) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookApp) DeepCopyInto(out *NotebookApp) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookApp.
+func (in *NotebookApp) DeepCopy() *NotebookApp {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookApp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookAppStatus) DeepCopyInto(out *NotebookAppStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookAppStatus.
+func (in *NotebookAppStatus) DeepCopy() *NotebookAppStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookAppStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookCloneSource) DeepCopyInto(out *NotebookCloneSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookCloneSource.
+func (in *NotebookCloneSource) DeepCopy() *NotebookCloneSource {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookCloneSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookCullingStatus) DeepCopyInto(out *NotebookCullingStatus) {
+	*out = *in
+	if in.ScheduledStopTime != nil {
+		in, out := &in.ScheduledStopTime, &out.ScheduledStopTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	in.CullingSettings.DeepCopyInto(&out.CullingSettings)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookCullingStatus.
+func (in *NotebookCullingStatus) DeepCopy() *NotebookCullingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookCullingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookDefaulter) DeepCopyInto(out *NotebookDefaulter) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookDefaulter.
+func (in *NotebookDefaulter) DeepCopy() *NotebookDefaulter {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookDefaulter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookIdlenessStatus) DeepCopyInto(out *NotebookIdlenessStatus) {
+	*out = *in
+	if in.LastActivity != nil {
+		in, out := &in.LastActivity, &out.LastActivity
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Kernels != nil {
+		in, out := &in.Kernels, &out.Kernels
+		*out = new(int32)
+		**out = **in
+	}
+	if in.BusyKernels != nil {
+		in, out := &in.BusyKernels, &out.BusyKernels
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookIdlenessStatus.
+func (in *NotebookIdlenessStatus) DeepCopy() *NotebookIdlenessStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookIdlenessStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookList) DeepCopyInto(out *NotebookList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Notebook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookList.
+func (in *NotebookList) DeepCopy() *NotebookList {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NotebookList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookNetworkPeer) DeepCopyInto(out *NotebookNetworkPeer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookNetworkPeer.
+func (in *NotebookNetworkPeer) DeepCopy() *NotebookNetworkPeer {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookNetworkPeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookNetworkPolicy) DeepCopyInto(out *NotebookNetworkPolicy) {
+	*out = *in
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = make([]NotebookNetworkPeer, len(*in))
+		copy(*out, *in)
+	}
+	if in.Egress != nil {
+		in, out := &in.Egress, &out.Egress
+		*out = make([]NotebookNetworkPeer, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookNetworkPolicy.
+func (in *NotebookNetworkPolicy) DeepCopy() *NotebookNetworkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookNetworkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookRemoteAccess) DeepCopyInto(out *NotebookRemoteAccess) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookRemoteAccess.
+func (in *NotebookRemoteAccess) DeepCopy() *NotebookRemoteAccess {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookRemoteAccess)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookRemoteAccessStatus) DeepCopyInto(out *NotebookRemoteAccessStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookRemoteAccessStatus.
+func (in *NotebookRemoteAccessStatus) DeepCopy() *NotebookRemoteAccessStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookRemoteAccessStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookReplicaStatus) DeepCopyInto(out *NotebookReplicaStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookReplicaStatus.
+func (in *NotebookReplicaStatus) DeepCopy() *NotebookReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookSchedule) DeepCopyInto(out *NotebookSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSchedule.
+func (in *NotebookSchedule) DeepCopy() *NotebookSchedule {
 	if in == nil {
 		return nil
 	}
-	out := new(Notebook)
+	out := new(NotebookSchedule)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *Notebook) DeepCopyObject() runtime.Object {
+func (in *NotebookSchedule) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -52,58 +541,269 @@ func (in *Notebook) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NotebookCondition) DeepCopyInto(out *NotebookCondition) {
+func (in *NotebookScheduleList) DeepCopyInto(out *NotebookScheduleList) {
 	*out = *in
-	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NotebookSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookCondition.
-func (in *NotebookCondition) DeepCopy() *NotebookCondition {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookScheduleList.
+func (in *NotebookScheduleList) DeepCopy() *NotebookScheduleList {
 	if in == nil {
 		return nil
 	}
-	out := new(NotebookCondition)
+	out := new(NotebookScheduleList)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NotebookScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NotebookList) DeepCopyInto(out *NotebookList) {
+func (in *NotebookScheduleSpec) DeepCopyInto(out *NotebookScheduleSpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookScheduleSpec.
+func (in *NotebookScheduleSpec) DeepCopy() *NotebookScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookScheduleStatus) DeepCopyInto(out *NotebookScheduleStatus) {
+	*out = *in
+	if in.LastStartTime != nil {
+		in, out := &in.LastStartTime, &out.LastStartTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastStopTime != nil {
+		in, out := &in.LastStopTime, &out.LastStopTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextStartTime != nil {
+		in, out := &in.NextStartTime, &out.NextStartTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextStopTime != nil {
+		in, out := &in.NextStopTime, &out.NextStopTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookScheduleStatus.
+func (in *NotebookScheduleStatus) DeepCopy() *NotebookScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookSnapshot) DeepCopyInto(out *NotebookSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSnapshot.
+func (in *NotebookSnapshot) DeepCopy() *NotebookSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NotebookSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookSnapshotList) DeepCopyInto(out *NotebookSnapshotList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]Notebook, len(*in))
+		*out = make([]NotebookSnapshot, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookList.
-func (in *NotebookList) DeepCopy() *NotebookList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSnapshotList.
+func (in *NotebookSnapshotList) DeepCopy() *NotebookSnapshotList {
 	if in == nil {
 		return nil
 	}
-	out := new(NotebookList)
+	out := new(NotebookSnapshotList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *NotebookList) DeepCopyObject() runtime.Object {
+func (in *NotebookSnapshotList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookSnapshotSpec) DeepCopyInto(out *NotebookSnapshotSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSnapshotSpec.
+func (in *NotebookSnapshotSpec) DeepCopy() *NotebookSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookSnapshotStatus) DeepCopyInto(out *NotebookSnapshotStatus) {
+	*out = *in
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]NotebookSnapshotVolume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSnapshotStatus.
+func (in *NotebookSnapshotStatus) DeepCopy() *NotebookSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookSnapshotVolume) DeepCopyInto(out *NotebookSnapshotVolume) {
+	*out = *in
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]corev1.PersistentVolumeAccessMode, len(*in))
+		copy(*out, *in)
+	}
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		*out = new(resource.Quantity)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSnapshotVolume.
+func (in *NotebookSnapshotVolume) DeepCopy() *NotebookSnapshotVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookSnapshotVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NotebookSpec) DeepCopyInto(out *NotebookSpec) {
 	*out = *in
 	in.Template.DeepCopyInto(&out.Template)
+	if in.Culling != nil {
+		in, out := &in.Culling, &out.Culling
+		*out = new(CullingSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Workers != nil {
+		in, out := &in.Workers, &out.Workers
+		*out = new(NotebookWorkersSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make([]NotebookVolumeClaimTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CloneFrom != nil {
+		in, out := &in.CloneFrom, &out.CloneFrom
+		*out = new(NotebookCloneSource)
+		**out = **in
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NotebookNetworkPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RemoteAccess != nil {
+		in, out := &in.RemoteAccess, &out.RemoteAccess
+		*out = new(NotebookRemoteAccess)
+		**out = **in
+	}
+	if in.Apps != nil {
+		in, out := &in.Apps, &out.Apps
+		*out = make([]NotebookApp, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSpec.
@@ -121,12 +821,49 @@ func (in *NotebookStatus) DeepCopyInto(out *NotebookStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]NotebookCondition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 	in.ContainerState.DeepCopyInto(&out.ContainerState)
+	if in.StoppedAt != nil {
+		in, out := &in.StoppedAt, &out.StoppedAt
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Culling != nil {
+		in, out := &in.Culling, &out.Culling
+		*out = new(NotebookCullingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Idleness != nil {
+		in, out := &in.Idleness, &out.Idleness
+		*out = new(NotebookIdlenessStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Workers != nil {
+		in, out := &in.Workers, &out.Workers
+		*out = new(NotebookWorkersStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VolumeClaims != nil {
+		in, out := &in.VolumeClaims, &out.VolumeClaims
+		*out = make([]NotebookVolumeClaimStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RemoteAccess != nil {
+		in, out := &in.RemoteAccess, &out.RemoteAccess
+		*out = new(NotebookRemoteAccessStatus)
+		**out = **in
+	}
+	if in.Apps != nil {
+		in, out := &in.Apps, &out.Apps
+		*out = make([]NotebookAppStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookStatus.
@@ -139,9 +876,43 @@ func (in *NotebookStatus) DeepCopy() *NotebookStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookTemplateMetadata) DeepCopyInto(out *NotebookTemplateMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookTemplateMetadata.
+func (in *NotebookTemplateMetadata) DeepCopy() *NotebookTemplateMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookTemplateMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NotebookTemplateSpec) DeepCopyInto(out *NotebookTemplateSpec) {
 	*out = *in
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(NotebookTemplateMetadata)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Spec.DeepCopyInto(&out.Spec)
 }
 
@@ -154,3 +925,109 @@ func (in *NotebookTemplateSpec) DeepCopy() *NotebookTemplateSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookVolumeClaimStatus) DeepCopyInto(out *NotebookVolumeClaimStatus) {
+	*out = *in
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = new(resource.Quantity)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookVolumeClaimStatus.
+func (in *NotebookVolumeClaimStatus) DeepCopy() *NotebookVolumeClaimStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookVolumeClaimStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookVolumeClaimTemplate) DeepCopyInto(out *NotebookVolumeClaimTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookVolumeClaimTemplate.
+func (in *NotebookVolumeClaimTemplate) DeepCopy() *NotebookVolumeClaimTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookVolumeClaimTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookWorkersSpec) DeepCopyInto(out *NotebookWorkersSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookWorkersSpec.
+func (in *NotebookWorkersSpec) DeepCopy() *NotebookWorkersSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookWorkersSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotebookWorkersStatus) DeepCopyInto(out *NotebookWorkersStatus) {
+	*out = *in
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		*out = make([]NotebookReplicaStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookWorkersStatus.
+func (in *NotebookWorkersStatus) DeepCopy() *NotebookWorkersStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotebookWorkersStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusIdlenessProbe) DeepCopyInto(out *PrometheusIdlenessProbe) {
+	*out = *in
+	if in.Threshold != nil {
+		in, out := &in.Threshold, &out.Threshold
+		*out = new(resource.Quantity)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusIdlenessProbe.
+func (in *PrometheusIdlenessProbe) DeepCopy() *PrometheusIdlenessProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusIdlenessProbe)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,166 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// ProbeTokenEnvVar is the environment variable of the notebook container that
+// holds the token of the Token probe authentication. Jupyter servers use it as
+// their token.
+const ProbeTokenEnvVar = "JUPYTER_TOKEN"
+
+// probeTokenSecretKey is the key of the token in its Secret
+const probeTokenSecretKey = "token"
+
+// ProbeTokenLabel is set on the Secrets the controller generates for the
+// tokens of the Notebooks. The cache of the manager only holds the Secrets
+// with this label, so it doesn't watch all the Secrets of the cluster.
+const ProbeTokenLabel = "notebooks.kubeflow.org/culler-token"
+
+// probeTokenSecretName returns the name of the Secret that holds the token of
+// the Notebook
+func probeTokenSecretName(nb *v1beta1.Notebook, auth *v1beta1.IdlenessProbeAuth) string {
+	if auth.SecretName != "" {
+		return auth.SecretName
+	}
+	return nb.Name + "-culler-token"
+}
+
+// probeTokenSecretReader returns the reader of the Secret of the token. The
+// generated Secrets carry ProbeTokenLabel and are read from the cache, while
+// the Secrets of the users aren't cached.
+func probeTokenSecretReader(auth *v1beta1.IdlenessProbeAuth, c client.Client, apiReader client.Reader) client.Reader {
+	if auth.SecretName != "" {
+		return apiReader
+	}
+	return c
+}
+
+// generateProbeTokenSecret returns a Secret with a new random token
+func generateProbeTokenSecret(nb *v1beta1.Notebook, name string) (*corev1.Secret, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: nb.Namespace,
+			Labels:    map[string]string{"notebook-name": nb.Name, ProbeTokenLabel: "true"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{probeTokenSecretKey: []byte(hex.EncodeToString(token))},
+	}, nil
+}
+
+// reconcileProbeToken creates the Secret of the token the culler
+// authenticates to the Notebook with, when its idleness probe uses the Token
+// authentication, and returns its name. Existing Secrets are kept as they are,
+// so the token doesn't change under a running Notebook.
+func (r *NotebookReconciler) reconcileProbeToken(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.NotebookControllerConfig, log logr.Logger) (string, error) {
+	if !cfg.Culling.Enabled {
+		return "", nil
+	}
+	policy, err := resolveCullingPolicy(ctx, r.Client, nb, cfg)
+	if err != nil {
+		return "", err
+	}
+	auth := policy.probe.Auth
+	if auth == nil || auth.Type != v1beta1.IdlenessProbeAuthToken {
+		return "", nil
+	}
+
+	name := probeTokenSecretName(nb, auth)
+	reader := probeTokenSecretReader(auth, r.Client, r.APIReader)
+	err = reader.Get(ctx, types.NamespacedName{Name: name, Namespace: nb.Namespace}, &corev1.Secret{})
+	if err == nil || !apierrs.IsNotFound(err) {
+		return name, err
+	}
+	secret, err := generateProbeTokenSecret(nb, name)
+	if err != nil {
+		return "", err
+	}
+	if err := ctrl.SetControllerReference(nb, secret, r.Scheme); err != nil {
+		return "", err
+	}
+	log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+	if err := r.Create(ctx, secret); err != nil && !apierrs.IsAlreadyExists(err) {
+		return "", err
+	}
+	return name, nil
+}
+
+// setProbeTokenEnvVar sets the token of the Secret as the Jupyter token of the
+// container
+func setProbeTokenEnvVar(container *corev1.Container, secretName string) {
+	env := corev1.EnvVar{
+		Name: ProbeTokenEnvVar,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  probeTokenSecretKey,
+			},
+		},
+	}
+	for i := range container.Env {
+		if container.Env[i].Name == ProbeTokenEnvVar {
+			container.Env[i] = env
+			return
+		}
+	}
+	container.Env = append(container.Env, env)
+}
+
+// probeAuthorization returns the Authorization header the probes of the
+// policy send to the Notebook, or an empty string if they are unauthenticated.
+// The token is specific to the Notebook, so a Notebook can't replay it
+// against the others.
+func (r *CullingReconciler) probeAuthorization(ctx context.Context, nb *v1beta1.Notebook,
+	policy cullingPolicy) (string, error) {
+	auth := policy.probe.Auth
+	if auth == nil || auth.Type != v1beta1.IdlenessProbeAuthToken {
+		return "", nil
+	}
+
+	name := probeTokenSecretName(nb, auth)
+	secret := &corev1.Secret{}
+	reader := probeTokenSecretReader(auth, r.Client, r.APIReader)
+	if err := reader.Get(ctx, types.NamespacedName{Name: name, Namespace: nb.Namespace}, secret); err != nil {
+		return "", err
+	}
+	token := secret.Data[probeTokenSecretKey]
+	if len(token) == 0 {
+		return "", fmt.Errorf("Secret %s/%s has no %s", nb.Namespace, name, probeTokenSecretKey)
+	}
+	return "token " + string(token), nil
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func newTestProbeAuth(auth v1beta1.IdlenessProbeAuthType) *v1beta1.CullingSettings {
+	return &v1beta1.CullingSettings{
+		Probe: &v1beta1.IdlenessProbe{Auth: &v1beta1.IdlenessProbeAuth{Type: auth}},
+	}
+}
+
+// cachedOnlyReader fails the test on reads that should go through the cache
+type cachedOnlyReader struct {
+	t *testing.T
+}
+
+func (r cachedOnlyReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	r.t.Errorf("Unexpected uncached read of %s", key)
+	return fmt.Errorf("uncached read of %s", key)
+}
+
+func (r cachedOnlyReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	r.t.Errorf("Unexpected uncached list")
+	return fmt.Errorf("uncached list")
+}
+
+func TestReconcileProbeToken(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.Culling = newTestProbeAuth(v1beta1.IdlenessProbeAuthToken)
+	r, c := newTestNotebookReconciler(nb)
+	// The generated Secrets are read from the cache
+	r.APIReader = cachedOnlyReader{t}
+	cfg := config.Default()
+
+	// No token is needed while culling is disabled
+	name, err := r.reconcileProbeToken(context.TODO(), nb, cfg, TestLogger)
+	if err != nil || name != "" {
+		t.Fatalf("Got the Secret %q and the error %v, Expected none", name, err)
+	}
+
+	cfg.Culling.Enabled = true
+	name, err = r.reconcileProbeToken(context.TODO(), nb, cfg, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name != "nb-culler-token" {
+		t.Errorf("Got the Secret %q", name)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: "ns"}, secret); err != nil {
+		t.Fatalf("Expected the Secret to exist: %v", err)
+	}
+	token := string(secret.Data[probeTokenSecretKey])
+	if len(token) != 64 || !metav1.IsControlledBy(secret, nb) || secret.Labels[ProbeTokenLabel] != "true" {
+		t.Errorf("Got the Secret %+v", secret)
+	}
+
+	// The token is kept
+	if _, err := r.reconcileProbeToken(context.TODO(), nb, cfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: "ns"}, secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(secret.Data[probeTokenSecretKey]) != token {
+		t.Errorf("Expected the token to be kept")
+	}
+}
+
+func TestSetProbeTokenEnvVar(t *testing.T) {
+	container := &corev1.Container{Env: []corev1.EnvVar{{Name: ProbeTokenEnvVar, Value: "secret"}}}
+	setProbeTokenEnvVar(container, "nb-culler-token")
+	if len(container.Env) != 1 || container.Env[0].Value != "" || container.Env[0].ValueFrom == nil ||
+		container.Env[0].ValueFrom.SecretKeyRef.Name != "nb-culler-token" {
+		t.Errorf("Got the env %+v", container.Env)
+	}
+}
+
+func TestProbeAuthorization(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb-culler-token", Namespace: "ns"},
+		Data:       map[string][]byte{probeTokenSecretKey: []byte("abc")},
+	}
+	// The Secrets of the users aren't cached
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-token", Namespace: "ns"},
+		Data:       map[string][]byte{probeTokenSecretKey: []byte("def")},
+	}
+	scheme := newTestScheme()
+	r := &CullingReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		Log:           TestLogger,
+		Scheme:        scheme,
+		EventRecorder: record.NewFakeRecorder(100),
+		APIReader:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(userSecret).Build(),
+	}
+	cfg := config.Default()
+
+	testCases := []struct {
+		testName      string
+		auth          v1beta1.IdlenessProbeAuthType
+		secretName    string
+		authorization string
+	}{
+		{testName: "None", auth: v1beta1.IdlenessProbeAuthNone, authorization: ""},
+		{testName: "Generated token", auth: v1beta1.IdlenessProbeAuthToken, authorization: "token abc"},
+		{testName: "User token", auth: v1beta1.IdlenessProbeAuthToken, secretName: "my-token", authorization: "token def"},
+	}
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			nb := newTestNotebook("nb")
+			nb.Spec.Culling = newTestProbeAuth(c.auth)
+			nb.Spec.Culling.Probe.Auth.SecretName = c.secretName
+			policy := defaultCullingPolicy(cfg)
+			policy.merge(nb.Spec.Culling)
+			authorization, err := r.probeAuthorization(context.TODO(), nb, policy)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if authorization != c.authorization {
+				t.Errorf("Got the authorization %q, Expected %q", authorization, c.authorization)
+			}
+		})
+	}
+
+	// The Secret of another Notebook doesn't exist yet
+	nb := newTestNotebook("other")
+	nb.Spec.Culling = newTestProbeAuth(v1beta1.IdlenessProbeAuthToken)
+	policy := defaultCullingPolicy(cfg)
+	policy.merge(nb.Spec.Culling)
+	if _, err := r.probeAuthorization(context.TODO(), nb, policy); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// namespaceBusyRetryPeriod is how long the check of a Notebook waits, on
+// average, when the namespace already has as many checks in flight as it's
+// allowed to
+const namespaceBusyRetryPeriod = time.Second
+
+// namespaceLimiter bounds the number of concurrent checks per namespace, so
+// the Notebooks of a namespace with many, or many unreachable, Notebooks can't
+// take up all the workers of the culler. The zero value is ready to use.
+type namespaceLimiter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+// tryAcquire reserves a check for the namespace, unless limit checks are
+// already in flight
+func (l *namespaceLimiter) tryAcquire(ns string, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight == nil {
+		l.inFlight = map[string]int{}
+	}
+	if l.inFlight[ns] >= limit {
+		return false
+	}
+	l.inFlight[ns]++
+	return true
+}
+
+// release ends a check reserved with tryAcquire
+func (l *namespaceLimiter) release(ns string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight[ns]--
+	if l.inFlight[ns] <= 0 {
+		delete(l.inFlight, ns)
+	}
+}
+
+// probeBackoff delays the next check of the Notebooks whose probes failed,
+// e.g. because their server is unreachable, so they don't hold a worker until
+// the probe times out on every check period. The zero value is ready to use.
+type probeBackoff struct {
+	mu    sync.Mutex
+	items map[types.NamespacedName]probeBackoffItem
+}
+
+type probeBackoffItem struct {
+	failures int
+	retryAt  time.Time
+}
+
+// retryAt returns the time the Notebook can be probed again, if its last
+// probes failed
+func (b *probeBackoff) retryAt(key types.NamespacedName) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, ok := b.items[key]
+	return item.retryAt, ok
+}
+
+// failed records a failed probe of the Notebook and returns how long to wait
+// before the next one. The delay starts at the check period and doubles with
+// every consecutive failure, up to max.
+func (b *probeBackoff) failed(key types.NamespacedName, checkPeriod, max time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.items == nil {
+		b.items = map[types.NamespacedName]probeBackoffItem{}
+	}
+	item := b.items[key]
+	delay := checkPeriod
+	for i := 0; i < item.failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	item.failures++
+	item.retryAt = time.Now().Add(delay)
+	b.items[key] = item
+	return delay
+}
+
+// forget resets the backoff of the Notebook, after a successful probe or when
+// it's no longer probed
+func (b *probeBackoff) forget(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.items, key)
+}
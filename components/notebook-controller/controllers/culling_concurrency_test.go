@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func TestNamespaceLimiter(t *testing.T) {
+	l := &namespaceLimiter{}
+	if !l.tryAcquire("a", 2) || !l.tryAcquire("a", 2) {
+		t.Fatalf("Expected 2 checks to be allowed in namespace a")
+	}
+	if l.tryAcquire("a", 2) {
+		t.Errorf("Expected a third check to be refused in namespace a")
+	}
+	if !l.tryAcquire("b", 2) {
+		t.Errorf("Expected the checks of namespace b not to be limited by namespace a")
+	}
+	l.release("a")
+	if !l.tryAcquire("a", 2) {
+		t.Errorf("Expected a check to be allowed in namespace a once another one is released")
+	}
+}
+
+func TestProbeBackoff(t *testing.T) {
+	b := &probeBackoff{}
+	key := types.NamespacedName{Name: "nb", Namespace: "ns"}
+	if _, ok := b.retryAt(key); ok {
+		t.Fatalf("Expected no backoff before a failure")
+	}
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, e := range expected {
+		if delay := b.failed(key, time.Minute, 5*time.Minute); delay != e {
+			t.Errorf("Got delay %s after %d failures, Expected %s", delay, i+1, e)
+		}
+	}
+	if retryAt, ok := b.retryAt(key); !ok || time.Until(retryAt) <= 4*time.Minute {
+		t.Errorf("Got retry time %s", retryAt)
+	}
+
+	b.forget(key)
+	if _, ok := b.retryAt(key); ok {
+		t.Errorf("Expected the backoff to be reset")
+	}
+}
+
+// hangingProbe never responds before its context is done
+type hangingProbe struct{}
+
+func (hangingProbe) activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error) {
+	<-ctx.Done()
+	return notebookActivity{}, ctx.Err()
+}
+
+func TestProbeIdlenessTimeout(t *testing.T) {
+	lastActivity := metav1.NewTime(time.Date(2022, 8, 31, 10, 0, 0, 0, time.UTC))
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "ns"},
+		Status: v1beta1.NotebookStatus{
+			Idleness: &v1beta1.NotebookIdlenessStatus{LastActivity: &lastActivity},
+		},
+	}
+	cfg := config.Default()
+	cfg.Culling.ProbeTimeout.Duration = 10 * time.Millisecond
+	r := &CullingReconciler{Log: TestLogger}
+
+	start := time.Now()
+	idleness, err := r.probeIdleness(context.TODO(), nb, hangingProbe{}, defaultCullingPolicy(cfg), cfg)
+	if err == nil {
+		t.Fatalf("Expected the probe to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the probe to time out after 10ms, took %s", elapsed)
+	}
+	if idleness.LastCheckTime == nil || !idleness.LastActivity.Equal(&lastActivity) {
+		t.Errorf("Expected the last activity to be kept and the check to be recorded, got %+v", idleness)
+	}
+}
@@ -2,52 +2,46 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"os"
-	"strconv"
+	"math"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
 	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/metrics"
 )
 
-// The constants with name 'DEFAULT_{ENV_Var}' are the default values to be
-// used, if the respective ENV vars are not present.
-// All the time numbers correspond to minutes.
-
-const DEFAULT_CULL_IDLE_TIME = "1440" // One day
-const DEFAULT_IDLENESS_CHECK_PERIOD = "1"
-const DEFAULT_ENABLE_CULLING = "false"
-const DEFAULT_CLUSTER_DOMAIN = "cluster.local"
-const DEFAULT_DEV = "false"
-
-var CULL_IDLE_TIME = 0
-var ENABLE_CULLING = false
-var IDLENESS_CHECK_PERIOD = 0
-var CLUSTER_DOMAIN = ""
-var DEV = false
-
-// When a Resource should be stopped/culled, then the controller should add this
-// annotation in the Resource's Metadata. Then, inside the reconcile loop,
-// the controller must check if this annotation is set and then apply the
-// respective culling logic for that Resource. The value of the annotation will
-// be a timestamp of when the Resource was stopped/culled.
+// STOP_ANNOTATION is the legacy way of stopping a Resource. The value of the
+// annotation is a timestamp of when the Resource was stopped/culled.
 //
 // In case of Notebooks, the controller will reduce the replicas to 0 if
-// this annotation is set. If it's not set, then it will make the replicas 1.
+// this annotation is set or if spec.state is Stopped. The annotation is still
+// honored for a migration period and will be removed in a future release.
+// Until then, the culler keeps setting it on the Notebooks that don't set
+// spec.state, so that the clients that remove it to start a Notebook keep
+// working.
 const STOP_ANNOTATION = "kubeflow-resource-stopped"
+
+// LAST_ACTIVITY_ANNOTATION and LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION are the
+// legacy way of reporting the idleness of a Notebook, which is now reported in
+// status.idleness. The culler only sets them if culling.idlenessAnnotations is
+// set in the configuration, for the clients that still read them.
 const LAST_ACTIVITY_ANNOTATION = "notebooks.kubeflow.org/last-activity"
 const LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION = "notebooks.kubeflow.org/last_activity_check_timestamp"
 
@@ -68,11 +62,21 @@ type KernelStatus struct {
 }
 
 // CullingReconciler : Type of a reconciler that will be culling idle notebooks
+//
+// +kubebuilder:rbac:groups=kubeflow.org,resources=cullingpolicies,verbs=get;list;watch
 type CullingReconciler struct {
 	client.Client
-	Log     logr.Logger
-	Scheme  *runtime.Scheme
-	Metrics *metrics.Metrics
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	Metrics       *metrics.Metrics
+	EventRecorder record.EventRecorder
+	Config        *config.Provider
+	// APIReader reads the objects that aren't cached, like the Secrets of
+	// the users
+	APIReader client.Reader
+
+	limiter namespaceLimiter
+	backoff probeBackoff
 }
 
 func (r *CullingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -85,18 +89,50 @@ func (r *CullingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification), and we can get them
 		// on deleted requests.
+		r.backoff.forget(req.NamespacedName)
 		return ctrl.Result{}, nil
 	} else if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Resolve the culling policy of the Notebook and report it in its status
+	cfg := r.Config.Get()
+	policy, err := resolveCullingPolicy(ctx, r.Client, instance, cfg)
+	if err != nil {
+		log.Error(err, "Could not resolve the culling policy")
+		return ctrl.Result{}, err
+	}
+	err = r.updateCullingStatus(ctx, instance, policy)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Won't check for culling when a Notebook is being culled/stopped
-	// Remove LAST_ACTIVITY_ANNOTATION and LAST_ACTIVITY_TIMESTAMP_CHECK
-	// annotations for CR objects
-	if StopAnnotationIsSet(instance.ObjectMeta) {
+	// Remove the idleness of the Notebook from its status
+	if notebookIsStopped(instance) {
 		log.Info("Notebook is already stopping")
-		removeAnnotations(&instance.ObjectMeta, r.Log)
-		err = r.Update(ctx, instance)
+		r.backoff.forget(req.NamespacedName)
+		err = r.cancelCulling(ctx, instance, "Notebook was stopped")
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.clearIdleness(ctx, instance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Won't check for culling when the Notebook is exempt. A change to the
+	// Notebook or to a CullingPolicy in its namespace triggers a new check.
+	if policy.exempt {
+		log.Info("Notebook is exempt from culling")
+		r.backoff.forget(req.NamespacedName)
+		err = r.cancelCulling(ctx, instance, "Notebook is exempt from culling")
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.clearIdleness(ctx, instance)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -107,10 +143,8 @@ func (r *CullingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	foundPod := &corev1.Pod{}
 	err = r.Get(ctx, types.NamespacedName{Name: instance.Name + "-0", Namespace: instance.Namespace}, foundPod)
 	if err != nil && apierrs.IsNotFound(err) {
-		log.Info("Pod not found...Will remove last-activity annotation...")
-
-		removeAnnotations(&instance.ObjectMeta, r.Log)
-		err = r.Update(ctx, instance)
+		log.Info("Pod not found...Will remove the idleness status...")
+		err = r.clearIdleness(ctx, instance)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -120,124 +154,156 @@ func (r *CullingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	// Initialize culling (last-activity and last-activity-check-timestamp) annotations
-	if !annotationsExist(instance) {
-		log.Info("No annotations found. Initializing last-activity and last-activity-check-timestamp annotations")
-		initializeAnnotations(&instance.ObjectMeta)
-		err = r.Update(ctx, instance)
+	// Initialize the idleness status (last activity and last check time)
+	if instance.Status.Idleness == nil {
+		log.Info("No idleness status found. Initializing the last activity and the last check time")
+		err = r.updateIdleness(ctx, instance, initialIdleness(instance.ObjectMeta, policy.probe.Type))
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	// Check if culling period has passed (IDLENESS_CHECK_PERIOD ~ default 1 min)
-	if !cullingCheckPeriodHasPassed(instance.ObjectMeta, r.Log) {
+	// Check if culling period has passed (culling.checkPeriod ~ default 1 min)
+	if !cullingCheckPeriodHasPassed(instance.Status.Idleness, policy.checkPeriod, r.Log) {
 		log.Info("Not enough time has passed. Won't check for culling.")
-		return ctrl.Result{RequeueAfter: getRequeueTime()}, nil
+		return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
+	}
+
+	// Back off from Notebooks whose probes keep failing
+	if retryAt, ok := r.backoff.retryAt(req.NamespacedName); ok && time.Now().Before(retryAt) {
+		log.Info(fmt.Sprintf("Previous probes failed. Won't check for culling before %s", retryAt.Format(time.RFC3339)))
+		return ctrl.Result{RequeueAfter: time.Until(retryAt)}, nil
+	}
+
+	// Won't check for culling if the Notebook's activity can't be probed
+	authorization, err := r.probeAuthorization(ctx, instance, policy)
+	if err != nil {
+		log.Error(err, "Could not authenticate the idleness probe. Won't check for culling.")
+		return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
+	}
+	probe, err := newIdlenessProbe(policy.probe, cfg, authorization)
+	if err != nil {
+		log.Error(err, "Invalid idleness probe. Won't check for culling.")
+		return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
 	}
 
-	// Update the LAST_ACTIVITY_ANNOTATION and LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION
-	updateNotebookLastActivityAnnotation(&instance.ObjectMeta, r.Log)
-	updateLastCullingCheckTimestampAnnotation(&instance.ObjectMeta, r.Log)
-	// Always keep track of the last time we checked for culling
-	err = r.Update(ctx, instance)
+	// Probe the Notebook and always keep track of the last time we checked
+	// for culling. The namespace only gets its share of the workers.
+	if !r.limiter.tryAcquire(instance.Namespace, cfg.Culling.MaxConcurrentChecksPerNamespace) {
+		log.Info("Too many checks in flight in the namespace. Will check for culling later.")
+		return ctrl.Result{RequeueAfter: wait.Jitter(namespaceBusyRetryPeriod, 1)}, nil
+	}
+	idleness, err := r.probeIdleness(ctx, instance, probe, policy, cfg)
+	r.limiter.release(instance.Namespace)
+	if err != nil {
+		delay := r.backoff.failed(req.NamespacedName, policy.checkPeriod, cfg.Culling.MaxProbeBackoff.Duration)
+		log.Error(err, fmt.Sprintf("Could not probe the Notebook's activity. Will not update the last activity "+
+			"and will probe it again in %s.", delay))
+	} else {
+		r.backoff.forget(req.NamespacedName)
+	}
+	err = r.limitCullingPostponement(ctx, instance, cfg.Culling.MaxPostponement.Duration, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	applyCullingPostponement(instance.ObjectMeta, idleness, r.Log)
+	err = r.updateIdleness(ctx, instance, idleness)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
 	// Check if the Notebook needs to be stopped
-	if notebookIsIdle(instance.ObjectMeta, r.Log) {
-		log.Info(fmt.Sprintf(
-			"Notebook %s/%s needs culling. Updating Notebook CR Annotations...",
-			instance.Namespace, instance.Name))
-
-		// Set Stop Annotation to the Notebook CR
-		setStopAnnotation(&instance.ObjectMeta, r.Metrics, r.Log)
-		err = r.Update(ctx, instance)
+	if !notebookIsIdle(instance, policy.idleTime, r.Log) {
+		// Activity during the grace period cancels the stop
+		err = r.cancelCulling(ctx, instance, "Notebook is active again")
 		if err != nil {
 			return ctrl.Result{}, err
 		}
+		return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
 	}
-	return ctrl.Result{RequeueAfter: getRequeueTime()}, nil
-}
 
-// This function ensures that we run the culling checks every CULLING_CHECK_PERIOD
-// even if in the meantime an update/create/delete event occurs for a Notebook CR.
-func cullingCheckPeriodHasPassed(meta metav1.ObjectMeta, log logr.Logger) bool {
-	if _, ok := meta.GetAnnotations()[LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION]; !ok {
-		log.Info("No last-activity-check-timestamp found in the CR. Won't check for culling")
-		return false
+	inWorkingHours, err := policy.inWorkingHours(time.Now())
+	if err != nil {
+		log.Error(err, "Could not evaluate the working hours of the culling policy")
+		return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
 	}
-	storedTimestamp, _ := time.Parse(time.RFC3339, meta.Annotations[LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION])
-	nextCullingCheck := storedTimestamp.Add(getRequeueTime())
-	currentTime := time.Now()
-
-	return nextCullingCheck.Before(currentTime)
-}
-
-// Culling Logic
-func notebookIsIdle(meta metav1.ObjectMeta, log logr.Logger) bool {
-	// Being idle means that the Notebook can be culled/stopped
-	if meta.GetAnnotations() != nil {
-		if StopAnnotationIsSet(meta) {
-			log.Info("Notebook is already stopping")
-			return false
-		}
-		// Read the current LAST_ACTIVITY_ANNOTATION
-		tempLastActivity := meta.GetAnnotations()[LAST_ACTIVITY_ANNOTATION]
-		LastActivity, err := time.Parse(time.RFC3339, tempLastActivity)
+	if inWorkingHours {
+		log.Info("Notebook is idle, but won't be culled during working hours")
+		err = r.cancelCulling(ctx, instance, "Notebooks are not culled during working hours")
 		if err != nil {
-			log.Error(err, "Error parsing last-activity time")
-			return false
+			return ctrl.Result{}, err
 		}
-
-		timeCap := LastActivity.Add(time.Duration(CULL_IDLE_TIME) * time.Minute)
-		if time.Now().After(timeCap) {
-			return true
+		return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
+	}
+
+	// Warn before stopping the Notebook, if it has a grace period
+	if policy.gracePeriod > 0 {
+		scheduledStopTime := cullingScheduledStopTime(instance)
+		if scheduledStopTime == nil {
+			stopAt := time.Now().Add(policy.gracePeriod)
+			log.Info(fmt.Sprintf("Notebook is idle. Scheduling culling at %s", stopAt.Format(time.RFC3339)))
+			err = r.scheduleCulling(ctx, instance, policy, authorization, stopAt)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
+		}
+		if time.Now().Before(*scheduledStopTime) {
+			log.Info(fmt.Sprintf("Notebook is idle. Culling is scheduled at %s", scheduledStopTime.Format(time.RFC3339)))
+			return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
 		}
 	}
-	return false
-}
 
-func getNotebookApiKernels(nm, ns string, log logr.Logger) []KernelStatus {
-	// Get the Kernels' status from the Server's `/api/kernels` endpoint
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
+	log.Info(fmt.Sprintf(
+		"Notebook %s/%s needs culling. Setting the Notebook CR state to Stopped...",
+		instance.Namespace, instance.Name))
 
-	domain := GetEnvDefault("CLUSTER_DOMAIN", DEFAULT_CLUSTER_DOMAIN)
-	url := fmt.Sprintf(
-		"http://%s.%s.svc.%s/notebook/%s/%s/api/kernels",
-		nm, ns, domain, ns, nm)
-	if GetEnvDefault("DEV", DEFAULT_DEV) != "false" {
-		url = fmt.Sprintf(
-			"http://localhost:8001/api/v1/namespaces/%s/services/%s:http-%s/proxy/notebook/%s/%s/api/kernels",
-			ns, nm, nm, ns, nm)
+	// Stop the Notebook CR and record that it was culled
+	patch := client.MergeFrom(instance.DeepCopy())
+	setStopState(instance, r.Metrics, r.Log)
+	err = r.Patch(ctx, instance, patch)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
-
-	resp, err := client.Get(url)
+	err = r.recordCulling(ctx, instance)
 	if err != nil {
-		log.Error(err, fmt.Sprintf("Error talking to %s", url))
-		return nil
+		return ctrl.Result{}, err
 	}
+	return ctrl.Result{RequeueAfter: policy.checkPeriod}, nil
+}
 
-	// Decode the body
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		log.Info(fmt.Sprintf(
-			"Warning: GET to %s: %d", url, resp.StatusCode))
-		return nil
+// This function ensures that we run the culling checks every CULLING_CHECK_PERIOD
+// even if in the meantime an update/create/delete event occurs for a Notebook CR.
+func cullingCheckPeriodHasPassed(idleness *v1beta1.NotebookIdlenessStatus, checkPeriod time.Duration, log logr.Logger) bool {
+	if idleness == nil || idleness.LastCheckTime == nil {
+		log.Info("No last check time found in the status. Won't check for culling")
+		return false
 	}
+	nextCullingCheck := idleness.LastCheckTime.Add(checkPeriod)
+	currentTime := time.Now()
 
-	var kernels []KernelStatus
+	return nextCullingCheck.Before(currentTime)
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&kernels)
-	if err != nil {
-		log.Error(err, "Error parsing JSON response for Notebook API Kernels.")
-		return nil
+// Culling Logic
+func notebookIsIdle(nb *v1beta1.Notebook, idleTime time.Duration, log logr.Logger) bool {
+	// Being idle means that the Notebook can be culled/stopped
+	if StopAnnotationIsSet(nb.ObjectMeta) {
+		log.Info("Notebook is already stopping")
+		return false
+	}
+	idleness := nb.Status.Idleness
+	if idleness == nil || idleness.LastActivity == nil {
+		log.Info("No last activity found in the status")
+		return false
+	}
+	if idleness.Busy {
+		log.Info("Notebook is busy")
+		return false
 	}
 
-	return kernels
+	timeCap := idleness.LastActivity.Add(idleTime)
+	return time.Now().After(timeCap)
 }
 
 func allKernelsAreIdle(kernels []KernelStatus, log logr.Logger) bool {
@@ -254,85 +320,135 @@ func allKernelsAreIdle(kernels []KernelStatus, log logr.Logger) bool {
 	return true
 }
 
-// Update LAST_ACTIVITY_ANNOTATION
-func updateNotebookLastActivityAnnotation(meta *metav1.ObjectMeta, log logr.Logger) {
-
-	log.Info("Updating the last-activity annotation. Checking /api/kernels")
-	nm, ns := meta.GetName(), meta.GetNamespace()
-	kernels := getNotebookApiKernels(nm, ns, log)
-	if kernels == nil {
-		log.Info("Could not GET the kernels status. Will not update last-activity.")
-		return
-	} else if len(kernels) == 0 {
-		log.Info("Notebook has no kernels. Will not update last-activity")
-		return
+// initialIdleness returns the idleness of a Notebook the culler hasn't
+// checked yet. Its last activity is the legacy LAST_ACTIVITY_ANNOTATION, if
+// it's set, so that upgrading the controller doesn't reset the idle time of
+// the Notebooks.
+func initialIdleness(meta metav1.ObjectMeta, probeType v1beta1.IdlenessProbeType) *v1beta1.NotebookIdlenessStatus {
+	now := metav1.Now()
+	lastActivity := now
+	if t, err := time.Parse(time.RFC3339, meta.GetAnnotations()[LAST_ACTIVITY_ANNOTATION]); err == nil {
+		lastActivity = metav1.NewTime(t)
+	}
+	return &v1beta1.NotebookIdlenessStatus{
+		LastActivity:  &lastActivity,
+		LastCheckTime: &now,
+		Probe:         probeType,
 	}
-
-	updateTimestampFromKernelsActivity(meta, kernels, log)
 }
 
-func updateTimestampFromKernelsActivity(meta *metav1.ObjectMeta, kernels []KernelStatus, log logr.Logger) {
-
-	if !allKernelsAreIdle(kernels, log) {
-		// At least on kernel is "busy" so the last-activity annotation should
-		// should be the current time.
-		t := createTimestamp()
-		log.Info(fmt.Sprintf("Found a busy kernel. Updating the last-activity to %s", t))
+// probeIdleness probes the Notebook within the probe timeout and records the
+// latency and the failures of the probe, and how late the check is
+func (r *CullingReconciler) probeIdleness(ctx context.Context, nb *v1beta1.Notebook, probe idlenessProbe,
+	policy cullingPolicy, cfg *config.NotebookControllerConfig) (*v1beta1.NotebookIdlenessStatus, error) {
+	if r.Metrics != nil && nb.Status.Idleness != nil && nb.Status.Idleness.LastCheckTime != nil {
+		due := nb.Status.Idleness.LastCheckTime.Add(policy.checkPeriod)
+		r.Metrics.NotebookCullingCheckDelay.WithLabelValues(nb.Namespace).Observe(math.Max(0, time.Since(due).Seconds()))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Culling.ProbeTimeout.Duration)
+	defer cancel()
+	start := time.Now()
+	idleness, err := probeNotebookIdleness(ctx, nb, probe, policy.probe.Type, r.Log)
+	if r.Metrics != nil {
+		probeType := string(policy.probe.Type)
+		r.Metrics.NotebookProbeDuration.WithLabelValues(nb.Namespace, probeType).Observe(time.Since(start).Seconds())
+		if err != nil {
+			r.Metrics.NotebookProbeFailures.WithLabelValues(nb.Namespace, probeType).Inc()
+		}
+	}
+	return idleness, err
+}
 
-		meta.Annotations[LAST_ACTIVITY_ANNOTATION] = t
-		return
+// probeNotebookIdleness probes the activity of the Notebook and returns its
+// updated idleness. The last activity is kept if the probe fails or reports
+// no activity, and the error of a failed probe is returned along with the
+// idleness.
+func probeNotebookIdleness(ctx context.Context, nb *v1beta1.Notebook, probe idlenessProbe, probeType v1beta1.IdlenessProbeType, log logr.Logger) (*v1beta1.NotebookIdlenessStatus, error) {
+	now := metav1.Now()
+	idleness := &v1beta1.NotebookIdlenessStatus{LastCheckTime: &now, Probe: probeType}
+	if nb.Status.Idleness != nil {
+		idleness.LastActivity = nb.Status.Idleness.LastActivity
 	}
 
-	// Checking for the most recent kernel last_activity. The LAST_ACTIVITY_ANNOTATION
-	// should be the most recent kernel last-activity among the kernels.
-	recentTime, err := time.Parse(time.RFC3339, kernels[0].LastActivity)
+	log.Info("Updating the last activity. Probing the Notebook's activity")
+	activity, err := probe.activity(ctx, nb.Name, nb.Namespace, log)
 	if err != nil {
-		log.Error(err, "Error parsing the last-activity from the /api/kernels")
-		return
+		return idleness, err
 	}
-
-	for i := 1; i < len(kernels); i++ {
-		kernelLastActivity, err := time.Parse(time.RFC3339, kernels[i].LastActivity)
-		if err != nil {
-			log.Error(err, "Error parsing the last-activity from the /api/kernels")
-			return
-		}
-		if kernelLastActivity.After(recentTime) {
-			recentTime = kernelLastActivity
-		}
+	idleness.Busy = activity.busy
+	idleness.Kernels = activity.kernels
+	idleness.BusyKernels = activity.busyKernels
+	if activity.lastActivity == nil {
+		log.Info("Notebook reported no activity. Will not update the last activity")
+		return idleness, nil
 	}
-	t := recentTime.Format(time.RFC3339)
 
-	meta.Annotations[LAST_ACTIVITY_ANNOTATION] = t
-	log.Info(fmt.Sprintf("Successfully updated last-activity from latest kernel action, %s", t))
+	lastActivity := metav1.NewTime(activity.lastActivity.Truncate(time.Second))
+	idleness.LastActivity = &lastActivity
+	log.Info(fmt.Sprintf("Successfully updated the last activity to %s", lastActivity.Format(time.RFC3339)))
+	return idleness, nil
 }
 
-func updateLastCullingCheckTimestampAnnotation(meta *metav1.ObjectMeta, log logr.Logger) {
-	t := createTimestamp()
-	if _, ok := meta.GetAnnotations()[LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION]; !ok {
-		log.Info("No last-activity-check-timestamp annotation found. Will not update")
+// updateIdleness writes the idleness of the Notebook to its status and, if
+// culling.idlenessAnnotations is set, to the legacy annotations.
+func (r *CullingReconciler) updateIdleness(ctx context.Context, nb *v1beta1.Notebook, idleness *v1beta1.NotebookIdlenessStatus) error {
+	if !equality.Semantic.DeepEqual(nb.Status.Idleness, idleness) {
+		patch := client.MergeFrom(nb.DeepCopy())
+		nb.Status.Idleness = idleness
+		if err := r.Status().Patch(ctx, nb, patch); err != nil {
+			return err
+		}
+	}
+	if !r.Config.Get().Culling.IdlenessAnnotations {
+		return nil
 	}
-	meta.Annotations[LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION] = t
-	log.Info("Successfully updated last-activity-check-timestamp annotation")
 
-}
+	annotations := map[string]string{}
+	if idleness.LastActivity != nil {
+		annotations[LAST_ACTIVITY_ANNOTATION] = idleness.LastActivity.Format(time.RFC3339)
+	}
+	if idleness.LastCheckTime != nil {
+		annotations[LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION] = idleness.LastCheckTime.Format(time.RFC3339)
+	}
+	changed := false
+	for k, v := range annotations {
+		if nb.Annotations[k] != v {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
 
-func annotationsExist(instance *v1beta1.Notebook) bool {
-	meta := instance.ObjectMeta
-	if metav1.HasAnnotation(meta, LAST_ACTIVITY_ANNOTATION) &&
-		metav1.HasAnnotation(meta, LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION) {
-		return true
+	patch := client.MergeFrom(nb.DeepCopy())
+	if nb.Annotations == nil {
+		nb.Annotations = map[string]string{}
 	}
-	return false
+	for k, v := range annotations {
+		nb.Annotations[k] = v
+	}
+	return r.Patch(ctx, nb, patch)
 }
 
-func initializeAnnotations(meta *metav1.ObjectMeta) {
-	if len(meta.GetAnnotations()) == 0 {
-		meta.SetAnnotations(map[string]string{})
+// clearIdleness removes the idleness from the status of the Notebook, and the
+// legacy annotations if they are set.
+func (r *CullingReconciler) clearIdleness(ctx context.Context, nb *v1beta1.Notebook) error {
+	if nb.Status.Idleness != nil {
+		patch := client.MergeFrom(nb.DeepCopy())
+		nb.Status.Idleness = nil
+		if err := r.Status().Patch(ctx, nb, patch); err != nil {
+			return err
+		}
+	}
+
+	if !metav1.HasAnnotation(nb.ObjectMeta, LAST_ACTIVITY_ANNOTATION) &&
+		!metav1.HasAnnotation(nb.ObjectMeta, LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION) {
+		return nil
 	}
-	t := createTimestamp()
-	meta.Annotations[LAST_ACTIVITY_ANNOTATION] = t
-	meta.Annotations[LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION] = t
+	patch := client.MergeFrom(nb.DeepCopy())
+	removeAnnotations(&nb.ObjectMeta, r.Log)
+	return r.Patch(ctx, nb, patch)
 }
 
 func removeAnnotations(meta *metav1.ObjectMeta, log logr.Logger) {
@@ -351,90 +467,94 @@ func removeAnnotations(meta *metav1.ObjectMeta, log logr.Logger) {
 	}
 }
 
-// Stop Annotation handling functions
-func setStopAnnotation(meta *metav1.ObjectMeta, m *metrics.Metrics, log logr.Logger) {
-	if meta == nil {
-		log.Info("Error: Metadata is Nil. Can't set Annotations")
+// Stop state handling functions
+func setStopState(nb *v1beta1.Notebook, m *metrics.Metrics, log logr.Logger) {
+	if nb == nil {
+		log.Info("Error: Notebook is Nil. Can't set the stop state")
 		return
 	}
 
-	log.Info("Setting stop timestamp annotation")
+	log.Info("Stopping the Notebook")
 	t := time.Now()
-	if len(meta.GetAnnotations()) == 0 {
-		meta.SetAnnotations(map[string]string{})
-	}
-	meta.Annotations[STOP_ANNOTATION] = t.Format(time.RFC3339)
+	markNotebookStopped(nb, t)
 
 	if m != nil {
-		m.NotebookCullingCount.WithLabelValues(meta.Namespace, meta.Name).Inc()
-		m.NotebookCullingTimestamp.WithLabelValues(meta.Namespace, meta.Name).Set(float64(t.Unix()))
+		m.NotebookCullingCount.WithLabelValues(nb.Namespace, nb.Name).Inc()
+		m.NotebookCullingTimestamp.WithLabelValues(nb.Namespace, nb.Name).Set(float64(t.Unix()))
 	}
 }
 
-func StopAnnotationIsSet(meta metav1.ObjectMeta) bool {
-	if meta.GetAnnotations() == nil {
-		return false
+// markNotebookStopped stops the Notebook the way its clients start it again.
+// Notebooks without spec.state are managed through the legacy STOP_ANNOTATION,
+// which the web apps remove to start them, so the annotation is set instead of
+// spec.state.
+func markNotebookStopped(nb *v1beta1.Notebook, t time.Time) {
+	if nb.Spec.State != "" {
+		nb.Spec.State = v1beta1.NotebookStateStopped
+		return
 	}
-	if metav1.HasAnnotation(meta, STOP_ANNOTATION) {
-		return true
+	if nb.Annotations == nil {
+		nb.Annotations = map[string]string{}
 	}
-	return false
+	nb.Annotations[STOP_ANNOTATION] = t.Format(time.RFC3339)
 }
 
-// Some Utility Functions
-func GetEnvDefault(variable string, defaultVal string) string {
-	envVar := os.Getenv(variable)
-	if len(envVar) == 0 {
-		return defaultVal
+// recordCulling marks the Notebook's status as stopped by the culler. A merge
+// patch without optimistic locking is used, so that the culling reason wins
+// over the generic reason the Notebook controller might have written after
+// observing the spec change.
+func (r *CullingReconciler) recordCulling(ctx context.Context, nb *v1beta1.Notebook) error {
+	patch := client.MergeFrom(nb.DeepCopy())
+	now := metav1.Now()
+	nb.Status.StoppedAt = &now
+	nb.Status.StopReason = v1beta1.NotebookStopReasonCulled
+	clearCullingSchedule(nb)
+	if err := r.Status().Patch(ctx, nb, patch); err != nil {
+		return err
 	}
-	return envVar
-}
-
-// Time / Frequency Utility functions
-func createTimestamp() string {
-	now := time.Now()
-	return now.Format(time.RFC3339)
-}
 
-func getRequeueTime() time.Duration {
-	// The frequency in which we check if the Pod needs culling
-	// Uses ENV var: IDLENESS_CHECK_PERIOD
-	return time.Duration(IDLENESS_CHECK_PERIOD) * time.Minute
+	r.EventRecorder.Event(nb, corev1.EventTypeNormal, "Culled",
+		"Notebook was stopped because it was idle")
+	return nil
 }
 
-func initGlobalVars() error {
-	log := logf.Log.WithName("Culler")
-
-	devMode := GetEnvDefault("DEV", DEFAULT_DEV)
-	if devMode == "true" {
-		DEV = true
+// updateCullingStatus reports the effective culling policy in the Notebook's
+// status, if it changed.
+func (r *CullingReconciler) updateCullingStatus(ctx context.Context, nb *v1beta1.Notebook, policy cullingPolicy) error {
+	status := policy.status()
+	if nb.Status.Culling != nil {
+		status.ScheduledStopTime = nb.Status.Culling.ScheduledStopTime
 	}
-
-	idleTime := GetEnvDefault("CULL_IDLE_TIME", DEFAULT_CULL_IDLE_TIME)
-	realIdleTime, err := strconv.Atoi(idleTime)
-	if err != nil {
-		log.Info(fmt.Sprintf(
-			"CULL_IDLE_TIME should be Int. Got %s instead. Using default value.",
-			idleTime))
-		realIdleTime, _ = strconv.Atoi(DEFAULT_CULL_IDLE_TIME)
+	if equality.Semantic.DeepEqual(nb.Status.Culling, status) {
+		return nil
 	}
-	CULL_IDLE_TIME = realIdleTime
 
-	enableCulling := GetEnvDefault("ENABLE_CULLING", DEFAULT_ENABLE_CULLING)
-	if enableCulling == "true" {
-		ENABLE_CULLING = true
-	}
+	patch := client.MergeFrom(nb.DeepCopy())
+	nb.Status.Culling = status
+	return r.Status().Patch(ctx, nb, patch)
+}
 
-	CLUSTER_DOMAIN = GetEnvDefault("CLUSTER_DOMAIN", DEFAULT_CLUSTER_DOMAIN)
+// notebookIsStopped returns true if the Notebook should not be running, either
+// because its spec.state is Stopped or because the legacy STOP_ANNOTATION is
+// set.
+func notebookIsStopped(nb *v1beta1.Notebook) bool {
+	return nb.Spec.State == v1beta1.NotebookStateStopped || StopAnnotationIsSet(nb.ObjectMeta)
+}
 
-	cullPeriod := GetEnvDefault("IDLENESS_CHECK_PERIOD", DEFAULT_IDLENESS_CHECK_PERIOD)
-	period, err := strconv.Atoi(cullPeriod)
-	if err != nil {
-		return err
+func StopAnnotationIsSet(meta metav1.ObjectMeta) bool {
+	if meta.GetAnnotations() == nil {
+		return false
 	}
-	IDLENESS_CHECK_PERIOD = period
+	if metav1.HasAnnotation(meta, STOP_ANNOTATION) {
+		return true
+	}
+	return false
+}
 
-	return nil
+// Time / Frequency Utility functions
+func createTimestamp() string {
+	now := time.Now()
+	return now.Format(time.RFC3339)
 }
 
 // SetupWithManager : Add the culling controller to the manager
@@ -442,18 +562,36 @@ func (r *CullingReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	log := r.Log.WithValues("Culler", "setup")
 
-	if err := initGlobalVars(); err != nil {
-		log.Error(err, "Could not initialize the global variables")
-		return err
-	}
-
-	controller := ctrl.NewControllerManagedBy(mgr).
+	err := ctrl.NewControllerManagedBy(mgr).
 		For(&v1beta1.Notebook{}).
-		Named("Culler")
-
-	err := controller.Complete(r)
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.Get().Culling.MaxConcurrentChecks}).
+		Watches(
+			&source.Kind{Type: &v1beta1.CullingPolicy{}},
+			handler.EnqueueRequestsFromMapFunc(mapCullingPolicyToNotebooks(r.Client, log))).
+		Named("Culler").
+		Complete(r)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// mapCullingPolicyToNotebooks returns a map function that converts
+// CullingPolicy events to reconciliation requests for all the Notebooks in the
+// policy's namespace
+func mapCullingPolicyToNotebooks(c client.Client, log logr.Logger) handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		notebooks := &v1beta1.NotebookList{}
+		if err := c.List(context.Background(), notebooks, client.InNamespace(object.GetNamespace())); err != nil {
+			log.Error(err, "Could not list the Notebooks of CullingPolicy", "namespace", object.GetNamespace())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for _, nb := range notebooks.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: nb.Name, Namespace: nb.Namespace},
+			})
+		}
+		return requests
+	}
+}
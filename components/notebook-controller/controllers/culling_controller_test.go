@@ -1,55 +1,123 @@
 package controllers
 
 import (
-	"os"
+	"context"
 	"testing"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
 )
 
 var TestLogger = logf.Log.WithName("test-logger")
 
-func TestSetStopAnnotation(t *testing.T) {
-	// Test if the annotation gets set
+func TestSetStopState(t *testing.T) {
+	// Test if the state gets set
 	testCases := []struct {
-		testName string
-		meta     *metav1.ObjectMeta
+		testName           string
+		nb                 *v1beta1.Notebook
+		expectedState      v1beta1.NotebookState
+		expectedAnnotation bool
 	}{
 		{
-			testName: "Nil Metadata",
-			meta:     nil,
+			testName: "Nil Notebook",
+			nb:       nil,
 		},
 		{
-			testName: "No existing Annotations",
-			meta:     &metav1.ObjectMeta{},
+			testName:           "No existing state",
+			nb:                 &v1beta1.Notebook{},
+			expectedAnnotation: true,
 		},
 		{
-			testName: "Basic case",
-			meta: &metav1.ObjectMeta{
-				Annotations: map[string]string{},
+			testName: "Running state",
+			nb: &v1beta1.Notebook{
+				Spec: v1beta1.NotebookSpec{State: v1beta1.NotebookStateRunning},
 			},
+			expectedState: v1beta1.NotebookStateStopped,
 		},
 		{
-			testName: "Annotation is already set",
-			meta: &metav1.ObjectMeta{
-				Annotations: map[string]string{
-					STOP_ANNOTATION: createTimestamp(),
-				},
+			testName: "State is already Stopped",
+			nb: &v1beta1.Notebook{
+				Spec: v1beta1.NotebookSpec{State: v1beta1.NotebookStateStopped},
 			},
+			expectedState: v1beta1.NotebookStateStopped,
 		},
 	}
 
 	for _, c := range testCases {
 		t.Run(c.testName, func(t *testing.T) {
-			setStopAnnotation(c.meta, nil, TestLogger)
-			if c.meta == nil {
+			setStopState(c.nb, nil, TestLogger)
+			if c.nb == nil {
 				return
 			}
 
-			if _, ok := c.meta.Annotations[STOP_ANNOTATION]; !ok {
-				t.Errorf("StopAnnotation not set for case: %+v", c)
+			if !notebookIsStopped(c.nb) {
+				t.Errorf("Notebook not stopped for case: %+v", c)
+			}
+			if c.nb.Spec.State != c.expectedState {
+				t.Errorf("Got state %q, Expected %q", c.nb.Spec.State, c.expectedState)
+			}
+			if StopAnnotationIsSet(c.nb.ObjectMeta) != c.expectedAnnotation {
+				t.Errorf("Got StopAnnotation %v, Expected %v", StopAnnotationIsSet(c.nb.ObjectMeta), c.expectedAnnotation)
+			}
+
+			// Removing the annotation starts the Notebooks stopped through it
+			delete(c.nb.Annotations, STOP_ANNOTATION)
+			if notebookIsStopped(c.nb) != (c.expectedState == v1beta1.NotebookStateStopped) {
+				t.Errorf("Got stopped %v after removing the annotation", notebookIsStopped(c.nb))
+			}
+		})
+	}
+}
+
+func TestNotebookIsStopped(t *testing.T) {
+	testCases := []struct {
+		testName string
+		nb       *v1beta1.Notebook
+		result   bool
+	}{
+		{
+			testName: "No state and no annotation",
+			nb:       &v1beta1.Notebook{},
+			result:   false,
+		},
+		{
+			testName: "Running state",
+			nb: &v1beta1.Notebook{
+				Spec: v1beta1.NotebookSpec{State: v1beta1.NotebookStateRunning},
+			},
+			result: false,
+		},
+		{
+			testName: "Stopped state",
+			nb: &v1beta1.Notebook{
+				Spec: v1beta1.NotebookSpec{State: v1beta1.NotebookStateStopped},
+			},
+			result: true,
+		},
+		{
+			testName: "Legacy stop annotation",
+			nb: &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						STOP_ANNOTATION: createTimestamp(),
+					},
+				},
+			},
+			result: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			if notebookIsStopped(c.nb) != c.result {
+				t.Errorf("Wrong result for case: %+v", c)
 			}
 		})
 	}
@@ -141,123 +209,160 @@ func TestAllKernelsAreIdle(t *testing.T) {
 }
 
 func TestNotebookIsIdle(t *testing.T) {
-	// Test if the annotation gets set
+	idleness := func(lastActivity time.Time, busy bool) v1beta1.NotebookStatus {
+		return v1beta1.NotebookStatus{
+			Idleness: &v1beta1.NotebookIdlenessStatus{
+				LastActivity: &metav1.Time{Time: lastActivity},
+				Busy:         busy,
+			},
+		}
+	}
 	testCases := []struct {
 		testName string
-		meta     metav1.ObjectMeta
-		env      map[string]string
+		nb       v1beta1.Notebook
+		idleTime time.Duration
 		result   bool
 	}{
 		{
-			testName: "No existing Annotations",
-			meta:     metav1.ObjectMeta{},
-			env:      map[string]string{},
+			testName: "No idleness status",
+			nb:       v1beta1.Notebook{},
 			result:   false,
 		},
 		{
-			testName: "Basic case",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{},
+			testName: "Last activity is not set",
+			nb: v1beta1.Notebook{
+				Status: v1beta1.NotebookStatus{Idleness: &v1beta1.NotebookIdlenessStatus{}},
 			},
-			env:    map[string]string{},
 			result: false,
 		},
 		{
 			testName: "Stop Annotation already set",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					STOP_ANNOTATION: time.Now().Format(time.RFC3339),
+			nb: v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						STOP_ANNOTATION: time.Now().Format(time.RFC3339),
+					},
 				},
+				Status: idleness(time.Date(2021, 8, 30, 15, 37, 36, 0, time.UTC), false),
 			},
-			env:    map[string]string{},
 			result: false,
 		},
 		{
-			testName: "LAST_ACTIVITY_ANNOTATION is not set",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{},
+			testName: "Last activity is old",
+			nb: v1beta1.Notebook{
+				Status: idleness(time.Date(2021, 8, 30, 15, 37, 36, 0, time.UTC), false),
 			},
-			env:    map[string]string{},
-			result: false,
-		},
-		{
-			testName: "LAST_ACTIVITY_ANNOTATION is not RF3339",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					LAST_ACTIVITY_ANNOTATION: "should-fail",
-				},
-			},
-			env:    map[string]string{},
-			result: false,
-		},
-		{
-			testName: "LAST_ACTIVITY_ANNOTATION is old",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					LAST_ACTIVITY_ANNOTATION: "2021-08-30T15:37:36.990063Z",
-				},
-			},
-			env:    map[string]string{},
 			result: true,
 		},
 		{
-			testName: "LAST_ACTIVITY_ANNOTATION is too old",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					LAST_ACTIVITY_ANNOTATION: "1900-08-30T15:37:36.990063Z",
-				},
+			testName: "Last activity is too old",
+			nb: v1beta1.Notebook{
+				Status: idleness(time.Date(1900, 8, 30, 15, 37, 36, 0, time.UTC), false),
 			},
-			env:    map[string]string{},
 			result: true,
 		},
 		{
-			testName: "LAST_ACTIVITY_ANNOTATION is the current time",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					LAST_ACTIVITY_ANNOTATION: time.Now().Format(time.RFC3339),
-				},
-			},
-			env: map[string]string{
-				"CULL_IDLE_TIME": "5",
+			testName: "Last activity is old, but the Notebook is busy",
+			nb: v1beta1.Notebook{
+				Status: idleness(time.Date(2021, 8, 30, 15, 37, 36, 0, time.UTC), true),
 			},
 			result: false,
 		},
 		{
-			testName: "LAST_ACTIVITY_ANNOTATION is 1 minute MORE than the deadline.",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					LAST_ACTIVITY_ANNOTATION: time.Now().Add(-6 * time.Minute).Format(time.RFC3339),
-				},
-			},
-			env: map[string]string{
-				"CULL_IDLE_TIME": "5",
+			testName: "Last activity is the current time",
+			nb: v1beta1.Notebook{
+				Status: idleness(time.Now(), false),
 			},
-			result: true,
+			idleTime: 5 * time.Minute,
+			result:   false,
 		},
 		{
-			testName: "LAST_ACTIVITY_ANNOTATION is 1 minute LESS than the deadline.",
-			meta: metav1.ObjectMeta{
-				Annotations: map[string]string{
-					LAST_ACTIVITY_ANNOTATION: time.Now().Add(-3 * time.Minute).Format(time.RFC3339),
-				},
+			testName: "Last activity is 1 minute MORE than the deadline.",
+			nb: v1beta1.Notebook{
+				Status: idleness(time.Now().Add(-6*time.Minute), false),
 			},
-			env: map[string]string{
-				"CULL_IDLE_TIME": "5",
+			idleTime: 5 * time.Minute,
+			result:   true,
+		},
+		{
+			testName: "Last activity is 1 minute LESS than the deadline.",
+			nb: v1beta1.Notebook{
+				Status: idleness(time.Now().Add(-3*time.Minute), false),
 			},
-			result: false,
+			idleTime: 5 * time.Minute,
+			result:   false,
 		},
 	}
 
 	for _, c := range testCases {
 		t.Run(c.testName, func(t *testing.T) {
-			for envVar, val := range c.env {
-				os.Setenv(envVar, val)
+			cfg := config.Default()
+			if c.idleTime != 0 {
+				cfg.Culling.IdleTime.Duration = c.idleTime
 			}
-			initGlobalVars()
-			if notebookIsIdle(c.meta, TestLogger) != c.result {
-				t.Errorf("ENV VAR: %+v\n", c.env)
-				t.Errorf("Wrong result for case object: %+v\n", c.meta)
+			if notebookIsIdle(&c.nb, defaultCullingPolicy(cfg).idleTime, TestLogger) != c.result {
+				t.Errorf("Idle time: %s\n", cfg.Culling.IdleTime.Duration)
+				t.Errorf("Wrong result for case object: %+v\n", c.nb.Status)
 			}
 		})
 	}
 }
+
+func TestUpdateAndClearIdleness(t *testing.T) {
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nb",
+			Namespace: "ns",
+			Annotations: map[string]string{
+				LAST_ACTIVITY_ANNOTATION: "2022-08-31T10:00:00Z",
+			},
+		},
+	}
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+	cfg := config.Default()
+	cfg.Culling.IdlenessAnnotations = true
+	r := &CullingReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(nb).Build(),
+		Log:    TestLogger,
+		Scheme: scheme,
+		Config: config.NewProvider(cfg),
+	}
+	get := func() *v1beta1.Notebook {
+		t.Helper()
+		found := &v1beta1.Notebook{}
+		if err := r.Get(context.TODO(), client.ObjectKeyFromObject(nb), found); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return found
+	}
+
+	// The last activity is migrated from the legacy annotation
+	idleness := initialIdleness(nb.ObjectMeta, v1beta1.IdlenessProbeJupyterKernels)
+	if got := idleness.LastActivity.UTC().Format(time.RFC3339); got != "2022-08-31T10:00:00Z" {
+		t.Errorf("Got last activity %s, Expected the one of the annotation", got)
+	}
+
+	if err := r.updateIdleness(context.TODO(), nb, idleness); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	found := get()
+	if found.Status.Idleness == nil || found.Status.Idleness.Probe != v1beta1.IdlenessProbeJupyterKernels {
+		t.Errorf("Got idleness %+v, Expected it to be set", found.Status.Idleness)
+	}
+	if !metav1.HasAnnotation(found.ObjectMeta, LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION) {
+		t.Errorf("Expected the compatibility annotations to be set")
+	}
+
+	if err := r.clearIdleness(context.TODO(), found); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	found = get()
+	if found.Status.Idleness != nil {
+		t.Errorf("Got idleness %+v, Expected it to be removed", found.Status.Idleness)
+	}
+	if metav1.HasAnnotation(found.ObjectMeta, LAST_ACTIVITY_ANNOTATION) ||
+		metav1.HasAnnotation(found.ObjectMeta, LAST_ACTIVITY_CHECK_TIMESTAMP_ANNOTATION) {
+		t.Errorf("Expected the legacy annotations to be removed, got %v", found.Annotations)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// cullingPolicy is the effective culling configuration of a Notebook
+type cullingPolicy struct {
+	// name of the CullingPolicy that matched the Notebook, if any
+	name         string
+	idleTime     time.Duration
+	checkPeriod  time.Duration
+	exempt       bool
+	workingHours []v1beta1.CullingWindow
+	probe        v1beta1.IdlenessProbe
+	gracePeriod  time.Duration
+	warningPath  string
+	webhookURL   string
+}
+
+var weekdays = map[v1beta1.Weekday]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// defaultCullingPolicy returns the controller-wide culling settings of the
+// configuration.
+func defaultCullingPolicy(cfg *config.NotebookControllerConfig) cullingPolicy {
+	return cullingPolicy{
+		idleTime:    cfg.Culling.IdleTime.Duration,
+		checkPeriod: cfg.Culling.CheckPeriod.Duration,
+		gracePeriod: cfg.Culling.GracePeriod.Duration,
+		probe:       v1beta1.IdlenessProbe{Type: v1beta1.IdlenessProbeJupyterKernels},
+	}
+}
+
+// merge overrides the policy with the fields that are set in s
+func (p *cullingPolicy) merge(s *v1beta1.CullingSettings) {
+	if s == nil {
+		return
+	}
+	// Non-positive durations are rejected by the CRDs and the webhooks, and
+	// are ignored if they were stored anyway
+	if s.IdleTime != nil && s.IdleTime.Duration > 0 {
+		p.idleTime = s.IdleTime.Duration
+	}
+	if s.CheckPeriod != nil && s.CheckPeriod.Duration > 0 {
+		p.checkPeriod = s.CheckPeriod.Duration
+	}
+	if s.Exempt != nil {
+		p.exempt = *s.Exempt
+	}
+	if s.WorkingHours != nil {
+		p.workingHours = s.WorkingHours
+	}
+	if s.GracePeriod != nil && s.GracePeriod.Duration >= 0 {
+		p.gracePeriod = s.GracePeriod.Duration
+	}
+	if s.Warning != nil {
+		p.warningPath = s.Warning.NotebookPath
+	}
+	if s.Probe != nil {
+		p.probe = *s.Probe
+		if p.probe.Type == "" {
+			p.probe.Type = v1beta1.IdlenessProbeJupyterKernels
+		}
+	}
+}
+
+// status returns the policy in the form it's reported in the Notebook's status
+func (p *cullingPolicy) status() *v1beta1.NotebookCullingStatus {
+	exempt := p.exempt
+	status := &v1beta1.NotebookCullingStatus{
+		PolicyName: p.name,
+		CullingSettings: v1beta1.CullingSettings{
+			IdleTime:     &metav1.Duration{Duration: p.idleTime},
+			CheckPeriod:  &metav1.Duration{Duration: p.checkPeriod},
+			Exempt:       &exempt,
+			WorkingHours: p.workingHours,
+			Probe:        p.probe.DeepCopy(),
+			GracePeriod:  &metav1.Duration{Duration: p.gracePeriod},
+		},
+	}
+	if p.warningPath != "" {
+		status.Warning = &v1beta1.CullingWarning{NotebookPath: p.warningPath}
+	}
+	return status
+}
+
+// inWorkingHours returns true if t falls into one of the policy's working
+// hours windows.
+func (p *cullingPolicy) inWorkingHours(t time.Time) (bool, error) {
+	for _, w := range p.workingHours {
+		in, err := windowContains(w, t)
+		if err != nil {
+			return false, err
+		}
+		if in {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// resolveCullingPolicy computes the culling policy of a Notebook by merging,
+// in order, the controller defaults, the matching CullingPolicy of the
+// Notebook's namespace and the Notebook's spec.culling.
+func resolveCullingPolicy(ctx context.Context, c client.Client, nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig) (cullingPolicy, error) {
+	policy := defaultCullingPolicy(cfg)
+
+	policies := &v1beta1.CullingPolicyList{}
+	if err := c.List(ctx, policies, client.InNamespace(nb.Namespace)); err != nil {
+		return policy, err
+	}
+	match, err := matchCullingPolicy(policies.Items, nb)
+	if err != nil {
+		return policy, err
+	}
+	if match != nil {
+		policy.name = match.Name
+		policy.webhookURL = match.Spec.WebhookURL
+		policy.merge(&match.Spec.CullingSettings)
+	}
+
+	// The Prometheus query runs with the access of the controller, so only
+	// administrators can choose it
+	settings := nb.Spec.Culling
+	if settings != nil && settings.Probe != nil && settings.Probe.Prometheus != nil {
+		settings = settings.DeepCopy()
+		settings.Probe.Prometheus.Query = ""
+		if policy.probe.Prometheus != nil {
+			settings.Probe.Prometheus.Query = policy.probe.Prometheus.Query
+		}
+	}
+	policy.merge(settings)
+	return policy, nil
+}
+
+// matchCullingPolicy returns the policy with the highest priority among the
+// ones that select the Notebook. Ties are broken by name.
+func matchCullingPolicy(policies []v1beta1.CullingPolicy, nb *v1beta1.Notebook) (*v1beta1.CullingPolicy, error) {
+	var match *v1beta1.CullingPolicy
+	for i := range policies {
+		p := &policies[i]
+
+		selector := labels.Everything()
+		if p.Spec.Selector != nil {
+			s, err := metav1.LabelSelectorAsSelector(p.Spec.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector in CullingPolicy %s/%s: %v", p.Namespace, p.Name, err)
+			}
+			selector = s
+		}
+		if !selector.Matches(labels.Set(nb.Labels)) {
+			continue
+		}
+
+		if match == nil || p.Spec.Priority > match.Spec.Priority ||
+			(p.Spec.Priority == match.Spec.Priority && p.Name < match.Name) {
+			match = p
+		}
+	}
+	return match, nil
+}
+
+// windowContains returns true if t falls into the window w
+func windowContains(w v1beta1.CullingWindow, t time.Time) (bool, error) {
+	loc := time.UTC
+	if w.TimeZone != "" {
+		l, err := time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return false, err
+		}
+		loc = l
+	}
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false, err
+	}
+
+	t = t.In(loc)
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	day := t.Weekday()
+
+	if start <= end {
+		return dayMatches(w.Days, day) && now >= start && now < end, nil
+	}
+	// The window spans midnight. The part after midnight belongs to the
+	// window that started on the previous day.
+	if now >= start {
+		return dayMatches(w.Days, day), nil
+	}
+	if now < end {
+		return dayMatches(w.Days, (day+6)%7), nil
+	}
+	return false, nil
+}
+
+func dayMatches(days []v1beta1.Weekday, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if weekdays[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses a HH:MM time of the day into the duration since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day %q: %v", clock, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func TestResolveCullingPolicy(t *testing.T) {
+	exempt := true
+
+	gpuPolicy := &v1beta1.CullingPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu", Namespace: "team"},
+		Spec: v1beta1.CullingPolicySpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"accelerator": "gpu"},
+			},
+			Priority: 10,
+			CullingSettings: v1beta1.CullingSettings{
+				IdleTime: &metav1.Duration{Duration: 2 * time.Hour},
+			},
+		},
+	}
+	namespacePolicy := &v1beta1.CullingPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team"},
+		Spec: v1beta1.CullingPolicySpec{
+			CullingSettings: v1beta1.CullingSettings{
+				IdleTime:    &metav1.Duration{Duration: 8 * time.Hour},
+				CheckPeriod: &metav1.Duration{Duration: 5 * time.Minute},
+			},
+		},
+	}
+	otherNamespacePolicy := &v1beta1.CullingPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "other"},
+		Spec: v1beta1.CullingPolicySpec{
+			CullingSettings: v1beta1.CullingSettings{
+				Exempt: &exempt,
+			},
+		},
+	}
+
+	testCases := []struct {
+		testName string
+		nb       *v1beta1.Notebook
+		expected cullingPolicy
+	}{
+		{
+			testName: "No matching policy",
+			nb: &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "empty"},
+			},
+			expected: cullingPolicy{
+				idleTime:    1440 * time.Minute,
+				checkPeriod: time.Minute,
+			},
+		},
+		{
+			testName: "Namespace policy",
+			nb: &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "team"},
+			},
+			expected: cullingPolicy{
+				name:        "default",
+				idleTime:    8 * time.Hour,
+				checkPeriod: 5 * time.Minute,
+			},
+		},
+		{
+			testName: "Policy with the highest priority wins",
+			nb: &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nb",
+					Namespace: "team",
+					Labels:    map[string]string{"accelerator": "gpu"},
+				},
+			},
+			expected: cullingPolicy{
+				name:        "gpu",
+				idleTime:    2 * time.Hour,
+				checkPeriod: time.Minute,
+			},
+		},
+		{
+			testName: "Notebook overrides the policy",
+			nb: &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "team"},
+				Spec: v1beta1.NotebookSpec{
+					Culling: &v1beta1.CullingSettings{
+						Exempt: &exempt,
+					},
+				},
+			},
+			expected: cullingPolicy{
+				name:        "default",
+				idleTime:    8 * time.Hour,
+				checkPeriod: 5 * time.Minute,
+				exempt:      true,
+			},
+		},
+		{
+			testName: "Non-positive durations are ignored",
+			nb: &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "team"},
+				Spec: v1beta1.NotebookSpec{
+					Culling: &v1beta1.CullingSettings{
+						IdleTime:    &metav1.Duration{Duration: -time.Hour},
+						CheckPeriod: &metav1.Duration{},
+					},
+				},
+			},
+			expected: cullingPolicy{
+				name:        "default",
+				idleTime:    8 * time.Hour,
+				checkPeriod: 5 * time.Minute,
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(gpuPolicy, namespacePolicy, otherNamespacePolicy).Build()
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			policy, err := resolveCullingPolicy(context.TODO(), c, tc.nb, config.Default())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if policy.name != tc.expected.name || policy.idleTime != tc.expected.idleTime ||
+				policy.checkPeriod != tc.expected.checkPeriod || policy.exempt != tc.expected.exempt {
+				t.Errorf("Got %+v, Expected %+v", policy, tc.expected)
+			}
+		})
+	}
+}
+
+func TestResolveCullingPolicyPrometheusQuery(t *testing.T) {
+	policy := &v1beta1.CullingPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team"},
+		Spec: v1beta1.CullingPolicySpec{
+			CullingSettings: v1beta1.CullingSettings{
+				Probe: &v1beta1.IdlenessProbe{
+					Type:       v1beta1.IdlenessProbePrometheus,
+					Prometheus: &v1beta1.PrometheusIdlenessProbe{Query: "notebook_cpu"},
+				},
+			},
+		},
+	}
+	threshold := resource.MustParse("100m")
+	newNotebook := func(namespace string) *v1beta1.Notebook {
+		return &v1beta1.Notebook{
+			ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: namespace},
+			Spec: v1beta1.NotebookSpec{
+				Culling: &v1beta1.CullingSettings{
+					Probe: &v1beta1.IdlenessProbe{
+						Type:       v1beta1.IdlenessProbePrometheus,
+						Prometheus: &v1beta1.PrometheusIdlenessProbe{Query: "secrets", Threshold: &threshold},
+					},
+				},
+			},
+		}
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(policy).Build()
+
+	for namespace, expected := range map[string]string{"team": "notebook_cpu", "empty": ""} {
+		nb := newNotebook(namespace)
+		resolved, err := resolveCullingPolicy(context.TODO(), c, nb, config.Default())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		prometheus := resolved.probe.Prometheus
+		if prometheus == nil || prometheus.Query != expected || prometheus.Threshold.Cmp(threshold) != 0 {
+			t.Errorf("Got the Prometheus probe %+v in %s, Expected the query %q", prometheus, namespace, expected)
+		}
+		if nb.Spec.Culling.Probe.Prometheus.Query != "secrets" {
+			t.Errorf("Expected the Notebook to be unchanged")
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2022-08-31 is a Wednesday
+	testCases := []struct {
+		testName string
+		window   v1beta1.CullingWindow
+		time     time.Time
+		result   bool
+	}{
+		{
+			testName: "Inside the window",
+			window:   v1beta1.CullingWindow{Start: "08:00", End: "18:00"},
+			time:     time.Date(2022, 8, 31, 12, 0, 0, 0, time.UTC),
+			result:   true,
+		},
+		{
+			testName: "End of the window is exclusive",
+			window:   v1beta1.CullingWindow{Start: "08:00", End: "18:00"},
+			time:     time.Date(2022, 8, 31, 18, 0, 0, 0, time.UTC),
+			result:   false,
+		},
+		{
+			testName: "Other day of the week",
+			window: v1beta1.CullingWindow{
+				Days:  []v1beta1.Weekday{"Mon", "Tue"},
+				Start: "08:00",
+				End:   "18:00",
+			},
+			time:   time.Date(2022, 8, 31, 12, 0, 0, 0, time.UTC),
+			result: false,
+		},
+		{
+			testName: "Window in another time zone",
+			window: v1beta1.CullingWindow{
+				Start:    "08:00",
+				End:      "18:00",
+				TimeZone: "Europe/Berlin",
+			},
+			// 17:30 UTC is 19:30 in Berlin during summer time
+			time:   time.Date(2022, 8, 31, 17, 30, 0, 0, time.UTC),
+			result: false,
+		},
+		{
+			testName: "Window spanning midnight, after midnight",
+			window: v1beta1.CullingWindow{
+				Days:  []v1beta1.Weekday{"Tue"},
+				Start: "22:00",
+				End:   "02:00",
+			},
+			time:   time.Date(2022, 8, 31, 1, 0, 0, 0, time.UTC),
+			result: true,
+		},
+		{
+			testName: "Window spanning midnight, outside of it",
+			window:   v1beta1.CullingWindow{Start: "22:00", End: "02:00"},
+			time:     time.Date(2022, 8, 31, 12, 0, 0, 0, time.UTC),
+			result:   false,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			result, err := windowContains(c.window, c.time)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != c.result {
+				t.Errorf("Wrong result for case: %+v", c)
+			}
+		})
+	}
+}
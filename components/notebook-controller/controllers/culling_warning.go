@@ -0,0 +1,223 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+// POSTPONE_CULLING_ANNOTATION postpones culling. Its value is a timestamp that
+// counts as activity of the Notebook, so the Notebook is culled no earlier
+// than the idle time after it. Setting it to the current time "touches" the
+// Notebook. Timestamps further in the future than culling.maxPostponement are
+// shortened to that limit.
+const POSTPONE_CULLING_ANNOTATION = "notebooks.kubeflow.org/postpone-culling"
+
+// warningTimeout is how long the culler waits for the webhook and the
+// Notebook to accept a warning
+const warningTimeout = 10 * time.Second
+
+// cullingWarning is the payload POSTed to the webhook and to the Notebook
+// before an idle Notebook is stopped
+type cullingWarning struct {
+	Namespace         string `json:"namespace"`
+	Name              string `json:"name"`
+	LastActivity      string `json:"lastActivity"`
+	ScheduledStopTime string `json:"scheduledStopTime"`
+	Message           string `json:"message"`
+}
+
+// cullingScheduledStopTime returns when the culler will stop the Notebook, or
+// nil if no stop is scheduled
+func cullingScheduledStopTime(nb *v1beta1.Notebook) *time.Time {
+	if nb.Status.Culling == nil || nb.Status.Culling.ScheduledStopTime == nil {
+		return nil
+	}
+	return &nb.Status.Culling.ScheduledStopTime.Time
+}
+
+// scheduleCulling records that the idle Notebook will be stopped at stopAt and
+// warns its users. The warning is POSTed to the Notebook with the
+// authorization of its probe.
+func (r *CullingReconciler) scheduleCulling(ctx context.Context, nb *v1beta1.Notebook, policy cullingPolicy, authorization string, stopAt time.Time) error {
+	log := r.Log.WithValues("notebook", client.ObjectKeyFromObject(nb))
+
+	message := fmt.Sprintf(
+		"Notebook is idle and will be stopped at %s. Use it, or set the %s annotation to the current time, to postpone the stop.",
+		stopAt.UTC().Format(time.RFC3339), POSTPONE_CULLING_ANNOTATION)
+
+	patch := client.MergeFrom(nb.DeepCopy())
+	if nb.Status.Culling == nil {
+		nb.Status.Culling = policy.status()
+	}
+	nb.Status.Culling.ScheduledStopTime = &metav1.Time{Time: stopAt}
+	meta.SetStatusCondition(&nb.Status.Conditions, metav1.Condition{
+		Type:               v1beta1.NotebookConditionCullingScheduled,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: nb.Generation,
+		Reason:             "Idle",
+		Message:            message,
+	})
+	if err := r.Status().Patch(ctx, nb, patch); err != nil {
+		return err
+	}
+
+	r.EventRecorder.Event(nb, corev1.EventTypeWarning, "CullingScheduled", message)
+
+	lastActivity := ""
+	if nb.Status.Idleness != nil && nb.Status.Idleness.LastActivity != nil {
+		lastActivity = nb.Status.Idleness.LastActivity.UTC().Format(time.RFC3339)
+	}
+	warning := cullingWarning{
+		Namespace:         nb.Namespace,
+		Name:              nb.Name,
+		LastActivity:      lastActivity,
+		ScheduledStopTime: stopAt.UTC().Format(time.RFC3339),
+		Message:           message,
+	}
+	// Failing to deliver a warning doesn't block culling, the Event and the
+	// condition are still there
+	if policy.webhookURL != "" {
+		if err := postJSON(ctx, policy.webhookURL, "", warning); err != nil {
+			log.Error(err, "Could not send the culling warning to the webhook")
+		}
+	}
+	if policy.warningPath != "" {
+		endpoint := newNotebookEndpoint(policy.warningPath, 80, r.Config.Get())
+		if err := postJSON(ctx, endpoint.url(nb.Name, nb.Namespace), authorization, warning); err != nil {
+			log.Error(err, "Could not send the culling warning to the Notebook")
+		}
+	}
+	return nil
+}
+
+// cancelCulling removes the scheduled stop of the Notebook, if any
+func (r *CullingReconciler) cancelCulling(ctx context.Context, nb *v1beta1.Notebook, reason string) error {
+	if cullingScheduledStopTime(nb) == nil {
+		return nil
+	}
+
+	patch := client.MergeFrom(nb.DeepCopy())
+	clearCullingSchedule(nb)
+	if err := r.Status().Patch(ctx, nb, patch); err != nil {
+		return err
+	}
+
+	r.EventRecorder.Event(nb, corev1.EventTypeNormal, "CullingCanceled",
+		fmt.Sprintf("Notebook will not be stopped: %s", reason))
+	return nil
+}
+
+func clearCullingSchedule(nb *v1beta1.Notebook) {
+	if nb.Status.Culling != nil {
+		nb.Status.Culling.ScheduledStopTime = nil
+	}
+	meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionCullingScheduled)
+}
+
+// applyCullingPostponement moves the last activity of the idleness forward to
+// the time in the POSTPONE_CULLING_ANNOTATION
+func applyCullingPostponement(meta metav1.ObjectMeta, idleness *v1beta1.NotebookIdlenessStatus, log logr.Logger) {
+	value, ok := meta.GetAnnotations()[POSTPONE_CULLING_ANNOTATION]
+	if !ok {
+		return
+	}
+	postponedTo, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Error(err, "Error parsing the postpone-culling annotation")
+		return
+	}
+	if idleness.LastActivity != nil && !postponedTo.After(idleness.LastActivity.Time) {
+		return
+	}
+
+	log.Info(fmt.Sprintf("Culling is postponed. Updating the last activity to %s", value))
+	idleness.LastActivity = &metav1.Time{Time: postponedTo}
+}
+
+// limitCullingPostponement shortens a postponement that is further than
+// maxPostponement in the future. The annotation itself is rewritten, so the
+// limit doesn't move forward with every check and a far-future timestamp
+// can't exempt the Notebook from culling.
+func (r *CullingReconciler) limitCullingPostponement(ctx context.Context, nb *v1beta1.Notebook,
+	maxPostponement time.Duration, now time.Time) error {
+	value, ok := nb.GetAnnotations()[POSTPONE_CULLING_ANNOTATION]
+	if !ok {
+		return nil
+	}
+	postponedTo, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// applyCullingPostponement reports it
+		return nil
+	}
+	limit := now.Add(maxPostponement).UTC().Truncate(time.Second)
+	if !postponedTo.After(limit) {
+		return nil
+	}
+
+	patch := client.MergeFrom(nb.DeepCopy())
+	nb.Annotations[POSTPONE_CULLING_ANNOTATION] = limit.Format(time.RFC3339)
+	if err := r.Patch(ctx, nb, patch); err != nil {
+		return err
+	}
+	r.EventRecorder.Event(nb, corev1.EventTypeWarning, "CullingPostponementLimited",
+		fmt.Sprintf("Culling can be postponed by at most %s, postponing it to %s instead of %s",
+			maxPostponement, limit.Format(time.RFC3339), value))
+	return nil
+}
+
+// postJSON POSTs v, encoded as JSON, to url. authorization is sent in the
+// Authorization header, unless it's empty.
+func postJSON(ctx context.Context, url, authorization string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, warningTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := probeHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error talking to %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("POST to %s: %d", url, resp.StatusCode)
+	}
+	return nil
+}
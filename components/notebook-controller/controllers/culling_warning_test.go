@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func TestApplyCullingPostponement(t *testing.T) {
+	testCases := []struct {
+		testName     string
+		annotations  map[string]string
+		lastActivity string
+	}{
+		{
+			testName: "Postponed after the last activity",
+			annotations: map[string]string{
+				POSTPONE_CULLING_ANNOTATION: "2022-08-31T12:00:00Z",
+			},
+			lastActivity: "2022-08-31T12:00:00Z",
+		},
+		{
+			testName: "Postponed before the last activity",
+			annotations: map[string]string{
+				POSTPONE_CULLING_ANNOTATION: "2022-08-31T08:00:00Z",
+			},
+			lastActivity: "2022-08-31T10:00:00Z",
+		},
+		{
+			testName: "Invalid postponement",
+			annotations: map[string]string{
+				POSTPONE_CULLING_ANNOTATION: "tomorrow",
+			},
+			lastActivity: "2022-08-31T10:00:00Z",
+		},
+		{
+			testName:     "Not postponed",
+			annotations:  map[string]string{},
+			lastActivity: "2022-08-31T10:00:00Z",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			idleness := &v1beta1.NotebookIdlenessStatus{
+				LastActivity: &metav1.Time{Time: time.Date(2022, 8, 31, 10, 0, 0, 0, time.UTC)},
+			}
+			applyCullingPostponement(metav1.ObjectMeta{Annotations: c.annotations}, idleness, TestLogger)
+			if got := idleness.LastActivity.UTC().Format(time.RFC3339); got != c.lastActivity {
+				t.Errorf("Got last activity %s, Expected %s", got, c.lastActivity)
+			}
+		})
+	}
+}
+
+func TestLimitCullingPostponement(t *testing.T) {
+	now := time.Date(2022, 8, 31, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		testName    string
+		postponedTo string
+		expected    string
+	}{
+		{
+			testName:    "Postponed within the limit",
+			postponedTo: "2022-09-01T10:00:00Z",
+			expected:    "2022-09-01T10:00:00Z",
+		},
+		{
+			testName:    "Postponed beyond the limit",
+			postponedTo: "9999-12-31T23:59:59Z",
+			expected:    "2022-09-01T10:00:00Z",
+		},
+		{
+			testName:    "Invalid postponement",
+			postponedTo: "never",
+			expected:    "never",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			nb := &v1beta1.Notebook{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "nb",
+					Namespace:   "ns",
+					Annotations: map[string]string{POSTPONE_CULLING_ANNOTATION: c.postponedTo},
+				},
+			}
+			r := &CullingReconciler{
+				Client:        fake.NewClientBuilder().WithScheme(scheme).WithObjects(nb).Build(),
+				Log:           TestLogger,
+				Scheme:        scheme,
+				EventRecorder: record.NewFakeRecorder(10),
+			}
+			if err := r.limitCullingPostponement(context.TODO(), nb, 24*time.Hour, now); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			found := &v1beta1.Notebook{}
+			if err := r.Get(context.TODO(), client.ObjectKeyFromObject(nb), found); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := found.Annotations[POSTPONE_CULLING_ANNOTATION]; got != c.expected {
+				t.Errorf("Got postponement %s, Expected %s", got, c.expected)
+			}
+		})
+	}
+}
+
+func TestScheduleAndCancelCulling(t *testing.T) {
+	warnings := make(chan cullingWarning, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		warning := cullingWarning{}
+		if err := json.NewDecoder(r.Body).Decode(&warning); err != nil {
+			t.Errorf("Error decoding the warning: %v", err)
+		}
+		warnings <- warning
+	}))
+	defer webhook.Close()
+
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "ns"},
+	}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	r := &CullingReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme).WithObjects(nb).Build(),
+		Log:           TestLogger,
+		Scheme:        scheme,
+		EventRecorder: recorder,
+	}
+
+	policy := defaultCullingPolicy(config.Default())
+	policy.webhookURL = webhook.URL
+	stopAt := time.Date(2022, 8, 31, 12, 0, 0, 0, time.UTC)
+	if err := r.scheduleCulling(context.TODO(), nb, policy, "", stopAt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := &v1beta1.Notebook{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(nb), found); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if scheduled := cullingScheduledStopTime(found); scheduled == nil || !scheduled.Equal(stopAt) {
+		t.Errorf("Got scheduled stop time %v, Expected %s", scheduled, stopAt)
+	}
+	if len(found.Status.Conditions) != 1 ||
+		found.Status.Conditions[0].Type != v1beta1.NotebookConditionCullingScheduled {
+		t.Errorf("Expected a %s condition, got %+v",
+			v1beta1.NotebookConditionCullingScheduled, found.Status.Conditions)
+	}
+	if warning := <-warnings; warning.ScheduledStopTime != "2022-08-31T12:00:00Z" {
+		t.Errorf("Got warning %+v", warning)
+	}
+
+	if err := r.cancelCulling(context.TODO(), found, "Notebook is active again"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(nb), found); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cullingScheduledStopTime(found) != nil || len(found.Status.Conditions) != 0 {
+		t.Errorf("Expected culling to be canceled, got %+v", found.Status)
+	}
+
+	if len(recorder.Events) != 2 {
+		t.Errorf("Expected 2 Events, got %d", len(recorder.Events))
+	}
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+	return scheme
+}
+
+// newTestNotebook returns a Notebook of the ns namespace with a single
+// container. The tests set the fields they exercise on top of it.
+func newTestNotebook(name string) *v1beta1.Notebook {
+	return &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", UID: types.UID("uid-" + name)},
+		Spec: v1beta1.NotebookSpec{
+			Template: v1beta1.NotebookTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: name, Image: "jupyter"}}},
+			},
+		},
+	}
+}
+
+// newTestNotebookReconciler returns a NotebookReconciler with the default
+// configuration, whose fake client holds the objects.
+func newTestNotebookReconciler(objects ...client.Object) (*NotebookReconciler, client.Client) {
+	scheme := newTestScheme()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &NotebookReconciler{
+		Client:        c,
+		Log:           TestLogger,
+		Scheme:        scheme,
+		EventRecorder: record.NewFakeRecorder(100),
+		APIReader:     c,
+		Config:        config.NewProvider(config.Default()),
+	}, c
+}
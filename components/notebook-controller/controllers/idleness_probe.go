@@ -0,0 +1,429 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+const DEFAULT_PROMETHEUS_QUERY = `sum(rate(container_cpu_usage_seconds_total{namespace="$(NAMESPACE)",pod="$(NAME)-0",container!="",container!="POD"}[5m]))`
+const DEFAULT_PROMETHEUS_THRESHOLD = "10m"
+const DEFAULT_LAST_ACTIVITY_FIELD = "last_activity"
+
+// probeHTTPClient sends the requests of the culler. Their timeouts are set
+// on their contexts: culling.probeTimeout for the probes and warningTimeout
+// for the warnings.
+var probeHTTPClient = &http.Client{}
+
+// idlenessProbe finds out when a Notebook was last active
+type idlenessProbe interface {
+	// activity returns the activity of the Notebook. Its lastActivity is
+	// nil if the Notebook reported no activity.
+	activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error)
+}
+
+// notebookActivity is the activity of a Notebook reported by a probe
+type notebookActivity struct {
+	lastActivity *time.Time
+	// busy is true if the Notebook is active right now
+	busy bool
+	// kernels and busyKernels are only reported by the JupyterKernels probe
+	kernels     *int32
+	busyKernels *int32
+}
+
+// activeNow returns the activity of a Notebook that is busy right now
+func activeNow() notebookActivity {
+	now := time.Now()
+	return notebookActivity{lastActivity: &now, busy: true}
+}
+
+// newIdlenessProbe returns the probe described by spec. The probes that reach
+// the Notebook send authorization in their Authorization header, unless it's
+// empty.
+func newIdlenessProbe(spec v1beta1.IdlenessProbe, cfg *config.NotebookControllerConfig, authorization string) (idlenessProbe, error) {
+	endpoint := func(defaultPath string) notebookEndpoint {
+		e := newNotebookEndpoint(defaultPath, 80, cfg)
+		e.authorization = authorization
+		if spec.HTTP != nil {
+			if spec.HTTP.Path != "" {
+				e.path = spec.HTTP.Path
+			}
+			if spec.HTTP.Port != 0 {
+				e.port = spec.HTTP.Port
+			}
+		}
+		return e
+	}
+
+	switch spec.Type {
+	case "", v1beta1.IdlenessProbeJupyterKernels:
+		return &jupyterKernelsProbe{endpoint("$(NB_PREFIX)/api/kernels")}, nil
+	case v1beta1.IdlenessProbeJupyterStatus:
+		return &jupyterStatusProbe{endpoint("$(NB_PREFIX)/api/status")}, nil
+	case v1beta1.IdlenessProbeCodeServer:
+		return &codeServerProbe{endpoint("/healthz")}, nil
+	case v1beta1.IdlenessProbeHTTP:
+		if spec.HTTP == nil || spec.HTTP.Path == "" {
+			return nil, fmt.Errorf("the %s idleness probe requires http.path", spec.Type)
+		}
+		field := spec.HTTP.LastActivityField
+		if field == "" {
+			field = DEFAULT_LAST_ACTIVITY_FIELD
+		}
+		return &httpProbe{endpoint: endpoint(""), field: field}, nil
+	case v1beta1.IdlenessProbePrometheus:
+		p := &prometheusProbe{
+			url:       cfg.Culling.PrometheusURL,
+			query:     DEFAULT_PROMETHEUS_QUERY,
+			threshold: resource.MustParse(DEFAULT_PROMETHEUS_THRESHOLD),
+		}
+		if spec.Prometheus != nil {
+			if spec.Prometheus.Query != "" {
+				p.query = spec.Prometheus.Query
+			}
+			if spec.Prometheus.Threshold != nil {
+				p.threshold = *spec.Prometheus.Threshold
+			}
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown idleness probe type %q", spec.Type)
+	}
+}
+
+// notebookEndpoint is an HTTP endpoint of the Notebook's Service
+type notebookEndpoint struct {
+	path string
+	port int32
+	// dev reaches the Service through kubectl proxy
+	dev           bool
+	clusterDomain string
+	// authorization is the value of the Authorization header, if any
+	authorization string
+}
+
+func newNotebookEndpoint(path string, port int32, cfg *config.NotebookControllerConfig) notebookEndpoint {
+	return notebookEndpoint{path: path, port: port, dev: cfg.Dev, clusterDomain: cfg.ClusterDomain}
+}
+
+func (e notebookEndpoint) url(nm, ns string) string {
+	p := strings.ReplaceAll(e.path, "$(NB_PREFIX)", fmt.Sprintf("/notebook/%s/%s", ns, nm))
+
+	if e.dev {
+		port := strconv.Itoa(int(e.port))
+		if e.port == 80 {
+			port = "http-" + nm
+		}
+		return fmt.Sprintf(
+			"http://localhost:8001/api/v1/namespaces/%s/services/%s:%s/proxy%s",
+			ns, nm, port, p)
+	}
+
+	if e.port == 80 {
+		return fmt.Sprintf("http://%s.%s.svc.%s%s", nm, ns, e.clusterDomain, p)
+	}
+	return fmt.Sprintf("http://%s.%s.svc.%s:%d%s", nm, ns, e.clusterDomain, e.port, p)
+}
+
+// getJSON decodes the JSON document served at url into v. authorization is
+// sent in the Authorization header, unless it's empty.
+func getJSON(ctx context.Context, url, authorization string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := probeHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error talking to %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET to %s: %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error parsing JSON response of %s: %v", url, err)
+	}
+	return nil
+}
+
+// jupyterKernelsProbe considers the Notebook active while one of its kernels
+// is busy. Otherwise, the last activity is the most recent activity among the
+// kernels.
+type jupyterKernelsProbe struct {
+	endpoint notebookEndpoint
+}
+
+func (p *jupyterKernelsProbe) activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error) {
+	var kernels []KernelStatus
+	if err := getJSON(ctx, p.endpoint.url(nm, ns), p.endpoint.authorization, &kernels); err != nil {
+		return notebookActivity{}, err
+	}
+
+	count, busy := int32(len(kernels)), int32(0)
+	for _, k := range kernels {
+		if k.ExecutionState != KERNEL_EXECUTION_STATE_IDLE {
+			busy++
+		}
+	}
+	activity := notebookActivity{busy: busy > 0, kernels: &count, busyKernels: &busy}
+	if len(kernels) == 0 {
+		log.Info("Notebook has no kernels")
+		return activity, nil
+	}
+	lastActivity, err := kernelsLastActivity(kernels, log)
+	if err != nil {
+		return notebookActivity{}, err
+	}
+	activity.lastActivity = lastActivity
+	return activity, nil
+}
+
+func kernelsLastActivity(kernels []KernelStatus, log logr.Logger) (*time.Time, error) {
+	if !allKernelsAreIdle(kernels, log) {
+		// At least one kernel is "busy" so the Notebook is active right now
+		now := time.Now()
+		return &now, nil
+	}
+
+	var recentTime *time.Time
+	for i := range kernels {
+		kernelLastActivity, err := time.Parse(time.RFC3339, kernels[i].LastActivity)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the last-activity of kernel %s: %v", kernels[i].ID, err)
+		}
+		if recentTime == nil || kernelLastActivity.After(*recentTime) {
+			recentTime = &kernelLastActivity
+		}
+	}
+	return recentTime, nil
+}
+
+// jupyterStatusProbe reads the last activity of the Jupyter server, which
+// also covers the activity of the kernels, and of its terminals. The terminals
+// are read from the terminals endpoint next to the status endpoint.
+type jupyterStatusProbe struct {
+	endpoint notebookEndpoint
+}
+
+type jupyterServerStatus struct {
+	LastActivity string `json:"last_activity"`
+}
+
+type jupyterTerminal struct {
+	Name         string `json:"name"`
+	LastActivity string `json:"last_activity"`
+}
+
+func (p *jupyterStatusProbe) activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error) {
+	status := jupyterServerStatus{}
+	if err := getJSON(ctx, p.endpoint.url(nm, ns), p.endpoint.authorization, &status); err != nil {
+		return notebookActivity{}, err
+	}
+	recentTime, err := time.Parse(time.RFC3339, status.LastActivity)
+	if err != nil {
+		return notebookActivity{}, fmt.Errorf("error parsing the last_activity of the server: %v", err)
+	}
+
+	// Older servers don't account for the terminals in their last_activity.
+	// Listing the terminals would count as activity itself, unless
+	// no_track_activity is set.
+	terminalsEndpoint := p.endpoint
+	terminalsEndpoint.path = path.Join(path.Dir(p.endpoint.path), "terminals") + "?no_track_activity=1"
+	terminals := []jupyterTerminal{}
+	if err := getJSON(ctx, terminalsEndpoint.url(nm, ns), terminalsEndpoint.authorization, &terminals); err != nil {
+		log.Info(fmt.Sprintf("Could not list the terminals, using the server's last_activity only: %v", err))
+		return notebookActivity{lastActivity: &recentTime}, nil
+	}
+	for _, t := range terminals {
+		terminalLastActivity, err := time.Parse(time.RFC3339, t.LastActivity)
+		if err != nil {
+			return notebookActivity{}, fmt.Errorf("error parsing the last_activity of terminal %s: %v", t.Name, err)
+		}
+		if terminalLastActivity.After(recentTime) {
+			recentTime = terminalLastActivity
+		}
+	}
+	return notebookActivity{lastActivity: &recentTime}, nil
+}
+
+// codeServerProbe reads the time of the last heartbeat of code-server.
+// code-server touches its heartbeat file whenever there is activity and
+// reports the time of the last heartbeat in its /healthz endpoint. The probe
+// reads the endpoint rather than the file, which would require exec access to
+// the notebook Pods.
+type codeServerProbe struct {
+	endpoint notebookEndpoint
+}
+
+type codeServerHealth struct {
+	Status        string `json:"status"`
+	LastHeartbeat int64  `json:"lastHeartbeat"`
+}
+
+func (p *codeServerProbe) activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error) {
+	health := codeServerHealth{}
+	if err := getJSON(ctx, p.endpoint.url(nm, ns), p.endpoint.authorization, &health); err != nil {
+		return notebookActivity{}, err
+	}
+	if health.LastHeartbeat == 0 {
+		log.Info("code-server reported no heartbeat")
+		return notebookActivity{}, nil
+	}
+	// lastHeartbeat is in milliseconds since the epoch
+	t := time.UnixMilli(health.LastHeartbeat)
+	return notebookActivity{lastActivity: &t, busy: health.Status == "alive"}, nil
+}
+
+// httpProbe reads the last activity from a top-level field of the JSON
+// document served by the Notebook
+type httpProbe struct {
+	endpoint notebookEndpoint
+	field    string
+}
+
+func (p *httpProbe) activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error) {
+	doc := map[string]interface{}{}
+	if err := getJSON(ctx, p.endpoint.url(nm, ns), p.endpoint.authorization, &doc); err != nil {
+		return notebookActivity{}, err
+	}
+	value, ok := doc[p.field]
+	if !ok || value == nil {
+		log.Info(fmt.Sprintf("Response has no %s field", p.field))
+		return notebookActivity{}, nil
+	}
+	lastActivity, err := parseLastActivity(value)
+	if err != nil {
+		return notebookActivity{}, err
+	}
+	return notebookActivity{lastActivity: lastActivity}, nil
+}
+
+// parseLastActivity parses an RFC 3339 string or a number of seconds since
+// the epoch
+func parseLastActivity(value interface{}) (*time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing last activity %q: %v", v, err)
+		}
+		return &t, nil
+	case float64:
+		sec := int64(v)
+		t := time.Unix(sec, int64((v-float64(sec))*float64(time.Second)))
+		return &t, nil
+	default:
+		return nil, fmt.Errorf("last activity should be a string or a number, got %T", value)
+	}
+}
+
+// prometheusProbe considers the Notebook active while the CPU usage returned
+// by the query is above the threshold
+type prometheusProbe struct {
+	// url is the address of the Prometheus server
+	url       string
+	query     string
+	threshold resource.Quantity
+}
+
+type prometheusQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func (p *prometheusProbe) activity(ctx context.Context, nm, ns string, log logr.Logger) (notebookActivity, error) {
+	if p.url == "" {
+		return notebookActivity{}, fmt.Errorf("culling.prometheusURL is not set")
+	}
+
+	query := strings.NewReplacer("$(NAMESPACE)", ns, "$(NAME)", nm).Replace(p.query)
+	u := strings.TrimSuffix(p.url, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	resp := prometheusQueryResponse{}
+	if err := getJSON(ctx, u, "", &resp); err != nil {
+		return notebookActivity{}, err
+	}
+	usage, ok, err := prometheusScalar(resp)
+	if err != nil {
+		return notebookActivity{}, err
+	}
+	if !ok {
+		log.Info("Prometheus returned no CPU usage for the Notebook")
+		return notebookActivity{}, nil
+	}
+
+	threshold := float64(p.threshold.MilliValue()) / 1000
+	if usage <= threshold {
+		log.Info(fmt.Sprintf("CPU usage %f is below the threshold %f", usage, threshold))
+		return notebookActivity{}, nil
+	}
+	return activeNow(), nil
+}
+
+// prometheusScalar returns the value of a single-sample vector. ok is false if
+// the vector is empty.
+func prometheusScalar(resp prometheusQueryResponse) (value float64, ok bool, err error) {
+	if resp.Status != "success" {
+		return 0, false, fmt.Errorf("prometheus query failed: %s", resp.Error)
+	}
+	if resp.Data.ResultType != "vector" {
+		return 0, false, fmt.Errorf("prometheus query should return a vector, got %s", resp.Data.ResultType)
+	}
+	if len(resp.Data.Result) == 0 {
+		return 0, false, nil
+	}
+	if len(resp.Data.Result) > 1 {
+		return 0, false, fmt.Errorf("prometheus query should return a single sample, got %d", len(resp.Data.Result))
+	}
+
+	sample := resp.Data.Result[0].Value
+	if len(sample) != 2 {
+		return 0, false, fmt.Errorf("malformed prometheus sample %v", sample)
+	}
+	s, isString := sample[1].(string)
+	if !isString {
+		return 0, false, fmt.Errorf("malformed prometheus sample value %v", sample[1])
+	}
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
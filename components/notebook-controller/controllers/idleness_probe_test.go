@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func TestNewIdlenessProbe(t *testing.T) {
+	testCases := []struct {
+		testName string
+		spec     v1beta1.IdlenessProbe
+		url      string
+		err      bool
+	}{
+		{
+			testName: "Default probe",
+			spec:     v1beta1.IdlenessProbe{},
+			url:      "http://nb.ns.svc.cluster.local/notebook/ns/nb/api/kernels",
+		},
+		{
+			testName: "Jupyter status probe",
+			spec:     v1beta1.IdlenessProbe{Type: v1beta1.IdlenessProbeJupyterStatus},
+			url:      "http://nb.ns.svc.cluster.local/notebook/ns/nb/api/status",
+		},
+		{
+			testName: "code-server probe with custom port",
+			spec: v1beta1.IdlenessProbe{
+				Type: v1beta1.IdlenessProbeCodeServer,
+				HTTP: &v1beta1.HTTPIdlenessProbe{Port: 8080},
+			},
+			url: "http://nb.ns.svc.cluster.local:8080/healthz",
+		},
+		{
+			testName: "HTTP probe",
+			spec: v1beta1.IdlenessProbe{
+				Type: v1beta1.IdlenessProbeHTTP,
+				HTTP: &v1beta1.HTTPIdlenessProbe{Path: "$(NB_PREFIX)/activity"},
+			},
+			url: "http://nb.ns.svc.cluster.local/notebook/ns/nb/activity",
+		},
+		{
+			testName: "HTTP probe without a path",
+			spec:     v1beta1.IdlenessProbe{Type: v1beta1.IdlenessProbeHTTP},
+			err:      true,
+		},
+		{
+			testName: "Unknown probe",
+			spec:     v1beta1.IdlenessProbe{Type: "Unknown"},
+			err:      true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			probe, err := newIdlenessProbe(c.spec, config.Default(), "")
+			if c.err {
+				if err == nil {
+					t.Errorf("Expected an error for case: %+v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var endpoint notebookEndpoint
+			switch p := probe.(type) {
+			case *jupyterKernelsProbe:
+				endpoint = p.endpoint
+			case *jupyterStatusProbe:
+				endpoint = p.endpoint
+			case *codeServerProbe:
+				endpoint = p.endpoint
+			case *httpProbe:
+				endpoint = p.endpoint
+			}
+			if url := endpoint.url("nb", "ns"); url != c.url {
+				t.Errorf("Got URL %s, Expected %s", url, c.url)
+			}
+		})
+	}
+}
+
+func TestKernelsLastActivity(t *testing.T) {
+	testCases := []struct {
+		testName string
+		kernels  []KernelStatus
+		expected time.Time
+		busy     bool
+	}{
+		{
+			testName: "Most recent activity of idle kernels",
+			kernels: []KernelStatus{
+				{ExecutionState: KERNEL_EXECUTION_STATE_IDLE, LastActivity: "2022-08-31T10:00:00Z"},
+				{ExecutionState: KERNEL_EXECUTION_STATE_IDLE, LastActivity: "2022-08-31T12:00:00Z"},
+			},
+			expected: time.Date(2022, 8, 31, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			testName: "Busy kernel",
+			kernels: []KernelStatus{
+				{ExecutionState: KERNEL_EXECUTION_STATE_IDLE, LastActivity: "2022-08-31T10:00:00Z"},
+				{ExecutionState: KERNEL_EXECUTION_STATE_BUSY, LastActivity: "2022-08-31T12:00:00Z"},
+			},
+			busy: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			start := time.Now()
+			lastActivity, err := kernelsLastActivity(c.kernels, TestLogger)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if c.busy {
+				if lastActivity.Before(start) {
+					t.Errorf("Busy kernel should be active now, got %s", lastActivity)
+				}
+				return
+			}
+			if !lastActivity.Equal(c.expected) {
+				t.Errorf("Got %s, Expected %s", lastActivity, c.expected)
+			}
+		})
+	}
+}
+
+func TestParseLastActivity(t *testing.T) {
+	testCases := []struct {
+		testName string
+		value    interface{}
+		expected time.Time
+		err      bool
+	}{
+		{
+			testName: "RFC 3339 string",
+			value:    "2022-08-31T12:00:00.5Z",
+			expected: time.Date(2022, 8, 31, 12, 0, 0, 500000000, time.UTC),
+		},
+		{
+			testName: "Seconds since the epoch",
+			value:    float64(1661947200),
+			expected: time.Date(2022, 8, 31, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			testName: "Invalid string",
+			value:    "yesterday",
+			err:      true,
+		},
+		{
+			testName: "Invalid type",
+			value:    true,
+			err:      true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			lastActivity, err := parseLastActivity(c.value)
+			if c.err {
+				if err == nil {
+					t.Errorf("Expected an error for case: %+v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !lastActivity.Equal(c.expected) {
+				t.Errorf("Got %s, Expected %s", lastActivity, c.expected)
+			}
+		})
+	}
+}
+
+func TestPrometheusProbe(t *testing.T) {
+	testCases := []struct {
+		testName string
+		response string
+		active   bool
+		err      bool
+	}{
+		{
+			testName: "CPU usage above the threshold",
+			response: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1661947200,"0.5"]}]}}`,
+			active:   true,
+		},
+		{
+			testName: "CPU usage below the threshold",
+			response: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1661947200,"0.001"]}]}}`,
+			active:   false,
+		},
+		{
+			testName: "No samples",
+			response: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			active:   false,
+		},
+		{
+			testName: "Failed query",
+			response: `{"status":"error","error":"parse error"}`,
+			err:      true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				expected := `sum(rate(container_cpu_usage_seconds_total{pod="nb-0",namespace="ns"}[5m]))`
+				if q := r.URL.Query().Get("query"); q != expected {
+					t.Errorf("Got query %s, Expected %s", q, expected)
+				}
+				fmt.Fprint(w, c.response)
+			}))
+			defer server.Close()
+			probe := &prometheusProbe{
+				url:       server.URL,
+				query:     `sum(rate(container_cpu_usage_seconds_total{pod="$(NAME)-0",namespace="$(NAMESPACE)"}[5m]))`,
+				threshold: resource.MustParse("10m"),
+			}
+			activity, err := probe.activity(context.TODO(), "nb", "ns", TestLogger)
+			if c.err {
+				if err == nil {
+					t.Errorf("Expected an error for case: %+v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (activity.lastActivity != nil) != c.active || activity.busy != c.active {
+				t.Errorf("Got activity %+v, Expected active: %v", activity, c.active)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/common/routing"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// AppLabel is set on the routes of the apps of a Notebook to the name of the
+// app, so the routes of removed apps can be found
+const AppLabel = "notebook-app"
+
+func appPrefix(nb *v1beta1.Notebook, app *v1beta1.NotebookApp) string {
+	return fmt.Sprintf("/notebook-apps/%s/%s/%s/", nb.Namespace, nb.Name, app.Name)
+}
+
+// appRouteName returns notebook-<namespace>-<notebook>-app-<app>. It can still
+// be the name of the route of another Notebook, e.g. of the <notebook>-app-<app>
+// Notebook, which routing.Reconcile doesn't take over.
+func appRouteName(nb *v1beta1.Notebook, app *v1beta1.NotebookApp) string {
+	return virtualServiceName(nb.Name, nb.Namespace) + "-app-" + app.Name
+}
+
+// appServicePorts returns the ports of the Service of the Notebook that
+// expose its apps. The port names follow the Istio pattern, like the one of
+// the notebook server.
+func appServicePorts(nb *v1beta1.Notebook) []corev1.ServicePort {
+	ports := []corev1.ServicePort{}
+	for _, app := range nb.Spec.Apps {
+		ports = append(ports, corev1.ServicePort{
+			Name:       "http-" + app.Name,
+			Port:       app.Port,
+			TargetPort: intstr.FromInt(int(app.Port)),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+	return ports
+}
+
+// generateAppRoute returns the route of an app of the Notebook. Unless the
+// app rewrites its path, the app is requested under its prefix, like the
+// notebook server.
+func generateAppRoute(nb *v1beta1.Notebook, app *v1beta1.NotebookApp) routing.Route {
+	prefix := appPrefix(nb, app)
+	rewrite := prefix
+	if app.RewritePath {
+		rewrite = "/"
+	}
+	return routing.Route{
+		Name:        appRouteName(nb, app),
+		Namespace:   nb.Namespace,
+		Labels:      map[string]string{"notebook-name": nb.Name, AppLabel: app.Name},
+		Prefix:      prefix,
+		Rewrite:     rewrite,
+		ServiceName: nb.Name,
+		ServicePort: app.Port,
+	}
+}
+
+// appsStatus returns the addresses of the apps of the Notebook
+func appsStatus(nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig) []v1beta1.NotebookAppStatus {
+	var status []v1beta1.NotebookAppStatus
+	for i := range nb.Spec.Apps {
+		app := &nb.Spec.Apps[i]
+		path := appPrefix(nb, app)
+		if app.RewritePath {
+			path = "/"
+		}
+		appStatus := v1beta1.NotebookAppStatus{
+			Name:       app.Name,
+			ServiceURL: fmt.Sprintf("http://%s.%s.svc.%s:%d%s", nb.Name, nb.Namespace, cfg.ClusterDomain, app.Port, path),
+		}
+		if cfg.RoutingConfig().Enabled() {
+			appStatus.URL = appPrefix(nb, app)
+		}
+		status = append(status, appStatus)
+	}
+	return status
+}
+
+// reconcileAppRoutes creates or updates the routes of the apps of the
+// Notebook, and deletes the routes of the apps that were removed
+func (r *NotebookReconciler) reconcileAppRoutes(ctx context.Context, nb *v1beta1.Notebook, cfg routing.Config,
+	log logr.Logger) error {
+
+	routeNames := map[string]bool{}
+	for i := range nb.Spec.Apps {
+		route, err := routing.Generate(cfg, generateAppRoute(nb, &nb.Spec.Apps[i]))
+		if err != nil {
+			log.Error(err, "unable to generate app route", "mode", cfg.Mode)
+			return err
+		}
+		if err := ctrl.SetControllerReference(nb, route, r.Scheme); err != nil {
+			return err
+		}
+		if err := routing.Reconcile(ctx, r.Client, route, log); errors.Is(err, routing.ErrNotControlled) {
+			// The other apps are still routed
+			r.EventRecorder.Eventf(nb, corev1.EventTypeWarning, "RouteConflict",
+				"The route of the app %s isn't created: %v", nb.Spec.Apps[i].Name, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		routeNames[route.GetName()] = true
+	}
+
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(cfg.Object().GroupVersionKind())
+	routes.SetKind(routes.GetKind() + "List")
+	if err := r.List(ctx, routes, client.InNamespace(nb.Namespace),
+		client.MatchingLabels{"notebook-name": nb.Name}, client.HasLabels{AppLabel}); err != nil {
+		return err
+	}
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		if routeNames[route.GetName()] || !metav1.IsControlledBy(route, nb) {
+			continue
+		}
+		log.Info("Deleting the route of a removed app", "name", route.GetName(), "app", route.GetLabels()[AppLabel])
+		if err := r.Delete(ctx, route); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/common/routing"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func newTestApps() []v1beta1.NotebookApp {
+	return []v1beta1.NotebookApp{
+		{Name: "tensorboard", Port: 6006},
+		{Name: "streamlit", Port: 8501, RewritePath: true},
+	}
+}
+
+func TestGenerateServiceApps(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.Apps = newTestApps()
+	svc := generateService(nb)
+	if len(svc.Spec.Ports) != 3 {
+		t.Fatalf("Got the ports %+v", svc.Spec.Ports)
+	}
+	port := svc.Spec.Ports[1]
+	if port.Name != "http-tensorboard" || port.Port != 6006 || port.TargetPort.IntValue() != 6006 {
+		t.Errorf("Got the port %+v", port)
+	}
+}
+
+func TestAppsStatus(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.Apps = newTestApps()
+	cfg := config.Default()
+	cfg.Routing.Mode = routing.ModeIstio
+
+	expected := []v1beta1.NotebookAppStatus{
+		{
+			Name:       "tensorboard",
+			URL:        "/notebook-apps/ns/nb/tensorboard/",
+			ServiceURL: "http://nb.ns.svc.cluster.local:6006/notebook-apps/ns/nb/tensorboard/",
+		},
+		{
+			Name:       "streamlit",
+			URL:        "/notebook-apps/ns/nb/streamlit/",
+			ServiceURL: "http://nb.ns.svc.cluster.local:8501/",
+		},
+	}
+	if status := appsStatus(nb, cfg); !reflect.DeepEqual(status, expected) {
+		t.Errorf("Got the status %+v, Expected %+v", status, expected)
+	}
+
+	// Without routing, the apps are only reachable through the Service
+	if status := appsStatus(nb, config.Default()); status[0].URL != "" {
+		t.Errorf("Got the status %+v", status)
+	}
+}
+
+func TestReconcileAppRoutes(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.Apps = newTestApps()
+	r, c := newTestNotebookReconciler(nb)
+	cfg := config.Default()
+	cfg.Routing.Mode = routing.ModeIstio
+	routingCfg := cfg.RoutingConfig()
+
+	if err := r.reconcileAppRoutes(context.TODO(), nb, routingCfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	route := routingCfg.Object()
+	key := client.ObjectKey{Name: "notebook-ns-nb-app-streamlit", Namespace: "ns"}
+	if err := c.Get(context.TODO(), key, route); err != nil {
+		t.Fatalf("Expected the route to exist: %v", err)
+	}
+	if route.GetLabels()[AppLabel] != "streamlit" || !metav1.IsControlledBy(route, nb) {
+		t.Errorf("Got the route %+v", route.Object["metadata"])
+	}
+
+	// The routes of the removed apps are deleted
+	nb.Spec.Apps = nb.Spec.Apps[:1]
+	if err := r.reconcileAppRoutes(context.TODO(), nb, routingCfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Get(context.TODO(), key, route); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the route to be deleted, got %v", err)
+	}
+	key.Name = "notebook-ns-nb-app-tensorboard"
+	if err := c.Get(context.TODO(), key, route); err != nil {
+		t.Errorf("Expected the route to be kept: %v", err)
+	}
+}
+
+func TestReconcileAppRoutesConflict(t *testing.T) {
+	// The route of the nb-app-tensorboard Notebook has the name of the route
+	// of the tensorboard app of the nb Notebook
+	nb := newTestNotebook("nb")
+	nb.Spec.Apps = newTestApps()
+	other := newTestNotebook("nb-app-tensorboard")
+	other.Spec.Apps = newTestApps()
+	cfg := config.Default()
+	cfg.Routing.Mode = routing.ModeIstio
+	routingCfg := cfg.RoutingConfig()
+	otherRoute, err := routing.Generate(routingCfg, generateRoute(other))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ctrl.SetControllerReference(other, otherRoute, newTestScheme()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r, c := newTestNotebookReconciler(nb, other, otherRoute)
+	recorder := r.EventRecorder.(*record.FakeRecorder)
+	if err := r.reconcileAppRoutes(context.TODO(), nb, routingCfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	route := routingCfg.Object()
+	key := client.ObjectKey{Name: "notebook-ns-nb-app-tensorboard", Namespace: "ns"}
+	if err := c.Get(context.TODO(), key, route); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !metav1.IsControlledBy(route, other) {
+		t.Errorf("Expected the route of the other Notebook to be kept, got %+v", route.Object["metadata"])
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "RouteConflict") {
+		t.Errorf("Got the event %q", event)
+	}
+	key.Name = "notebook-ns-nb-app-streamlit"
+	if err := c.Get(context.TODO(), key, route); err != nil {
+		t.Errorf("Expected the route of the other app to exist: %v", err)
+	}
+}
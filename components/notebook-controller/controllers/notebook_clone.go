@@ -0,0 +1,301 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+const (
+	// AnnotationClonedFrom is set on the cloned Notebooks to the name of
+	// their source Notebook, once it was copied, and on the cloned PVCs to
+	// the name of their source PVC.
+	AnnotationClonedFrom = "notebooks.kubeflow.org/cloned-from"
+
+	// The source of a clone isn't watched, but polled until it exists
+	cloneSourcePollPeriod = 10 * time.Second
+)
+
+// volumeClone is a PVC of the source Notebook that is cloned for the clone
+type volumeClone struct {
+	sourceClaimName string
+	claimName       string
+	// owned clones are deleted along with the clone, like the PVCs of
+	// volume claim templates with the Delete retention policy
+	owned bool
+}
+
+// copyCloneSource copies the pod template, the labels and the volume claim
+// templates of the source into the clone, unless the clone sets them itself,
+// and returns the PVCs of the source to clone when the clone's volumes are
+// cloned. The cloned PVCs are named like the PVCs of volume claim templates.
+// The clones of the template's PVCs only exist for the clone, so they are
+// owned by it. The clones of the volume claim templates follow the retention
+// policy of their template.
+func copyCloneSource(nb, source *v1beta1.Notebook) []volumeClone {
+	clones := []volumeClone{}
+	cloneVolumes := nb.Spec.CloneFrom.CloneVolumes
+
+	if len(nb.Spec.Template.Spec.Containers) == 0 {
+		nb.Spec.Template = *source.Spec.Template.DeepCopy()
+		// The webhook requires the container to be named after the Notebook
+		nb.Spec.Template.Spec.Containers[0].Name = nb.Name
+		if cloneVolumes {
+			for i := range nb.Spec.Template.Spec.Volumes {
+				volume := &nb.Spec.Template.Spec.Volumes[i]
+				if volume.PersistentVolumeClaim == nil {
+					continue
+				}
+				clone := volumeClone{
+					sourceClaimName: volume.PersistentVolumeClaim.ClaimName,
+					claimName:       nb.Name + "-" + volume.Name,
+					owned:           true,
+				}
+				volume.PersistentVolumeClaim.ClaimName = clone.claimName
+				clones = append(clones, clone)
+			}
+		}
+	}
+
+	if len(nb.Spec.VolumeClaimTemplates) == 0 && len(source.Spec.VolumeClaimTemplates) > 0 {
+		nb.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{}
+		for i := range source.Spec.VolumeClaimTemplates {
+			template := source.Spec.VolumeClaimTemplates[i].DeepCopy()
+			nb.Spec.VolumeClaimTemplates = append(nb.Spec.VolumeClaimTemplates, *template)
+			if cloneVolumes {
+				clones = append(clones, volumeClone{
+					sourceClaimName: volumeClaimName(source, template),
+					claimName:       volumeClaimName(nb, template),
+					owned:           template.RetentionPolicy == v1beta1.VolumeClaimDelete,
+				})
+			}
+		}
+	}
+
+	// The labels select the PodDefaults of the notebook Pod
+	if nb.Labels == nil {
+		nb.Labels = map[string]string{}
+	}
+	for k, v := range source.Labels {
+		if _, ok := nb.Labels[k]; !ok {
+			nb.Labels[k] = v
+		}
+	}
+
+	if nb.Annotations == nil {
+		nb.Annotations = map[string]string{}
+	}
+	nb.Annotations[AnnotationClonedFrom] = source.Name
+	return clones
+}
+
+// generateVolumeClone returns a PVC with the settings of the source PVC, that
+// is populated from it through CSI volume cloning. It is labeled with the
+// name of the clone, so it is picked up as the PVC of a copied volume claim
+// template.
+func generateVolumeClone(nb *v1beta1.Notebook, source *corev1.PersistentVolumeClaim, name string) *corev1.PersistentVolumeClaim {
+	// The clone can't be smaller than its source
+	size, ok := source.Status.Capacity[corev1.ResourceStorage]
+	if !ok {
+		size = source.Spec.Resources.Requests[corev1.ResourceStorage]
+	}
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   nb.Namespace,
+			Labels:      map[string]string{"notebook-name": nb.Name},
+			Annotations: map[string]string{AnnotationClonedFrom: source.Name},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      source.Spec.AccessModes,
+			StorageClassName: source.Spec.StorageClassName,
+			VolumeMode:       source.Spec.VolumeMode,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+			DataSource: &corev1.TypedLocalObjectReference{
+				Kind: "PersistentVolumeClaim",
+				Name: source.Name,
+			},
+		},
+	}
+}
+
+// reconcileClone copies the source of a cloned Notebook into it and creates
+// the clones of the source's PVCs, once. It returns false while the source
+// doesn't exist yet.
+func (r *NotebookReconciler) reconcileClone(ctx context.Context, nb *v1beta1.Notebook, log logr.Logger) (bool, error) {
+	if nb.Spec.CloneFrom == nil || nb.Annotations[AnnotationClonedFrom] != "" {
+		return true, nil
+	}
+
+	source := &v1beta1.Notebook{}
+	err := r.Get(ctx, types.NamespacedName{Name: nb.Spec.CloneFrom.Name, Namespace: nb.Namespace}, source)
+	if err != nil && !apierrs.IsNotFound(err) {
+		return false, err
+	}
+	// The source can be a clone that wasn't copied yet
+	if err != nil || len(source.Spec.Template.Spec.Containers) == 0 {
+		message := fmt.Sprintf("Waiting for Notebook %s to clone", nb.Spec.CloneFrom.Name)
+		r.EventRecorder.Event(nb, corev1.EventTypeWarning, "CloneSourceNotFound", message)
+		return false, r.setCloneConditions(ctx, nb, "WaitingForCloneSource", message)
+	}
+
+	copiesTemplate := len(nb.Spec.Template.Spec.Containers) == 0
+	clones := copyCloneSource(nb, source)
+	for _, clone := range clones {
+		sourceClaim := &corev1.PersistentVolumeClaim{}
+		if err := r.Get(ctx, types.NamespacedName{Name: clone.sourceClaimName, Namespace: nb.Namespace}, sourceClaim); err != nil {
+			return false, err
+		}
+		pvc := generateVolumeClone(nb, sourceClaim, clone.claimName)
+		if clone.owned {
+			if err := ctrl.SetControllerReference(nb, pvc, r.Scheme); err != nil {
+				return false, err
+			}
+		}
+		log.Info("Cloning PersistentVolumeClaim", "namespace", pvc.Namespace, "name", pvc.Name, "source", sourceClaim.Name)
+		if err := r.Create(ctx, pvc); err != nil && !apierrs.IsAlreadyExists(err) {
+			return false, err
+		}
+	}
+
+	if copiesTemplate && !nb.Spec.CloneFrom.CloneVolumes {
+		shared, err := r.sharedSingleNodeClaims(ctx, nb)
+		if err != nil {
+			return false, err
+		}
+		if len(shared) > 0 {
+			r.EventRecorder.Event(nb, corev1.EventTypeWarning, "SharedVolumes", fmt.Sprintf(
+				"The clone mounts the PersistentVolumeClaims %s of Notebook %s, which can only be mounted by one "+
+					"node at a time. Set spec.cloneFrom.cloneVolumes to clone them instead.",
+				strings.Join(shared, ", "), source.Name))
+		}
+	}
+
+	log.Info("Copying the source Notebook into the clone", "source", source.Name)
+	if err := r.Update(ctx, nb); err != nil {
+		return false, err
+	}
+	r.EventRecorder.Event(nb, corev1.EventTypeNormal, "Cloned",
+		fmt.Sprintf("Cloned Notebook %s and %d of its PersistentVolumeClaims", source.Name, len(clones)))
+	return true, nil
+}
+
+// sharedSingleNodeClaims returns the PVCs of the Notebook's template that can
+// only be mounted by a single node, which a clone that doesn't clone its
+// volumes shares with its source
+func (r *NotebookReconciler) sharedSingleNodeClaims(ctx context.Context, nb *v1beta1.Notebook) ([]string, error) {
+	shared := []string{}
+	for _, volume := range nb.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: volume.PersistentVolumeClaim.ClaimName, Namespace: nb.Namespace}, pvc)
+		if apierrs.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, mode := range pvc.Spec.AccessModes {
+			if mode == corev1.ReadWriteOnce || mode == corev1.ReadWriteOncePod {
+				shared = append(shared, pvc.Name)
+				break
+			}
+		}
+	}
+	return shared, nil
+}
+
+// pendingVolumeClones returns the names of the cloned PVCs of the Notebook
+// that aren't bound yet. The PVCs of storage classes that bind their volumes
+// once a Pod uses them aren't waited for.
+func (r *NotebookReconciler) pendingVolumeClones(ctx context.Context, nb *v1beta1.Notebook) ([]string, error) {
+	if nb.Spec.CloneFrom == nil || !nb.Spec.CloneFrom.CloneVolumes {
+		return nil, nil
+	}
+	pvcs, err := r.getNotebookVolumeClaims(ctx, nb)
+	if err != nil {
+		return nil, err
+	}
+	pending := []string{}
+	for name, pvc := range pvcs {
+		if pvc == nil || pvc.Annotations[AnnotationClonedFrom] == "" || pvc.Status.Phase == corev1.ClaimBound {
+			continue
+		}
+		if pvc.Spec.StorageClassName != nil {
+			class := &storagev1.StorageClass{}
+			err := r.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, class)
+			if err != nil && !apierrs.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil && class.VolumeBindingMode != nil &&
+				*class.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+				continue
+			}
+		}
+		pending = append(pending, name)
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
+
+// setCloneConditions reports that the clone is waiting to be started, since
+// its StatefulSet doesn't exist yet to compute its conditions from
+func (r *NotebookReconciler) setCloneConditions(ctx context.Context, nb *v1beta1.Notebook, reason, message string) error {
+	for _, conditionType := range []string{v1beta1.NotebookConditionReady, v1beta1.NotebookConditionProgressing} {
+		status := metav1.ConditionFalse
+		if conditionType == v1beta1.NotebookConditionProgressing {
+			status = metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(&nb.Status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             status,
+			ObservedGeneration: nb.Generation,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+	return r.Status().Update(ctx, nb)
+}
+
+// waitForVolumeClones reports the cloned PVCs the Notebook is waiting for,
+// and returns true while there are any
+func (r *NotebookReconciler) waitForVolumeClones(ctx context.Context, nb *v1beta1.Notebook, log logr.Logger) (bool, error) {
+	pending, err := r.pendingVolumeClones(ctx, nb)
+	if err != nil || len(pending) == 0 {
+		return false, err
+	}
+	log.Info("Waiting for the cloned PersistentVolumeClaims to be bound", "pvcs", pending)
+	return true, r.setCloneConditions(ctx, nb, "CloningVolumes",
+		fmt.Sprintf("Waiting for the cloned PersistentVolumeClaims to be bound: %s", strings.Join(pending, ", ")))
+}
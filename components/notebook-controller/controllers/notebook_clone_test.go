@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func newCloneSource() (*v1beta1.Notebook, []client.Object) {
+	source := newTestNotebook("nb")
+	source.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{
+		newTestClaimTemplate("5Gi", v1beta1.VolumeClaimDelete),
+	}
+	source.Labels = map[string]string{"access-ml-pipeline": "true"}
+	source.Spec.Template.Spec.Volumes = []corev1.Volume{{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "datasets"},
+		},
+	}}
+	storageClass := "csi-rbd"
+	claims := []client.Object{}
+	for _, name := range []string{"datasets", "nb-workspace"} {
+		claims = append(claims, &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: &storageClass,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+				},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Phase:    corev1.ClaimBound,
+				Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("8Gi")},
+			},
+		})
+	}
+	return source, claims
+}
+
+func newClone(cloneVolumes bool) *v1beta1.Notebook {
+	return &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "copy",
+			Namespace: "ns",
+			Labels:    map[string]string{"access-ml-pipeline": "false"},
+		},
+		Spec: v1beta1.NotebookSpec{
+			CloneFrom: &v1beta1.NotebookCloneSource{Name: "nb", CloneVolumes: cloneVolumes},
+		},
+	}
+}
+
+func TestCopyCloneSource(t *testing.T) {
+	source, _ := newCloneSource()
+
+	nb := newClone(false)
+	clones := copyCloneSource(nb, source)
+	if len(clones) != 0 {
+		t.Errorf("Expected no PVCs to be cloned, got %+v", clones)
+	}
+	containers := nb.Spec.Template.Spec.Containers
+	if len(containers) != 1 || containers[0].Name != "copy" || containers[0].Image != "jupyter" {
+		t.Errorf("Got the containers %+v", containers)
+	}
+	if source.Spec.Template.Spec.Containers[0].Name != "nb" {
+		t.Errorf("Expected the source to be unchanged")
+	}
+	// Without cloning, the clone mounts the PVCs of the source's template
+	// and gets new PVCs from its volume claim templates
+	if claim := nb.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != "datasets" {
+		t.Errorf("Got the claim %s", claim)
+	}
+	if len(nb.Spec.VolumeClaimTemplates) != 1 || nb.Spec.VolumeClaimTemplates[0].Name != "workspace" {
+		t.Errorf("Got the volume claim templates %+v", nb.Spec.VolumeClaimTemplates)
+	}
+	// The labels of the clone take precedence
+	if nb.Labels["access-ml-pipeline"] != "false" || nb.Annotations[AnnotationClonedFrom] != "nb" {
+		t.Errorf("Got the labels %v and the annotations %v", nb.Labels, nb.Annotations)
+	}
+
+	nb = newClone(true)
+	clones = copyCloneSource(nb, source)
+	expected := []volumeClone{
+		{sourceClaimName: "datasets", claimName: "copy-data", owned: true},
+		{sourceClaimName: "nb-workspace", claimName: "copy-workspace", owned: true},
+	}
+	if !reflect.DeepEqual(clones, expected) {
+		t.Errorf("Got the clones %+v, Expected %+v", clones, expected)
+	}
+	if claim := nb.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != "copy-data" {
+		t.Errorf("Got the claim %s", claim)
+	}
+}
+
+func TestReconcileClone(t *testing.T) {
+	source, claims := newCloneSource()
+	nb := newClone(true)
+	r, c := newTestNotebookReconciler(nb)
+
+	// The clone waits for its source
+	cloned, err := r.reconcileClone(context.TODO(), nb, TestLogger)
+	if err != nil || cloned {
+		t.Fatalf("Got %v and the error %v, Expected the clone to wait", cloned, err)
+	}
+	if !meta.IsStatusConditionTrue(nb.Status.Conditions, v1beta1.NotebookConditionProgressing) {
+		t.Errorf("Got the conditions %+v", nb.Status.Conditions)
+	}
+
+	for _, obj := range append(claims, source) {
+		if err := c.Create(context.TODO(), obj); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	cloned, err = r.reconcileClone(context.TODO(), nb, TestLogger)
+	if err != nil || !cloned {
+		t.Fatalf("Got %v and the error %v, Expected the clone to be copied", cloned, err)
+	}
+	stored := &v1beta1.Notebook{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "copy", Namespace: "ns"}, stored); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stored.Annotations[AnnotationClonedFrom] != "nb" || len(stored.Spec.Template.Spec.Containers) != 1 {
+		t.Errorf("Expected the copy to be stored, got %+v", stored)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "copy-workspace", Namespace: "ns"}, pvc); err != nil {
+		t.Fatalf("Expected the PVC to be cloned: %v", err)
+	}
+	if pvc.Spec.DataSource == nil || pvc.Spec.DataSource.Kind != "PersistentVolumeClaim" ||
+		pvc.Spec.DataSource.Name != "nb-workspace" || pvc.Labels["notebook-name"] != "copy" {
+		t.Errorf("Got the PVC %+v", pvc)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "8Gi" {
+		t.Errorf("Expected the clone to have the capacity of its source, got %s", size.String())
+	}
+	data := &corev1.PersistentVolumeClaim{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "copy-data", Namespace: "ns"}, data); err != nil {
+		t.Fatalf("Expected the PVC to be cloned: %v", err)
+	}
+	if !metav1.IsControlledBy(data, nb) {
+		t.Errorf("Expected the clone of the template's PVC to be owned by the clone, got %+v", data.OwnerReferences)
+	}
+
+	// The clone starts once its PVCs are bound
+	pending, err := r.pendingVolumeClones(context.TODO(), stored)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pending, []string{"copy-data", "copy-workspace"}) {
+		t.Errorf("Got the pending PVCs %v", pending)
+	}
+	pvc.Status.Phase = corev1.ClaimBound
+	if err := c.Status().Update(context.TODO(), pvc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The PVCs of storage classes that wait for the first consumer are
+	// bound once the notebook Pod is created
+	waitForConsumer := storagev1.VolumeBindingWaitForFirstConsumer
+	class := &storagev1.StorageClass{
+		ObjectMeta:        metav1.ObjectMeta{Name: "csi-rbd"},
+		Provisioner:       "rbd.csi.ceph.com",
+		VolumeBindingMode: &waitForConsumer,
+	}
+	if err := c.Create(context.TODO(), class); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pending, err = r.pendingVolumeClones(context.TODO(), stored)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Got the pending PVCs %v and the error %v", pending, err)
+	}
+
+	// The clone is only copied once
+	stored.Spec.Template.Spec.Containers[0].Image = "jupyter:v2"
+	if cloned, err := r.reconcileClone(context.TODO(), stored, TestLogger); err != nil || !cloned {
+		t.Fatalf("Got %v and the error %v", cloned, err)
+	}
+	if stored.Spec.Template.Spec.Containers[0].Image != "jupyter:v2" {
+		t.Errorf("Expected the clone to keep its changes")
+	}
+}
+
+func TestReconcileCloneSharedVolumes(t *testing.T) {
+	source, claims := newCloneSource()
+	nb := newClone(false)
+	r, _ := newTestNotebookReconciler(append(claims, source, nb)...)
+	recorder := r.EventRecorder.(*record.FakeRecorder)
+
+	if cloned, err := r.reconcileClone(context.TODO(), nb, TestLogger); err != nil || !cloned {
+		t.Fatalf("Got %v and the error %v, Expected the clone to be copied", cloned, err)
+	}
+	event := <-recorder.Events
+	if !strings.Contains(event, "SharedVolumes") || !strings.Contains(event, "datasets") {
+		t.Errorf("Expected a SharedVolumes event about datasets, got %q", event)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+// notebookConditionTypes are the condition types that are kept in the
+// Notebook's status. Any other condition, e.g. mirrored from the Pod by older
+// versions of the controller, is dropped.
+var notebookConditionTypes = map[string]bool{
+	v1beta1.NotebookConditionReady:            true,
+	v1beta1.NotebookConditionProgressing:      true,
+	v1beta1.NotebookConditionDegraded:         true,
+	v1beta1.NotebookConditionStopped:          true,
+	v1beta1.NotebookConditionCulled:           true,
+	v1beta1.NotebookConditionCullingScheduled: true,
+	v1beta1.NotebookConditionPendingUpdate:    true,
+}
+
+// Reasons of container states that mean the Notebook can't run without
+// intervention
+var degradedContainerReasons = map[string]string{
+	"ErrImagePull":               "ImagePullFailed",
+	"ImagePullBackOff":           "ImagePullFailed",
+	"InvalidImageName":           "ImagePullFailed",
+	"ErrImageNeverPull":          "ImagePullFailed",
+	"CrashLoopBackOff":           "CrashLoopBackOff",
+	"CreateContainerConfigError": "ContainerCreationFailed",
+	"CreateContainerError":       "ContainerCreationFailed",
+	"RunContainerError":          "ContainerCreationFailed",
+}
+
+// getNotebookVolumeClaims returns the PVCs mounted by the Notebook, by claim
+// name. Claims that don't exist are mapped to nil.
+func (r *NotebookReconciler) getNotebookVolumeClaims(ctx context.Context, nb *v1beta1.Notebook) (map[string]*corev1.PersistentVolumeClaim, error) {
+	pvcs := map[string]*corev1.PersistentVolumeClaim{}
+	for _, v := range notebookVolumes(nb) {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		name := v.PersistentVolumeClaim.ClaimName
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: nb.Namespace}, pvc)
+		if err != nil && apierrs.IsNotFound(err) {
+			pvcs[name] = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		pvcs[name] = pvc
+	}
+	return pvcs, nil
+}
+
+// computeNotebookConditions computes the conditions of the Notebook from the
+// state of its StatefulSet, Pod and PVCs. The LastTransitionTime of conditions
+// whose status didn't change is preserved.
+func computeNotebookConditions(nb *v1beta1.Notebook, status *v1beta1.NotebookStatus,
+	sts *appsv1.StatefulSet, pod *corev1.Pod, pvcs map[string]*corev1.PersistentVolumeClaim) []metav1.Condition {
+
+	conditions := []metav1.Condition{}
+	for _, c := range nb.Status.Conditions {
+		if notebookConditionTypes[c.Type] {
+			conditions = append(conditions, c)
+		}
+	}
+	set := func(conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			ObservedGeneration: nb.Generation,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+
+	podExists := pod.Name != ""
+	ready := sts.Status.ReadyReplicas > 0
+
+	if notebookIsStopped(nb) {
+		set(v1beta1.NotebookConditionStopped, metav1.ConditionTrue,
+			string(status.StopReason), "Notebook is stopped")
+		if status.StopReason == v1beta1.NotebookStopReasonCulled {
+			set(v1beta1.NotebookConditionCulled, metav1.ConditionTrue,
+				"Idle", "Notebook was stopped by the culler because it was idle")
+		} else {
+			set(v1beta1.NotebookConditionCulled, metav1.ConditionFalse, "NotCulled", "")
+		}
+		set(v1beta1.NotebookConditionReady, metav1.ConditionFalse, "Stopped", "Notebook is stopped")
+		set(v1beta1.NotebookConditionDegraded, metav1.ConditionFalse, "Stopped", "")
+		if podExists {
+			set(v1beta1.NotebookConditionProgressing, metav1.ConditionTrue,
+				"Stopping", "Waiting for the Pod to terminate")
+		} else {
+			set(v1beta1.NotebookConditionProgressing, metav1.ConditionFalse, "Stopped", "")
+		}
+		return conditions
+	}
+
+	set(v1beta1.NotebookConditionStopped, metav1.ConditionFalse, "Running", "")
+	set(v1beta1.NotebookConditionCulled, metav1.ConditionFalse, "NotCulled", "")
+
+	if ready {
+		set(v1beta1.NotebookConditionReady, metav1.ConditionTrue, "PodReady", "Notebook is ready")
+	} else {
+		message := "Waiting for the Pod to be created"
+		if podExists {
+			message = "Waiting for the Pod to become ready"
+			if c := podCondition(pod, corev1.PodReady); c != nil && c.Message != "" {
+				message = c.Message
+			}
+		}
+		set(v1beta1.NotebookConditionReady, metav1.ConditionFalse, "PodNotReady", message)
+	}
+
+	if reason, message := notebookDegradation(pod, pvcs); reason != "" {
+		set(v1beta1.NotebookConditionDegraded, metav1.ConditionTrue, reason, message)
+	} else {
+		set(v1beta1.NotebookConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	}
+
+	switch {
+	case sts.Status.UpdateRevision != "" && sts.Status.CurrentRevision != sts.Status.UpdateRevision:
+		set(v1beta1.NotebookConditionProgressing, metav1.ConditionTrue,
+			"Updating", "The Pod is being updated to the latest revision")
+	case !ready:
+		set(v1beta1.NotebookConditionProgressing, metav1.ConditionTrue,
+			"Starting", "Waiting for the Pod to become ready")
+	default:
+		set(v1beta1.NotebookConditionProgressing, metav1.ConditionFalse, "Complete", "")
+	}
+
+	return conditions
+}
+
+// notebookDegradation returns the reason and message of the first problem
+// that keeps the Notebook from running, or an empty reason.
+func notebookDegradation(pod *corev1.Pod, pvcs map[string]*corev1.PersistentVolumeClaim) (string, string) {
+	names := []string{}
+	for name := range pvcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pvc := pvcs[name]
+		if pvc == nil {
+			return "VolumeClaimNotFound", fmt.Sprintf("PersistentVolumeClaim %s not found", name)
+		}
+		if pvc.Status.Phase == corev1.ClaimLost {
+			return "VolumeClaimLost", fmt.Sprintf("PersistentVolumeClaim %s lost its volume", name)
+		}
+	}
+
+	if c := podCondition(pod, corev1.PodScheduled); c != nil &&
+		c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+		return "Unschedulable", c.Message
+	}
+
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if cs.State.Waiting == nil {
+			continue
+		}
+		if reason, ok := degradedContainerReasons[cs.State.Waiting.Reason]; ok {
+			return reason, fmt.Sprintf("container %s: %s: %s",
+				cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+		}
+	}
+	return "", ""
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func TestComputeNotebookConditions(t *testing.T) {
+	runningPod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-0"},
+	}
+	readySts := appsv1.StatefulSet{
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 1},
+	}
+
+	tests := []struct {
+		name     string
+		nb       v1beta1.Notebook
+		status   v1beta1.NotebookStatus
+		sts      appsv1.StatefulSet
+		pod      corev1.Pod
+		pvcs     map[string]*corev1.PersistentVolumeClaim
+		expected map[string]string
+	}{
+		{
+			name: "ReadyNotebook",
+			sts:  readySts,
+			pod:  runningPod,
+			expected: map[string]string{
+				v1beta1.NotebookConditionReady:       "True/PodReady",
+				v1beta1.NotebookConditionProgressing: "False/Complete",
+				v1beta1.NotebookConditionDegraded:    "False/AsExpected",
+				v1beta1.NotebookConditionStopped:     "False/Running",
+				v1beta1.NotebookConditionCulled:      "False/NotCulled",
+			},
+		},
+		{
+			name: "StartingNotebook",
+			expected: map[string]string{
+				v1beta1.NotebookConditionReady:       "False/PodNotReady",
+				v1beta1.NotebookConditionProgressing: "True/Starting",
+				v1beta1.NotebookConditionDegraded:    "False/AsExpected",
+			},
+		},
+		{
+			name: "UpdatingNotebook",
+			sts: appsv1.StatefulSet{
+				Status: appsv1.StatefulSetStatus{
+					ReadyReplicas:   1,
+					CurrentRevision: "test-1",
+					UpdateRevision:  "test-2",
+				},
+			},
+			pod: runningPod,
+			expected: map[string]string{
+				v1beta1.NotebookConditionReady:       "True/PodReady",
+				v1beta1.NotebookConditionProgressing: "True/Updating",
+			},
+		},
+		{
+			name: "ImagePullFailure",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-0"},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "test",
+							State: corev1.ContainerState{
+								Waiting: &corev1.ContainerStateWaiting{
+									Reason:  "ImagePullBackOff",
+									Message: "Back-off pulling image",
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: map[string]string{
+				v1beta1.NotebookConditionReady:    "False/PodNotReady",
+				v1beta1.NotebookConditionDegraded: "True/ImagePullFailed",
+			},
+		},
+		{
+			name: "UnschedulablePod",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-0"},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:    corev1.PodScheduled,
+							Status:  corev1.ConditionFalse,
+							Reason:  corev1.PodReasonUnschedulable,
+							Message: "0/1 nodes are available: 1 Insufficient cpu.",
+						},
+					},
+				},
+			},
+			expected: map[string]string{
+				v1beta1.NotebookConditionDegraded: "True/Unschedulable",
+			},
+		},
+		{
+			name: "MissingVolumeClaim",
+			pvcs: map[string]*corev1.PersistentVolumeClaim{
+				"workspace": nil,
+			},
+			expected: map[string]string{
+				v1beta1.NotebookConditionDegraded: "True/VolumeClaimNotFound",
+			},
+		},
+		{
+			name: "StoppingNotebook",
+			nb: v1beta1.Notebook{
+				Spec: v1beta1.NotebookSpec{State: v1beta1.NotebookStateStopped},
+			},
+			status: v1beta1.NotebookStatus{StopReason: v1beta1.NotebookStopReasonUserRequested},
+			pod:    runningPod,
+			expected: map[string]string{
+				v1beta1.NotebookConditionStopped:     "True/UserRequested",
+				v1beta1.NotebookConditionCulled:      "False/NotCulled",
+				v1beta1.NotebookConditionReady:       "False/Stopped",
+				v1beta1.NotebookConditionProgressing: "True/Stopping",
+			},
+		},
+		{
+			name: "CulledNotebook",
+			nb: v1beta1.Notebook{
+				Spec: v1beta1.NotebookSpec{State: v1beta1.NotebookStateStopped},
+			},
+			status: v1beta1.NotebookStatus{StopReason: v1beta1.NotebookStopReasonCulled},
+			expected: map[string]string{
+				v1beta1.NotebookConditionStopped:     "True/Culled",
+				v1beta1.NotebookConditionCulled:      "True/Idle",
+				v1beta1.NotebookConditionProgressing: "False/Stopped",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conditions := computeNotebookConditions(&test.nb, &test.status, &test.sts, &test.pod, test.pvcs)
+			for conditionType, expected := range test.expected {
+				c := meta.FindStatusCondition(conditions, conditionType)
+				if c == nil {
+					t.Errorf("Condition %s not found", conditionType)
+					continue
+				}
+				if got := string(c.Status) + "/" + c.Reason; got != expected {
+					t.Errorf("Condition %s: got %s, expected %s", conditionType, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeNotebookConditionsTransitions(t *testing.T) {
+	transition := metav1.NewTime(time.Date(2022, 8, 30, 1, 10, 30, 0, time.UTC))
+	nb := v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Generation: 3},
+		Status: v1beta1.NotebookStatus{
+			Conditions: []metav1.Condition{
+				{
+					Type:               v1beta1.NotebookConditionReady,
+					Status:             metav1.ConditionTrue,
+					Reason:             "PodReady",
+					LastTransitionTime: transition,
+				},
+				{
+					Type:               v1beta1.NotebookConditionDegraded,
+					Status:             metav1.ConditionTrue,
+					Reason:             "ImagePullFailed",
+					LastTransitionTime: transition,
+				},
+				{
+					Type:               "PodScheduled",
+					Status:             metav1.ConditionTrue,
+					Reason:             "Scheduled",
+					LastTransitionTime: transition,
+				},
+			},
+		},
+	}
+	sts := appsv1.StatefulSet{
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 1},
+	}
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-0"}}
+
+	conditions := computeNotebookConditions(&nb, &v1beta1.NotebookStatus{}, &sts, &pod, nil)
+
+	ready := meta.FindStatusCondition(conditions, v1beta1.NotebookConditionReady)
+	if !ready.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Ready didn't change, expected the transition time to be kept, got %s", ready.LastTransitionTime)
+	}
+	if ready.ObservedGeneration != 3 {
+		t.Errorf("Expected observedGeneration 3, got %d", ready.ObservedGeneration)
+	}
+	degraded := meta.FindStatusCondition(conditions, v1beta1.NotebookConditionDegraded)
+	if degraded.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Degraded changed, expected a new transition time")
+	}
+	if meta.FindStatusCondition(conditions, "PodScheduled") != nil {
+		t.Errorf("Expected mirrored Pod conditions to be dropped")
+	}
+}
@@ -18,21 +18,22 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"reflect"
-	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	reconcilehelper "github.com/kubeflow/kubeflow/components/common/reconcilehelper"
+	"github.com/kubeflow/kubeflow/components/common/routing"
 	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
 	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/metrics"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -47,16 +48,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
-const DefaultContainerPort = 8888
-const DefaultServingPort = 80
-const AnnotationRewriteURI = "notebooks.kubeflow.org/http-rewrite-uri"
-const AnnotationHeadersRequestSet = "notebooks.kubeflow.org/http-headers-request-set"
+const DefaultServingPort = v1beta1.DefaultServingPort
 
 const PrefixEnvVar = "NB_PREFIX"
 
-// The default fsGroup of PodSecurityContext.
-// https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.11/#podsecuritycontext-v1-core
-const DefaultFSGroup = int64(100)
+// statefulSetDeletionPollPeriod is how often the controller checks whether a
+// StatefulSet it is recreating is gone
+const statefulSetDeletionPollPeriod = 5 * time.Second
 
 /*
 We generally want to ignore (not requeue) NotFound errors, since we'll get a
@@ -77,50 +75,29 @@ type NotebookReconciler struct {
 	Scheme        *runtime.Scheme
 	Metrics       *metrics.Metrics
 	EventRecorder record.EventRecorder
+	Config        *config.Provider
+	// APIReader reads the objects that aren't cached, like the Secrets of
+	// the users
+	APIReader client.Reader
 }
 
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
 // +kubebuilder:rbac:groups=core,resources=services,verbs="*"
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs="*"
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=kubeflow.org,resources=notebooks;notebooks/status;notebooks/finalizers,verbs="*"
 // +kubebuilder:rbac:groups="networking.istio.io",resources=virtualservices,verbs="*"
+// +kubebuilder:rbac:groups="gateway.networking.k8s.io",resources=httproutes;tcproutes,verbs="*"
 
 func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("notebook", req.NamespacedName)
 	log.Info("Reconciliation loop started")
 
-	// TODO(yanniszark): Can we avoid reconciling Events and Notebook in the same queue?
-	event := &corev1.Event{}
-	var getEventErr error
-	getEventErr = r.Get(ctx, req.NamespacedName, event)
-	if getEventErr == nil {
-		log.Info("Found event for Notebook. Re-emitting...")
-
-		// Find the Notebook that corresponds to the triggered event
-		involvedNotebook := &v1beta1.Notebook{}
-		nbName, err := nbNameFromInvolvedObject(r.Client, &event.InvolvedObject)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-
-		involvedNotebookKey := types.NamespacedName{Name: nbName, Namespace: req.Namespace}
-		if err := r.Get(ctx, involvedNotebookKey, involvedNotebook); err != nil {
-			log.Error(err, "unable to fetch Notebook by looking at event")
-			return ctrl.Result{}, ignoreNotFound(err)
-		}
-
-		// re-emit the event in the Notebook CR
-		log.Info("Emitting Notebook Event.", "Event", event)
-		r.EventRecorder.Eventf(involvedNotebook, event.Type, event.Reason,
-			"Reissued from %s/%s: %s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name, event.Message)
-		return ctrl.Result{}, nil
-	}
-
-	if getEventErr != nil && !apierrs.IsNotFound(getEventErr) {
-		return ctrl.Result{}, getEventErr
-	}
-	// If not found, continue. Is not an event.
 	instance := &v1beta1.Notebook{}
 	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
 		log.Error(err, "unable to fetch Notebook")
@@ -131,20 +108,68 @@ func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	// reconcile loop might keep on trying to recreate the resources that the API server tries to delete.
 	// so when Notebook CR is terminating, reconcile loop should do nothing
 
+	// The only thing left to do is releasing the port of the gateway of its
+	// SSH server, if any
 	if !instance.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalizeGatewayPort(ctx, instance, &r.Config.Get().RemoteAccess)
+	}
+
+	// Copy the source of a clone into it before anything is generated from
+	// its spec
+	cloned, err := r.reconcileClone(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !cloned {
+		return ctrl.Result{RequeueAfter: cloneSourcePollPeriod}, nil
+	}
+
+	// Notebooks without containers are rejected by the validating webhook,
+	// but can still exist if it's disabled
+	if len(instance.Spec.Template.Spec.Containers) == 0 {
+		log.Info("Notebook has no containers, not reconciling it")
+		r.EventRecorder.Event(instance, corev1.EventTypeWarning, "InvalidSpec",
+			"Notebook has no containers")
 		return ctrl.Result{}, nil
 	}
 
+	// Reconcile the PVCs of the volume claim templates before the StatefulSet
+	// that mounts them
+	instance.Status.VolumeClaims, err = r.reconcileVolumeClaims(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the token the culler authenticates to the Notebook with, if
+	// any, before the StatefulSet that reads it
+	cfg := r.Config.Get()
+	probeTokenSecret, err := r.reconcileProbeToken(ctx, instance, cfg, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Reconcile StatefulSet
-	ss := generateStatefulSet(instance)
+	ss := generateStatefulSet(instance, cfg)
+	if probeTokenSecret != "" {
+		setProbeTokenEnvVar(&ss.Spec.Template.Spec.Containers[0], probeTokenSecret)
+	}
 	if err := ctrl.SetControllerReference(instance, ss, r.Scheme); err != nil {
 		return ctrl.Result{}, err
 	}
+	if err := setLastAppliedPodSpec(ss); err != nil {
+		return ctrl.Result{}, err
+	}
 	// Check if the StatefulSet already exists
 	foundStateful := &appsv1.StatefulSet{}
 	justCreated := false
-	err := r.Get(ctx, types.NamespacedName{Name: ss.Name, Namespace: ss.Namespace}, foundStateful)
+	err = r.Get(ctx, types.NamespacedName{Name: ss.Name, Namespace: ss.Namespace}, foundStateful)
 	if err != nil && apierrs.IsNotFound(err) {
+		// A clone is started once its cloned PVCs are populated. They are
+		// watched like the PVCs of the volume claim templates.
+		waiting, err := r.waitForVolumeClones(ctx, instance, log)
+		if err != nil || waiting {
+			return ctrl.Result{}, err
+		}
 		log.Info("Creating StatefulSet", "namespace", ss.Namespace, "name", ss.Name)
 		r.Metrics.NotebookCreation.WithLabelValues(ss.Namespace).Inc()
 		err = r.Create(ctx, ss)
@@ -157,9 +182,34 @@ func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	} else if err != nil {
 		log.Error(err, "error getting Statefulset")
 		return ctrl.Result{}, err
+	} else if ss.Spec.ServiceName != "" && foundStateful.Spec.ServiceName != ss.Spec.ServiceName {
+		// The service name of a StatefulSet is immutable, so the StatefulSet
+		// of a Notebook that didn't have workers is recreated when they are
+		// added
+		if foundStateful.DeletionTimestamp.IsZero() {
+			log.Info("Recreating StatefulSet for the headless Service", "namespace", ss.Namespace, "name", ss.Name)
+			r.EventRecorder.Event(instance, corev1.EventTypeNormal, "RecreatingStatefulSet",
+				"Notebook is restarted to make it resolvable through the headless Service of its workers")
+			err = r.Delete(ctx, foundStateful, client.PropagationPolicy(metav1.DeletePropagationForeground))
+			if ignoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: statefulSetDeletionPollPeriod}, nil
+	}
+	// Changes to the pod template can be held by the update strategy, so
+	// they don't restart a running notebook
+	pendingChanges := []string{}
+	if !justCreated {
+		pendingChanges, err = holdPodTemplateUpdate(instance, ss, foundStateful)
+		if err != nil {
+			log.Error(err, "unable to compare the pod spec of the StatefulSet")
+			return ctrl.Result{}, err
+		}
 	}
+	setPendingUpdateCondition(instance, pendingChanges)
 	// Update the foundStateful object and write the result back if there are any changes
-	if !justCreated && reconcilehelper.CopyStatefulSetFields(ss, foundStateful) {
+	if !justCreated && copyStatefulSetFields(ss, foundStateful) {
 		log.Info("Updating StatefulSet", "namespace", ss.Namespace, "name", ss.Name)
 		err = r.Update(ctx, foundStateful)
 		if err != nil {
@@ -167,6 +217,11 @@ func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 			return ctrl.Result{}, err
 		}
 	}
+	if len(pendingChanges) == 0 {
+		if err := r.removeApplyUpdateAnnotation(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	// Reconcile service
 	service := generateService(instance)
@@ -199,13 +254,34 @@ func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	// Reconcile virtual service if we use ISTIO.
-	if os.Getenv("USE_ISTIO") == "true" {
-		err = r.reconcileVirtualService(instance)
-		if err != nil {
+	// Reconcile the NetworkPolicy of the notebook Pod, if any
+	if err := r.reconcileNetworkPolicy(ctx, instance, cfg, log); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the workers and their headless Service, if any
+	instance.Status.Workers, err = r.reconcileWorkers(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the Service and the route of the SSH server, if any
+	instance.Status.RemoteAccess, err = r.reconcileRemoteAccess(ctx, instance, cfg, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the Istio VirtualService or Gateway API HTTPRoute, if any.
+	routingCfg := cfg.RoutingConfig()
+	if routingCfg.Enabled() {
+		if err := r.reconcileRoute(ctx, instance, routingCfg); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.reconcileAppRoutes(ctx, instance, routingCfg, log); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
+	instance.Status.Apps = appsStatus(instance, cfg)
 
 	foundPod := &corev1.Pod{}
 	err = r.Get(ctx, types.NamespacedName{Name: ss.Name + "-0", Namespace: ss.Namespace}, foundPod)
@@ -215,8 +291,13 @@ func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
+	pvcs, err := r.getNotebookVolumeClaims(ctx, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Update Notebook CR status
-	err = updateNotebookStatus(r, instance, foundStateful, foundPod, req)
+	err = updateNotebookStatus(r, instance, foundStateful, foundPod, pvcs, req)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -225,121 +306,134 @@ func (r *NotebookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 }
 
 func updateNotebookStatus(r *NotebookReconciler, nb *v1beta1.Notebook,
-	sts *appsv1.StatefulSet, pod *corev1.Pod, req ctrl.Request) error {
+	sts *appsv1.StatefulSet, pod *corev1.Pod, pvcs map[string]*corev1.PersistentVolumeClaim,
+	req ctrl.Request) error {
 
 	log := r.Log.WithValues("notebook", req.NamespacedName)
 	ctx := context.Background()
 
-	status, err := createNotebookStatus(r, nb, sts, pod, req)
+	status, err := createNotebookStatus(r, nb, sts, pod, pvcs, req)
 	if err != nil {
 		return err
 	}
 
 	log.Info("Updating Notebook CR Status", "status", status)
+	oldConditions := nb.Status.Conditions
 	nb.Status = status
-	return r.Status().Update(ctx, nb)
-}
-
-func createNotebookStatus(r *NotebookReconciler, nb *v1beta1.Notebook,
-	sts *appsv1.StatefulSet, pod *corev1.Pod, req ctrl.Request) (v1beta1.NotebookStatus, error) {
-
-	log := r.Log.WithValues("notebook", req.NamespacedName)
-
-	// Initialize Notebook CR Status
-	log.Info("Initializing Notebook CR Status")
-	status := v1beta1.NotebookStatus{
-		Conditions:     make([]v1beta1.NotebookCondition, 0),
-		ReadyReplicas:  sts.Status.ReadyReplicas,
-		ContainerState: corev1.ContainerState{},
+	if err := r.Status().Update(ctx, nb); err != nil {
+		return err
 	}
+	r.recordConditionMetrics(nb, oldConditions)
+	return nil
+}
 
-	// Update the status based on the Pod's status
-	if reflect.DeepEqual(pod.Status, corev1.PodStatus{}) {
-		log.Info("No pod.Status found. Won't update notebook conditions and containerState")
-		return status, nil
+// recordConditionMetrics observes the time it took the Notebook to become
+// ready and counts its image pull failures, when its conditions change.
+func (r *NotebookReconciler) recordConditionMetrics(nb *v1beta1.Notebook, oldConditions []metav1.Condition) {
+	if r.Metrics == nil {
+		return
 	}
 
-	// Update status of the CR using the ContainerState of
-	// the container that has the same name as the CR.
-	// If no container of same name is found, the state of the CR is not updated.
-	notebookContainerFound := false
-	log.Info("Calculating Notebook's  containerState")
-	for i := range pod.Status.ContainerStatuses {
-		if pod.Status.ContainerStatuses[i].Name != nb.Name {
-			continue
-		}
-
-		if pod.Status.ContainerStatuses[i].State == nb.Status.ContainerState {
-			continue
+	if !meta.IsStatusConditionTrue(oldConditions, v1beta1.NotebookConditionReady) &&
+		meta.IsStatusConditionTrue(nb.Status.Conditions, v1beta1.NotebookConditionReady) {
+		// The Stopped condition turned False when the Notebook was started
+		startTime := nb.CreationTimestamp.Time
+		if c := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionStopped); c != nil &&
+			c.Status == metav1.ConditionFalse {
+			startTime = c.LastTransitionTime.Time
 		}
-
-		// Update Notebook CR's status.ContainerState
-		cs := pod.Status.ContainerStatuses[i].State
-		log.Info("Updating Notebook CR state: ", "state", cs)
-
-		status.ContainerState = cs
-		notebookContainerFound = true
-		break
-	}
-
-	if !notebookContainerFound {
-		log.Error(nil, "Could not find container with the same name as Notebook "+
-			"in containerStates of Pod. Will not update notebook's "+
-			"status.containerState ")
+		r.Metrics.NotebookTimeToReady.WithLabelValues(nb.Namespace).Observe(time.Since(startTime).Seconds())
 	}
 
-	// Mirroring pod condition
-	notebookConditions := []v1beta1.NotebookCondition{}
-	log.Info("Calculating Notebook's Conditions")
-	for i := range pod.Status.Conditions {
-		condition := PodCondToNotebookCond(pod.Status.Conditions[i])
-		notebookConditions = append(notebookConditions, condition)
+	if !imagePullFailed(oldConditions) && imagePullFailed(nb.Status.Conditions) {
+		r.Metrics.NotebookImagePullFailures.WithLabelValues(nb.Namespace, nb.Name).Inc()
 	}
-
-	status.Conditions = notebookConditions
-
-	return status, nil
 }
 
-func PodCondToNotebookCond(podc corev1.PodCondition) v1beta1.NotebookCondition {
+func imagePullFailed(conditions []metav1.Condition) bool {
+	c := meta.FindStatusCondition(conditions, v1beta1.NotebookConditionDegraded)
+	return c != nil && c.Status == metav1.ConditionTrue && c.Reason == "ImagePullFailed"
+}
 
-	condition := v1beta1.NotebookCondition{}
+func createNotebookStatus(r *NotebookReconciler, nb *v1beta1.Notebook,
+	sts *appsv1.StatefulSet, pod *corev1.Pod, pvcs map[string]*corev1.PersistentVolumeClaim,
+	req ctrl.Request) (v1beta1.NotebookStatus, error) {
 
-	if len(podc.Type) > 0 {
-		condition.Type = string(podc.Type)
-	}
+	log := r.Log.WithValues("notebook", req.NamespacedName)
 
-	if len(podc.Status) > 0 {
-		condition.Status = string(podc.Status)
+	// Initialize Notebook CR Status
+	log.Info("Initializing Notebook CR Status")
+	status := v1beta1.NotebookStatus{
+		ReadyReplicas:      sts.Status.ReadyReplicas,
+		ContainerState:     corev1.ContainerState{},
+		ObservedGeneration: nb.Generation,
+		// The culling policy and the idleness are reported by the culler
+		Culling:  nb.Status.Culling,
+		Idleness: nb.Status.Idleness,
+		// The workers, the PVCs, the remote access and the apps are reported
+		// when they are reconciled
+		Workers:      nb.Status.Workers,
+		VolumeClaims: nb.Status.VolumeClaims,
+		RemoteAccess: nb.Status.RemoteAccess,
+		Apps:         nb.Status.Apps,
+	}
+
+	// Keep track of when and why the Notebook was stopped
+	if notebookIsStopped(nb) {
+		status.StoppedAt, status.StopReason = notebookStopStatus(nb)
+	}
+
+	// Update status of the CR using the ContainerState of the Notebook's
+	// container
+	if cs := notebookContainerStatus(nb, pod); cs != nil {
+		status.ContainerState = cs.State
+	} else if len(pod.Status.ContainerStatuses) > 0 {
+		log.Info("Could not find the Notebook's container in the containerStatuses of the Pod. " +
+			"Will not update notebook's status.containerState")
 	}
 
-	if len(podc.Message) > 0 {
-		condition.Message = podc.Message
-	}
+	log.Info("Calculating Notebook's Conditions")
+	status.Conditions = computeNotebookConditions(nb, &status, sts, pod, pvcs)
 
-	if len(podc.Reason) > 0 {
-		condition.Reason = podc.Reason
-	}
+	return status, nil
+}
 
-	// check if podc.LastProbeTime is null. If so initialize
-	// the field with metav1.Now()
-	check := podc.LastProbeTime.Time.Equal(time.Time{})
-	if !check {
-		condition.LastProbeTime = podc.LastProbeTime
-	} else {
-		condition.LastProbeTime = metav1.Now()
+// notebookContainerStatus returns the status of the Notebook's container in
+// the Pod. The container is the one with the same name as the Notebook or,
+// failing that, the first container of the Notebook's template.
+func notebookContainerStatus(nb *v1beta1.Notebook, pod *corev1.Pod) *corev1.ContainerStatus {
+	names := []string{nb.Name}
+	if containers := nb.Spec.Template.Spec.Containers; len(containers) > 0 {
+		names = append(names, containers[0].Name)
+	}
+	for _, name := range names {
+		for i := range pod.Status.ContainerStatuses {
+			if pod.Status.ContainerStatuses[i].Name == name {
+				return &pod.Status.ContainerStatuses[i]
+			}
+		}
 	}
+	return nil
+}
 
-	// check if podc.LastTransitionTime is null. If so initialize
-	// the field with metav1.Now()
-	check = podc.LastTransitionTime.Time.Equal(time.Time{})
-	if !check {
-		condition.LastTransitionTime = podc.LastTransitionTime
-	} else {
-		condition.LastTransitionTime = metav1.Now()
+// notebookStopStatus returns the StoppedAt and StopReason status fields of a
+// stopped Notebook. Values that have already been recorded, e.g. by the
+// culler, are preserved.
+func notebookStopStatus(nb *v1beta1.Notebook) (*metav1.Time, v1beta1.NotebookStopReason) {
+	stoppedAt := nb.Status.StoppedAt
+	if stoppedAt == nil {
+		now := metav1.Now()
+		stoppedAt = &now
+	}
+
+	reason := nb.Status.StopReason
+	if reason == "" {
+		reason = v1beta1.NotebookStopReasonUserRequested
+		if nb.Spec.State != v1beta1.NotebookStateStopped {
+			reason = v1beta1.NotebookStopReasonStopAnnotation
+		}
 	}
-
-	return condition
+	return stoppedAt, reason
 }
 
 func setPrefixEnvVar(instance *v1beta1.Notebook, container *corev1.Container) {
@@ -358,9 +452,9 @@ func setPrefixEnvVar(instance *v1beta1.Notebook, container *corev1.Container) {
 	})
 }
 
-func generateStatefulSet(instance *v1beta1.Notebook) *appsv1.StatefulSet {
+func generateStatefulSet(instance *v1beta1.Notebook, cfg *config.NotebookControllerConfig) *appsv1.StatefulSet {
 	replicas := int32(1)
-	if metav1.HasAnnotation(instance.ObjectMeta, "kubeflow-resource-stopped") {
+	if notebookIsStopped(instance) {
 		replicas = 0
 	}
 
@@ -377,41 +471,25 @@ func generateStatefulSet(instance *v1beta1.Notebook) *appsv1.StatefulSet {
 				},
 			},
 			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"statefulset":   instance.Name,
-						"notebook-name": instance.Name,
-					},
-					Annotations: map[string]string{},
-				},
 				Spec: *instance.Spec.Template.Spec.DeepCopy(),
 			},
 		},
 	}
-
-	// copy all of the Notebook labels to the pod including poddefault related labels
-	l := &ss.Spec.Template.ObjectMeta.Labels
-	for k, v := range instance.ObjectMeta.Labels {
-		(*l)[k] = v
-	}
-
-	// copy all of the Notebook annotations to the pod.
-	a := &ss.Spec.Template.ObjectMeta.Annotations
-	for k, v := range instance.ObjectMeta.Annotations {
-		if !strings.Contains(k, "kubectl") && !strings.Contains(k, "notebook") {
-			(*a)[k] = v
-		}
-	}
+	setPodMetadata(&ss.Spec.Template, instance, instance.Spec.Template.Metadata, cfg, map[string]string{
+		"statefulset":   instance.Name,
+		"notebook-name": instance.Name,
+	})
 
 	podSpec := &ss.Spec.Template.Spec
+	podSpec.Volumes = notebookVolumes(instance)
 	container := &podSpec.Containers[0]
 	if container.WorkingDir == "" {
-		container.WorkingDir = "/home/jovyan"
+		container.WorkingDir = v1beta1.DefaultWorkingDir
 	}
 	if container.Ports == nil {
 		container.Ports = []corev1.ContainerPort{
 			{
-				ContainerPort: DefaultContainerPort,
+				ContainerPort: v1beta1.DefaultContainerPort,
 				Name:          "notebook-port",
 				Protocol:      "TCP",
 			},
@@ -420,24 +498,40 @@ func generateStatefulSet(instance *v1beta1.Notebook) *appsv1.StatefulSet {
 
 	setPrefixEnvVar(instance, container)
 
+	// The notebook Pod is resolvable through the headless Service of its
+	// workers
+	if instance.Spec.Workers != nil {
+		ss.Spec.ServiceName = headlessServiceName(instance)
+		setWorkerEnvVars(instance, podSpec)
+	}
+	if instance.Spec.RemoteAccess != nil {
+		addSSHServer(instance, podSpec, cfg)
+	}
+
+	setDefaultFSGroup(podSpec, cfg)
+	return ss
+}
+
+// setDefaultFSGroup sets the default fsGroup of the pod spec, if it has no
+// security context.
+func setDefaultFSGroup(podSpec *corev1.PodSpec, cfg *config.NotebookControllerConfig) {
 	// For some platforms (like OpenShift), adding fsGroup: 100 is troublesome.
 	// This allows for those platforms to bypass the automatic addition of the fsGroup
 	// and will allow for the Pod Security Policy controller to make an appropriate choice
 	// https://github.com/kubernetes-sigs/controller-runtime/issues/4617
-	if value, exists := os.LookupEnv("ADD_FSGROUP"); !exists || value == "true" {
+	if *cfg.AddFSGroup {
 		if podSpec.SecurityContext == nil {
-			fsGroup := DefaultFSGroup
+			fsGroup := v1beta1.DefaultFSGroup
 			podSpec.SecurityContext = &corev1.PodSecurityContext{
 				FSGroup: &fsGroup,
 			}
 		}
 	}
-	return ss
 }
 
 func generateService(instance *v1beta1.Notebook) *corev1.Service {
 	// Define the desired Service object
-	port := DefaultContainerPort
+	port := v1beta1.DefaultContainerPort
 	containerPorts := instance.Spec.Template.Spec.Containers[0].Ports
 	if containerPorts != nil {
 		port = int(containerPorts[0].ContainerPort)
@@ -461,6 +555,7 @@ func generateService(instance *v1beta1.Notebook) *corev1.Service {
 			},
 		},
 	}
+	svc.Spec.Ports = append(svc.Spec.Ports, appServicePorts(instance)...)
 	return svc
 }
 
@@ -468,10 +563,9 @@ func virtualServiceName(kfName string, namespace string) string {
 	return fmt.Sprintf("notebook-%s-%s", namespace, kfName)
 }
 
-func generateVirtualService(instance *v1beta1.Notebook) (*unstructured.Unstructured, error) {
+func generateRoute(instance *v1beta1.Notebook) routing.Route {
 	name := instance.Name
 	namespace := instance.Namespace
-	clusterDomain := "cluster.local"
 	prefix := fmt.Sprintf("/notebook/%s/%s/", namespace, name)
 
 	// unpack annotations from Notebook resource
@@ -482,127 +576,47 @@ func generateVirtualService(instance *v1beta1.Notebook) (*unstructured.Unstructu
 
 	rewrite := fmt.Sprintf("/notebook/%s/%s/", namespace, name)
 	// If AnnotationRewriteURI is present, use this value for "rewrite"
-	if _, ok := annotations[AnnotationRewriteURI]; ok && len(annotations[AnnotationRewriteURI]) > 0 {
-		rewrite = annotations[AnnotationRewriteURI]
-	}
-
-	if clusterDomainFromEnv, ok := os.LookupEnv("CLUSTER_DOMAIN"); ok {
-		clusterDomain = clusterDomainFromEnv
-	}
-	service := fmt.Sprintf("%s.%s.svc.%s", name, namespace, clusterDomain)
-
-	vsvc := &unstructured.Unstructured{}
-	vsvc.SetAPIVersion("networking.istio.io/v1alpha3")
-	vsvc.SetKind("VirtualService")
-	vsvc.SetName(virtualServiceName(name, namespace))
-	vsvc.SetNamespace(namespace)
-	if err := unstructured.SetNestedStringSlice(vsvc.Object, []string{"*"}, "spec", "hosts"); err != nil {
-		return nil, fmt.Errorf("set .spec.hosts error: %v", err)
-	}
-
-	istioGateway := os.Getenv("ISTIO_GATEWAY")
-	if len(istioGateway) == 0 {
-		istioGateway = "kubeflow/kubeflow-gateway"
-	}
-	if err := unstructured.SetNestedStringSlice(vsvc.Object, []string{istioGateway},
-		"spec", "gateways"); err != nil {
-		return nil, fmt.Errorf("set .spec.gateways error: %v", err)
+	if _, ok := annotations[v1beta1.AnnotationRewriteURI]; ok && len(annotations[v1beta1.AnnotationRewriteURI]) > 0 {
+		rewrite = annotations[v1beta1.AnnotationRewriteURI]
 	}
 
 	headersRequestSet := make(map[string]string)
 	// If AnnotationHeadersRequestSet is present, use its values in "headers.request.set"
-	if _, ok := annotations[AnnotationHeadersRequestSet]; ok && len(annotations[AnnotationHeadersRequestSet]) > 0 {
-		requestHeadersBytes := []byte(annotations[AnnotationHeadersRequestSet])
+	if _, ok := annotations[v1beta1.AnnotationHeadersRequestSet]; ok && len(annotations[v1beta1.AnnotationHeadersRequestSet]) > 0 {
+		requestHeadersBytes := []byte(annotations[v1beta1.AnnotationHeadersRequestSet])
 		if err := json.Unmarshal(requestHeadersBytes, &headersRequestSet); err != nil {
 			// if JSON decoding fails, set an empty map
 			headersRequestSet = make(map[string]string)
 		}
 	}
-	// cast from map[string]string, as SetNestedSlice needs map[string]interface{}
-	headersRequestSetInterface := make(map[string]interface{})
-	for key, element := range headersRequestSet {
-		headersRequestSetInterface[key] = element
-	}
 
-	// the http section of the istio VirtualService spec
-	http := []interface{}{
-		map[string]interface{}{
-			"headers": map[string]interface{}{
-				"request": map[string]interface{}{
-					"set": headersRequestSetInterface,
-				},
-			},
-			"match": []interface{}{
-				map[string]interface{}{
-					"uri": map[string]interface{}{
-						"prefix": prefix,
-					},
-				},
-			},
-			"rewrite": map[string]interface{}{
-				"uri": rewrite,
-			},
-			"route": []interface{}{
-				map[string]interface{}{
-					"destination": map[string]interface{}{
-						"host": service,
-						"port": map[string]interface{}{
-							"number": int64(DefaultServingPort),
-						},
-					},
-				},
-			},
-		},
-	}
-
-	// add http section to istio VirtualService spec
-	if err := unstructured.SetNestedSlice(vsvc.Object, http, "spec", "http"); err != nil {
-		return nil, fmt.Errorf("set .spec.http error: %v", err)
+	return routing.Route{
+		Name:           virtualServiceName(name, namespace),
+		Namespace:      namespace,
+		Prefix:         prefix,
+		Rewrite:        rewrite,
+		RequestHeaders: headersRequestSet,
+		ServiceName:    name,
+		ServicePort:    DefaultServingPort,
 	}
-
-	return vsvc, nil
-
 }
 
-func (r *NotebookReconciler) reconcileVirtualService(instance *v1beta1.Notebook) error {
+func (r *NotebookReconciler) reconcileRoute(ctx context.Context, instance *v1beta1.Notebook, cfg routing.Config) error {
 	log := r.Log.WithValues("notebook", instance.Namespace)
-	virtualService, err := generateVirtualService(instance)
+	route, err := routing.Generate(cfg, generateRoute(instance))
 	if err != nil {
-		log.Info("Unable to generate VirtualService...", err)
+		log.Error(err, "unable to generate route", "mode", cfg.Mode)
 		return err
 	}
-	if err := ctrl.SetControllerReference(instance, virtualService, r.Scheme); err != nil {
-		return err
-	}
-	// Check if the virtual service already exists.
-	foundVirtual := &unstructured.Unstructured{}
-	justCreated := false
-	foundVirtual.SetAPIVersion("networking.istio.io/v1alpha3")
-	foundVirtual.SetKind("VirtualService")
-	err = r.Get(context.TODO(), types.NamespacedName{Name: virtualServiceName(instance.Name,
-		instance.Namespace), Namespace: instance.Namespace}, foundVirtual)
-	if err != nil && apierrs.IsNotFound(err) {
-		log.Info("Creating virtual service", "namespace", instance.Namespace, "name",
-			virtualServiceName(instance.Name, instance.Namespace))
-		err = r.Create(context.TODO(), virtualService)
-		justCreated = true
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
+	if err := ctrl.SetControllerReference(instance, route, r.Scheme); err != nil {
 		return err
 	}
-
-	if !justCreated && reconcilehelper.CopyVirtualService(virtualService, foundVirtual) {
-		log.Info("Updating virtual service", "namespace", instance.Namespace, "name",
-			virtualServiceName(instance.Name, instance.Namespace))
-		err = r.Update(context.TODO(), foundVirtual)
-		if err != nil {
-			return err
-		}
+	err = routing.Reconcile(ctx, r.Client, route, log)
+	if errors.Is(err, routing.ErrNotControlled) {
+		r.EventRecorder.Eventf(instance, corev1.EventTypeWarning, "RouteConflict",
+			"The route of the Notebook isn't created: %v", err)
 	}
-
-	return nil
+	return err
 }
 
 func isStsOrPodEvent(event *corev1.Event) bool {
@@ -613,6 +627,15 @@ func nbNameFromInvolvedObject(c client.Client, object *corev1.ObjectReference) (
 	name, namespace := object.Name, object.Namespace
 
 	if object.Kind == "StatefulSet" {
+		// The StatefulSet of the workers is labeled with the Notebook's name,
+		// the one of the notebook Pod is named after it
+		sts := &appsv1.StatefulSet{}
+		err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, sts)
+		if err == nil {
+			if nbName, ok := sts.Labels["notebook-name"]; ok {
+				return nbName, nil
+			}
+		}
 		return name, nil
 	}
 	if object.Kind == "Pod" {
@@ -635,14 +658,6 @@ func nbNameFromInvolvedObject(c client.Client, object *corev1.ObjectReference) (
 	return "", fmt.Errorf("object isn't related to a Notebook")
 }
 
-func nbNameExists(client client.Client, nbName string, namespace string) bool {
-	if err := client.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: nbName}, &v1beta1.Notebook{}); err != nil {
-		// If error != NotFound, trigger the reconcile call anyway to avoid loosing a potential relevant event
-		return !apierrs.IsNotFound(err)
-	}
-	return true
-}
-
 // predNBPodIsLabeled filters pods not containing the "notebook-name" label key
 func predNBPodIsLabeled() predicate.Funcs {
 	// Documented at
@@ -657,17 +672,12 @@ func predNBPodIsLabeled() predicate.Funcs {
 	return predicate.NewPredicateFuncs(checkNBLabel())
 }
 
-// predNBEvents filters events not coming from Pod or STS, and coming from
-// unknown NBs
-func predNBEvents(r *NotebookReconciler) predicate.Funcs {
+// predNBEvents filters events not coming from Pod or STS. The events are
+// mapped to their Notebook through the cache, see nbNameFromInvolvedObject.
+func predNBEvents() predicate.Funcs {
 	checkEvent := func() func(object client.Object) bool {
 		return func(object client.Object) bool {
-			event := object.(*corev1.Event)
-			nbName, err := nbNameFromInvolvedObject(r.Client, &event.InvolvedObject)
-			if err != nil {
-				return false
-			}
-			return isStsOrPodEvent(event) && nbNameExists(r.Client, nbName, object.GetNamespace())
+			return isStsOrPodEvent(object.(*corev1.Event))
 		}
 	}
 
@@ -694,34 +704,40 @@ func (r *NotebookReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		}
 	}
 
-	// Map function to convert namespace events to reconciliation requests
-	mapEventToRequest := func(object client.Object) []reconcile.Request {
-		return []reconcile.Request{
-			{NamespacedName: types.NamespacedName{
-				Name:      object.GetName(),
-				Namespace: object.GetNamespace(),
-			}},
-		}
-	}
-
 	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&v1beta1.Notebook{}).
 		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
+		Owns(&networkingv1.NetworkPolicy{}).
 		Watches(
 			&source.Kind{Type: &corev1.Pod{}},
 			handler.EnqueueRequestsFromMapFunc(mapPodToRequest),
 			builder.WithPredicates(predNBPodIsLabeled())).
+		// the PVCs of the volume claim templates are labeled like the Pods,
+		// also when they aren't owned by the Notebook
 		Watches(
-			&source.Kind{Type: &corev1.Event{}},
-			handler.EnqueueRequestsFromMapFunc(mapEventToRequest),
-			builder.WithPredicates(predNBEvents(r)))
-	// watch Istio virtual service
-	if os.Getenv("USE_ISTIO") == "true" {
-		virtualService := &unstructured.Unstructured{}
-		virtualService.SetAPIVersion("networking.istio.io/v1alpha3")
-		virtualService.SetKind("VirtualService")
-		builder.Owns(virtualService)
+			&source.Kind{Type: &corev1.PersistentVolumeClaim{}},
+			handler.EnqueueRequestsFromMapFunc(mapPodToRequest),
+			builder.WithPredicates(predNBPodIsLabeled()))
+	// the CullingPolicies decide whether the Notebooks get a token for the
+	// idleness probes. Only the Secrets labeled with ProbeTokenLabel are
+	// cached.
+	if r.Config.Get().Culling.Enabled {
+		builder.
+			Owns(&corev1.Secret{}).
+			Watches(
+				&source.Kind{Type: &v1beta1.CullingPolicy{}},
+				handler.EnqueueRequestsFromMapFunc(mapCullingPolicyToNotebooks(r.Client, r.Log)))
+	}
+	// watch the Istio VirtualServices or Gateway API HTTPRoutes
+	routingCfg := r.Config.Get().RoutingConfig()
+	if routingCfg.Enabled() {
+		builder.Owns(routingCfg.Object())
+	}
+	// Istio routes SSH with VirtualServices too, the Gateway API with
+	// TCPRoutes
+	if routingCfg.Mode == routing.ModeGatewayAPI && r.Config.Get().RemoteAccess.GatewayRoutingEnabled() {
+		builder.Owns(routingCfg.TCPObject())
 	}
 
 	err := builder.Complete(r)
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -14,6 +16,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 
+	"github.com/kubeflow/kubeflow/components/common/routing"
 	nbv1beta1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
@@ -58,6 +61,27 @@ func TestNbNameFromInvolvedObject(t *testing.T) {
 		},
 	}
 
+	workerSts := &appsv1.StatefulSet{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-notebook-worker",
+			Namespace: "test-namespace",
+			Labels: map[string]string{
+				"notebook-name": "test-notebook",
+			},
+		},
+	}
+
+	workerStsEvent := &corev1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "worker-sts-event",
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "StatefulSet",
+			Name:      "test-notebook-worker",
+			Namespace: "test-namespace",
+		},
+	}
+
 	tests := []struct {
 		name           string
 		event          *corev1.Event
@@ -73,8 +97,13 @@ func TestNbNameFromInvolvedObject(t *testing.T) {
 			event:          stsEvent,
 			expectedNbName: "test-notebook",
 		},
+		{
+			name:           "worker statefulset event",
+			event:          workerStsEvent,
+			expectedNbName: "test-notebook",
+		},
 	}
-	objects := []runtime.Object{testPod, testSts}
+	objects := []runtime.Object{testPod, testSts, workerSts}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -98,23 +127,26 @@ func TestCreateNotebookStatus(t *testing.T) {
 		pod              corev1.Pod
 		sts              appsv1.StatefulSet
 		expectedNbStatus nbv1beta1.NotebookStatus
+		expectedReady    v1.ConditionStatus
 	}{
 		{
 			name: "NotebookStatusInitialization",
 			currentNb: nbv1beta1.Notebook{
 				ObjectMeta: v1.ObjectMeta{
-					Name:      "test",
-					Namespace: "kubeflow-user",
+					Name:       "test",
+					Namespace:  "kubeflow-user",
+					Generation: 2,
 				},
 				Status: nbv1beta1.NotebookStatus{},
 			},
 			pod: corev1.Pod{},
 			sts: appsv1.StatefulSet{},
 			expectedNbStatus: nbv1beta1.NotebookStatus{
-				Conditions:     []nbv1beta1.NotebookCondition{},
-				ReadyReplicas:  int32(0),
-				ContainerState: corev1.ContainerState{},
+				ReadyReplicas:      int32(0),
+				ContainerState:     corev1.ContainerState{},
+				ObservedGeneration: 2,
 			},
+			expectedReady: v1.ConditionFalse,
 		},
 		{
 			name: "NotebookStatusReadyReplicas",
@@ -136,10 +168,10 @@ func TestCreateNotebookStatus(t *testing.T) {
 				},
 			},
 			expectedNbStatus: nbv1beta1.NotebookStatus{
-				Conditions:     []nbv1beta1.NotebookCondition{},
 				ReadyReplicas:  int32(1),
 				ContainerState: corev1.ContainerState{},
 			},
+			expectedReady: v1.ConditionTrue,
 		},
 		{
 			name: "NotebookContainerState",
@@ -170,7 +202,6 @@ func TestCreateNotebookStatus(t *testing.T) {
 			},
 			sts: appsv1.StatefulSet{},
 			expectedNbStatus: nbv1beta1.NotebookStatus{
-				Conditions:    []nbv1beta1.NotebookCondition{},
 				ReadyReplicas: int32(0),
 				ContainerState: corev1.ContainerState{
 					Running: &corev1.ContainerStateRunning{
@@ -178,98 +209,68 @@ func TestCreateNotebookStatus(t *testing.T) {
 					},
 				},
 			},
+			expectedReady: v1.ConditionFalse,
 		},
 		{
-			name: "mirroringPodConditions",
-			pod: corev1.Pod{
+			name: "NotebookContainerStateOfFirstContainer",
+			currentNb: nbv1beta1.Notebook{
 				ObjectMeta: v1.ObjectMeta{
 					Name:      "test",
 					Namespace: "kubeflow-user",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
-						{
-							Type:               "Running",
-							LastProbeTime:      v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-							LastTransitionTime: v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-						},
-						{
-							Type:               "Waiting",
-							LastProbeTime:      v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-							LastTransitionTime: v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-							Reason:             "PodInitializing",
+				Spec: nbv1beta1.NotebookSpec{
+					Template: nbv1beta1.NotebookTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "notebook"}},
 						},
 					},
 				},
-			},
-			sts: appsv1.StatefulSet{
-				ObjectMeta: v1.ObjectMeta{
-					Name:      "test",
-					Namespace: "kubeflow-user",
-				},
-				Status: appsv1.StatefulSetStatus{
-					ReadyReplicas: int32(1),
-				},
-			},
-			expectedNbStatus: nbv1beta1.NotebookStatus{
-				Conditions: []nbv1beta1.NotebookCondition{
-					{
-						Type:               "Running",
-						LastProbeTime:      v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-						LastTransitionTime: v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-					},
-					{
-						Type:               "Waiting",
-						LastProbeTime:      v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-						LastTransitionTime: v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC),
-						Reason:             "PodInitializing",
+				Status: nbv1beta1.NotebookStatus{
+					ContainerState: corev1.ContainerState{
+						Running: &corev1.ContainerStateRunning{
+							StartedAt: v1.Time{},
+						},
 					},
 				},
-				ReadyReplicas:  int32(1),
-				ContainerState: corev1.ContainerState{},
 			},
-		},
-		{
-			name: "unschedulablePod",
 			pod: corev1.Pod{
 				ObjectMeta: v1.ObjectMeta{
 					Name:      "test",
 					Namespace: "kubeflow-user",
 				},
 				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+					ContainerStatuses: []corev1.ContainerStatus{
 						{
-							Type:               "PodScheduled",
-							LastProbeTime:      v1.Date(2022, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
-							LastTransitionTime: v1.Date(2022, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
-							Message:            "0/1 nodes are available: 1 Insufficient cpu.",
-							Status:             "false",
-							Reason:             "Unschedulable",
+							Name: "sidecar",
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{},
+							},
+						},
+						{
+							Name: "notebook",
+							State: corev1.ContainerState{
+								Running: &corev1.ContainerStateRunning{
+									StartedAt: v1.Time{},
+								},
+							},
 						},
 					},
 				},
 			},
 			sts: appsv1.StatefulSet{
-				ObjectMeta: v1.ObjectMeta{
-					Name:      "test",
-					Namespace: "kubeflow-user",
+				Status: appsv1.StatefulSetStatus{
+					ReadyReplicas: int32(1),
 				},
-				Status: appsv1.StatefulSetStatus{},
 			},
 			expectedNbStatus: nbv1beta1.NotebookStatus{
-				Conditions: []nbv1beta1.NotebookCondition{
-					{
-						Type:               "PodScheduled",
-						LastProbeTime:      v1.Date(2022, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
-						LastTransitionTime: v1.Date(2022, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
-						Message:            "0/1 nodes are available: 1 Insufficient cpu.",
-						Status:             "false",
-						Reason:             "Unschedulable",
+				ReadyReplicas: int32(1),
+				ContainerState: corev1.ContainerState{
+					Running: &corev1.ContainerStateRunning{
+						StartedAt: v1.Time{},
 					},
 				},
-				ReadyReplicas:  int32(0),
-				ContainerState: corev1.ContainerState{},
 			},
+			expectedReady: v1.ConditionTrue,
 		},
 	}
 
@@ -277,10 +278,16 @@ func TestCreateNotebookStatus(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			r := createMockReconciler()
 			req := ctrl.Request{}
-			status, err := createNotebookStatus(r, &test.currentNb, &test.sts, &test.pod, req)
+			status, err := createNotebookStatus(r, &test.currentNb, &test.sts, &test.pod, nil, req)
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
 			}
+
+			ready := meta.FindStatusCondition(status.Conditions, nbv1beta1.NotebookConditionReady)
+			if ready == nil || ready.Status != test.expectedReady {
+				t.Errorf("Expect Ready condition %s, got %+v", test.expectedReady, ready)
+			}
+			status.Conditions = nil
 			if !reflect.DeepEqual(status, test.expectedNbStatus) {
 				t.Errorf("\nExpect: %v; \nOutput: %v", test.expectedNbStatus, status)
 			}
@@ -289,6 +296,168 @@ func TestCreateNotebookStatus(t *testing.T) {
 
 }
 
+func TestNotebookStopStatus(t *testing.T) {
+	stoppedAt := v1.Date(2022, time.Month(8), 30, 1, 10, 30, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		nb             nbv1beta1.Notebook
+		expectedReason nbv1beta1.NotebookStopReason
+		keepsTimestamp bool
+	}{
+		{
+			name: "stopped through spec.state",
+			nb: nbv1beta1.Notebook{
+				Spec: nbv1beta1.NotebookSpec{State: nbv1beta1.NotebookStateStopped},
+			},
+			expectedReason: nbv1beta1.NotebookStopReasonUserRequested,
+		},
+		{
+			name: "stopped through the legacy annotation",
+			nb: nbv1beta1.Notebook{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: map[string]string{STOP_ANNOTATION: createTimestamp()},
+				},
+			},
+			expectedReason: nbv1beta1.NotebookStopReasonStopAnnotation,
+		},
+		{
+			name: "culled notebook keeps its reason and timestamp",
+			nb: nbv1beta1.Notebook{
+				Spec: nbv1beta1.NotebookSpec{State: nbv1beta1.NotebookStateStopped},
+				Status: nbv1beta1.NotebookStatus{
+					StoppedAt:  &stoppedAt,
+					StopReason: nbv1beta1.NotebookStopReasonCulled,
+				},
+			},
+			expectedReason: nbv1beta1.NotebookStopReasonCulled,
+			keepsTimestamp: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			at, reason := notebookStopStatus(&test.nb)
+			if reason != test.expectedReason {
+				t.Errorf("Got reason %v, Expected %v", reason, test.expectedReason)
+			}
+			if at == nil {
+				t.Fatalf("Expected a stop timestamp")
+			}
+			if test.keepsTimestamp && !at.Equal(&stoppedAt) {
+				t.Errorf("Got timestamp %v, Expected %v", at, stoppedAt)
+			}
+		})
+	}
+}
+
+func TestGenerateRoute(t *testing.T) {
+	nb := &nbv1beta1.Notebook{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-notebook",
+			Namespace: "test-namespace",
+			Annotations: map[string]string{
+				nbv1beta1.AnnotationRewriteURI:        "/",
+				nbv1beta1.AnnotationHeadersRequestSet: `{"X-RStudio-Root-Path":"/notebook/test-namespace/test-notebook/"}`,
+			},
+		},
+	}
+	route := generateRoute(nb)
+
+	t.Run("istio", func(t *testing.T) {
+		cfg := routing.Config{Mode: routing.ModeIstio, Gateway: "kubeflow/kubeflow-gateway", ClusterDomain: "cluster.local"}
+		vsvc, err := routing.Generate(cfg, route)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if vsvc.GetKind() != "VirtualService" || vsvc.GetName() != "notebook-test-namespace-test-notebook" {
+			t.Fatalf("Got %v %v, Expected VirtualService notebook-test-namespace-test-notebook", vsvc.GetKind(), vsvc.GetName())
+		}
+		http, _, _ := unstructured.NestedSlice(vsvc.Object, "spec", "http")
+		expected := map[string]interface{}{
+			"headers": map[string]interface{}{
+				"request": map[string]interface{}{
+					"set": map[string]interface{}{
+						"X-RStudio-Root-Path": "/notebook/test-namespace/test-notebook/",
+					},
+				},
+			},
+			"match": []interface{}{
+				map[string]interface{}{
+					"uri": map[string]interface{}{"prefix": "/notebook/test-namespace/test-notebook/"},
+				},
+			},
+			"rewrite": map[string]interface{}{"uri": "/"},
+			"route": []interface{}{
+				map[string]interface{}{
+					"destination": map[string]interface{}{
+						"host": "test-notebook.test-namespace.svc.cluster.local",
+						"port": map[string]interface{}{"number": int64(80)},
+					},
+				},
+			},
+		}
+		if len(http) != 1 || !reflect.DeepEqual(http[0], expected) {
+			t.Errorf("Got http %v, Expected %v", http, expected)
+		}
+	})
+
+	t.Run("gateway-api", func(t *testing.T) {
+		cfg := routing.Config{Mode: routing.ModeGatewayAPI, Gateway: "kubeflow/kubeflow-gateway", ClusterDomain: "cluster.local"}
+		httpRoute, err := routing.Generate(cfg, route)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if httpRoute.GetKind() != "HTTPRoute" || httpRoute.GetAPIVersion() != "gateway.networking.k8s.io/v1" {
+			t.Fatalf("Got %v %v, Expected gateway.networking.k8s.io/v1 HTTPRoute", httpRoute.GetAPIVersion(), httpRoute.GetKind())
+		}
+		parentRefs, _, _ := unstructured.NestedSlice(httpRoute.Object, "spec", "parentRefs")
+		if len(parentRefs) != 1 || parentRefs[0].(map[string]interface{})["namespace"] != "kubeflow" ||
+			parentRefs[0].(map[string]interface{})["name"] != "kubeflow-gateway" {
+			t.Errorf("Got parentRefs %v, Expected kubeflow/kubeflow-gateway", parentRefs)
+		}
+		rules, _, _ := unstructured.NestedSlice(httpRoute.Object, "spec", "rules")
+		if len(rules) != 1 {
+			t.Fatalf("Got %d rules, Expected 1", len(rules))
+		}
+		expectedFilters := []interface{}{
+			map[string]interface{}{
+				"type": "URLRewrite",
+				"urlRewrite": map[string]interface{}{
+					"path": map[string]interface{}{"type": "ReplacePrefixMatch", "replacePrefixMatch": "/"},
+				},
+			},
+			map[string]interface{}{
+				"type": "RequestHeaderModifier",
+				"requestHeaderModifier": map[string]interface{}{
+					"set": []interface{}{
+						map[string]interface{}{
+							"name":  "X-RStudio-Root-Path",
+							"value": "/notebook/test-namespace/test-notebook/",
+						},
+					},
+				},
+			},
+		}
+		filters := rules[0].(map[string]interface{})["filters"]
+		if !reflect.DeepEqual(filters, expectedFilters) {
+			t.Errorf("Got filters %v, Expected %v", filters, expectedFilters)
+		}
+		backendRefs := rules[0].(map[string]interface{})["backendRefs"].([]interface{})
+		backend := backendRefs[0].(map[string]interface{})
+		if backend["name"] != "test-notebook" || backend["port"] != int64(80) {
+			t.Errorf("Got backendRef %v, Expected test-notebook:80", backend)
+		}
+	})
+
+	t.Run("gateway-api with an invalid gateway", func(t *testing.T) {
+		cfg := routing.Config{Mode: routing.ModeGatewayAPI, Gateway: "kubeflow-gateway"}
+		if _, err := routing.Generate(cfg, route); err == nil {
+			t.Errorf("Expected an error for a gateway without namespace")
+		}
+	})
+}
+
 func createMockReconciler() *NotebookReconciler {
 	reconciler := &NotebookReconciler{
 		Scheme: runtime.NewScheme(),
@@ -0,0 +1,237 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// eventInvolvedObjectIndex indexes the Events of Pods and StatefulSets
+	// by "<kind>/<name>" of the object they are about.
+	eventInvolvedObjectIndex = "involvedObject.kindName"
+
+	// How long a re-emitted Event and the rate limiter of a Notebook are
+	// remembered, unless they are evicted earlier to bound the cache size.
+	eventCacheTTL = time.Hour
+)
+
+// NotebookEventReconciler re-emits the Events of the StatefulSet and Pods of
+// a Notebook on the Notebook itself. Events and Pods are read from the
+// informer cache, each Event is re-emitted once per occurrence and the
+// re-emitted Events are rate limited per Notebook.
+type NotebookEventReconciler struct {
+	client.Client
+	Log           logr.Logger
+	EventRecorder record.EventRecorder
+
+	// CacheSize bounds the number of re-emitted Events and of per Notebook
+	// rate limiters that are remembered. Defaults to events.cacheSize.
+	CacheSize int
+	// QPS and Burst configure the per Notebook rate limiter. They default
+	// to events.qps and events.burst.
+	QPS   float64
+	Burst int
+
+	startTime time.Time
+	// Event UID -> the count of the Event when it was last re-emitted
+	reemitted *cache.LRUExpireCache
+	// Notebook namespace/name -> *rate.Limiter
+	limiters *cache.LRUExpireCache
+}
+
+func (r *NotebookEventReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("notebook", req.NamespacedName)
+
+	nb := &v1beta1.Notebook{}
+	if err := r.Get(ctx, req.NamespacedName, nb); err != nil {
+		return ctrl.Result{}, ignoreNotFound(err)
+	}
+
+	events, err := r.notebookEvents(ctx, nb)
+	if err != nil {
+		log.Error(err, "unable to list the Events of Notebook")
+		return ctrl.Result{}, err
+	}
+
+	limiter := r.limiterFor(req.NamespacedName)
+	for i := range events {
+		ev := &events[i]
+		if !r.shouldReemit(ev) {
+			continue
+		}
+		if !limiter.Allow() {
+			log.V(1).Info("Rate limited re-emitting Events, requeueing")
+			return ctrl.Result{RequeueAfter: time.Duration(float64(time.Second) / r.QPS)}, nil
+		}
+
+		log.Info("Emitting Notebook Event.", "Event", ev.Name)
+		r.EventRecorder.Eventf(nb, ev.Type, ev.Reason,
+			"Reissued from %s/%s: %s", strings.ToLower(ev.InvolvedObject.Kind), ev.InvolvedObject.Name, ev.Message)
+		r.reemitted.Add(ev.UID, ev.Count, eventCacheTTL)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// notebookEvents returns the Events of the StatefulSets and the Pods of the
+// Notebook, including the ones of its workers, oldest first.
+func (r *NotebookEventReconciler) notebookEvents(ctx context.Context, nb *v1beta1.Notebook) ([]corev1.Event, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(nb.Namespace),
+		client.MatchingLabels{"notebook-name": nb.Name}); err != nil {
+		return nil, err
+	}
+
+	keys := []string{involvedObjectKey("StatefulSet", nb.Name)}
+	if nb.Spec.Workers != nil {
+		keys = append(keys, involvedObjectKey("StatefulSet", workersName(nb)))
+	}
+	for _, pod := range pods.Items {
+		keys = append(keys, involvedObjectKey("Pod", pod.Name))
+	}
+
+	events := []corev1.Event{}
+	for _, key := range keys {
+		list := &corev1.EventList{}
+		if err := r.List(ctx, list, client.InNamespace(nb.Namespace),
+			client.MatchingFields{eventInvolvedObjectIndex: key}); err != nil {
+			return nil, err
+		}
+		events = append(events, list.Items...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+	return events, nil
+}
+
+// shouldReemit returns whether an Event occurred since it was last re-emitted.
+// Events last seen before the controller started were handled, or dropped,
+// by the previous instance.
+func (r *NotebookEventReconciler) shouldReemit(event *corev1.Event) bool {
+	if eventTime(event).Before(r.startTime) {
+		return false
+	}
+	count, ok := r.reemitted.Get(event.UID)
+	return !ok || count.(int32) < event.Count
+}
+
+func (r *NotebookEventReconciler) limiterFor(key types.NamespacedName) *rate.Limiter {
+	if limiter, ok := r.limiters.Get(key); ok {
+		return limiter.(*rate.Limiter)
+	}
+	limiter := rate.NewLimiter(rate.Limit(r.QPS), r.Burst)
+	r.limiters.Add(key, limiter, eventCacheTTL)
+	return limiter
+}
+
+// eventTime returns when the Event was last seen.
+func eventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+func involvedObjectKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NotebookEventReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.CacheSize == 0 {
+		r.CacheSize = config.DefaultEventCacheSize
+	}
+	if r.QPS == 0 {
+		r.QPS = config.DefaultEventQPS
+	}
+	if r.Burst == 0 {
+		r.Burst = config.DefaultEventBurst
+	}
+	r.startTime = time.Now()
+	r.reemitted = cache.NewLRUExpireCache(r.CacheSize)
+	r.limiters = cache.NewLRUExpireCache(r.CacheSize)
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Event{}, eventInvolvedObjectIndex,
+		func(object client.Object) []string {
+			ev := object.(*corev1.Event)
+			if !isStsOrPodEvent(ev) {
+				return nil
+			}
+			return []string{involvedObjectKey(ev.InvolvedObject.Kind, ev.InvolvedObject.Name)}
+		}); err != nil {
+		return err
+	}
+
+	// Map function to convert Pod and StatefulSet events to reconciliation
+	// requests for their Notebook
+	mapEventToRequest := func(object client.Object) []reconcile.Request {
+		ev := object.(*corev1.Event)
+		nbName, err := nbNameFromInvolvedObject(r.Client, &ev.InvolvedObject)
+		if err != nil {
+			return nil
+		}
+		return []reconcile.Request{
+			{NamespacedName: types.NamespacedName{
+				Name:      nbName,
+				Namespace: object.GetNamespace(),
+			}},
+		}
+	}
+
+	// Notebooks are only reconciled when one of their Events changes
+	ignoreNotebooks := predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+
+	controller := ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.Notebook{}, builder.WithPredicates(ignoreNotebooks)).
+		Watches(
+			&source.Kind{Type: &corev1.Event{}},
+			handler.EnqueueRequestsFromMapFunc(mapEventToRequest),
+			builder.WithPredicates(predNBEvents())).
+		Named("NotebookEvents")
+
+	return controller.Complete(r)
+}
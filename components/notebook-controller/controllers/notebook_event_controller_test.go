@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func newTestEvent(name, kind, object string, count int32, lastTimestamp time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "test-namespace",
+			UID:       types.UID(name),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      kind,
+			Name:      object,
+			Namespace: "test-namespace",
+		},
+		Type:          corev1.EventTypeWarning,
+		Reason:        "FailedScheduling",
+		Message:       "0/1 nodes are available",
+		Count:         count,
+		LastTimestamp: metav1.NewTime(lastTimestamp),
+	}
+}
+
+// indexedEventClient filters the listed Events by the involved object index,
+// which the fake client ignores
+type indexedEventClient struct {
+	client.Client
+}
+
+func (c indexedEventClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	events, ok := list.(*corev1.EventList)
+	o := &client.ListOptions{}
+	o.ApplyOptions(opts)
+	if !ok || o.FieldSelector == nil {
+		return nil
+	}
+	key, found := o.FieldSelector.RequiresExactMatch(eventInvolvedObjectIndex)
+	if !found {
+		return nil
+	}
+	items := []corev1.Event{}
+	for _, ev := range events.Items {
+		if involvedObjectKey(ev.InvolvedObject.Kind, ev.InvolvedObject.Name) == key {
+			items = append(items, ev)
+		}
+	}
+	events.Items = items
+	return nil
+}
+
+func newTestEventReconciler(c client.Client, burst int) (*NotebookEventReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(100)
+	return &NotebookEventReconciler{
+		Client:        indexedEventClient{c},
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		QPS:           config.DefaultEventQPS,
+		Burst:         burst,
+		startTime:     time.Now().Add(-time.Minute),
+		reemitted:     cache.NewLRUExpireCache(config.DefaultEventCacheSize),
+		limiters:      cache.NewLRUExpireCache(config.DefaultEventCacheSize),
+	}, recorder
+}
+
+func TestNotebookEventReemission(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	now := time.Now()
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-notebook", Namespace: "test-namespace"},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-notebook-0",
+			Namespace: "test-namespace",
+			Labels:    map[string]string{"notebook-name": "test-notebook"},
+		},
+	}
+	podEvent := newTestEvent("pod-event", "Pod", "test-notebook-0", 1, now)
+	stsEvent := newTestEvent("sts-event", "StatefulSet", "test-notebook", 1, now)
+	oldEvent := newTestEvent("old-event", "Pod", "test-notebook-0", 1, now.Add(-time.Hour))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-notebook", Namespace: "test-namespace"}}
+
+	t.Run("re-emits every occurrence once", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(nb, pod, podEvent.DeepCopy(), stsEvent.DeepCopy(), oldEvent.DeepCopy()).Build()
+		r, recorder := newTestEventReconciler(c, config.DefaultEventBurst)
+
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := len(recorder.Events); got != 2 {
+			t.Fatalf("Got %d re-emitted events, Expected 2", got)
+		}
+		<-recorder.Events
+		<-recorder.Events
+
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := len(recorder.Events); got != 0 {
+			t.Fatalf("Got %d re-emitted events for already re-emitted events, Expected 0", got)
+		}
+
+		updated := &corev1.Event{}
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(podEvent), updated); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updated.Count = 2
+		if err := c.Update(context.Background(), updated); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := len(recorder.Events); got != 1 {
+			t.Fatalf("Got %d re-emitted events for a repeated event, Expected 1", got)
+		}
+	})
+
+	t.Run("re-emits the events of the workers", func(t *testing.T) {
+		workers := nb.DeepCopy()
+		workers.Spec.Workers = &v1beta1.NotebookWorkersSpec{Replicas: 1}
+		workersEvent := newTestEvent("workers-event", "StatefulSet", workersName(workers), 1, now)
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(workers, workersEvent).Build()
+		r, recorder := newTestEventReconciler(c, config.DefaultEventBurst)
+
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := len(recorder.Events); got != 1 {
+			t.Fatalf("Got %d re-emitted events, Expected 1", got)
+		}
+		if event := <-recorder.Events; !strings.Contains(event, "statefulset/"+workersName(workers)) {
+			t.Errorf("Expected the event of the workers, got %q", event)
+		}
+	})
+
+	t.Run("rate limited per notebook", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(nb, pod, podEvent.DeepCopy(), stsEvent.DeepCopy()).Build()
+		r, recorder := newTestEventReconciler(c, 1)
+
+		result, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := len(recorder.Events); got != 1 {
+			t.Fatalf("Got %d re-emitted events, Expected 1", got)
+		}
+		if result.RequeueAfter == 0 {
+			t.Errorf("Expected the rate limited request to be requeued")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// controllerAnnotations are the patterns of the annotations of the Notebooks
+// that are meant for the controller or kubectl. They are never propagated to
+// the Pods, e.g. the culler updates the last activity, which would restart
+// the notebook.
+var controllerAnnotations = []string{"notebooks.kubeflow.org/*", "kubectl.kubernetes.io/*", STOP_ANNOTATION}
+
+// propagatedLabels returns the labels of the Notebook that are propagated to
+// its Pods, including the ones that select PodDefaults
+func propagatedLabels(nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig) map[string]string {
+	labels := map[string]string{}
+	for k, v := range nb.Labels {
+		if cfg.PodMetadata.Labels.Propagates(k) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// propagatedAnnotations returns the annotations of the Notebook that are
+// propagated to its Pods. Without an annotations filter in the configuration,
+// the keys that contain "kubectl" or "notebook" are dropped, like before the
+// filter existed.
+func propagatedAnnotations(nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig) map[string]string {
+	filter := &cfg.PodMetadata.Annotations
+	annotations := map[string]string{}
+	for k, v := range nb.Annotations {
+		if filter.IsEmpty() {
+			if strings.Contains(k, "kubectl") || strings.Contains(k, "notebook") {
+				continue
+			}
+		} else if config.MatchesAny(controllerAnnotations, k) || !filter.Propagates(k) {
+			continue
+		}
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// setPodMetadata sets the labels and annotations of the pod template to the
+// ones propagated from the Notebook, overridden by the ones of the template
+// of the Notebook, and then by the labels of the controller, which select the
+// Pods.
+func setPodMetadata(template *corev1.PodTemplateSpec, nb *v1beta1.Notebook, metadata *v1beta1.NotebookTemplateMetadata,
+	cfg *config.NotebookControllerConfig, controllerLabels map[string]string) {
+
+	labels := propagatedLabels(nb, cfg)
+	annotations := propagatedAnnotations(nb, cfg)
+	if metadata != nil {
+		for k, v := range metadata.Labels {
+			labels[k] = v
+		}
+		for k, v := range metadata.Annotations {
+			annotations[k] = v
+		}
+	}
+	for k, v := range controllerLabels {
+		labels[k] = v
+	}
+	template.Labels = labels
+	template.Annotations = annotations
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// setTestMetadata sets the labels and annotations of the Notebook and of the
+// template of its Pods
+func setTestMetadata(nb *v1beta1.Notebook) {
+	nb.Labels = map[string]string{
+		"access-ml-pipeline": "true",
+		"statefulset":        "other",
+	}
+	nb.Annotations = map[string]string{
+		"mynotebook-team.example.com/owner":                "alice",
+		"sidecar.istio.io/inject":                          "false",
+		LAST_ACTIVITY_ANNOTATION:                           "2022-01-01T00:00:00Z",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	}
+	nb.Spec.Template.Metadata = &v1beta1.NotebookTemplateMetadata{
+		Labels:      map[string]string{"access-ml-pipeline": "false"},
+		Annotations: map[string]string{"notebook.example.com/kept": "true"},
+	}
+}
+
+func TestGenerateStatefulSetMetadata(t *testing.T) {
+	nb := newTestNotebook("nb")
+	setTestMetadata(nb)
+
+	// Without a filter, the keys that contain "kubectl" or "notebook" are
+	// dropped, but the ones of the template are kept
+	template := generateStatefulSet(nb, config.Default()).Spec.Template
+	expectedLabels := map[string]string{
+		"access-ml-pipeline": "false",
+		"statefulset":        "nb",
+		"notebook-name":      "nb",
+	}
+	if !reflect.DeepEqual(template.Labels, expectedLabels) {
+		t.Errorf("Got the labels %v, Expected %v", template.Labels, expectedLabels)
+	}
+	expectedAnnotations := map[string]string{
+		"sidecar.istio.io/inject":   "false",
+		"notebook.example.com/kept": "true",
+	}
+	if !reflect.DeepEqual(template.Annotations, expectedAnnotations) {
+		t.Errorf("Got the annotations %v, Expected %v", template.Annotations, expectedAnnotations)
+	}
+
+	// With a filter, the annotations of the controller and of kubectl are
+	// still dropped
+	cfg := config.Default()
+	cfg.PodMetadata.Annotations.Deny = []string{"sidecar.istio.io/*"}
+	cfg.PodMetadata.Labels.Deny = []string{"access-*"}
+	template = generateStatefulSet(nb, cfg).Spec.Template
+	expectedAnnotations = map[string]string{
+		"mynotebook-team.example.com/owner": "alice",
+		"notebook.example.com/kept":         "true",
+	}
+	if !reflect.DeepEqual(template.Annotations, expectedAnnotations) {
+		t.Errorf("Got the annotations %v, Expected %v", template.Annotations, expectedAnnotations)
+	}
+	if template.Labels["access-ml-pipeline"] != "false" {
+		t.Errorf("Expected the labels of the template to be kept, got %v", template.Labels)
+	}
+
+	nb.Spec.Template.Metadata = nil
+	template = generateStatefulSet(nb, cfg).Spec.Template
+	if _, ok := template.Labels["access-ml-pipeline"]; ok {
+		t.Errorf("Expected the label to be denied, got %v", template.Labels)
+	}
+}
+
+func TestReconcileTemplateMetadata(t *testing.T) {
+	for _, strategy := range []v1beta1.NotebookUpdateStrategy{v1beta1.NotebookUpdateImmediate, v1beta1.NotebookUpdateOnStop} {
+		t.Run(string(strategy), func(t *testing.T) {
+			// The StatefulSet was created before the metadata of the template
+			// changed
+			nb := newTestNotebook("nb")
+			setTestMetadata(nb)
+			nb.Spec.UpdateStrategy = strategy
+			found := appliedStatefulSet(t, nb)
+			if err := ctrl.SetControllerReference(nb, found, newTestScheme()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			nb.Spec.Template.Metadata.Labels["access-ml-pipeline"] = "true"
+			nb.Spec.Template.Metadata.Annotations["notebook.example.com/added"] = "true"
+
+			r, c := newTestNotebookReconciler(nb, found)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			ss := &appsv1.StatefulSet{}
+			if err := c.Get(context.TODO(), client.ObjectKeyFromObject(found), ss); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := c.Get(context.TODO(), req.NamespacedName, nb); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			labels, annotations := ss.Spec.Template.Labels, ss.Spec.Template.Annotations
+			pending := meta.IsStatusConditionTrue(nb.Status.Conditions, v1beta1.NotebookConditionPendingUpdate)
+			if strategy == v1beta1.NotebookUpdateImmediate {
+				if labels["access-ml-pipeline"] != "true" || annotations["notebook.example.com/added"] != "true" || pending {
+					t.Errorf("Expected the metadata to be updated, got the labels %v and the annotations %v", labels, annotations)
+				}
+				return
+			}
+			if labels["access-ml-pipeline"] != "false" || annotations["notebook.example.com/added"] != "" || !pending {
+				t.Errorf("Expected the metadata to be held, got the labels %v and the annotations %v", labels, annotations)
+			}
+			condition := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionPendingUpdate)
+			expected := "Changes to spec.template.metadata.labels, spec.template.metadata.annotations are held until the Notebook is stopped"
+			if condition.Message != expected {
+				t.Errorf("Got the message %q, Expected %q", condition.Message, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// namespaceNameLabel is set by Kubernetes on every namespace to its name
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+func namespacePeer(namespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{namespaceNameLabel: namespace},
+		},
+	}
+}
+
+// notebookPeers returns the NetworkPolicy peers of the peers of a Notebook
+func notebookPeers(peers []v1beta1.NotebookNetworkPeer) []networkingv1.NetworkPolicyPeer {
+	result := []networkingv1.NetworkPolicyPeer{}
+	for _, peer := range peers {
+		if peer.CIDR != "" {
+			result = append(result, networkingv1.NetworkPolicyPeer{
+				IPBlock: &networkingv1.IPBlock{CIDR: peer.CIDR},
+			})
+		} else {
+			result = append(result, namespacePeer(peer.Namespace))
+		}
+	}
+	return result
+}
+
+// generateNetworkPolicy returns the NetworkPolicy of the notebook Pod and of
+// its workers, which all carry the notebook-name label. The ingress gateway,
+// the notebook-controller and the other Pods of the Notebook can always reach
+// them, and they can always reach DNS and each other when their egress is
+// restricted.
+func generateNetworkPolicy(nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig) *networkingv1.NetworkPolicy {
+	notebookPods := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"notebook-name": nb.Name},
+		},
+	}
+
+	from := []networkingv1.NetworkPolicyPeer{}
+	for _, ns := range cfg.NetworkPolicy.IngressGatewayNamespaces {
+		from = append(from, namespacePeer(ns))
+	}
+	controller := namespacePeer(cfg.NetworkPolicy.ControllerNamespace)
+	controller.PodSelector = &metav1.LabelSelector{MatchLabels: cfg.NetworkPolicy.ControllerPodLabels}
+	from = append(from, controller, notebookPods)
+	from = append(from, notebookPeers(nb.Spec.NetworkPolicy.Ingress)...)
+
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nb.Name,
+			Namespace: nb.Namespace,
+			Labels:    map[string]string{"notebook-name": nb.Name},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *notebookPods.PodSelector,
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: from}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+
+	if egress := nb.Spec.NetworkPolicy.Egress; len(egress) > 0 {
+		udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+		dns := intstr.FromInt(53)
+		np.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{
+			{
+				Ports: []networkingv1.NetworkPolicyPort{
+					{Protocol: &udp, Port: &dns},
+					{Protocol: &tcp, Port: &dns},
+				},
+			},
+			{
+				To: append([]networkingv1.NetworkPolicyPeer{notebookPods}, notebookPeers(egress)...),
+			},
+		}
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return np
+}
+
+// reconcileNetworkPolicy creates or updates the NetworkPolicy of the
+// Notebook, or deletes it once the Notebook no longer declares one. A
+// NetworkPolicy with the same name that the Notebook doesn't control is left
+// alone.
+func (r *NotebookReconciler) reconcileNetworkPolicy(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.NotebookControllerConfig, log logr.Logger) error {
+
+	found := &networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, types.NamespacedName{Name: nb.Name, Namespace: nb.Namespace}, found)
+	if err != nil && !apierrs.IsNotFound(err) {
+		log.Error(err, "error getting NetworkPolicy")
+		return err
+	}
+	exists := err == nil
+
+	if nb.Spec.NetworkPolicy == nil {
+		if !exists || !metav1.IsControlledBy(found, nb) {
+			return nil
+		}
+		log.Info("Deleting NetworkPolicy", "namespace", found.Namespace, "name", found.Name)
+		return ignoreNotFound(r.Delete(ctx, found))
+	}
+
+	np := generateNetworkPolicy(nb, cfg)
+	if err := ctrl.SetControllerReference(nb, np, r.Scheme); err != nil {
+		return err
+	}
+	if !exists {
+		log.Info("Creating NetworkPolicy", "namespace", np.Namespace, "name", np.Name)
+		if err := r.Create(ctx, np); err != nil {
+			log.Error(err, "unable to create NetworkPolicy")
+			return err
+		}
+		return nil
+	}
+	if !metav1.IsControlledBy(found, nb) {
+		// Don't take over a policy of the user's that has the same name
+		log.Info("NetworkPolicy isn't controlled by the Notebook, skipping it",
+			"namespace", found.Namespace, "name", found.Name)
+		r.EventRecorder.Eventf(nb, corev1.EventTypeWarning, "NetworkPolicyConflict",
+			"NetworkPolicy %s already exists and isn't controlled by the Notebook", found.Name)
+		return nil
+	}
+	if !apiequality.Semantic.DeepEqual(found.Spec, np.Spec) {
+		log.Info("Updating NetworkPolicy", "namespace", np.Namespace, "name", np.Name)
+		found.Spec = np.Spec
+		if err := r.Update(ctx, found); err != nil {
+			log.Error(err, "unable to update NetworkPolicy")
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func TestGenerateNetworkPolicy(t *testing.T) {
+	cfg := config.Default()
+	nb := newTestNotebook("nb")
+	nb.Spec.NetworkPolicy = &v1beta1.NotebookNetworkPolicy{
+		Ingress: []v1beta1.NotebookNetworkPeer{{Namespace: "monitoring"}},
+	}
+
+	np := generateNetworkPolicy(nb, cfg)
+	if np.Spec.PodSelector.MatchLabels["notebook-name"] != "nb" {
+		t.Errorf("Got the pod selector %+v", np.Spec.PodSelector)
+	}
+	// The policy also applies to the Pods of the workers
+	nb.Spec.Workers = &v1beta1.NotebookWorkersSpec{Replicas: 1}
+	workerLabels := labels.Set(generateWorkerStatefulSet(nb, cfg).Spec.Template.Labels)
+	headLabels := labels.Set(generateStatefulSet(nb, cfg).Spec.Template.Labels)
+	selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !selector.Matches(workerLabels) || !selector.Matches(headLabels) {
+		t.Errorf("Expected the pod selector to match the notebook and its workers, got %+v", np.Spec.PodSelector)
+	}
+	if len(np.Spec.PolicyTypes) != 1 || np.Spec.PolicyTypes[0] != networkingv1.PolicyTypeIngress || np.Spec.Egress != nil {
+		t.Errorf("Expected the egress not to be restricted, got %+v", np.Spec)
+	}
+	from := np.Spec.Ingress[0].From
+	if len(from) != 4 {
+		t.Fatalf("Got the ingress %+v", from)
+	}
+	if from[0].NamespaceSelector.MatchLabels[namespaceNameLabel] != "istio-system" {
+		t.Errorf("Expected the ingress gateway to be allowed, got %+v", from[0])
+	}
+	if from[1].NamespaceSelector.MatchLabels[namespaceNameLabel] != "kubeflow" ||
+		from[1].PodSelector.MatchLabels["app"] != "notebook-controller" {
+		t.Errorf("Expected the controller to be allowed, got %+v", from[1])
+	}
+	if from[2].NamespaceSelector != nil || from[2].PodSelector.MatchLabels["notebook-name"] != "nb" {
+		t.Errorf("Expected the workers to be allowed, got %+v", from[2])
+	}
+	if from[3].NamespaceSelector.MatchLabels[namespaceNameLabel] != "monitoring" {
+		t.Errorf("Got the ingress %+v", from[3])
+	}
+
+	nb.Spec.NetworkPolicy.Egress = []v1beta1.NotebookNetworkPeer{{CIDR: "10.0.0.0/16"}}
+	np = generateNetworkPolicy(nb, cfg)
+	if len(np.Spec.PolicyTypes) != 2 || len(np.Spec.Egress) != 2 {
+		t.Fatalf("Expected the egress to be restricted, got %+v", np.Spec)
+	}
+	if ports := np.Spec.Egress[0].Ports; len(ports) != 2 || ports[0].Port.IntValue() != 53 || np.Spec.Egress[0].To != nil {
+		t.Errorf("Expected DNS to be allowed, got %+v", np.Spec.Egress[0])
+	}
+	to := np.Spec.Egress[1].To
+	if len(to) != 2 || to[1].IPBlock == nil || to[1].IPBlock.CIDR != "10.0.0.0/16" {
+		t.Errorf("Got the egress %+v", to)
+	}
+}
+
+func TestReconcileNetworkPolicy(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.NetworkPolicy = &v1beta1.NotebookNetworkPolicy{}
+	r, c := newTestNotebookReconciler(nb)
+	cfg := config.Default()
+	key := client.ObjectKey{Name: "nb", Namespace: "ns"}
+
+	if err := r.reconcileNetworkPolicy(context.TODO(), nb, cfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	np := &networkingv1.NetworkPolicy{}
+	if err := c.Get(context.TODO(), key, np); err != nil {
+		t.Fatalf("Expected the NetworkPolicy to exist: %v", err)
+	}
+	if !metav1.IsControlledBy(np, nb) {
+		t.Errorf("Expected the NetworkPolicy to be owned by the Notebook, got %+v", np.OwnerReferences)
+	}
+
+	nb.Spec.NetworkPolicy.Egress = []v1beta1.NotebookNetworkPeer{{Namespace: "kubeflow"}}
+	if err := r.reconcileNetworkPolicy(context.TODO(), nb, cfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Get(context.TODO(), key, np); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(np.Spec.Egress) != 2 {
+		t.Errorf("Expected the egress to be updated, got %+v", np.Spec.Egress)
+	}
+
+	nb.Spec.NetworkPolicy = nil
+	if err := r.reconcileNetworkPolicy(context.TODO(), nb, cfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Get(context.TODO(), key, np); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the NetworkPolicy to be deleted, got %v", err)
+	}
+}
+
+func TestReconcileNetworkPolicyConflict(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.NetworkPolicy = &v1beta1.NotebookNetworkPolicy{}
+	existing := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "ns"},
+		Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}},
+	}
+	r, c := newTestNotebookReconciler(nb, existing)
+	recorder := r.EventRecorder.(*record.FakeRecorder)
+
+	if err := r.reconcileNetworkPolicy(context.TODO(), nb, config.Default(), TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	np := &networkingv1.NetworkPolicy{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb", Namespace: "ns"}, np); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(np.OwnerReferences) != 0 || len(np.Spec.Ingress) != 0 {
+		t.Errorf("Expected the NetworkPolicy to be left alone, got %+v", np)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NetworkPolicyConflict") {
+		t.Errorf("Expected a NetworkPolicyConflict event, got %q", event)
+	}
+}
@@ -0,0 +1,440 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	reconcilehelper "github.com/kubeflow/kubeflow/components/common/reconcilehelper"
+	"github.com/kubeflow/kubeflow/components/common/routing"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+const (
+	// SSHServiceSuffix is appended to the name of a Notebook with remote
+	// access to name the Service and the route of its SSH server
+	SSHServiceSuffix = "-ssh"
+
+	sshContainerName = "ssh"
+	sshContainerPort = 2222
+	sshServicePort   = 22
+
+	// The authorized keys of the Secret are mounted in the SSH server
+	sshKeysVolumeName    = "notebook-ssh-keys"
+	sshKeysMountPath     = "/etc/notebook-ssh"
+	sshAuthorizedKeysKey = "authorized_keys"
+
+	// The user of the SSH server when the notebook container doesn't set
+	// it, the jovyan user of the Kubeflow images
+	defaultSSHUserID = 1000
+
+	// GatewayPortLabel is set on the Leases that reserve the ports of the
+	// gateway to the reserved port
+	GatewayPortLabel = "notebooks.kubeflow.org/gateway-port"
+
+	// GatewayPortFinalizer keeps a Notebook whose SSH server is routed
+	// through the gateway around until the Lease of its port is released.
+	// The Leases live in the namespace of the controller, so they can't be
+	// owned by the Notebooks.
+	GatewayPortFinalizer = "notebooks.kubeflow.org/gateway-port"
+)
+
+func sshServiceName(nb *v1beta1.Notebook) string {
+	return nb.Name + SSHServiceSuffix
+}
+
+// sshUserIDs returns the user and group the SSH sessions run as, the ones of
+// the notebook container, so they can write the same files. They fall back to
+// the ones of the pod, its fsGroup, and the jovyan user of the Kubeflow
+// images.
+func sshUserIDs(podSpec *corev1.PodSpec) (int64, int64) {
+	uid, gid := int64(defaultSSHUserID), v1beta1.DefaultFSGroup
+	if pod := podSpec.SecurityContext; pod != nil {
+		if pod.FSGroup != nil {
+			gid = *pod.FSGroup
+		}
+		if pod.RunAsUser != nil {
+			uid = *pod.RunAsUser
+		}
+		if pod.RunAsGroup != nil {
+			gid = *pod.RunAsGroup
+		}
+	}
+	if container := podSpec.Containers[0].SecurityContext; container != nil {
+		if container.RunAsUser != nil {
+			uid = *container.RunAsUser
+		}
+		if container.RunAsGroup != nil {
+			gid = *container.RunAsGroup
+		}
+	}
+	return uid, gid
+}
+
+// addSSHServer adds the SSH server sidecar to the pod spec of a Notebook with
+// remote access. It mounts the volumes of the notebook container at the same
+// paths, so the remote sessions see the files of the notebook, and runs as
+// the notebook user.
+func addSSHServer(nb *v1beta1.Notebook, podSpec *corev1.PodSpec, cfg *config.NotebookControllerConfig) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: sshKeysVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: nb.Spec.RemoteAccess.AuthorizedKeysSecretName,
+				Items:      []corev1.KeyToPath{{Key: sshAuthorizedKeysKey, Path: sshAuthorizedKeysKey}},
+			},
+		},
+	})
+
+	uid, gid := sshUserIDs(podSpec)
+	mounts := append([]corev1.VolumeMount{}, podSpec.Containers[0].VolumeMounts...)
+	mounts = append(mounts, corev1.VolumeMount{
+		Name:      sshKeysVolumeName,
+		MountPath: sshKeysMountPath,
+		ReadOnly:  true,
+	})
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  sshContainerName,
+		Image: cfg.RemoteAccess.Image,
+		Ports: []corev1.ContainerPort{{
+			Name:          "ssh",
+			ContainerPort: sshContainerPort,
+			Protocol:      corev1.ProtocolTCP,
+		}},
+		Env: []corev1.EnvVar{
+			{Name: "USER_NAME", Value: cfg.RemoteAccess.User},
+			{Name: "PUBLIC_KEY_FILE", Value: path.Join(sshKeysMountPath, sshAuthorizedKeysKey)},
+			{Name: "PUID", Value: fmt.Sprint(uid)},
+			{Name: "PGID", Value: fmt.Sprint(gid)},
+		},
+		VolumeMounts: mounts,
+	})
+}
+
+// generateSSHService returns the Service of the SSH server of a Notebook.
+// The port name follows the Istio pattern, like the one of the notebook
+// Service.
+func generateSSHService(nb *v1beta1.Notebook) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sshServiceName(nb),
+			Namespace: nb.Namespace,
+			Labels:    map[string]string{"notebook-name": nb.Name},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{"statefulset": nb.Name},
+			Ports: []corev1.ServicePort{{
+				Name:       "tcp-ssh",
+				Port:       sshServicePort,
+				TargetPort: intstr.FromInt(sshContainerPort),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+}
+
+func gatewayPortLeaseName(port int32) string {
+	return fmt.Sprintf("notebook-gateway-port-%d", port)
+}
+
+func leaseHolder(nb *v1beta1.Notebook) string {
+	return nb.Namespace + "/" + nb.Name
+}
+
+// allocateGatewayPort returns the port of the gateway routed to the SSH
+// server of the Notebook. Each port is reserved by a Lease held by the
+// Notebook, which is created before the port is routed, so two Notebooks
+// can't be assigned the same port, even from a stale cache. A Notebook keeps
+// its port, and new Notebooks get the lowest free port of the range. The
+// ports of deleted Notebooks, or of Notebooks without remote access, are
+// reclaimed. It returns 0 once all the ports are taken. The Leases are read
+// from the cache, the API server is only queried when a port turns out to be
+// taken.
+func (r *NotebookReconciler) allocateGatewayPort(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.RemoteAccessConfig) (int32, error) {
+
+	leases := &coordinationv1.LeaseList{}
+	if err := r.List(ctx, leases, client.InNamespace(cfg.PortLeaseNamespace),
+		client.HasLabels{GatewayPortLabel}); err != nil {
+		return 0, err
+	}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != leaseHolder(nb) {
+			continue
+		}
+		port, err := strconv.ParseInt(lease.Labels[GatewayPortLabel], 10, 32)
+		if err == nil && int32(port) >= cfg.FirstGatewayPort && int32(port) <= cfg.LastGatewayPort {
+			return int32(port), nil
+		}
+		// The range of ports changed
+		if err := r.Delete(ctx, lease); ignoreNotFound(err) != nil {
+			return 0, err
+		}
+	}
+
+	// Notebooks routed by older versions of the controller keep the port of
+	// their status if it's free
+	ports := []int32{}
+	if status := nb.Status.RemoteAccess; status != nil && status.GatewayPort != 0 {
+		ports = append(ports, status.GatewayPort)
+	}
+	for port := cfg.FirstGatewayPort; port <= cfg.LastGatewayPort; port++ {
+		ports = append(ports, port)
+	}
+	for _, port := range ports {
+		if port < cfg.FirstGatewayPort || port > cfg.LastGatewayPort {
+			continue
+		}
+		reserved, err := r.reserveGatewayPort(ctx, nb, cfg, port)
+		if err != nil {
+			return 0, err
+		}
+		if reserved {
+			return port, nil
+		}
+	}
+	return 0, nil
+}
+
+// reserveGatewayPort creates the Lease of the port for the Notebook, or takes
+// it over if its holder no longer needs it. It returns false if the port is
+// held by another Notebook.
+func (r *NotebookReconciler) reserveGatewayPort(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.RemoteAccessConfig, port int32) (bool, error) {
+
+	holder := leaseHolder(nb)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gatewayPortLeaseName(port),
+			Namespace: cfg.PortLeaseNamespace,
+			Labels:    map[string]string{GatewayPortLabel: fmt.Sprint(port)},
+		},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder},
+	}
+	err := r.Create(ctx, lease)
+	if err == nil || !apierrs.IsAlreadyExists(err) {
+		return err == nil, err
+	}
+
+	if err := r.APIReader.Get(ctx, client.ObjectKeyFromObject(lease), lease); err != nil {
+		return false, ignoreNotFound(err)
+	}
+	if lease.Spec.HolderIdentity != nil {
+		if *lease.Spec.HolderIdentity == holder {
+			return true, nil
+		}
+		namespace, name, _ := cache.SplitMetaNamespaceKey(*lease.Spec.HolderIdentity)
+		other := &v1beta1.Notebook{}
+		err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, other)
+		if err == nil && other.Spec.RemoteAccess != nil {
+			return false, nil
+		}
+		if ignoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+	// The update fails if another Notebook took the port over first
+	lease.Spec.HolderIdentity = &holder
+	if err := r.Update(ctx, lease); apierrs.IsConflict(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseGatewayPort deletes the Leases of the ports held by the Notebook
+func (r *NotebookReconciler) releaseGatewayPort(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.RemoteAccessConfig) error {
+
+	leases := &coordinationv1.LeaseList{}
+	if err := r.List(ctx, leases, client.InNamespace(cfg.PortLeaseNamespace),
+		client.HasLabels{GatewayPortLabel}); err != nil {
+		return err
+	}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == leaseHolder(nb) {
+			if err := r.Delete(ctx, lease); ignoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setGatewayPortFinalizer adds or removes the GatewayPortFinalizer of the
+// Notebook. Only the finalizers and the resource version of nb are updated,
+// so the status computed so far is kept.
+func (r *NotebookReconciler) setGatewayPortFinalizer(ctx context.Context, nb *v1beta1.Notebook, present bool) error {
+	if controllerutil.ContainsFinalizer(nb, GatewayPortFinalizer) == present {
+		return nil
+	}
+	updated := nb.DeepCopy()
+	patch := client.MergeFrom(nb)
+	if present {
+		controllerutil.AddFinalizer(updated, GatewayPortFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(updated, GatewayPortFinalizer)
+	}
+	if err := r.Patch(ctx, updated, patch); err != nil {
+		return err
+	}
+	nb.Finalizers = updated.Finalizers
+	nb.ResourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// finalizeGatewayPort releases the port of the gateway of a deleted Notebook
+func (r *NotebookReconciler) finalizeGatewayPort(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.RemoteAccessConfig) error {
+
+	if !controllerutil.ContainsFinalizer(nb, GatewayPortFinalizer) {
+		return nil
+	}
+	if err := r.releaseGatewayPort(ctx, nb, cfg); err != nil {
+		return err
+	}
+	return ignoreNotFound(r.setGatewayPortFinalizer(ctx, nb, false))
+}
+
+// connectionString returns the ssh command that connects to the SSH server
+// of the Notebook, through the gateway if it is routed, and through its
+// Service otherwise, e.g. from another Pod or with kubectl port-forward
+func connectionString(nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig, gatewayPort int32) string {
+	if gatewayPort != 0 {
+		return fmt.Sprintf("ssh -p %d %s@%s", gatewayPort, cfg.RemoteAccess.User, cfg.RemoteAccess.GatewayHost)
+	}
+	return fmt.Sprintf("ssh %s@%s.%s.svc.%s", cfg.RemoteAccess.User, sshServiceName(nb), nb.Namespace, cfg.ClusterDomain)
+}
+
+// reconcileRemoteAccess creates or updates the Service of the SSH server of
+// the Notebook and, if the gateway is configured, the TCP route from a port
+// of the gateway to it. It returns the status of the remote access, and
+// removes the Service and the route once the Notebook no longer declares it.
+func (r *NotebookReconciler) reconcileRemoteAccess(ctx context.Context, nb *v1beta1.Notebook,
+	cfg *config.NotebookControllerConfig, log logr.Logger) (*v1beta1.NotebookRemoteAccessStatus, error) {
+
+	routingCfg := cfg.RoutingConfig()
+	routed := routingCfg.Enabled() && cfg.RemoteAccess.GatewayRoutingEnabled()
+	if nb.Spec.RemoteAccess == nil {
+		status := nb.Status.RemoteAccess
+		if controllerutil.ContainsFinalizer(nb, GatewayPortFinalizer) || (status != nil && status.GatewayPort != 0) {
+			if err := r.releaseGatewayPort(ctx, nb, &cfg.RemoteAccess); err != nil {
+				return nil, err
+			}
+			if err := r.setGatewayPortFinalizer(ctx, nb, false); err != nil {
+				return nil, err
+			}
+		}
+		return nil, r.removeRemoteAccess(ctx, nb, routingCfg, routed, log)
+	}
+
+	service := generateSSHService(nb)
+	if err := ctrl.SetControllerReference(nb, service, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := reconcilehelper.Service(ctx, r.Client, service, log); err != nil {
+		return nil, err
+	}
+
+	status := &v1beta1.NotebookRemoteAccessStatus{ServiceName: service.Name}
+	if routed {
+		if err := r.setGatewayPortFinalizer(ctx, nb, true); err != nil {
+			return nil, err
+		}
+		port, err := r.allocateGatewayPort(ctx, nb, &cfg.RemoteAccess)
+		if err != nil {
+			return nil, err
+		}
+		if port == 0 {
+			r.EventRecorder.Event(nb, corev1.EventTypeWarning, "GatewayPortsExhausted",
+				"All the gateway ports for SSH are taken, the SSH server is only reachable inside the cluster")
+		} else {
+			route, err := routing.GenerateTCP(routingCfg, routing.TCPRoute{
+				Name:        sshServiceName(nb),
+				Namespace:   nb.Namespace,
+				Labels:      map[string]string{"notebook-name": nb.Name},
+				GatewayPort: port,
+				ServiceName: service.Name,
+				ServicePort: sshServicePort,
+			})
+			if err != nil {
+				log.Error(err, "unable to generate the SSH route", "mode", routingCfg.Mode)
+				return nil, err
+			}
+			if err := ctrl.SetControllerReference(nb, route, r.Scheme); err != nil {
+				return nil, err
+			}
+			if err := routing.Reconcile(ctx, r.Client, route, log); err != nil {
+				return nil, err
+			}
+			status.GatewayPort = port
+		}
+	}
+	status.ConnectionString = connectionString(nb, cfg, status.GatewayPort)
+	return status, nil
+}
+
+// removeRemoteAccess deletes the Service and the route of the SSH server,
+// once the remote access is removed from the Notebook
+func (r *NotebookReconciler) removeRemoteAccess(ctx context.Context, nb *v1beta1.Notebook,
+	routingCfg routing.Config, routed bool, log logr.Logger) error {
+
+	objects := []client.Object{
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: sshServiceName(nb), Namespace: nb.Namespace}},
+	}
+	if routed {
+		route := routingCfg.TCPObject()
+		route.SetName(sshServiceName(nb))
+		route.SetNamespace(nb.Namespace)
+		objects = append(objects, route)
+	}
+	for _, obj := range objects {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if apierrs.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+		if !metav1.IsControlledBy(obj, nb) {
+			continue
+		}
+		log.Info("Deleting the remote access of the Notebook", "name", obj.GetName())
+		if err := r.Delete(ctx, obj); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
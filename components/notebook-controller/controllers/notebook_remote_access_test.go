@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/kubeflow/kubeflow/components/common/routing"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func newTestRemoteAccess() *v1beta1.NotebookRemoteAccess {
+	return &v1beta1.NotebookRemoteAccess{AuthorizedKeysSecretName: "ssh-keys"}
+}
+
+func remoteAccessConfig() *config.NotebookControllerConfig {
+	cfg := config.Default()
+	cfg.Routing.Mode = routing.ModeGatewayAPI
+	cfg.RemoteAccess.GatewayHost = "kubeflow.example.com"
+	cfg.RemoteAccess.FirstGatewayPort = 2200
+	cfg.RemoteAccess.LastGatewayPort = 2201
+	return cfg
+}
+
+func TestAddSSHServer(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.RemoteAccess = newTestRemoteAccess()
+	nb.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "workspace", MountPath: "/home/jovyan"}}
+	ss := generateStatefulSet(nb, config.Default())
+
+	podSpec := ss.Spec.Template.Spec
+	if len(podSpec.Containers) != 2 {
+		t.Fatalf("Expected the SSH server sidecar, got %+v", podSpec.Containers)
+	}
+	ssh := podSpec.Containers[1]
+	if ssh.Name != sshContainerName || ssh.Image != config.DefaultRemoteAccessImage ||
+		ssh.Ports[0].ContainerPort != sshContainerPort {
+		t.Errorf("Got the container %+v", ssh)
+	}
+	// The sidecar sees the files of the notebook
+	if len(ssh.VolumeMounts) != 2 || ssh.VolumeMounts[0].MountPath != "/home/jovyan" ||
+		ssh.VolumeMounts[1].Name != sshKeysVolumeName {
+		t.Errorf("Got the volume mounts %+v", ssh.VolumeMounts)
+	}
+	volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+	if volume.Secret == nil || volume.Secret.SecretName != "ssh-keys" {
+		t.Errorf("Got the volume %+v", volume)
+	}
+	if len(podSpec.Containers[0].VolumeMounts) != 1 {
+		t.Errorf("Expected the notebook container to be unchanged, got %+v", podSpec.Containers[0].VolumeMounts)
+	}
+}
+
+func TestReconcileRemoteAccess(t *testing.T) {
+	// Another Notebook holds the first port of the gateway
+	other := newTestNotebook("other")
+	other.Spec.RemoteAccess = newTestRemoteAccess()
+	nb := newTestNotebook("nb")
+	nb.Spec.RemoteAccess = newTestRemoteAccess()
+	r, c := newTestNotebookReconciler(nb, other, gatewayPortLease(2200, "ns/other"))
+	recorder := r.EventRecorder.(*record.FakeRecorder)
+	cfg := remoteAccessConfig()
+
+	status, err := r.reconcileRemoteAccess(context.TODO(), nb, cfg, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.ServiceName != "nb-ssh" || status.GatewayPort != 2201 ||
+		status.ConnectionString != "ssh -p 2201 jovyan@kubeflow.example.com" {
+		t.Errorf("Got the status %+v", status)
+	}
+	service := &corev1.Service{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb-ssh", Namespace: "ns"}, service); err != nil {
+		t.Fatalf("Expected the Service to exist: %v", err)
+	}
+	if service.Spec.Ports[0].Port != sshServicePort || service.Spec.Selector["statefulset"] != "nb" {
+		t.Errorf("Got the Service %+v", service.Spec)
+	}
+	route := cfg.RoutingConfig().TCPObject()
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb-ssh", Namespace: "ns"}, route); err != nil {
+		t.Fatalf("Expected the TCPRoute to exist: %v", err)
+	}
+	if !metav1.IsControlledBy(route, nb) {
+		t.Errorf("Expected the TCPRoute to be owned by the Notebook, got %+v", route.GetOwnerReferences())
+	}
+	lease := &coordinationv1.Lease{}
+	leaseKey := client.ObjectKey{Name: "notebook-gateway-port-2201", Namespace: config.DefaultControllerNamespace}
+	if err := c.Get(context.TODO(), leaseKey, lease); err != nil {
+		t.Fatalf("Expected the port to be reserved: %v", err)
+	}
+	if *lease.Spec.HolderIdentity != "ns/nb" || lease.Labels[GatewayPortLabel] != "2201" {
+		t.Errorf("Got the Lease %+v", lease)
+	}
+
+	// The Notebook keeps its port
+	nb.Status.RemoteAccess = status
+	if err := c.Status().Update(context.TODO(), nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status, err := r.reconcileRemoteAccess(context.TODO(), nb, cfg, TestLogger); err != nil || status.GatewayPort != 2201 {
+		t.Errorf("Got the status %+v and the error %v", status, err)
+	}
+
+	// Once the ports are taken, the SSH server is only reachable through its
+	// Service
+	third := newTestNotebook("third")
+	third.Spec.RemoteAccess = newTestRemoteAccess()
+	if err := c.Create(context.TODO(), third); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err = r.reconcileRemoteAccess(context.TODO(), third, cfg, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.GatewayPort != 0 || status.ConnectionString != "ssh jovyan@third-ssh.ns.svc.cluster.local" {
+		t.Errorf("Got the status %+v", status)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected an event, got %d", len(recorder.Events))
+	}
+
+	nb.Spec.RemoteAccess = nil
+	status, err = r.reconcileRemoteAccess(context.TODO(), nb, cfg, TestLogger)
+	if err != nil || status != nil {
+		t.Fatalf("Got the status %+v and the error %v", status, err)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb-ssh", Namespace: "ns"}, service); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the Service to be deleted, got %v", err)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb-ssh", Namespace: "ns"}, route); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the TCPRoute to be deleted, got %v", err)
+	}
+	if err := c.Get(context.TODO(), leaseKey, lease); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the port to be released, got %v", err)
+	}
+	if controllerutil.ContainsFinalizer(nb, GatewayPortFinalizer) {
+		t.Errorf("Expected the finalizer to be removed, got %v", nb.Finalizers)
+	}
+}
+
+func TestFinalizeGatewayPort(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.RemoteAccess = newTestRemoteAccess()
+	r, c := newTestNotebookReconciler(nb)
+	cfg := remoteAccessConfig()
+	r.Config = config.NewProvider(cfg)
+
+	// The status computed before the finalizer is added is kept
+	nb.Status.ReadyReplicas = 1
+	if _, err := r.reconcileRemoteAccess(context.TODO(), nb, cfg, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !controllerutil.ContainsFinalizer(nb, GatewayPortFinalizer) || nb.Status.ReadyReplicas != 1 {
+		t.Errorf("Got the finalizers %v and the status %+v", nb.Finalizers, nb.Status)
+	}
+
+	// The port is released once the Notebook is deleted
+	if err := c.Delete(context.TODO(), nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(nb)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	leaseKey := client.ObjectKey{Name: gatewayPortLeaseName(2200), Namespace: config.DefaultControllerNamespace}
+	if err := c.Get(context.TODO(), leaseKey, &coordinationv1.Lease{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the port to be released, got %v", err)
+	}
+	found := &v1beta1.Notebook{}
+	err := c.Get(context.TODO(), client.ObjectKeyFromObject(nb), found)
+	if err == nil && controllerutil.ContainsFinalizer(found, GatewayPortFinalizer) {
+		t.Errorf("Expected the finalizer to be removed, got %v", found.Finalizers)
+	} else if err != nil && !apierrs.IsNotFound(err) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func gatewayPortLease(port int32, holder string) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gatewayPortLeaseName(port),
+			Namespace: config.DefaultControllerNamespace,
+			Labels:    map[string]string{GatewayPortLabel: fmt.Sprint(port)},
+		},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder},
+	}
+}
+
+func TestAllocateGatewayPort(t *testing.T) {
+	// The first port is held by a deleted Notebook, the second one by a
+	// Notebook whose remote access was removed
+	stopped := newTestNotebook("stopped")
+	nb := newTestNotebook("nb")
+	nb.Spec.RemoteAccess = newTestRemoteAccess()
+	second := newTestNotebook("second")
+	second.Spec.RemoteAccess = newTestRemoteAccess()
+	third := newTestNotebook("third")
+	third.Spec.RemoteAccess = newTestRemoteAccess()
+	r, _ := newTestNotebookReconciler(nb, second, third, stopped,
+		gatewayPortLease(2200, "ns/deleted"), gatewayPortLease(2201, "ns/stopped"))
+	cfg := remoteAccessConfig()
+
+	port, err := r.allocateGatewayPort(context.TODO(), nb, &cfg.RemoteAccess)
+	if err != nil || port != 2200 {
+		t.Fatalf("Got the port %d and the error %v, Expected 2200", port, err)
+	}
+	port, err = r.allocateGatewayPort(context.TODO(), second, &cfg.RemoteAccess)
+	if err != nil || port != 2201 {
+		t.Fatalf("Got the port %d and the error %v, Expected 2201", port, err)
+	}
+	// The reservations aren't read from the status of the Notebooks
+	third.Status.RemoteAccess = &v1beta1.NotebookRemoteAccessStatus{GatewayPort: 2200}
+	port, err = r.allocateGatewayPort(context.TODO(), third, &cfg.RemoteAccess)
+	if err != nil || port != 0 {
+		t.Fatalf("Got the port %d and the error %v, Expected none", port, err)
+	}
+}
+
+func TestSSHUserIDs(t *testing.T) {
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "nb"}}}
+	if uid, gid := sshUserIDs(podSpec); uid != 1000 || gid != v1beta1.DefaultFSGroup {
+		t.Errorf("Got %d:%d, Expected the jovyan user", uid, gid)
+	}
+
+	podUser, fsGroup, root := int64(1001), int64(200), int64(0)
+	podSpec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: &podUser, FSGroup: &fsGroup}
+	if uid, gid := sshUserIDs(podSpec); uid != 1001 || gid != 200 {
+		t.Errorf("Got %d:%d, Expected the user of the Pod and its fsGroup", uid, gid)
+	}
+
+	podSpec.Containers[0].SecurityContext = &corev1.SecurityContext{RunAsUser: &root, RunAsGroup: &root}
+	if uid, gid := sshUserIDs(podSpec); uid != 0 || gid != 0 {
+		t.Errorf("Got %d:%d, Expected the user of the container", uid, gid)
+	}
+}
@@ -0,0 +1,312 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scheduleLookback bounds how far back missed start and stop times are
+// searched for, e.g. after the controller was down.
+const scheduleLookback = 7 * 24 * time.Hour
+
+// NotebookScheduleReconciler starts and stops the Notebooks selected by a
+// NotebookSchedule at the times of its cron expressions. Only the transitions
+// are applied, so users can still start a Notebook outside of the schedule.
+type NotebookScheduleReconciler struct {
+	client.Client
+	Log           logr.Logger
+	EventRecorder record.EventRecorder
+
+	// now returns the current time, it's replaced in the tests
+	now func() time.Time
+}
+
+// scheduleAction is what a NotebookSchedule does to its Notebooks
+type scheduleAction string
+
+const (
+	scheduleActionStart scheduleAction = "Start"
+	scheduleActionStop  scheduleAction = "Stop"
+)
+
+// +kubebuilder:rbac:groups=kubeflow.org,resources=notebookschedules;notebookschedules/status,verbs="*"
+
+func (r *NotebookScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("notebookschedule", req.NamespacedName)
+
+	schedule := &v1beta1.NotebookSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		return ctrl.Result{}, ignoreNotFound(err)
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	now := r.now()
+	status := schedule.Status.DeepCopy()
+	status.NextStartTime, status.NextStopTime = nil, nil
+	status.Message = ""
+
+	start, stop, selector, err := parseNotebookSchedule(&schedule.Spec)
+	if err != nil {
+		status.Message = err.Error()
+		if status.Message != schedule.Status.Message {
+			r.EventRecorder.Event(schedule, corev1.EventTypeWarning, "InvalidSchedule", status.Message)
+		}
+		return ctrl.Result{}, r.updateScheduleStatus(ctx, schedule, status)
+	}
+	if schedule.Spec.Suspend {
+		status.Message = "The schedule is suspended"
+		return ctrl.Result{}, r.updateScheduleStatus(ctx, schedule, status)
+	}
+
+	// Find the most recent start and stop times that weren't applied yet.
+	// Times before the schedule was created are never applied.
+	since := schedule.CreationTimestamp.Time
+	if status.LastStartTime != nil && status.LastStartTime.After(since) {
+		since = status.LastStartTime.Time
+	}
+	if status.LastStopTime != nil && status.LastStopTime.After(since) {
+		since = status.LastStopTime.Time
+	}
+	if since.Before(now.Add(-scheduleLookback)) {
+		since = now.Add(-scheduleLookback)
+	}
+	lastStart := lastScheduleTime(start, since, now)
+	lastStop := lastScheduleTime(stop, since, now)
+
+	var action scheduleAction
+	switch {
+	case lastStart.IsZero() && lastStop.IsZero():
+	case lastStart.After(lastStop):
+		action = scheduleActionStart
+	default:
+		action = scheduleActionStop
+	}
+	if action != "" {
+		log.Info("Applying the schedule", "action", action)
+		if err := r.applySchedule(ctx, schedule, selector, action); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if !lastStart.IsZero() {
+		status.LastStartTime = &metav1.Time{Time: lastStart}
+	}
+	if !lastStop.IsZero() {
+		status.LastStopTime = &metav1.Time{Time: lastStop}
+	}
+
+	var next time.Time
+	if start != nil {
+		t := start.Next(now)
+		status.NextStartTime = &metav1.Time{Time: t}
+		next = t
+	}
+	if stop != nil {
+		t := stop.Next(now)
+		status.NextStopTime = &metav1.Time{Time: t}
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	if err := r.updateScheduleStatus(ctx, schedule, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	if next.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	// Wake up a little after the next time, so that it has passed
+	return ctrl.Result{RequeueAfter: next.Sub(now) + time.Second}, nil
+}
+
+// parseNotebookSchedule parses the cron expressions, in the time zone of the
+// schedule, and the selector of a NotebookSchedule. Expressions that are
+// unset are returned as nil.
+func parseNotebookSchedule(spec *v1beta1.NotebookScheduleSpec) (cron.Schedule, cron.Schedule, labels.Selector, error) {
+	if spec.Start == "" && spec.Stop == "" {
+		return nil, nil, nil, fmt.Errorf("at least one of start and stop must be set")
+	}
+	loc := time.UTC
+	if spec.TimeZone != "" {
+		l, err := time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid time zone %q: %v", spec.TimeZone, err)
+		}
+		loc = l
+	}
+
+	parse := func(field, expr string) (cron.Schedule, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		s, err := cron.ParseStandard(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s schedule %q: %v", field, expr, err)
+		}
+		if spec, ok := s.(*cron.SpecSchedule); ok {
+			spec.Location = loc
+		}
+		return s, nil
+	}
+	start, err := parse("start", spec.Start)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stop, err := parse("stop", spec.Stop)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	selector := labels.Everything()
+	if spec.Selector != nil {
+		s, err := metav1.LabelSelectorAsSelector(spec.Selector)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid selector: %v", err)
+		}
+		selector = s
+	}
+	return start, stop, selector, nil
+}
+
+// lastScheduleTime returns the last time of the schedule in (since, now], or
+// the zero time if there is none.
+func lastScheduleTime(schedule cron.Schedule, since, now time.Time) time.Time {
+	var last time.Time
+	if schedule == nil {
+		return last
+	}
+	for t := schedule.Next(since); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		last = t
+	}
+	return last
+}
+
+// applySchedule starts or stops the Notebooks selected by the schedule
+func (r *NotebookScheduleReconciler) applySchedule(ctx context.Context, schedule *v1beta1.NotebookSchedule,
+	selector labels.Selector, action scheduleAction) error {
+
+	notebooks := &v1beta1.NotebookList{}
+	if err := r.List(ctx, notebooks, client.InNamespace(schedule.Namespace),
+		client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return err
+	}
+
+	count := 0
+	for i := range notebooks.Items {
+		nb := &notebooks.Items[i]
+		if !nb.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		var err error
+		var changed bool
+		if action == scheduleActionStart {
+			changed, err = r.startNotebook(ctx, nb)
+		} else {
+			changed, err = r.stopNotebook(ctx, nb)
+		}
+		if err != nil {
+			return err
+		}
+		if changed {
+			r.EventRecorder.Eventf(nb, corev1.EventTypeNormal, "Scheduled"+string(action),
+				"NotebookSchedule %s: %s", schedule.Name, scheduleActionMessage(action))
+			count++
+		}
+	}
+
+	r.EventRecorder.Eventf(schedule, corev1.EventTypeNormal, "Scheduled"+string(action),
+		"%s %d Notebooks", scheduleActionMessage(action), count)
+	return nil
+}
+
+func scheduleActionMessage(action scheduleAction) string {
+	if action == scheduleActionStart {
+		return "Started"
+	}
+	return "Stopped"
+}
+
+// startNotebook starts a stopped Notebook, also removing the legacy
+// STOP_ANNOTATION that the web apps use to stop Notebooks. Notebooks without
+// spec.state keep being managed through the annotation.
+func (r *NotebookScheduleReconciler) startNotebook(ctx context.Context, nb *v1beta1.Notebook) (bool, error) {
+	if !notebookIsStopped(nb) {
+		return false, nil
+	}
+	patch := client.MergeFrom(nb.DeepCopy())
+	if nb.Spec.State != "" {
+		nb.Spec.State = v1beta1.NotebookStateRunning
+	}
+	delete(nb.Annotations, STOP_ANNOTATION)
+	return true, r.Patch(ctx, nb, patch)
+}
+
+// stopNotebook stops a running Notebook and records the schedule as the
+// reason, like the culler does.
+func (r *NotebookScheduleReconciler) stopNotebook(ctx context.Context, nb *v1beta1.Notebook) (bool, error) {
+	if notebookIsStopped(nb) {
+		return false, nil
+	}
+	patch := client.MergeFrom(nb.DeepCopy())
+	markNotebookStopped(nb, r.now())
+	if err := r.Patch(ctx, nb, patch); err != nil {
+		return false, err
+	}
+
+	patch = client.MergeFrom(nb.DeepCopy())
+	now := metav1.Now()
+	nb.Status.StoppedAt = &now
+	nb.Status.StopReason = v1beta1.NotebookStopReasonScheduled
+	clearCullingSchedule(nb)
+	return true, r.Status().Patch(ctx, nb, patch)
+}
+
+func (r *NotebookScheduleReconciler) updateScheduleStatus(ctx context.Context, schedule *v1beta1.NotebookSchedule,
+	status *v1beta1.NotebookScheduleStatus) error {
+
+	if equality.Semantic.DeepEqual(&schedule.Status, status) {
+		return nil
+	}
+	schedule.Status = *status
+	return r.Status().Update(ctx, schedule)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NotebookScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.now == nil {
+		r.now = time.Now
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.NotebookSchedule{}).
+		Named("NotebookSchedule").
+		Complete(r)
+}
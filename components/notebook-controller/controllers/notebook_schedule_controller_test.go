@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func TestLastScheduleTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone database isn't available: %v", err)
+	}
+	start, _, _, err := parseNotebookSchedule(&v1beta1.NotebookScheduleSpec{
+		Start:    "0 8 * * 1-5",
+		TimeZone: "Europe/Berlin",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Monday 2022-01-03
+	monday := time.Date(2022, 1, 3, 0, 0, 0, 0, berlin)
+	tests := []struct {
+		name     string
+		since    time.Time
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			name:  "before the start",
+			since: monday,
+			now:   monday.Add(7 * time.Hour),
+		},
+		{
+			name:     "after the start",
+			since:    monday,
+			now:      monday.Add(9 * time.Hour),
+			expected: monday.Add(8 * time.Hour),
+		},
+		{
+			name:     "missed starts",
+			since:    monday,
+			now:      monday.Add(3*24*time.Hour + 9*time.Hour),
+			expected: monday.Add(3*24*time.Hour + 8*time.Hour),
+		},
+		{
+			name:  "already applied",
+			since: monday.Add(8 * time.Hour),
+			now:   monday.Add(9 * time.Hour),
+		},
+		{
+			name:     "weekend",
+			since:    monday.Add(4 * 24 * time.Hour),
+			now:      monday.Add(6*24*time.Hour + 9*time.Hour),
+			expected: monday.Add(4*24*time.Hour + 8*time.Hour),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := lastScheduleTime(start, test.since, test.now)
+			if !got.Equal(test.expected) {
+				t.Errorf("Got %v, Expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseNotebookScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1beta1.NotebookScheduleSpec
+	}{
+		{name: "empty", spec: v1beta1.NotebookScheduleSpec{}},
+		{name: "invalid cron", spec: v1beta1.NotebookScheduleSpec{Start: "0 25 * * *"}},
+		{name: "invalid time zone", spec: v1beta1.NotebookScheduleSpec{Stop: "0 20 * * *", TimeZone: "Mars/Olympus"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, _, err := parseNotebookSchedule(&test.spec); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestNotebookScheduleReconcile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	created := time.Date(2022, 1, 3, 7, 0, 0, 0, time.UTC)
+	schedule := &v1beta1.NotebookSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-schedule",
+			Namespace:         "test-namespace",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: v1beta1.NotebookScheduleSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"accelerator": "gpu"}},
+			Start:    "0 8 * * *",
+			Stop:     "0 20 * * *",
+		},
+	}
+	gpu := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "gpu",
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{"accelerator": "gpu"},
+			Annotations: map[string]string{STOP_ANNOTATION: "2022-01-02T00:00:00Z"},
+		},
+	}
+	cpu := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu", Namespace: "test-namespace"},
+		Spec:       v1beta1.NotebookSpec{State: v1beta1.NotebookStateStopped},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(schedule, gpu, cpu).Build()
+	now := created
+	r := &NotebookScheduleReconciler{
+		Client:        c,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(100),
+		now:           func() time.Time { return now },
+	}
+
+	reconcile := func() ctrl.Result {
+		t.Helper()
+		result, err := r.Reconcile(context.Background(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: "test-schedule", Namespace: "test-namespace"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return result
+	}
+	getNotebook := func(name string) *v1beta1.Notebook {
+		t.Helper()
+		nb := &v1beta1.Notebook{}
+		if err := c.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "test-namespace"}, nb); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return nb
+	}
+
+	// Nothing happens before the first start
+	result := reconcile()
+	if result.RequeueAfter != time.Hour+time.Second {
+		t.Errorf("Got RequeueAfter %v, Expected it to wake up at the start", result.RequeueAfter)
+	}
+	if !notebookIsStopped(getNotebook("gpu")) {
+		t.Fatalf("Expected the Notebook to still be stopped before the start")
+	}
+
+	// The matching Notebook is started, including the legacy annotation
+	now = created.Add(time.Hour + time.Second)
+	reconcile()
+	if notebookIsStopped(getNotebook("gpu")) {
+		t.Errorf("Expected the Notebook to be started")
+	}
+	if !notebookIsStopped(getNotebook("cpu")) {
+		t.Errorf("Expected the Notebook that isn't selected to stay stopped")
+	}
+
+	// A Notebook stopped by its user after the start stays stopped
+	nb := getNotebook("gpu")
+	nb.Spec.State = v1beta1.NotebookStateStopped
+	if err := c.Update(context.Background(), nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now = created.Add(2 * time.Hour)
+	reconcile()
+	if !notebookIsStopped(getNotebook("gpu")) {
+		t.Errorf("Expected the start to only be applied once")
+	}
+
+	// The Notebook is stopped with the Scheduled reason
+	nb = getNotebook("gpu")
+	nb.Spec.State = v1beta1.NotebookStateRunning
+	if err := c.Update(context.Background(), nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now = created.Add(13*time.Hour + time.Second)
+	reconcile()
+	nb = getNotebook("gpu")
+	if !notebookIsStopped(nb) {
+		t.Fatalf("Expected the Notebook to be stopped")
+	}
+	if nb.Status.StopReason != v1beta1.NotebookStopReasonScheduled {
+		t.Errorf("Got stop reason %q, Expected %q", nb.Status.StopReason, v1beta1.NotebookStopReasonScheduled)
+	}
+
+	got := &v1beta1.NotebookSchedule{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(schedule), got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Status.LastStopTime == nil || !got.Status.LastStopTime.Equal(&metav1.Time{Time: created.Add(13 * time.Hour)}) {
+		t.Errorf("Got LastStopTime %v, Expected 20:00", got.Status.LastStopTime)
+	}
+	if got.Status.NextStartTime == nil || !got.Status.NextStartTime.Equal(&metav1.Time{Time: created.Add(25 * time.Hour)}) {
+		t.Errorf("Got NextStartTime %v, Expected 08:00 on the next day", got.Status.NextStartTime)
+	}
+}
+
+func TestNotebookScheduleWithoutState(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	created := time.Date(2022, 1, 3, 7, 0, 0, 0, time.UTC)
+	schedule := &v1beta1.NotebookSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-schedule",
+			Namespace:         "test-namespace",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: v1beta1.NotebookScheduleSpec{Start: "0 8 * * *", Stop: "0 20 * * *"},
+	}
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-notebook", Namespace: "test-namespace"},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(schedule, nb).Build()
+	now := created.Add(13*time.Hour + time.Second)
+	r := &NotebookScheduleReconciler{
+		Client:        c,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(100),
+		now:           func() time.Time { return now },
+	}
+	reconcile := func() *v1beta1.Notebook {
+		t.Helper()
+		_, err := r.Reconcile(context.Background(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: "test-schedule", Namespace: "test-namespace"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got := &v1beta1.Notebook{}
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(nb), got); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return got
+	}
+
+	// The Notebook is stopped through the legacy annotation, which the web
+	// apps remove to start it again
+	got := reconcile()
+	if !StopAnnotationIsSet(got.ObjectMeta) || got.Spec.State != "" {
+		t.Fatalf("Expected the stop annotation to be set, got %v and the state %q", got.Annotations, got.Spec.State)
+	}
+	delete(got.Annotations, STOP_ANNOTATION)
+	if notebookIsStopped(got) {
+		t.Errorf("Expected removing the annotation to start the Notebook")
+	}
+
+	// The start removes the annotation and leaves spec.state unset
+	now = created.Add(25*time.Hour + time.Second)
+	got = reconcile()
+	if notebookIsStopped(got) || got.Spec.State != "" {
+		t.Errorf("Expected the Notebook to be started without spec.state, got %v and the state %q",
+			got.Annotations, got.Spec.State)
+	}
+}
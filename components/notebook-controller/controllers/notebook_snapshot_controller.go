@@ -0,0 +1,536 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	VolumeSnapshotAPIGroup   = "snapshot.storage.k8s.io"
+	VolumeSnapshotAPIVersion = VolumeSnapshotAPIGroup + "/v1"
+	VolumeSnapshotKind       = "VolumeSnapshot"
+
+	// AnnotationRestoredFrom is set on the Notebooks and PVCs restored by a
+	// NotebookSnapshot to the name of the restored NotebookSnapshot.
+	AnnotationRestoredFrom = "notebooks.kubeflow.org/restored-from"
+	// SnapshotNameLabel is set on the VolumeSnapshots of a NotebookSnapshot.
+	SnapshotNameLabel = "notebooks.kubeflow.org/snapshot-name"
+	// AnnotationStoppedBySnapshot is set on a Notebook to the name of the
+	// NotebookSnapshot that stopped it, in the same patch that stops it, so
+	// it is started again even if the status of the NotebookSnapshot is lost.
+	AnnotationStoppedBySnapshot = "notebooks.kubeflow.org/stopped-by-snapshot"
+	// SnapshotFinalizer keeps a NotebookSnapshot around until the Notebook it
+	// stopped is started again.
+	SnapshotFinalizer = "notebooks.kubeflow.org/snapshot"
+
+	// VolumeSnapshots aren't watched, since their CRD is optional, but
+	// polled while a NotebookSnapshot is in progress.
+	snapshotPollPeriod = 10 * time.Second
+)
+
+// NotebookSnapshotReconciler reconciles a NotebookSnapshot object
+type NotebookSnapshotReconciler struct {
+	client.Client
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	EventRecorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=kubeflow.org,resources=notebooksnapshots;notebooksnapshots/status;notebooksnapshots/finalizers,verbs="*"
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=create
+
+func (r *NotebookSnapshotReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("notebooksnapshot", req.NamespacedName)
+
+	snapshot := &v1beta1.NotebookSnapshot{}
+	if err := r.Get(ctx, req.NamespacedName, snapshot); err != nil {
+		return ctrl.Result{}, ignoreNotFound(err)
+	}
+	if !snapshot.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalizeSnapshot(ctx, snapshot)
+	}
+	if snapshotIsFinished(snapshot) {
+		return ctrl.Result{}, r.removeSnapshotFinalizer(ctx, snapshot)
+	}
+
+	status := snapshot.Status.DeepCopy()
+	var result ctrl.Result
+	var err error
+	if snapshot.Spec.Mode == v1beta1.NotebookSnapshotModeRestore {
+		result, err = r.reconcileRestore(ctx, log, snapshot, status)
+	} else {
+		result, err = r.reconcileSnapshot(ctx, log, snapshot, status)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if status.Phase != snapshot.Status.Phase {
+		log.Info("NotebookSnapshot changed phase", "phase", status.Phase)
+		eventType := corev1.EventTypeNormal
+		if status.Phase == v1beta1.NotebookSnapshotPhaseFailed {
+			eventType = corev1.EventTypeWarning
+		}
+		r.EventRecorder.Event(snapshot, eventType, string(status.Phase), status.Message)
+		if status.Phase == v1beta1.NotebookSnapshotPhaseReady || status.Phase == v1beta1.NotebookSnapshotPhaseFailed {
+			now := metav1.Now()
+			status.CompletionTime = &now
+		}
+	}
+	snapshot.Status = *status
+	if err := r.Status().Update(ctx, snapshot); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+func snapshotIsFinished(snapshot *v1beta1.NotebookSnapshot) bool {
+	return snapshot.Status.Phase == v1beta1.NotebookSnapshotPhaseReady ||
+		snapshot.Status.Phase == v1beta1.NotebookSnapshotPhaseFailed
+}
+
+func setSnapshotPhase(status *v1beta1.NotebookSnapshotStatus, phase v1beta1.NotebookSnapshotPhase, format string, args ...interface{}) {
+	status.Phase = phase
+	status.Message = fmt.Sprintf(format, args...)
+}
+
+// reconcileSnapshot stops the Notebook, unless the snapshot is online, takes a
+// VolumeSnapshot of each of its PVCs and starts it again once the snapshots
+// were taken.
+func (r *NotebookSnapshotReconciler) reconcileSnapshot(ctx context.Context, log logr.Logger,
+	snapshot *v1beta1.NotebookSnapshot, status *v1beta1.NotebookSnapshotStatus) (ctrl.Result, error) {
+
+	nb := &v1beta1.Notebook{}
+	if err := r.Get(ctx, types.NamespacedName{Name: snapshot.Spec.NotebookName, Namespace: snapshot.Namespace}, nb); err != nil {
+		if apierrs.IsNotFound(err) {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "Notebook %s not found", snapshot.Spec.NotebookName)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Record the volumes and the template once, before anything is changed
+	if status.Template == nil {
+		volumes := snapshotVolumes(snapshot, nb)
+		if len(volumes) == 0 {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "Notebook %s doesn't mount any PVC", nb.Name)
+			return ctrl.Result{}, nil
+		}
+		for i := range volumes {
+			if err := r.recordClaim(ctx, snapshot.Namespace, &volumes[i]); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		template, err := json.Marshal(nb.Spec.Template)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		status.Volumes = volumes
+		status.Template = &runtime.RawExtension{Raw: template}
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhasePending, "")
+	}
+
+	stoppedBySnapshot := nb.Annotations[AnnotationStoppedBySnapshot] == snapshot.Name
+	if !snapshot.Spec.Online && !status.StoppedNotebook && !stoppedBySnapshot && !notebookIsStopped(nb) {
+		// The finalizer starts the Notebook again if the NotebookSnapshot is
+		// deleted before it is done
+		if !controllerutil.ContainsFinalizer(snapshot, SnapshotFinalizer) {
+			controllerutil.AddFinalizer(snapshot, SnapshotFinalizer)
+			if err := r.Update(ctx, snapshot); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		log.Info("Stopping the Notebook to snapshot its volumes", "notebook", nb.Name)
+		if err := r.setNotebookState(ctx, nb, v1beta1.NotebookStateStopped, snapshot.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+		stoppedBySnapshot = true
+	}
+	status.StoppedNotebook = status.StoppedNotebook || stoppedBySnapshot
+	if !snapshot.Spec.Online && status.Phase != v1beta1.NotebookSnapshotPhaseSnapshotting {
+		running, err := r.notebookHasPods(ctx, nb)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if running {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseStopping, "Waiting for the Pod of Notebook %s to stop", nb.Name)
+			return ctrl.Result{RequeueAfter: snapshotPollPeriod}, nil
+		}
+	}
+
+	taken, ready := true, true
+	for i := range status.Volumes {
+		volume := &status.Volumes[i]
+		vs, err := r.volumeSnapshot(ctx, snapshot, volume)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed,
+					"The %s API isn't available in the cluster", VolumeSnapshotAPIVersion)
+				return ctrl.Result{}, r.restartNotebook(ctx, nb, snapshot.Name, status)
+			}
+			return ctrl.Result{}, err
+		}
+		if msg, _, _ := unstructured.NestedString(vs.Object, "status", "error", "message"); msg != "" {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed,
+				"VolumeSnapshot %s of PVC %s failed: %s", vs.GetName(), volume.ClaimName, msg)
+			return ctrl.Result{}, r.restartNotebook(ctx, nb, snapshot.Name, status)
+		}
+		// The snapshot was cut once it has a creation time, even if it
+		// isn't ready to use yet, e.g. while it is uploaded
+		if _, found, _ := unstructured.NestedString(vs.Object, "status", "creationTime"); !found {
+			taken = false
+		}
+		volume.ReadyToUse, _, _ = unstructured.NestedBool(vs.Object, "status", "readyToUse")
+		ready = ready && volume.ReadyToUse
+	}
+
+	if taken {
+		if err := r.restartNotebook(ctx, nb, snapshot.Name, status); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if !ready {
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseSnapshotting, "Waiting for %d VolumeSnapshots to be ready to use", len(status.Volumes))
+		return ctrl.Result{RequeueAfter: snapshotPollPeriod}, nil
+	}
+	setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseReady, "Snapshotted %d volumes of Notebook %s", len(status.Volumes), nb.Name)
+	return ctrl.Result{}, nil
+}
+
+// snapshotVolumes returns the PVC volumes of the Notebook's pod spec,
+// including the volume claim templates
+func snapshotVolumes(snapshot *v1beta1.NotebookSnapshot, nb *v1beta1.Notebook) []v1beta1.NotebookSnapshotVolume {
+	volumes := []v1beta1.NotebookSnapshotVolume{}
+	for _, volume := range notebookVolumes(nb) {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		volumes = append(volumes, v1beta1.NotebookSnapshotVolume{
+			Name:               volume.Name,
+			ClaimName:          volume.PersistentVolumeClaim.ClaimName,
+			VolumeSnapshotName: fmt.Sprintf("%s-%s", snapshot.Name, volume.Name),
+		})
+	}
+	return volumes
+}
+
+// recordClaim copies the settings of the PVC needed to restore it
+func (r *NotebookSnapshotReconciler) recordClaim(ctx context.Context, namespace string, volume *v1beta1.NotebookSnapshotVolume) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, types.NamespacedName{Name: volume.ClaimName, Namespace: namespace}, pvc); err != nil {
+		return err
+	}
+	volume.StorageClassName = pvc.Spec.StorageClassName
+	volume.AccessModes = pvc.Spec.AccessModes
+	if size, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		volume.Size = &size
+	}
+	return nil
+}
+
+// volumeSnapshot returns the VolumeSnapshot of the volume, creating it if it
+// doesn't exist yet.
+func (r *NotebookSnapshotReconciler) volumeSnapshot(ctx context.Context, snapshot *v1beta1.NotebookSnapshot,
+	volume *v1beta1.NotebookSnapshotVolume) (*unstructured.Unstructured, error) {
+
+	vs := &unstructured.Unstructured{}
+	vs.SetAPIVersion(VolumeSnapshotAPIVersion)
+	vs.SetKind(VolumeSnapshotKind)
+	err := r.Get(ctx, types.NamespacedName{Name: volume.VolumeSnapshotName, Namespace: snapshot.Namespace}, vs)
+	if err == nil || !apierrs.IsNotFound(err) {
+		return vs, err
+	}
+
+	vs = generateVolumeSnapshot(snapshot, volume)
+	if err := ctrl.SetControllerReference(snapshot, vs, r.Scheme); err != nil {
+		return nil, err
+	}
+	r.Log.Info("Creating VolumeSnapshot", "namespace", vs.GetNamespace(), "name", vs.GetName())
+	if err := r.Create(ctx, vs); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+func generateVolumeSnapshot(snapshot *v1beta1.NotebookSnapshot, volume *v1beta1.NotebookSnapshotVolume) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": volume.ClaimName,
+		},
+	}
+	if snapshot.Spec.VolumeSnapshotClassName != "" {
+		spec["volumeSnapshotClassName"] = snapshot.Spec.VolumeSnapshotClassName
+	}
+
+	vs := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	vs.SetAPIVersion(VolumeSnapshotAPIVersion)
+	vs.SetKind(VolumeSnapshotKind)
+	vs.SetName(volume.VolumeSnapshotName)
+	vs.SetNamespace(snapshot.Namespace)
+	vs.SetLabels(map[string]string{
+		"notebook-name":   snapshot.Spec.NotebookName,
+		SnapshotNameLabel: snapshot.Name,
+	})
+	return vs
+}
+
+func (r *NotebookSnapshotReconciler) notebookHasPods(ctx context.Context, nb *v1beta1.Notebook) (bool, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(nb.Namespace),
+		client.MatchingLabels{"notebook-name": nb.Name}); err != nil {
+		return false, err
+	}
+	return len(pods.Items) > 0, nil
+}
+
+// setNotebookState sets the state of the Notebook, along with the annotation
+// that records whether the NotebookSnapshot stopped it
+func (r *NotebookSnapshotReconciler) setNotebookState(ctx context.Context, nb *v1beta1.Notebook,
+	state v1beta1.NotebookState, snapshotName string) error {
+	patch := client.MergeFrom(nb.DeepCopy())
+	nb.Spec.State = state
+	if state == v1beta1.NotebookStateStopped {
+		if nb.Annotations == nil {
+			nb.Annotations = map[string]string{}
+		}
+		nb.Annotations[AnnotationStoppedBySnapshot] = snapshotName
+	} else {
+		delete(nb.Annotations, AnnotationStoppedBySnapshot)
+	}
+	return r.Patch(ctx, nb, patch)
+}
+
+// restartNotebook starts the Notebook again, if the NotebookSnapshot stopped it
+func (r *NotebookSnapshotReconciler) restartNotebook(ctx context.Context, nb *v1beta1.Notebook, snapshotName string,
+	status *v1beta1.NotebookSnapshotStatus) error {
+	if nb.Annotations[AnnotationStoppedBySnapshot] == snapshotName {
+		r.Log.Info("Starting the Notebook again", "namespace", nb.Namespace, "name", nb.Name)
+		if err := r.setNotebookState(ctx, nb, v1beta1.NotebookStateRunning, snapshotName); err != nil {
+			return err
+		}
+	}
+	status.StoppedNotebook = false
+	return nil
+}
+
+// finalizeSnapshot starts the Notebook again if the NotebookSnapshot is
+// deleted while it keeps the Notebook stopped
+func (r *NotebookSnapshotReconciler) finalizeSnapshot(ctx context.Context, snapshot *v1beta1.NotebookSnapshot) error {
+	if !controllerutil.ContainsFinalizer(snapshot, SnapshotFinalizer) {
+		return nil
+	}
+	nb := &v1beta1.Notebook{}
+	err := r.Get(ctx, types.NamespacedName{Name: snapshot.Spec.NotebookName, Namespace: snapshot.Namespace}, nb)
+	if err == nil {
+		err = r.restartNotebook(ctx, nb, snapshot.Name, snapshot.Status.DeepCopy())
+	}
+	if err != nil && !apierrs.IsNotFound(err) {
+		return err
+	}
+	return r.removeSnapshotFinalizer(ctx, snapshot)
+}
+
+func (r *NotebookSnapshotReconciler) removeSnapshotFinalizer(ctx context.Context, snapshot *v1beta1.NotebookSnapshot) error {
+	if !controllerutil.ContainsFinalizer(snapshot, SnapshotFinalizer) {
+		return nil
+	}
+	controllerutil.RemoveFinalizer(snapshot, SnapshotFinalizer)
+	return r.Update(ctx, snapshot)
+}
+
+// reconcileRestore creates a PVC from each VolumeSnapshot of the source
+// NotebookSnapshot and a Notebook that mounts them.
+func (r *NotebookSnapshotReconciler) reconcileRestore(ctx context.Context, log logr.Logger,
+	snapshot *v1beta1.NotebookSnapshot, status *v1beta1.NotebookSnapshotStatus) (ctrl.Result, error) {
+
+	if snapshot.Spec.SourceSnapshotName == "" {
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "spec.sourceSnapshotName is required in Restore mode")
+		return ctrl.Result{}, nil
+	}
+	source := &v1beta1.NotebookSnapshot{}
+	if err := r.Get(ctx, types.NamespacedName{Name: snapshot.Spec.SourceSnapshotName, Namespace: snapshot.Namespace}, source); err != nil {
+		if apierrs.IsNotFound(err) {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "NotebookSnapshot %s not found", snapshot.Spec.SourceSnapshotName)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if source.Spec.Mode == v1beta1.NotebookSnapshotModeRestore {
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "NotebookSnapshot %s is a restore", source.Name)
+		return ctrl.Result{}, nil
+	}
+	switch source.Status.Phase {
+	case v1beta1.NotebookSnapshotPhaseReady:
+	case v1beta1.NotebookSnapshotPhaseFailed:
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "NotebookSnapshot %s failed", source.Name)
+		return ctrl.Result{}, nil
+	default:
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhasePending, "Waiting for NotebookSnapshot %s to be ready", source.Name)
+		return ctrl.Result{RequeueAfter: snapshotPollPeriod}, nil
+	}
+
+	nb, err := restoredNotebook(snapshot, source)
+	if err != nil {
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "Invalid template in NotebookSnapshot %s: %v", source.Name, err)
+		return ctrl.Result{}, nil
+	}
+	existing := &v1beta1.Notebook{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(nb), existing); err == nil {
+		// The Notebook was restored by a previous reconciliation whose status
+		// update failed
+		if existing.Annotations[AnnotationRestoredFrom] == source.Name {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseReady, "Restored Notebook %s from NotebookSnapshot %s", nb.Name, source.Name)
+			return ctrl.Result{}, nil
+		}
+		setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "Notebook %s already exists", nb.Name)
+		return ctrl.Result{}, nil
+	} else if !apierrs.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	status.Volumes = make([]v1beta1.NotebookSnapshotVolume, len(source.Status.Volumes))
+	for i, volume := range source.Status.Volumes {
+		pvc := restoredClaim(snapshot, volume)
+		log.Info("Creating PVC from VolumeSnapshot", "pvc", pvc.Name, "volumesnapshot", volume.VolumeSnapshotName)
+		if err := r.Create(ctx, pvc); err != nil && !apierrs.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+		volume.RestoredClaimName = pvc.Name
+		status.Volumes[i] = volume
+	}
+
+	log.Info("Creating the restored Notebook", "notebook", nb.Name)
+	if err := r.Create(ctx, nb); err != nil {
+		if apierrs.IsInvalid(err) {
+			setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseFailed, "Restored Notebook is invalid: %v", err)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	setSnapshotPhase(status, v1beta1.NotebookSnapshotPhaseReady, "Restored Notebook %s from NotebookSnapshot %s", nb.Name, source.Name)
+	return ctrl.Result{}, nil
+}
+
+func restoredClaimName(snapshot *v1beta1.NotebookSnapshot, volume v1beta1.NotebookSnapshotVolume) string {
+	return fmt.Sprintf("%s-%s", snapshot.Spec.NotebookName, volume.Name)
+}
+
+// restoredNotebook returns the Notebook of the restore, with the template of
+// the source NotebookSnapshot mounting the restored PVCs.
+func restoredNotebook(snapshot, source *v1beta1.NotebookSnapshot) (*v1beta1.Notebook, error) {
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        snapshot.Spec.NotebookName,
+			Namespace:   snapshot.Namespace,
+			Annotations: map[string]string{AnnotationRestoredFrom: source.Name},
+		},
+	}
+	if source.Status.Template == nil {
+		return nil, fmt.Errorf("no template recorded")
+	}
+	if err := json.Unmarshal(source.Status.Template.Raw, &nb.Spec.Template); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]string{}
+	for _, volume := range source.Status.Volumes {
+		claims[volume.Name] = restoredClaimName(snapshot, volume)
+	}
+	for i := range nb.Spec.Template.Spec.Volumes {
+		volume := &nb.Spec.Template.Spec.Volumes[i]
+		if claim, ok := claims[volume.Name]; ok && volume.PersistentVolumeClaim != nil {
+			volume.PersistentVolumeClaim.ClaimName = claim
+			delete(claims, volume.Name)
+		}
+	}
+	// The other volumes came from the volume claim templates of the source
+	// Notebook, which aren't part of its template
+	for _, volume := range source.Status.Volumes {
+		if claim, ok := claims[volume.Name]; ok {
+			nb.Spec.Template.Spec.Volumes = append(nb.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: volume.Name,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+				},
+			})
+		}
+	}
+	// The webhook requires the container to be named after the Notebook
+	if len(nb.Spec.Template.Spec.Containers) > 0 {
+		nb.Spec.Template.Spec.Containers[0].Name = nb.Name
+	}
+	return nb, nil
+}
+
+// restoredClaim returns a PVC with the settings of the snapshotted PVC, that
+// is populated from its VolumeSnapshot
+func restoredClaim(snapshot *v1beta1.NotebookSnapshot, volume v1beta1.NotebookSnapshotVolume) *corev1.PersistentVolumeClaim {
+	apiGroup := VolumeSnapshotAPIGroup
+	accessModes := volume.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        restoredClaimName(snapshot, volume),
+			Namespace:   snapshot.Namespace,
+			Annotations: map[string]string{AnnotationRestoredFrom: snapshot.Spec.SourceSnapshotName},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      accessModes,
+			StorageClassName: volume.StorageClassName,
+			DataSource: &corev1.TypedLocalObjectReference{
+				APIGroup: &apiGroup,
+				Kind:     VolumeSnapshotKind,
+				Name:     volume.VolumeSnapshotName,
+			},
+		},
+	}
+	if volume.Size != nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: *volume.Size}
+	} else {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}
+	}
+	return pvc
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NotebookSnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.NotebookSnapshot{}).
+		Named("NotebookSnapshot").
+		Complete(r)
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func newTestSnapshotReconciler(objects ...client.Object) (*NotebookSnapshotReconciler, client.Client) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &NotebookSnapshotReconciler{
+		Client:        c,
+		Log:           ctrl.Log,
+		Scheme:        scheme,
+		EventRecorder: record.NewFakeRecorder(100),
+	}, c
+}
+
+func newTestSnapshotNotebook() *v1beta1.Notebook {
+	return &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-notebook", Namespace: "test-namespace"},
+		Spec: v1beta1.NotebookSpec{
+			Template: v1beta1.NotebookTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "test-notebook", Image: "jupyter"}},
+					Volumes: []corev1.Volume{
+						{Name: "workspace", VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "test-notebook-workspace"},
+						}},
+						{Name: "dshm", VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func reconcileSnapshot(t *testing.T, r *NotebookSnapshotReconciler, c client.Client, name string) (ctrl.Result, *v1beta1.NotebookSnapshot) {
+	t.Helper()
+	key := types.NamespacedName{Name: name, Namespace: "test-namespace"}
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	snapshot := &v1beta1.NotebookSnapshot{}
+	if err := c.Get(context.Background(), key, snapshot); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return result, snapshot
+}
+
+func TestNotebookSnapshot(t *testing.T) {
+	ctx := context.Background()
+	storageClass := "standard"
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-notebook-workspace", Namespace: "test-namespace"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-notebook-0",
+			Namespace: "test-namespace",
+			Labels:    map[string]string{"notebook-name": "test-notebook"},
+		},
+	}
+	snapshot := &v1beta1.NotebookSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-snapshot", Namespace: "test-namespace"},
+		Spec: v1beta1.NotebookSnapshotSpec{
+			Mode:         v1beta1.NotebookSnapshotModeSnapshot,
+			NotebookName: "test-notebook",
+		},
+	}
+	r, c := newTestSnapshotReconciler(newTestSnapshotNotebook(), pvc, pod, snapshot)
+
+	// The Notebook is stopped first
+	_, got := reconcileSnapshot(t, r, c, "test-snapshot")
+	if got.Status.Phase != v1beta1.NotebookSnapshotPhaseStopping {
+		t.Fatalf("Got phase %q, Expected %q", got.Status.Phase, v1beta1.NotebookSnapshotPhaseStopping)
+	}
+	if len(got.Status.Volumes) != 1 || got.Status.Volumes[0].ClaimName != "test-notebook-workspace" {
+		t.Fatalf("Got volumes %+v, Expected only the workspace PVC", got.Status.Volumes)
+	}
+	if got.Status.Volumes[0].Size == nil || got.Status.Volumes[0].Size.String() != "5Gi" {
+		t.Errorf("Got size %v, Expected 5Gi", got.Status.Volumes[0].Size)
+	}
+	nb := &v1beta1.Notebook{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "test-notebook", Namespace: "test-namespace"}, nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if nb.Spec.State != v1beta1.NotebookStateStopped {
+		t.Fatalf("Got Notebook state %q, Expected it to be stopped", nb.Spec.State)
+	}
+	if nb.Annotations[AnnotationStoppedBySnapshot] != "test-snapshot" {
+		t.Errorf("Expected the Notebook to be annotated with the NotebookSnapshot that stopped it")
+	}
+	if !controllerutil.ContainsFinalizer(got, SnapshotFinalizer) {
+		t.Errorf("Expected the NotebookSnapshot to have the %s finalizer", SnapshotFinalizer)
+	}
+
+	// The VolumeSnapshot is created once the Pod is gone
+	if err := c.Delete(ctx, pod); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, got = reconcileSnapshot(t, r, c, "test-snapshot")
+	if got.Status.Phase != v1beta1.NotebookSnapshotPhaseSnapshotting {
+		t.Fatalf("Got phase %q, Expected %q", got.Status.Phase, v1beta1.NotebookSnapshotPhaseSnapshotting)
+	}
+	vs := &unstructured.Unstructured{}
+	vs.SetAPIVersion(VolumeSnapshotAPIVersion)
+	vs.SetKind(VolumeSnapshotKind)
+	if err := c.Get(ctx, client.ObjectKey{Name: "test-snapshot-workspace", Namespace: "test-namespace"}, vs); err != nil {
+		t.Fatalf("Unexpected error getting the VolumeSnapshot: %v", err)
+	}
+	if claim, _, _ := unstructured.NestedString(vs.Object, "spec", "source", "persistentVolumeClaimName"); claim != "test-notebook-workspace" {
+		t.Errorf("Got VolumeSnapshot of PVC %q, Expected test-notebook-workspace", claim)
+	}
+
+	// The Notebook is started again once the snapshot was cut and the
+	// NotebookSnapshot is ready with the VolumeSnapshot
+	_ = unstructured.SetNestedField(vs.Object, "2022-01-01T00:00:00Z", "status", "creationTime")
+	_ = unstructured.SetNestedField(vs.Object, true, "status", "readyToUse")
+	if err := c.Update(ctx, vs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, got = reconcileSnapshot(t, r, c, "test-snapshot")
+	if got.Status.Phase != v1beta1.NotebookSnapshotPhaseReady {
+		t.Fatalf("Got phase %q, Expected %q", got.Status.Phase, v1beta1.NotebookSnapshotPhaseReady)
+	}
+	if got.Status.StoppedNotebook || got.Status.CompletionTime == nil {
+		t.Errorf("Expected the NotebookSnapshot to be completed and the Notebook restarted")
+	}
+	if err := c.Get(ctx, client.ObjectKey{Name: "test-notebook", Namespace: "test-namespace"}, nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if nb.Spec.State != v1beta1.NotebookStateRunning {
+		t.Errorf("Got Notebook state %q, Expected it to be running", nb.Spec.State)
+	}
+	if _, ok := nb.Annotations[AnnotationStoppedBySnapshot]; ok {
+		t.Errorf("Expected the %s annotation to be removed", AnnotationStoppedBySnapshot)
+	}
+	_, got = reconcileSnapshot(t, r, c, "test-snapshot")
+	if controllerutil.ContainsFinalizer(got, SnapshotFinalizer) {
+		t.Errorf("Expected the finalizer to be removed once the NotebookSnapshot is ready")
+	}
+
+	// Restore the NotebookSnapshot as a new Notebook
+	restore := &v1beta1.NotebookSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-restore", Namespace: "test-namespace"},
+		Spec: v1beta1.NotebookSnapshotSpec{
+			Mode:               v1beta1.NotebookSnapshotModeRestore,
+			NotebookName:       "restored-notebook",
+			SourceSnapshotName: "test-snapshot",
+		},
+	}
+	if err := c.Create(ctx, restore); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, got = reconcileSnapshot(t, r, c, "test-restore")
+	if got.Status.Phase != v1beta1.NotebookSnapshotPhaseReady {
+		t.Fatalf("Got phase %q (%s), Expected %q", got.Status.Phase, got.Status.Message, v1beta1.NotebookSnapshotPhaseReady)
+	}
+
+	restored := &corev1.PersistentVolumeClaim{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "restored-notebook-workspace", Namespace: "test-namespace"}, restored); err != nil {
+		t.Fatalf("Unexpected error getting the restored PVC: %v", err)
+	}
+	if restored.Spec.DataSource == nil || restored.Spec.DataSource.Name != "test-snapshot-workspace" {
+		t.Errorf("Got data source %+v, Expected VolumeSnapshot test-snapshot-workspace", restored.Spec.DataSource)
+	}
+	if size := restored.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "5Gi" {
+		t.Errorf("Got restored PVC size %s, Expected 5Gi", size.String())
+	}
+
+	restoredNb := &v1beta1.Notebook{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "restored-notebook", Namespace: "test-namespace"}, restoredNb); err != nil {
+		t.Fatalf("Unexpected error getting the restored Notebook: %v", err)
+	}
+	podSpec := restoredNb.Spec.Template.Spec
+	if podSpec.Containers[0].Name != "restored-notebook" {
+		t.Errorf("Got container name %q, Expected restored-notebook", podSpec.Containers[0].Name)
+	}
+	if podSpec.Volumes[0].PersistentVolumeClaim.ClaimName != "restored-notebook-workspace" {
+		t.Errorf("Got claim %q, Expected restored-notebook-workspace", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	}
+	if restoredNb.Annotations[AnnotationRestoredFrom] != "test-snapshot" {
+		t.Errorf("Expected the restored Notebook to be annotated with its NotebookSnapshot")
+	}
+}
+
+func TestNotebookSnapshotDeletedWhileStopped(t *testing.T) {
+	ctx := context.Background()
+	// The Notebook was stopped, but the status update of the NotebookSnapshot
+	// failed
+	nb := newTestSnapshotNotebook()
+	nb.Spec.State = v1beta1.NotebookStateStopped
+	nb.Annotations = map[string]string{AnnotationStoppedBySnapshot: "test-snapshot"}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-notebook-workspace", Namespace: "test-namespace"},
+	}
+	snapshot := &v1beta1.NotebookSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-snapshot",
+			Namespace:  "test-namespace",
+			Finalizers: []string{SnapshotFinalizer},
+		},
+		Spec: v1beta1.NotebookSnapshotSpec{NotebookName: "test-notebook"},
+	}
+	r, c := newTestSnapshotReconciler(nb, pvc, snapshot)
+
+	_, got := reconcileSnapshot(t, r, c, "test-snapshot")
+	if !got.Status.StoppedNotebook {
+		t.Errorf("Expected the status to record that the Notebook was stopped")
+	}
+
+	if err := c.Delete(ctx, got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	key := types.NamespacedName{Name: "test-snapshot", Namespace: "test-namespace"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Get(ctx, key, &v1beta1.NotebookSnapshot{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the NotebookSnapshot to be deleted, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(nb), nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if nb.Spec.State != v1beta1.NotebookStateRunning {
+		t.Errorf("Got Notebook state %q, Expected it to be started again", nb.Spec.State)
+	}
+}
+
+func TestNotebookSnapshotFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot *v1beta1.NotebookSnapshot
+		objects  []client.Object
+		phase    v1beta1.NotebookSnapshotPhase
+	}{
+		{
+			name: "missing notebook",
+			snapshot: &v1beta1.NotebookSnapshot{
+				Spec: v1beta1.NotebookSnapshotSpec{NotebookName: "test-notebook"},
+			},
+			phase: v1beta1.NotebookSnapshotPhaseFailed,
+		},
+		{
+			name: "restore of a missing snapshot",
+			snapshot: &v1beta1.NotebookSnapshot{
+				Spec: v1beta1.NotebookSnapshotSpec{
+					Mode:               v1beta1.NotebookSnapshotModeRestore,
+					NotebookName:       "restored-notebook",
+					SourceSnapshotName: "missing",
+				},
+			},
+			phase: v1beta1.NotebookSnapshotPhaseFailed,
+		},
+		{
+			name: "restore waits for the snapshot",
+			snapshot: &v1beta1.NotebookSnapshot{
+				Spec: v1beta1.NotebookSnapshotSpec{
+					Mode:               v1beta1.NotebookSnapshotModeRestore,
+					NotebookName:       "restored-notebook",
+					SourceSnapshotName: "source",
+				},
+			},
+			objects: []client.Object{&v1beta1.NotebookSnapshot{
+				ObjectMeta: metav1.ObjectMeta{Name: "source", Namespace: "test-namespace"},
+				Spec:       v1beta1.NotebookSnapshotSpec{NotebookName: "test-notebook"},
+				Status:     v1beta1.NotebookSnapshotStatus{Phase: v1beta1.NotebookSnapshotPhaseSnapshotting},
+			}},
+			phase: v1beta1.NotebookSnapshotPhasePending,
+		},
+		{
+			name: "restore over an existing notebook",
+			snapshot: &v1beta1.NotebookSnapshot{
+				Spec: v1beta1.NotebookSnapshotSpec{
+					Mode:               v1beta1.NotebookSnapshotModeRestore,
+					NotebookName:       "test-notebook",
+					SourceSnapshotName: "source",
+				},
+			},
+			objects: []client.Object{
+				newTestSnapshotNotebook(),
+				&v1beta1.NotebookSnapshot{
+					ObjectMeta: metav1.ObjectMeta{Name: "source", Namespace: "test-namespace"},
+					Spec:       v1beta1.NotebookSnapshotSpec{NotebookName: "test-notebook"},
+					Status: v1beta1.NotebookSnapshotStatus{
+						Phase:    v1beta1.NotebookSnapshotPhaseReady,
+						Template: &runtime.RawExtension{Raw: []byte(`{"spec":{"containers":[{"name":"test-notebook"}]}}`)},
+					},
+				},
+			},
+			phase: v1beta1.NotebookSnapshotPhaseFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.snapshot.Name = "test-snapshot"
+			test.snapshot.Namespace = "test-namespace"
+			r, c := newTestSnapshotReconciler(append(test.objects, test.snapshot)...)
+
+			_, got := reconcileSnapshot(t, r, c, "test-snapshot")
+			if got.Status.Phase != test.phase {
+				t.Errorf("Got phase %q (%s), Expected %q", got.Status.Phase, got.Status.Message, test.phase)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	reconcilehelper "github.com/kubeflow/kubeflow/components/common/reconcilehelper"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+// LastAppliedPodSpecAnnotation holds, on the StatefulSet of a Notebook, the
+// pod spec the controller last generated for it, as JSON. Unlike the pod spec
+// of the StatefulSet, it isn't defaulted by the API server, so it can be
+// compared to the one generated from the Notebook to find the changed fields.
+const LastAppliedPodSpecAnnotation = "notebooks.kubeflow.org/last-applied-pod-spec"
+
+// ApplyUpdateAnnotation applies the pending changes of a Notebook with the
+// Manual update strategy. The controller removes it once they are applied.
+const ApplyUpdateAnnotation = "notebooks.kubeflow.org/apply-update"
+
+// setLastAppliedPodSpec records the pod spec of the StatefulSet in its
+// annotations
+func setLastAppliedPodSpec(ss *appsv1.StatefulSet) error {
+	spec, err := json.Marshal(ss.Spec.Template.Spec)
+	if err != nil {
+		return err
+	}
+	if ss.Annotations == nil {
+		ss.Annotations = map[string]string{}
+	}
+	ss.Annotations[LastAppliedPodSpecAnnotation] = string(spec)
+	return nil
+}
+
+// updateIsHeld returns true if the update strategy of the Notebook keeps the
+// changes to its pod template from being applied
+func updateIsHeld(nb *v1beta1.Notebook) bool {
+	switch nb.Spec.UpdateStrategy {
+	case v1beta1.NotebookUpdateOnStop:
+		return !notebookIsStopped(nb)
+	case v1beta1.NotebookUpdateManual:
+		_, apply := nb.Annotations[ApplyUpdateAnnotation]
+		return !apply
+	}
+	return false
+}
+
+// copyStatefulSetFields copies the owned fields of the StatefulSet of a
+// Notebook like reconcilehelper.CopyStatefulSetFields, and also the labels and
+// annotations of the pod template, which the shared helper leaves alone.
+// Returns true if the fields copied from don't match to.
+func copyStatefulSetFields(from, to *appsv1.StatefulSet) bool {
+	requireUpdate := reconcilehelper.CopyStatefulSetFields(from, to)
+
+	// Unset and empty labels and annotations of the pod template are equal,
+	// since the API server drops empty maps
+	if !apiequality.Semantic.DeepEqual(to.Spec.Template.Labels, from.Spec.Template.Labels) ||
+		!apiequality.Semantic.DeepEqual(to.Spec.Template.Annotations, from.Spec.Template.Annotations) {
+		requireUpdate = true
+	}
+	to.Spec.Template.Labels = from.Spec.Template.Labels
+	to.Spec.Template.Annotations = from.Spec.Template.Annotations
+	return requireUpdate
+}
+
+// holdPodTemplateUpdate keeps the pod template of the existing StatefulSet in
+// the generated one when the update strategy of the Notebook holds the
+// changes, and returns the changed fields of the pod template. The changes are
+// only detected when the existing StatefulSet records its last applied pod
+// spec, so StatefulSets created by older versions of the controller are
+// updated right away, as they used to be.
+func holdPodTemplateUpdate(nb *v1beta1.Notebook, ss, found *appsv1.StatefulSet) ([]string, error) {
+	lastApplied, ok := found.Annotations[LastAppliedPodSpecAnnotation]
+	if !ok || !updateIsHeld(nb) {
+		return nil, nil
+	}
+	applied := corev1.PodSpec{}
+	if err := json.Unmarshal([]byte(lastApplied), &applied); err != nil {
+		return nil, err
+	}
+	changes := podSpecChanges("spec.template.spec", &applied, &ss.Spec.Template.Spec)
+	// The metadata of the pod template isn't defaulted, so it's compared to
+	// the one of the existing StatefulSet
+	if !apiequality.Semantic.DeepEqual(found.Spec.Template.Labels, ss.Spec.Template.Labels) {
+		changes = append(changes, "spec.template.metadata.labels")
+	}
+	if !apiequality.Semantic.DeepEqual(found.Spec.Template.Annotations, ss.Spec.Template.Annotations) {
+		changes = append(changes, "spec.template.metadata.annotations")
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	ss.Spec.Template.ObjectMeta = found.Spec.Template.ObjectMeta
+	ss.Spec.Template.Spec = found.Spec.Template.Spec
+	ss.Annotations[LastAppliedPodSpecAnnotation] = lastApplied
+	return changes, nil
+}
+
+// podSpecChanges returns the paths of the fields that differ between the pod
+// specs, e.g. spec.template.spec.containers[notebook].image. Empty and unset
+// fields are equal, since they are serialized the same way.
+func podSpecChanges(path string, from, to *corev1.PodSpec) []string {
+	changes := []string{}
+	fromValue, toValue := reflect.ValueOf(*from), reflect.ValueOf(*to)
+	for i := 0; i < fromValue.NumField(); i++ {
+		field := fromValue.Type().Field(i)
+		fieldPath := path + "." + jsonFieldName(field)
+		switch field.Name {
+		case "Containers":
+			changes = append(changes, containerChanges(fieldPath, from.Containers, to.Containers)...)
+		case "InitContainers":
+			changes = append(changes, containerChanges(fieldPath, from.InitContainers, to.InitContainers)...)
+		default:
+			if !apiequality.Semantic.DeepEqual(fromValue.Field(i).Interface(), toValue.Field(i).Interface()) {
+				changes = append(changes, fieldPath)
+			}
+		}
+	}
+	return changes
+}
+
+// containerChanges returns the paths of the changed fields of the containers
+// that are in both lists, and of the containers that were added or removed
+func containerChanges(path string, from, to []corev1.Container) []string {
+	changes := []string{}
+	previous := map[string]*corev1.Container{}
+	for i := range from {
+		previous[from[i].Name] = &from[i]
+	}
+	for i := range to {
+		containerPath := fmt.Sprintf("%s[%s]", path, to[i].Name)
+		old, ok := previous[to[i].Name]
+		if !ok {
+			changes = append(changes, containerPath)
+			continue
+		}
+		delete(previous, to[i].Name)
+
+		fromValue, toValue := reflect.ValueOf(*old), reflect.ValueOf(to[i])
+		for j := 0; j < fromValue.NumField(); j++ {
+			if !apiequality.Semantic.DeepEqual(fromValue.Field(j).Interface(), toValue.Field(j).Interface()) {
+				changes = append(changes, containerPath+"."+jsonFieldName(fromValue.Type().Field(j)))
+			}
+		}
+	}
+	for i := range from {
+		if _, ok := previous[from[i].Name]; ok {
+			changes = append(changes, fmt.Sprintf("%s[%s]", path, from[i].Name))
+		}
+	}
+	return changes
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// setPendingUpdateCondition reports the changes held by the update strategy
+// of the Notebook in its PendingUpdate condition
+func setPendingUpdateCondition(nb *v1beta1.Notebook, changes []string) {
+	condition := metav1.Condition{
+		Type:               v1beta1.NotebookConditionPendingUpdate,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: nb.Generation,
+		Reason:             "UpToDate",
+	}
+	if len(changes) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = string(nb.Spec.UpdateStrategy)
+		condition.Message = fmt.Sprintf("Changes to %s are held until the Notebook is stopped",
+			strings.Join(changes, ", "))
+		if nb.Spec.UpdateStrategy == v1beta1.NotebookUpdateManual {
+			condition.Message = fmt.Sprintf("Changes to %s are held until the %s annotation is set",
+				strings.Join(changes, ", "), ApplyUpdateAnnotation)
+		}
+	}
+	meta.SetStatusCondition(&nb.Status.Conditions, condition)
+}
+
+// removeApplyUpdateAnnotation removes the annotation that requested the
+// pending changes of the Notebook, once they are applied
+func (r *NotebookReconciler) removeApplyUpdateAnnotation(ctx context.Context, nb *v1beta1.Notebook) error {
+	if _, ok := nb.Annotations[ApplyUpdateAnnotation]; !ok {
+		return nil
+	}
+	// The status of the Notebook, which is being reconciled, is kept
+	updated := nb.DeepCopy()
+	delete(updated.Annotations, ApplyUpdateAnnotation)
+	if err := r.Patch(ctx, updated, client.MergeFrom(nb)); err != nil {
+		return err
+	}
+	nb.Annotations = updated.Annotations
+	nb.ResourceVersion = updated.ResourceVersion
+	return nil
+}
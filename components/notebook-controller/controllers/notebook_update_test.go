@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// appliedStatefulSet returns the StatefulSet of the Notebook, as the
+// controller created it
+func appliedStatefulSet(t *testing.T, nb *v1beta1.Notebook) *appsv1.StatefulSet {
+	ss := generateStatefulSet(nb, config.Default())
+	if err := setLastAppliedPodSpec(ss); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return ss
+}
+
+func TestPodSpecChanges(t *testing.T) {
+	from := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "nb", Image: "jupyter:v1"},
+			{Name: "sidecar", Image: "proxy"},
+		},
+	}
+	to := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "nb", Image: "jupyter:v2", Env: []corev1.EnvVar{{Name: "A", Value: "a"}}},
+			{Name: "exporter", Image: "exporter"},
+		},
+		NodeSelector: map[string]string{"gpu": "true"},
+	}
+
+	expected := []string{
+		"spec.containers[nb].image",
+		"spec.containers[nb].env",
+		"spec.containers[exporter]",
+		"spec.containers[sidecar]",
+		"spec.nodeSelector",
+	}
+	if changes := podSpecChanges("spec", from, to); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Got the changes %v, Expected %v", changes, expected)
+	}
+	if changes := podSpecChanges("spec", from, from.DeepCopy()); len(changes) != 0 {
+		t.Errorf("Got the changes %v, Expected none", changes)
+	}
+}
+
+func TestCopyStatefulSetFields(t *testing.T) {
+	newStatefulSet := func(labels, annotations map[string]string) *appsv1.StatefulSet {
+		ss := generateStatefulSet(newTestNotebook("nb"), config.Default())
+		ss.Spec.Template.Labels = labels
+		ss.Spec.Template.Annotations = annotations
+		return ss
+	}
+
+	tests := []struct {
+		name   string
+		from   *appsv1.StatefulSet
+		to     *appsv1.StatefulSet
+		update bool
+	}{
+		{
+			name:   "unchanged",
+			from:   newStatefulSet(map[string]string{"app": "nb"}, nil),
+			to:     newStatefulSet(map[string]string{"app": "nb"}, nil),
+			update: false,
+		},
+		{
+			name:   "empty and unset annotations are equal",
+			from:   newStatefulSet(map[string]string{"app": "nb"}, map[string]string{}),
+			to:     newStatefulSet(map[string]string{"app": "nb"}, nil),
+			update: false,
+		},
+		{
+			name:   "label added",
+			from:   newStatefulSet(map[string]string{"app": "nb", "team": "ml"}, nil),
+			to:     newStatefulSet(map[string]string{"app": "nb"}, nil),
+			update: true,
+		},
+		{
+			name:   "annotation removed",
+			from:   newStatefulSet(map[string]string{"app": "nb"}, nil),
+			to:     newStatefulSet(map[string]string{"app": "nb"}, map[string]string{"owner": "me"}),
+			update: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if update := copyStatefulSetFields(test.from, test.to); update != test.update {
+				t.Errorf("Got %v, Expected %v", update, test.update)
+			}
+			if !reflect.DeepEqual(test.to.Spec.Template.ObjectMeta, test.from.Spec.Template.ObjectMeta) {
+				t.Errorf("Got the pod template metadata %+v, Expected %+v",
+					test.to.Spec.Template.ObjectMeta, test.from.Spec.Template.ObjectMeta)
+			}
+		})
+	}
+}
+
+func TestHoldPodTemplateUpdate(t *testing.T) {
+	newNotebook := func(image string, strategy v1beta1.NotebookUpdateStrategy) *v1beta1.Notebook {
+		nb := newTestNotebook("nb")
+		nb.Spec.Template.Spec.Containers[0].Image = image
+		nb.Spec.UpdateStrategy = strategy
+		return nb
+	}
+
+	testCases := []struct {
+		testName string
+		notebook *v1beta1.Notebook
+		recorded bool
+		held     bool
+	}{
+		{
+			testName: "Immediate",
+			notebook: newNotebook("jupyter:v2", v1beta1.NotebookUpdateImmediate),
+			recorded: true,
+			held:     false,
+		},
+		{
+			testName: "OnStop while the Notebook is running",
+			notebook: newNotebook("jupyter:v2", v1beta1.NotebookUpdateOnStop),
+			recorded: true,
+			held:     true,
+		},
+		{
+			testName: "OnStop once the Notebook is stopped",
+			notebook: func() *v1beta1.Notebook {
+				nb := newNotebook("jupyter:v2", v1beta1.NotebookUpdateOnStop)
+				nb.Spec.State = v1beta1.NotebookStateStopped
+				return nb
+			}(),
+			recorded: true,
+			held:     false,
+		},
+		{
+			testName: "Manual",
+			notebook: newNotebook("jupyter:v2", v1beta1.NotebookUpdateManual),
+			recorded: true,
+			held:     true,
+		},
+		{
+			testName: "Manual with the apply annotation",
+			notebook: func() *v1beta1.Notebook {
+				nb := newNotebook("jupyter:v2", v1beta1.NotebookUpdateManual)
+				nb.Annotations = map[string]string{ApplyUpdateAnnotation: "true"}
+				return nb
+			}(),
+			recorded: true,
+			held:     false,
+		},
+		{
+			testName: "StatefulSet without the last applied pod spec",
+			notebook: newNotebook("jupyter:v2", v1beta1.NotebookUpdateOnStop),
+			recorded: false,
+			held:     false,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			found := appliedStatefulSet(t, newNotebook("jupyter:v1", c.notebook.Spec.UpdateStrategy))
+			if !c.recorded {
+				delete(found.Annotations, LastAppliedPodSpecAnnotation)
+			}
+			lastApplied := found.Annotations[LastAppliedPodSpecAnnotation]
+			ss := appliedStatefulSet(t, c.notebook)
+
+			changes, err := holdPodTemplateUpdate(c.notebook, ss, found)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			image := ss.Spec.Template.Spec.Containers[0].Image
+			if c.held {
+				if !reflect.DeepEqual(changes, []string{"spec.template.spec.containers[nb].image"}) {
+					t.Errorf("Got the changes %v", changes)
+				}
+				if image != "jupyter:v1" || ss.Annotations[LastAppliedPodSpecAnnotation] != lastApplied {
+					t.Errorf("Expected the pod spec of the StatefulSet to be kept, got image %s", image)
+				}
+			} else {
+				if len(changes) != 0 {
+					t.Errorf("Got the changes %v, Expected none", changes)
+				}
+				if image != "jupyter:v2" {
+					t.Errorf("Expected the pod spec to be updated, got image %s", image)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPendingUpdateCondition(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.UpdateStrategy = v1beta1.NotebookUpdateOnStop
+	setPendingUpdateCondition(nb, []string{"spec.template.spec.containers[nb].image"})
+	c := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionPendingUpdate)
+	if c == nil || c.Status != metav1.ConditionTrue || c.Reason != "OnStop" ||
+		c.Message != "Changes to spec.template.spec.containers[nb].image are held until the Notebook is stopped" {
+		t.Errorf("Got the condition %+v", c)
+	}
+
+	setPendingUpdateCondition(nb, nil)
+	c = meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionPendingUpdate)
+	if c == nil || c.Status != metav1.ConditionFalse || c.Reason != "UpToDate" {
+		t.Errorf("Got the condition %+v", c)
+	}
+}
+
+func TestRemoveApplyUpdateAnnotation(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.UpdateStrategy = v1beta1.NotebookUpdateManual
+	nb.Annotations = map[string]string{ApplyUpdateAnnotation: "true", "team": "ml"}
+	r, c := newTestNotebookReconciler(nb)
+
+	nb.Status.ReadyReplicas = 1
+	if err := r.removeApplyUpdateAnnotation(context.TODO(), nb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := nb.Annotations[ApplyUpdateAnnotation]; ok || nb.Status.ReadyReplicas != 1 {
+		t.Errorf("Expected only the annotation to be removed, got %v and %+v", nb.Annotations, nb.Status)
+	}
+	found := &v1beta1.Notebook{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb", Namespace: "ns"}, found); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := found.Annotations[ApplyUpdateAnnotation]; ok || found.Annotations["team"] != "ml" {
+		t.Errorf("Got the annotations %v", found.Annotations)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func volumeClaimName(nb *v1beta1.Notebook, template *v1beta1.NotebookVolumeClaimTemplate) string {
+	return nb.Name + "-" + template.Name
+}
+
+// notebookVolumes returns the volumes of the notebook Pod: the volumes of the
+// pod template, followed by the volumes of the volume claim templates
+func notebookVolumes(nb *v1beta1.Notebook) []corev1.Volume {
+	volumes := append([]corev1.Volume{}, nb.Spec.Template.Spec.Volumes...)
+	for i := range nb.Spec.VolumeClaimTemplates {
+		template := &nb.Spec.VolumeClaimTemplates[i]
+		volumes = append(volumes, corev1.Volume{
+			Name: template.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: volumeClaimName(nb, template),
+				},
+			},
+		})
+	}
+	return volumes
+}
+
+// generateVolumeClaim returns the PVC of a volume claim template. It is
+// labeled with the name of the Notebook, so the controller only manages the
+// PVCs it created.
+func generateVolumeClaim(nb *v1beta1.Notebook, template *v1beta1.NotebookVolumeClaimTemplate) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        volumeClaimName(nb, template),
+			Namespace:   nb.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	for k, v := range template.Labels {
+		pvc.Labels[k] = v
+	}
+	pvc.Labels["notebook-name"] = nb.Name
+	for k, v := range template.Annotations {
+		pvc.Annotations[k] = v
+	}
+	return pvc
+}
+
+// reconcileVolumeClaims creates the PVCs of the volume claim templates of the
+// Notebook and returns their state. The PVCs with the Delete retention policy
+// are owned by the Notebook, so they are garbage collected along with it.
+func (r *NotebookReconciler) reconcileVolumeClaims(ctx context.Context, nb *v1beta1.Notebook, log logr.Logger) ([]v1beta1.NotebookVolumeClaimStatus, error) {
+	var statuses []v1beta1.NotebookVolumeClaimStatus
+	for i := range nb.Spec.VolumeClaimTemplates {
+		template := &nb.Spec.VolumeClaimTemplates[i]
+		pvc := generateVolumeClaim(nb, template)
+		if template.RetentionPolicy == v1beta1.VolumeClaimDelete {
+			if err := ctrl.SetControllerReference(nb, pvc, r.Scheme); err != nil {
+				return nil, err
+			}
+		}
+
+		found := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, found)
+		if err != nil && apierrs.IsNotFound(err) {
+			log.Info("Creating PersistentVolumeClaim", "namespace", pvc.Namespace, "name", pvc.Name)
+			if err := r.Create(ctx, pvc); err != nil {
+				log.Error(err, "unable to create PersistentVolumeClaim")
+				return nil, err
+			}
+			found = pvc
+		} else if err != nil {
+			log.Error(err, "error getting PersistentVolumeClaim")
+			return nil, err
+		} else if found.Labels["notebook-name"] == nb.Name && r.copyVolumeClaimFields(nb, template, found) {
+			// PVCs that weren't created for the Notebook, e.g. by a user
+			// before the Notebook existed, are used as they are
+			log.Info("Updating PersistentVolumeClaim", "namespace", pvc.Namespace, "name", pvc.Name)
+			if err := r.Update(ctx, found); err != nil {
+				log.Error(err, "unable to update PersistentVolumeClaim")
+				return nil, err
+			}
+		}
+
+		status := v1beta1.NotebookVolumeClaimStatus{
+			Name:      template.Name,
+			ClaimName: found.Name,
+			Phase:     found.Status.Phase,
+		}
+		if capacity, ok := found.Status.Capacity[corev1.ResourceStorage]; ok {
+			status.Capacity = &capacity
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// copyVolumeClaimFields applies the retention policy and larger storage
+// requests of the template to an existing PVC. The rest of the spec of a PVC
+// is immutable. It returns true if the PVC needs to be updated.
+func (r *NotebookReconciler) copyVolumeClaimFields(nb *v1beta1.Notebook, template *v1beta1.NotebookVolumeClaimTemplate, pvc *corev1.PersistentVolumeClaim) bool {
+	requireUpdate := false
+
+	owned := metav1.IsControlledBy(pvc, nb)
+	if template.RetentionPolicy == v1beta1.VolumeClaimDelete && !owned {
+		if err := ctrl.SetControllerReference(nb, pvc, r.Scheme); err == nil {
+			requireUpdate = true
+		}
+	} else if template.RetentionPolicy != v1beta1.VolumeClaimDelete && owned {
+		refs := []metav1.OwnerReference{}
+		for _, ref := range pvc.OwnerReferences {
+			if ref.UID != nb.UID {
+				refs = append(refs, ref)
+			}
+		}
+		pvc.OwnerReferences = refs
+		requireUpdate = true
+	}
+
+	requested, ok := template.Spec.Resources.Requests[corev1.ResourceStorage]
+	current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if ok && requested.Cmp(current) > 0 {
+		if pvc.Spec.Resources.Requests == nil {
+			pvc.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = requested
+		requireUpdate = true
+	}
+	return requireUpdate
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// newTestClaimTemplate returns a workspace volume claim template
+func newTestClaimTemplate(size string, policy v1beta1.VolumeClaimRetentionPolicy) v1beta1.NotebookVolumeClaimTemplate {
+	return v1beta1.NotebookVolumeClaimTemplate{
+		Name:   "workspace",
+		Labels: map[string]string{"team": "ml"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+		RetentionPolicy: policy,
+	}
+}
+
+func TestGenerateStatefulSetVolumeClaims(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{newTestClaimTemplate("5Gi", v1beta1.VolumeClaimRetain)}
+	ss := generateStatefulSet(nb, config.Default())
+
+	volumes := ss.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].Name != "workspace" || volumes[0].PersistentVolumeClaim == nil ||
+		volumes[0].PersistentVolumeClaim.ClaimName != "nb-workspace" {
+		t.Errorf("Got the volumes %+v", volumes)
+	}
+	if len(nb.Spec.Template.Spec.Volumes) != 0 {
+		t.Errorf("Expected the template of the Notebook to be unchanged, got %+v", nb.Spec.Template.Spec.Volumes)
+	}
+}
+
+func TestReconcileVolumeClaims(t *testing.T) {
+	nb := newTestNotebook("nb")
+	nb.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{newTestClaimTemplate("5Gi", v1beta1.VolumeClaimRetain)}
+	r, c := newTestNotebookReconciler(nb)
+	getPVC := func() *corev1.PersistentVolumeClaim {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb-workspace", Namespace: "ns"}, pvc); err != nil {
+			t.Fatalf("Expected the PVC to exist: %v", err)
+		}
+		return pvc
+	}
+
+	statuses, err := r.reconcileVolumeClaims(context.TODO(), nb, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "workspace" || statuses[0].ClaimName != "nb-workspace" {
+		t.Errorf("Got the statuses %+v", statuses)
+	}
+	pvc := getPVC()
+	if pvc.Labels["notebook-name"] != "nb" || pvc.Labels["team"] != "ml" {
+		t.Errorf("Got the labels %v", pvc.Labels)
+	}
+	if len(pvc.OwnerReferences) != 0 {
+		t.Errorf("Expected a retained PVC to have no owner, got %+v", pvc.OwnerReferences)
+	}
+
+	// The Delete retention policy makes the Notebook own the PVC, and a
+	// larger request expands it
+	nb.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{newTestClaimTemplate("10Gi", v1beta1.VolumeClaimDelete)}
+	if _, err := r.reconcileVolumeClaims(context.TODO(), nb, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pvc = getPVC()
+	if !metav1.IsControlledBy(pvc, nb) {
+		t.Errorf("Expected the PVC to be owned by the Notebook, got %+v", pvc.OwnerReferences)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "10Gi" {
+		t.Errorf("Expected the PVC to be expanded to 10Gi, got %s", size.String())
+	}
+
+	// PVCs are never shrunk, and go back to being retained
+	nb.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{newTestClaimTemplate("1Gi", v1beta1.VolumeClaimRetain)}
+	if _, err := r.reconcileVolumeClaims(context.TODO(), nb, TestLogger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pvc = getPVC()
+	if len(pvc.OwnerReferences) != 0 {
+		t.Errorf("Expected the owner reference to be removed, got %+v", pvc.OwnerReferences)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "10Gi" {
+		t.Errorf("Expected the PVC to keep 10Gi, got %s", size.String())
+	}
+}
+
+func TestReconcileVolumeClaimsExisting(t *testing.T) {
+	// A PVC that wasn't created for the Notebook is used as it is
+	existing := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb-workspace", Namespace: "ns"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+		},
+	}
+	nb := newTestNotebook("nb")
+	nb.Spec.VolumeClaimTemplates = []v1beta1.NotebookVolumeClaimTemplate{newTestClaimTemplate("5Gi", v1beta1.VolumeClaimDelete)}
+	r, c := newTestNotebookReconciler(nb, existing)
+
+	statuses, err := r.reconcileVolumeClaims(context.TODO(), nb, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Phase != corev1.ClaimBound ||
+		statuses[0].Capacity == nil || statuses[0].Capacity.String() != "1Gi" {
+		t.Errorf("Got the statuses %+v", statuses)
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "nb-workspace", Namespace: "ns"}, pvc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pvc.OwnerReferences) != 0 {
+		t.Errorf("Expected the PVC not to be owned by the Notebook, got %+v", pvc.OwnerReferences)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "1Gi" {
+		t.Errorf("Expected the PVC to be unchanged, got %s", size.String())
+	}
+}
@@ -0,0 +1,249 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	reconcilehelper "github.com/kubeflow/kubeflow/components/common/reconcilehelper"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+// HeadlessServiceSuffix is appended to the name of a Notebook with workers to
+// name the headless Service of the Notebook and its workers
+const HeadlessServiceSuffix = "-headless"
+
+// The environment variables set in the containers of a Notebook with workers
+// and in its workers, so they can find each other
+const (
+	// HeadHostEnvVar is the DNS name of the notebook Pod, e.g. the address
+	// of the Dask scheduler or of the Ray head
+	HeadHostEnvVar = "NOTEBOOK_HEAD_HOST"
+	// HeadlessServiceEnvVar is the DNS name of the headless Service, which
+	// resolves to the addresses of the notebook Pod and all the workers
+	HeadlessServiceEnvVar = "NOTEBOOK_HEADLESS_SERVICE"
+)
+
+func headlessServiceName(nb *v1beta1.Notebook) string {
+	return nb.Name + HeadlessServiceSuffix
+}
+
+func workersName(nb *v1beta1.Notebook) string {
+	return nb.Name + v1beta1.WorkersNameSuffix
+}
+
+// setWorkerEnvVars sets the addresses of the notebook Pod and of the headless
+// Service in all the containers of the pod spec
+func setWorkerEnvVars(nb *v1beta1.Notebook, podSpec *corev1.PodSpec) {
+	service := fmt.Sprintf("%s.%s.svc", headlessServiceName(nb), nb.Namespace)
+	vars := []corev1.EnvVar{
+		{Name: HeadHostEnvVar, Value: fmt.Sprintf("%s-0.%s", nb.Name, service)},
+		{Name: HeadlessServiceEnvVar, Value: service},
+	}
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		for _, v := range vars {
+			setEnvVar(container, v)
+		}
+	}
+}
+
+// setEnvVar sets the environment variable in the container, replacing any
+// variable with the same name
+func setEnvVar(container *corev1.Container, envVar corev1.EnvVar) {
+	for i := range container.Env {
+		if container.Env[i].Name == envVar.Name {
+			container.Env[i] = envVar
+			return
+		}
+	}
+	container.Env = append(container.Env, envVar)
+}
+
+// generateHeadlessService returns the headless Service of a Notebook with
+// workers. It selects the notebook Pod and the workers, and publishes their
+// addresses before they are ready, so the workers can connect to the notebook
+// while it is starting and the other way around.
+func generateHeadlessService(nb *v1beta1.Notebook) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceName(nb),
+			Namespace: nb.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 map[string]string{"notebook-name": nb.Name},
+			PublishNotReadyAddresses: true,
+		},
+	}
+}
+
+// generateWorkerStatefulSet returns the StatefulSet of the workers of a
+// Notebook. The workers are named <notebook>-worker-<ordinal> and are
+// resolvable as <pod>.<headless service>.
+func generateWorkerStatefulSet(nb *v1beta1.Notebook, cfg *config.NotebookControllerConfig) *appsv1.StatefulSet {
+	name := workersName(nb)
+	replicas := nb.Spec.Workers.Replicas
+	if notebookIsStopped(nb) {
+		replicas = 0
+	}
+
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: nb.Namespace,
+			Labels:    map[string]string{"notebook-name": nb.Name},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: headlessServiceName(nb),
+			// Workers don't depend on each other, so they start together
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"statefulset": name,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				Spec: *nb.Spec.Workers.Template.Spec.DeepCopy(),
+			},
+		},
+	}
+	setPodMetadata(&ss.Spec.Template, nb, nb.Spec.Workers.Template.Metadata, cfg, map[string]string{
+		"statefulset":   name,
+		"notebook-name": nb.Name,
+	})
+
+	podSpec := &ss.Spec.Template.Spec
+	setWorkerEnvVars(nb, podSpec)
+	setDefaultFSGroup(podSpec, cfg)
+	return ss
+}
+
+// reconcileWorkers creates, updates or removes the headless Service and the
+// StatefulSet of the workers of the Notebook, and returns the status of the
+// workers.
+func (r *NotebookReconciler) reconcileWorkers(ctx context.Context, nb *v1beta1.Notebook, log logr.Logger) (*v1beta1.NotebookWorkersStatus, error) {
+	if nb.Spec.Workers == nil {
+		return nil, r.removeWorkers(ctx, nb, log)
+	}
+
+	service := generateHeadlessService(nb)
+	if err := ctrl.SetControllerReference(nb, service, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := reconcilehelper.Service(ctx, r.Client, service, log); err != nil {
+		return nil, err
+	}
+
+	ss := generateWorkerStatefulSet(nb, r.Config.Get())
+	if err := ctrl.SetControllerReference(nb, ss, r.Scheme); err != nil {
+		return nil, err
+	}
+	found := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: ss.Name, Namespace: ss.Namespace}, found)
+	if err != nil && apierrs.IsNotFound(err) {
+		log.Info("Creating worker StatefulSet", "namespace", ss.Namespace, "name", ss.Name)
+		if err := r.Create(ctx, ss); err != nil {
+			log.Error(err, "unable to create worker Statefulset")
+			return nil, err
+		}
+		found = ss
+	} else if err != nil {
+		log.Error(err, "error getting worker Statefulset")
+		return nil, err
+	} else if copyStatefulSetFields(ss, found) {
+		log.Info("Updating worker StatefulSet", "namespace", ss.Namespace, "name", ss.Name)
+		if err := r.Update(ctx, found); err != nil {
+			log.Error(err, "unable to update worker Statefulset")
+			return nil, err
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(nb.Namespace),
+		client.MatchingLabels{"statefulset": ss.Name}); err != nil {
+		return nil, err
+	}
+	return workersStatus(nb, pods.Items), nil
+}
+
+// workersStatus computes the status of the workers of a Notebook from their
+// Pods
+func workersStatus(nb *v1beta1.Notebook, pods []corev1.Pod) *v1beta1.NotebookWorkersStatus {
+	status := &v1beta1.NotebookWorkersStatus{
+		ServiceName: headlessServiceName(nb),
+		Replicas:    nb.Spec.Workers.Replicas,
+	}
+	if notebookIsStopped(nb) {
+		status.Replicas = 0
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		ready := false
+		if c := podCondition(pod, corev1.PodReady); c != nil && c.Status == corev1.ConditionTrue {
+			ready = true
+			status.ReadyReplicas++
+		}
+		status.Pods = append(status.Pods, v1beta1.NotebookReplicaStatus{
+			Name:  pod.Name,
+			Ready: ready,
+			Phase: pod.Status.Phase,
+		})
+	}
+	sort.Slice(status.Pods, func(i, j int) bool {
+		return status.Pods[i].Name < status.Pods[j].Name
+	})
+	return status
+}
+
+// removeWorkers deletes the StatefulSet of the workers and the headless
+// Service, once the workers are removed from the Notebook
+func (r *NotebookReconciler) removeWorkers(ctx context.Context, nb *v1beta1.Notebook, log logr.Logger) error {
+	objects := []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: workersName(nb), Namespace: nb.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: headlessServiceName(nb), Namespace: nb.Namespace}},
+	}
+	for _, obj := range objects {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if apierrs.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !metav1.IsControlledBy(obj, nb) {
+			continue
+		}
+		log.Info("Deleting the workers of the Notebook", "name", obj.GetName())
+		if err := r.Delete(ctx, obj); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
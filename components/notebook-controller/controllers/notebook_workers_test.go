@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
+)
+
+func newTestWorkers() *v1beta1.NotebookWorkersSpec {
+	return &v1beta1.NotebookWorkersSpec{
+		Replicas: 2,
+		Template: v1beta1.NotebookTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "worker", Image: "dask"}}},
+		},
+	}
+}
+
+func TestGenerateWorkerStatefulSet(t *testing.T) {
+	nb := newTestNotebook("dask")
+	nb.Spec.Workers = newTestWorkers()
+
+	ss := generateWorkerStatefulSet(nb, config.Default())
+	if ss.Name != "dask-worker" || *ss.Spec.Replicas != 2 || ss.Spec.ServiceName != "dask-headless" {
+		t.Errorf("Got StatefulSet %s with %d replicas and service %q", ss.Name, *ss.Spec.Replicas, ss.Spec.ServiceName)
+	}
+	env := map[string]string{}
+	for _, v := range ss.Spec.Template.Spec.Containers[0].Env {
+		env[v.Name] = v.Value
+	}
+	if env[HeadHostEnvVar] != "dask-0.dask-headless.ns.svc" {
+		t.Errorf("Got %s=%q", HeadHostEnvVar, env[HeadHostEnvVar])
+	}
+	if env[HeadlessServiceEnvVar] != "dask-headless.ns.svc" {
+		t.Errorf("Got %s=%q", HeadlessServiceEnvVar, env[HeadlessServiceEnvVar])
+	}
+
+	// The notebook Pod is resolvable through the headless Service
+	if head := generateStatefulSet(nb, config.Default()); head.Spec.ServiceName != "dask-headless" {
+		t.Errorf("Got service name %q for the notebook StatefulSet", head.Spec.ServiceName)
+	}
+
+	nb.Spec.State = v1beta1.NotebookStateStopped
+	if ss := generateWorkerStatefulSet(nb, config.Default()); *ss.Spec.Replicas != 0 {
+		t.Errorf("Expected the workers of a stopped Notebook to be scaled down, got %d", *ss.Spec.Replicas)
+	}
+}
+
+func TestReconcileWorkers(t *testing.T) {
+	nb := newTestNotebook("dask")
+	nb.Spec.Workers = newTestWorkers()
+	readyWorker := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dask-worker-0",
+			Namespace: "ns",
+			Labels:    map[string]string{"statefulset": "dask-worker", "notebook-name": "dask"},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	pendingWorker := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dask-worker-1",
+			Namespace: "ns",
+			Labels:    map[string]string{"statefulset": "dask-worker", "notebook-name": "dask"},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	r, c := newTestNotebookReconciler(nb, readyWorker, pendingWorker)
+
+	status, err := r.reconcileWorkers(context.TODO(), nb, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.ServiceName != "dask-headless" || status.Replicas != 2 || status.ReadyReplicas != 1 {
+		t.Errorf("Got status %+v", status)
+	}
+	if len(status.Pods) != 2 || !status.Pods[0].Ready || status.Pods[1].Ready ||
+		status.Pods[1].Phase != corev1.PodPending {
+		t.Errorf("Got the Pods %+v", status.Pods)
+	}
+
+	service := &corev1.Service{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "dask-headless", Namespace: "ns"}, service); err != nil {
+		t.Fatalf("Expected the headless Service to be created: %v", err)
+	}
+	if service.Spec.ClusterIP != corev1.ClusterIPNone || !service.Spec.PublishNotReadyAddresses {
+		t.Errorf("Expected a headless Service, got %+v", service.Spec)
+	}
+
+	// Removing the workers deletes their StatefulSet and the headless Service
+	nb.Spec.Workers = nil
+	status, err = r.reconcileWorkers(context.TODO(), nb, TestLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status != nil {
+		t.Errorf("Got status %+v, Expected none", status)
+	}
+	err = c.Get(context.TODO(), client.ObjectKey{Name: "dask-worker", Namespace: "ns"}, &appsv1.StatefulSet{})
+	if !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the worker StatefulSet to be deleted, got %v", err)
+	}
+	err = c.Get(context.TODO(), client.ObjectKey{Name: "dask-headless", Namespace: "ns"}, &corev1.Service{})
+	if !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the headless Service to be deleted, got %v", err)
+	}
+}
@@ -81,8 +81,9 @@ var _ = BeforeSuite(func() {
 		Client:        k8sManager.GetClient(),
 		Log:           ctrl.Log.WithName("controllers").WithName("notebook-controller"),
 		Scheme:        k8sManager.GetScheme(),
-		Metrics:       controllermetrics.NewMetrics(k8sManager.GetClient()),
+		Metrics:       controllermetrics.NewMetrics(k8sManager.GetCache(), nil),
 		EventRecorder: k8sManager.GetEventRecorderFor("notebook-controller"),
+		APIReader:     k8sManager.GetAPIReader(),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
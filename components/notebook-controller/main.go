@@ -23,10 +23,18 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	// Embed the time zone database, used by the working hours of the
+	// CullingPolicies, since the image doesn't ship one.
+	_ "time/tzdata"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -35,6 +43,7 @@ import (
 	nbv1alpha1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1alpha1"
 	nbv1beta1 "github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
 	"github.com/kubeflow/kubeflow/components/notebook-controller/controllers"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/config"
 	controller_metrics "github.com/kubeflow/kubeflow/components/notebook-controller/pkg/metrics"
 	//+kubebuilder:scaffold:imports
 )
@@ -55,7 +64,7 @@ func init() {
 }
 
 func main() {
-	var metricsAddr, leaderElectionNamespace string
+	var metricsAddr, leaderElectionNamespace, configFile string
 	var enableLeaderElection bool
 	var probeAddr string
 	var Burst int
@@ -69,6 +78,8 @@ func main() {
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.IntVar(&Burst, "burst", 0, "If it's zero, the created RESTClient will use DefaultBurst")
 	flag.IntVar(&QPS, "qps", 0, "If it's zero, the created RESTClient will use DefaultQPS")
+	flag.StringVar(&configFile, "config", "",
+		"The NotebookControllerConfig file. If it's empty, the controller is configured with the deprecated environment variables.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -83,6 +94,33 @@ func main() {
 		cfg.QPS = float32(QPS)
 	}
 
+	// Read and validate the configuration before anything is started
+	var configProvider *config.Provider
+	var err error
+	if configFile != "" {
+		if err = config.CheckLegacySettings(configFile); err == nil {
+			configProvider, err = config.NewFileProvider(configFile, ctrl.Log.WithName("config"))
+		}
+	} else {
+		var envConfig *config.NotebookControllerConfig
+		envConfig, err = config.FromEnv()
+		configProvider = config.NewProvider(envConfig)
+	}
+	if err != nil {
+		setupLog.Error(err, "invalid configuration")
+		os.Exit(1)
+	}
+	controllerConfig := configProvider.Get()
+	if controllerConfig.PodMetadata.Annotations.IsEmpty() {
+		setupLog.Info("The annotations propagated to the notebook Pods are filtered by key substrings, which is deprecated. " +
+			"Set podMetadata.annotations in the configuration file.")
+	}
+
+	gatewayPortLeases, err := labels.Parse(controllers.GatewayPortLabel)
+	if err != nil {
+		setupLog.Error(err, "unable to select the Leases of the gateway ports")
+		os.Exit(1)
+	}
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                  scheme,
 		MetricsBindAddress:      metricsAddr,
@@ -90,35 +128,91 @@ func main() {
 		LeaderElection:          enableLeaderElection,
 		LeaderElectionNamespace: leaderElectionNamespace,
 		LeaderElectionID:        "kubeflow-notebook-controller",
+		// Only cache the Secrets of the tokens of the Notebooks and the Leases
+		// of the gateway ports, instead of all the Secrets and Leases of the
+		// cluster
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Secret{}:        {Label: labels.SelectorFromSet(labels.Set{controllers.ProbeTokenLabel: "true"})},
+				&coordinationv1.Lease{}: {Label: gatewayPortLeases},
+			},
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// The price table was validated with the configuration
+	prices, _ := controller_metrics.ParsePriceTable(controllerConfig.PriceTable)
+	metrics := controller_metrics.NewMetrics(mgr.GetCache(), prices)
+
+	// Reload the configuration file when it changes
+	if err := mgr.Add(configProvider); err != nil {
+		setupLog.Error(err, "unable to watch the configuration file")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.NotebookReconciler{
 		Client:        mgr.GetClient(),
 		Log:           ctrl.Log.WithName("controllers").WithName("Notebook"),
 		Scheme:        mgr.GetScheme(),
-		Metrics:       controller_metrics.NewMetrics(mgr.GetClient()),
+		Metrics:       metrics,
 		EventRecorder: mgr.GetEventRecorderFor("notebook-controller"),
+		Config:        configProvider,
+		APIReader:     mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Notebook")
 		os.Exit(1)
 	} //+kubebuilder:scaffold:builder
 
-	if controllers.GetEnvDefault("ENABLE_CULLING", controllers.DEFAULT_ENABLE_CULLING) == "true" {
+	if err = (&controllers.NotebookEventReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("NotebookEvents"),
+		EventRecorder: mgr.GetEventRecorderFor("notebook-controller"),
+		CacheSize:     controllerConfig.Events.CacheSize,
+		QPS:           controllerConfig.Events.QPS,
+		Burst:         controllerConfig.Events.Burst,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NotebookEvents")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.NotebookSnapshotReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("NotebookSnapshot"),
+		Scheme:        mgr.GetScheme(),
+		EventRecorder: mgr.GetEventRecorderFor("notebook-snapshot-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NotebookSnapshot")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.NotebookScheduleReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("NotebookSchedule"),
+		EventRecorder: mgr.GetEventRecorderFor("notebook-schedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NotebookSchedule")
+		os.Exit(1)
+	}
+
+	if controllerConfig.Culling.Enabled {
 		if err = (&controllers.CullingReconciler{
-			Client: mgr.GetClient(),
-			Log:    ctrl.Log.WithName("controllers").WithName("Culler"),
-			Scheme: mgr.GetScheme(),
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("controllers").WithName("Culler"),
+			Scheme:        mgr.GetScheme(),
+			Metrics:       metrics,
+			EventRecorder: mgr.GetEventRecorderFor("notebook-culler"),
+			Config:        configProvider,
+			APIReader:     mgr.GetAPIReader(),
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Culler")
 			os.Exit(1)
 		} //+kubebuilder:scaffold:builder
 	} else {
-		log.Info("Culling of idle Pods is Disabled. To enable it set the " +
-			"ENV Var 'ENABLE_CULLING=true'")
+		log.Info("Culling of idle Pods is Disabled. To enable it set " +
+			"culling.enabled in the configuration file, or the ENV Var 'ENABLE_CULLING=true'")
 	}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -131,11 +225,21 @@ func main() {
 		os.Exit(1)
 	}
 
-	// uncomment when we need the conversion webhook.
-	// if err = (&nbv1beta1.Notebook{}).SetupWebhookWithManager(mgr); err != nil {
-	// 	setupLog.Error(err, "unable to create webhook", "webhook", "Captain")
-	// 	os.Exit(1)
-	// }
+	// Serve the conversion webhook, which converts Notebooks between
+	// v1alpha1, v1beta1 and v1, and the defaulting and validating webhooks.
+	// They can be disabled to run the controller locally, without the
+	// webhooks' certificate.
+	if *controllerConfig.EnableWebhooks {
+		if err = (&nbv1beta1.Notebook{}).SetupWebhookWithManager(mgr,
+			&nbv1beta1.NotebookDefaulter{AddFSGroup: *controllerConfig.AddFSGroup}); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Notebook")
+			os.Exit(1)
+		}
+		if err = (&nbv1beta1.CullingPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CullingPolicy")
+			os.Exit(1)
+		}
+	}
 
 	//+kubebuilder:scaffold:builder
 
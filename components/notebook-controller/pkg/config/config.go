@@ -0,0 +1,598 @@
+// Package config defines the configuration file of the notebook-controller,
+// a NotebookControllerConfig, and the Provider that hands it to the
+// reconcilers.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubeflow/kubeflow/components/common/routing"
+	"github.com/kubeflow/kubeflow/components/notebook-controller/pkg/metrics"
+)
+
+const (
+	// APIVersion is the version of the configuration file
+	APIVersion = "config.kubeflow.org/v1alpha1"
+	// Kind is the kind of the configuration file
+	Kind = "NotebookControllerConfig"
+)
+
+// Defaults of the configuration
+const (
+	DefaultRoutingMode     = routing.ModeNone
+	DefaultGateway         = "kubeflow/kubeflow-gateway"
+	DefaultClusterDomain   = routing.DefaultClusterDomain
+	DefaultAddFSGroup      = true
+	DefaultEnableWebhooks  = true
+	DefaultCullIdleTime    = 24 * time.Hour
+	DefaultCullCheckPeriod = time.Minute
+
+	DefaultMaxConcurrentChecks             = 10
+	DefaultMaxConcurrentChecksPerNamespace = 3
+	DefaultProbeTimeout                    = 10 * time.Second
+	DefaultMaxProbeBackoff                 = 30 * time.Minute
+	DefaultMaxCullingPostponement          = 24 * time.Hour
+
+	DefaultIngressGatewayNamespace = "istio-system"
+	DefaultControllerNamespace     = "kubeflow"
+
+	DefaultRemoteAccessImage = "lscr.io/linuxserver/openssh-server:latest"
+	DefaultRemoteAccessUser  = "jovyan"
+
+	DefaultEventCacheSize = 10000
+	DefaultEventQPS       = 1.0
+	DefaultEventBurst     = 10
+)
+
+// NotebookControllerConfig is the configuration of the notebook-controller.
+// Fields that are left out get their default value.
+type NotebookControllerConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Routing configures how Notebooks are exposed through the cluster
+	// gateway.
+	Routing RoutingConfig `json:"routing,omitempty"`
+	// ClusterDomain is the DNS domain of the cluster, used to reach the
+	// Services of the Notebooks. Defaults to cluster.local.
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+	// AddFSGroup sets the fsGroup of the notebook Pods that have no security
+	// context to 100. It can be disabled on platforms that assign the
+	// fsGroup themselves, like OpenShift. Defaults to true.
+	AddFSGroup *bool `json:"addFSGroup,omitempty"`
+	// EnableWebhooks serves the conversion, defaulting and validating
+	// webhooks. They can be disabled to run the controller locally, without
+	// their certificate. Defaults to true.
+	EnableWebhooks *bool `json:"enableWebhooks,omitempty"`
+	// PriceTable is the price per hour of the resources, used by the cost
+	// metrics, e.g. "cpu=0.03,memory=0.004,nvidia.com/gpu=2.5".
+	PriceTable string `json:"priceTable,omitempty"`
+	// Culling configures the culling of idle Notebooks.
+	Culling CullingConfig `json:"culling,omitempty"`
+	// NetworkPolicy configures the NetworkPolicies of the Notebooks that
+	// declare one.
+	NetworkPolicy NetworkPolicyConfig `json:"networkPolicy,omitempty"`
+	// RemoteAccess configures the SSH servers of the Notebooks that declare
+	// one.
+	RemoteAccess RemoteAccessConfig `json:"remoteAccess,omitempty"`
+	// PodMetadata filters the labels and annotations propagated from the
+	// Notebooks to their Pods.
+	PodMetadata PodMetadataConfig `json:"podMetadata,omitempty"`
+	// Events configures the re-emission of the Events of the StatefulSets
+	// and Pods of the Notebooks on the Notebooks.
+	Events EventsConfig `json:"events,omitempty"`
+	// Dev makes the culler reach the Notebooks through `kubectl proxy` on
+	// localhost:8001, to run the controller outside of the cluster.
+	Dev bool `json:"dev,omitempty"`
+}
+
+// EventsConfig configures how the Events of the StatefulSets and Pods of the
+// Notebooks are re-emitted on the Notebooks.
+type EventsConfig struct {
+	// QPS is the number of Events re-emitted per second on a Notebook.
+	// Defaults to 1.
+	QPS float64 `json:"qps,omitempty"`
+	// Burst is the number of Events re-emitted on a Notebook at once, above
+	// the QPS. Defaults to 10.
+	Burst int `json:"burst,omitempty"`
+	// CacheSize bounds the number of re-emitted Events, and of Notebooks,
+	// that are remembered to deduplicate and rate limit the Events.
+	// Defaults to 10000.
+	CacheSize int `json:"cacheSize,omitempty"`
+}
+
+// RoutingConfig configures the routes of the Notebooks.
+type RoutingConfig struct {
+	// Mode is none, istio or gateway-api. Defaults to none.
+	Mode routing.Mode `json:"mode,omitempty"`
+	// Gateway is the "namespace/name" of the Istio Gateway or of the
+	// Gateway API Gateway the routes attach to. Defaults to
+	// kubeflow/kubeflow-gateway.
+	Gateway string `json:"gateway,omitempty"`
+	// SectionName restricts HTTPRoutes to a single listener of the Gateway.
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// NetworkPolicyConfig configures the sources that are always allowed to reach
+// the Notebooks with a NetworkPolicy.
+type NetworkPolicyConfig struct {
+	// IngressGatewayNamespaces are the namespaces of the Pods of the
+	// ingress gateway. Defaults to istio-system.
+	IngressGatewayNamespaces []string `json:"ingressGatewayNamespaces,omitempty"`
+	// ControllerNamespace is the namespace of the notebook-controller, whose
+	// culler probes the Notebooks. Defaults to kubeflow.
+	ControllerNamespace string `json:"controllerNamespace,omitempty"`
+	// ControllerPodLabels select the Pods of the notebook-controller in its
+	// namespace. Defaults to app: notebook-controller.
+	ControllerPodLabels map[string]string `json:"controllerPodLabels,omitempty"`
+}
+
+// PodMetadataConfig filters the labels and annotations propagated from the
+// Notebooks to their Pods. The labels select the PodDefaults of the Pods, so
+// they are all propagated by default.
+type PodMetadataConfig struct {
+	Labels MetadataFilter `json:"labels,omitempty"`
+	// Annotations filters the annotations. If it is empty, the annotations
+	// whose key contains "kubectl" or "notebook" aren't propagated, which
+	// is deprecated.
+	Annotations MetadataFilter `json:"annotations,omitempty"`
+}
+
+// MetadataFilter selects the keys of the labels or annotations that are
+// propagated with glob patterns, where * matches any characters, e.g.
+// "*.example.com/*".
+type MetadataFilter struct {
+	// Allow are the patterns of the propagated keys. Defaults to all the
+	// keys.
+	Allow []string `json:"allow,omitempty"`
+	// Deny are the patterns of the keys that aren't propagated, even if
+	// they are allowed.
+	Deny []string `json:"deny,omitempty"`
+}
+
+// IsEmpty returns whether the filter has no patterns
+func (f *MetadataFilter) IsEmpty() bool {
+	return len(f.Allow) == 0 && len(f.Deny) == 0
+}
+
+// Propagates returns whether the key is allowed and not denied
+func (f *MetadataFilter) Propagates(key string) bool {
+	if len(f.Allow) > 0 && !MatchesAny(f.Allow, key) {
+		return false
+	}
+	return !MatchesAny(f.Deny, key)
+}
+
+// MatchesAny returns whether the key matches any of the glob patterns
+func MatchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches the key against a pattern where * matches any, possibly
+// empty, sequence of characters. Unlike path.Match, * also matches /.
+func matchGlob(pattern, key string) bool {
+	// Backtrack to the last * when a character doesn't match
+	p, k := 0, 0
+	star, starKey := -1, 0
+	for k < len(key) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, starKey = p, k
+			p++
+		case p < len(pattern) && pattern[p] == key[k]:
+			p++
+			k++
+		case star >= 0:
+			starKey++
+			p, k = star+1, starKey
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// RemoteAccessConfig configures the SSH servers of the Notebooks, and how they
+// are reached through the cluster gateway.
+type RemoteAccessConfig struct {
+	// Image is the image of the SSH server sidecar. It must read the
+	// authorized keys from the file in the PUBLIC_KEY_FILE environment
+	// variable and listen on port 2222, like the linuxserver.io
+	// openssh-server image. Defaults to
+	// lscr.io/linuxserver/openssh-server:latest.
+	Image string `json:"image,omitempty"`
+	// User is the user that logs in to the SSH servers. Defaults to jovyan.
+	User string `json:"user,omitempty"`
+	// GatewayHost is the host name of the cluster gateway, which the
+	// connection strings of the routed SSH servers point to.
+	GatewayHost string `json:"gatewayHost,omitempty"`
+	// FirstGatewayPort and LastGatewayPort are the range of ports of the
+	// gateway that are assigned to the SSH servers, one per Notebook. The
+	// gateway must listen on them. If they are unset, the SSH servers
+	// aren't routed through the gateway.
+	FirstGatewayPort int32 `json:"firstGatewayPort,omitempty"`
+	LastGatewayPort  int32 `json:"lastGatewayPort,omitempty"`
+	// PortLeaseNamespace is the namespace of the Leases that reserve the
+	// ports of the gateway, one per port. Defaults to kubeflow.
+	PortLeaseNamespace string `json:"portLeaseNamespace,omitempty"`
+}
+
+// GatewayRoutingEnabled returns whether the SSH servers are routed through
+// the gateway
+func (c *RemoteAccessConfig) GatewayRoutingEnabled() bool {
+	return c.FirstGatewayPort > 0
+}
+
+// CullingConfig configures the culler. Apart from Enabled and
+// MaxConcurrentChecks, it can be changed without restarting the controller.
+type CullingConfig struct {
+	// Enabled runs the culler.
+	Enabled bool `json:"enabled,omitempty"`
+	// IdleTime is how long a Notebook can be idle before it is stopped,
+	// unless a CullingPolicy says otherwise. Defaults to 24h.
+	IdleTime metav1.Duration `json:"idleTime,omitempty"`
+	// CheckPeriod is how often the activity of the Notebooks is probed.
+	// Defaults to 1m.
+	CheckPeriod metav1.Duration `json:"checkPeriod,omitempty"`
+	// GracePeriod is how long an idle Notebook is warned before it is
+	// stopped. Defaults to 0, i.e. no warning.
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+	// PrometheusURL is the address of the Prometheus server used by the
+	// Prometheus idleness probe.
+	PrometheusURL string `json:"prometheusURL,omitempty"`
+	// IdlenessAnnotations also reports the idleness of the Notebooks in the
+	// legacy notebooks.kubeflow.org/last-activity and
+	// notebooks.kubeflow.org/last_activity_check_timestamp annotations.
+	IdlenessAnnotations bool `json:"idlenessAnnotations,omitempty"`
+	// MaxConcurrentChecks is the number of Notebooks the culler checks at
+	// the same time. Defaults to 10.
+	MaxConcurrentChecks int `json:"maxConcurrentChecks,omitempty"`
+	// MaxConcurrentChecksPerNamespace is the number of Notebooks of a
+	// namespace the culler checks at the same time, so that a namespace with
+	// many, or many unreachable, Notebooks doesn't delay the checks of the
+	// other namespaces. Defaults to 3.
+	MaxConcurrentChecksPerNamespace int `json:"maxConcurrentChecksPerNamespace,omitempty"`
+	// ProbeTimeout is how long the culler waits for the response of an
+	// idleness probe. Defaults to 10s.
+	ProbeTimeout metav1.Duration `json:"probeTimeout,omitempty"`
+	// MaxProbeBackoff caps the delay of the next check of a Notebook whose
+	// probes failed, which doubles with every consecutive failure, starting
+	// at the check period. Defaults to 30m.
+	MaxProbeBackoff metav1.Duration `json:"maxProbeBackoff,omitempty"`
+	// MaxPostponement is how far in the future the postpone-culling
+	// annotation of a Notebook can be. Later timestamps are shortened to
+	// this limit. Defaults to 24h.
+	MaxPostponement metav1.Duration `json:"maxPostponement,omitempty"`
+}
+
+// Default returns the default configuration
+func Default() *NotebookControllerConfig {
+	c := &NotebookControllerConfig{}
+	c.SetDefaults()
+	return c
+}
+
+// SetDefaults sets the fields that are left out to their default value
+func (c *NotebookControllerConfig) SetDefaults() {
+	if c.APIVersion == "" {
+		c.APIVersion = APIVersion
+	}
+	if c.Kind == "" {
+		c.Kind = Kind
+	}
+	if c.Routing.Mode == "" {
+		c.Routing.Mode = DefaultRoutingMode
+	} else if mode, err := routing.ParseMode(string(c.Routing.Mode)); err == nil {
+		// Invalid modes are kept for Validate to report
+		c.Routing.Mode = mode
+	}
+	if c.Routing.Gateway == "" {
+		c.Routing.Gateway = DefaultGateway
+	}
+	if c.ClusterDomain == "" {
+		c.ClusterDomain = DefaultClusterDomain
+	}
+	if c.AddFSGroup == nil {
+		addFSGroup := DefaultAddFSGroup
+		c.AddFSGroup = &addFSGroup
+	}
+	if c.EnableWebhooks == nil {
+		enableWebhooks := DefaultEnableWebhooks
+		c.EnableWebhooks = &enableWebhooks
+	}
+	if len(c.NetworkPolicy.IngressGatewayNamespaces) == 0 {
+		c.NetworkPolicy.IngressGatewayNamespaces = []string{DefaultIngressGatewayNamespace}
+	}
+	if c.NetworkPolicy.ControllerNamespace == "" {
+		c.NetworkPolicy.ControllerNamespace = DefaultControllerNamespace
+	}
+	if len(c.NetworkPolicy.ControllerPodLabels) == 0 {
+		c.NetworkPolicy.ControllerPodLabels = map[string]string{"app": "notebook-controller"}
+	}
+	if c.RemoteAccess.Image == "" {
+		c.RemoteAccess.Image = DefaultRemoteAccessImage
+	}
+	if c.RemoteAccess.User == "" {
+		c.RemoteAccess.User = DefaultRemoteAccessUser
+	}
+	if c.RemoteAccess.PortLeaseNamespace == "" {
+		c.RemoteAccess.PortLeaseNamespace = DefaultControllerNamespace
+	}
+	if c.Events.QPS == 0 {
+		c.Events.QPS = DefaultEventQPS
+	}
+	if c.Events.Burst == 0 {
+		c.Events.Burst = DefaultEventBurst
+	}
+	if c.Events.CacheSize == 0 {
+		c.Events.CacheSize = DefaultEventCacheSize
+	}
+	if c.Culling.IdleTime.Duration == 0 {
+		c.Culling.IdleTime.Duration = DefaultCullIdleTime
+	}
+	if c.Culling.CheckPeriod.Duration == 0 {
+		c.Culling.CheckPeriod.Duration = DefaultCullCheckPeriod
+	}
+	if c.Culling.MaxConcurrentChecks == 0 {
+		c.Culling.MaxConcurrentChecks = DefaultMaxConcurrentChecks
+	}
+	if c.Culling.MaxConcurrentChecksPerNamespace == 0 {
+		c.Culling.MaxConcurrentChecksPerNamespace = DefaultMaxConcurrentChecksPerNamespace
+	}
+	if c.Culling.ProbeTimeout.Duration == 0 {
+		c.Culling.ProbeTimeout.Duration = DefaultProbeTimeout
+	}
+	if c.Culling.MaxProbeBackoff.Duration == 0 {
+		c.Culling.MaxProbeBackoff.Duration = DefaultMaxProbeBackoff
+	}
+	if c.Culling.MaxPostponement.Duration == 0 {
+		c.Culling.MaxPostponement.Duration = DefaultMaxCullingPostponement
+	}
+}
+
+// Validate returns an error if the configuration is invalid
+func (c *NotebookControllerConfig) Validate() error {
+	var errs field.ErrorList
+	if c.APIVersion != APIVersion {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), c.APIVersion, []string{APIVersion}))
+	}
+	if c.Kind != Kind {
+		errs = append(errs, field.NotSupported(field.NewPath("kind"), c.Kind, []string{Kind}))
+	}
+	if _, err := routing.ParseMode(string(c.Routing.Mode)); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("routing", "mode"), c.Routing.Mode, err.Error()))
+	}
+	if _, err := metrics.ParsePriceTable(c.PriceTable); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("priceTable"), c.PriceTable, err.Error()))
+	}
+
+	networkPolicy := field.NewPath("networkPolicy")
+	for i, ns := range c.NetworkPolicy.IngressGatewayNamespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(networkPolicy.Child("ingressGatewayNamespaces").Index(i), ns, msg))
+		}
+	}
+	for _, msg := range validation.IsDNS1123Label(c.NetworkPolicy.ControllerNamespace) {
+		errs = append(errs, field.Invalid(networkPolicy.Child("controllerNamespace"),
+			c.NetworkPolicy.ControllerNamespace, msg))
+	}
+
+	remoteAccess := field.NewPath("remoteAccess")
+	if first, last := c.RemoteAccess.FirstGatewayPort, c.RemoteAccess.LastGatewayPort; first != 0 || last != 0 {
+		if first <= 0 || first > 65535 {
+			errs = append(errs, field.Invalid(remoteAccess.Child("firstGatewayPort"), first, "must be a port number"))
+		}
+		if last < first || last > 65535 {
+			errs = append(errs, field.Invalid(remoteAccess.Child("lastGatewayPort"), last,
+				"must be a port number not lower than firstGatewayPort"))
+		}
+		if c.RemoteAccess.GatewayHost == "" {
+			errs = append(errs, field.Required(remoteAccess.Child("gatewayHost"),
+				"the SSH servers routed through the gateway are reached through its host name"))
+		}
+	}
+
+	podMetadata := field.NewPath("podMetadata")
+	errs = append(errs, validateMetadataFilter(podMetadata.Child("labels"), &c.PodMetadata.Labels)...)
+	errs = append(errs, validateMetadataFilter(podMetadata.Child("annotations"), &c.PodMetadata.Annotations)...)
+
+	events := field.NewPath("events")
+	if c.Events.QPS < 0 {
+		errs = append(errs, field.Invalid(events.Child("qps"), c.Events.QPS, "must be greater than 0"))
+	}
+	if c.Events.Burst < 0 {
+		errs = append(errs, field.Invalid(events.Child("burst"), c.Events.Burst, "must be greater than 0"))
+	}
+	if c.Events.CacheSize < 0 {
+		errs = append(errs, field.Invalid(events.Child("cacheSize"), c.Events.CacheSize, "must be greater than 0"))
+	}
+
+	culling := field.NewPath("culling")
+	if c.Culling.IdleTime.Duration <= 0 {
+		errs = append(errs, field.Invalid(culling.Child("idleTime"), c.Culling.IdleTime.Duration.String(),
+			"must be greater than 0"))
+	}
+	if c.Culling.CheckPeriod.Duration <= 0 {
+		errs = append(errs, field.Invalid(culling.Child("checkPeriod"), c.Culling.CheckPeriod.Duration.String(),
+			"must be greater than 0"))
+	}
+	if c.Culling.GracePeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(culling.Child("gracePeriod"), c.Culling.GracePeriod.Duration.String(),
+			"must not be negative"))
+	}
+	if c.Culling.MaxConcurrentChecks < 0 {
+		errs = append(errs, field.Invalid(culling.Child("maxConcurrentChecks"), c.Culling.MaxConcurrentChecks,
+			"must be greater than 0"))
+	}
+	if c.Culling.MaxConcurrentChecksPerNamespace < 0 {
+		errs = append(errs, field.Invalid(culling.Child("maxConcurrentChecksPerNamespace"),
+			c.Culling.MaxConcurrentChecksPerNamespace, "must be greater than 0"))
+	}
+	if c.Culling.ProbeTimeout.Duration < 0 {
+		errs = append(errs, field.Invalid(culling.Child("probeTimeout"), c.Culling.ProbeTimeout.Duration.String(),
+			"must be greater than 0"))
+	}
+	if c.Culling.MaxProbeBackoff.Duration < 0 {
+		errs = append(errs, field.Invalid(culling.Child("maxProbeBackoff"), c.Culling.MaxProbeBackoff.Duration.String(),
+			"must be greater than 0"))
+	}
+	if c.Culling.MaxPostponement.Duration < 0 {
+		errs = append(errs, field.Invalid(culling.Child("maxPostponement"), c.Culling.MaxPostponement.Duration.String(),
+			"must be greater than 0"))
+	}
+	if c.Culling.PrometheusURL != "" {
+		if u, err := url.Parse(c.Culling.PrometheusURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, field.Invalid(culling.Child("prometheusURL"), c.Culling.PrometheusURL,
+				"must be an absolute URL"))
+		}
+	}
+	return errs.ToAggregate()
+}
+
+// validateMetadataFilter checks that the patterns of the filter aren't empty
+func validateMetadataFilter(fldPath *field.Path, f *MetadataFilter) field.ErrorList {
+	var errs field.ErrorList
+	for i, pattern := range f.Allow {
+		if pattern == "" {
+			errs = append(errs, field.Invalid(fldPath.Child("allow").Index(i), pattern, "must not be empty"))
+		}
+	}
+	for i, pattern := range f.Deny {
+		if pattern == "" {
+			errs = append(errs, field.Invalid(fldPath.Child("deny").Index(i), pattern, "must not be empty"))
+		}
+	}
+	return errs
+}
+
+// RoutingConfig returns the routing settings of the controller
+func (c *NotebookControllerConfig) RoutingConfig() routing.Config {
+	return routing.Config{
+		Mode:          c.Routing.Mode,
+		Gateway:       c.Routing.Gateway,
+		SectionName:   c.Routing.SectionName,
+		ClusterDomain: c.ClusterDomain,
+	}
+}
+
+// Load reads the configuration file at path, sets the defaults and validates
+// it. Unknown fields are rejected, so typos don't go unnoticed.
+func Load(path string) (*NotebookControllerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &NotebookControllerConfig{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// LegacyEnv lists the environment variables read by FromEnv.
+var LegacyEnv = []string{
+	"USE_ISTIO", "ROUTING_MODE", "GATEWAY", "ISTIO_GATEWAY", "GATEWAY_SECTION_NAME",
+	"CLUSTER_DOMAIN", "ADD_FSGROUP", "ENABLE_WEBHOOKS", "PRICE_TABLE", "DEV",
+	"ENABLE_CULLING", "PROMETHEUS_URL", "ENABLE_IDLENESS_ANNOTATIONS",
+	"CULL_IDLE_TIME", "IDLENESS_CHECK_PERIOD", "CULL_GRACE_PERIOD",
+}
+
+// CheckLegacySettings returns an error if any of the LegacyEnv variables is
+// set, or is a key of the ConfigMap the configuration file at path is mounted
+// from, i.e. a file next to it. They are ignored when the controller is
+// configured with a file, so e.g. culling would silently be turned off.
+func CheckLegacySettings(path string) error {
+	var found []string
+	dir := filepath.Dir(path)
+	for _, name := range LegacyEnv {
+		if os.Getenv(name) != "" {
+			found = append(found, "environment variable "+name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, "file "+filepath.Join(dir, name))
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("the deprecated settings %s are ignored with a configuration file, "+
+			"set the matching fields of %s instead", strings.Join(found, ", "), path)
+	}
+	return nil
+}
+
+// FromEnv returns the configuration of the environment variables the
+// controller used to be configured with. It is used when no configuration
+// file is given, and will be removed in a future release.
+func FromEnv() (*NotebookControllerConfig, error) {
+	c := &NotebookControllerConfig{}
+	if os.Getenv("USE_ISTIO") == "true" {
+		c.Routing.Mode = routing.ModeIstio
+	}
+	if v := os.Getenv("ROUTING_MODE"); v != "" {
+		c.Routing.Mode = routing.Mode(v)
+	}
+	c.Routing.Gateway = os.Getenv("GATEWAY")
+	if c.Routing.Gateway == "" {
+		c.Routing.Gateway = os.Getenv("ISTIO_GATEWAY")
+	}
+	c.Routing.SectionName = os.Getenv("GATEWAY_SECTION_NAME")
+	c.ClusterDomain = os.Getenv("CLUSTER_DOMAIN")
+	if v, ok := os.LookupEnv("ADD_FSGROUP"); ok {
+		addFSGroup := v == "true"
+		c.AddFSGroup = &addFSGroup
+	}
+	if v, ok := os.LookupEnv("ENABLE_WEBHOOKS"); ok {
+		enableWebhooks := v != "false"
+		c.EnableWebhooks = &enableWebhooks
+	}
+	c.PriceTable = os.Getenv("PRICE_TABLE")
+	c.Dev = os.Getenv("DEV") == "true"
+
+	c.Culling.Enabled = os.Getenv("ENABLE_CULLING") == "true"
+	c.Culling.PrometheusURL = os.Getenv("PROMETHEUS_URL")
+	c.Culling.IdlenessAnnotations = os.Getenv("ENABLE_IDLENESS_ANNOTATIONS") == "true"
+	// The durations are in minutes
+	minutes := map[string]*metav1.Duration{
+		"CULL_IDLE_TIME":        &c.Culling.IdleTime,
+		"IDLENESS_CHECK_PERIOD": &c.Culling.CheckPeriod,
+		"CULL_GRACE_PERIOD":     &c.Culling.GracePeriod,
+	}
+	for name, d := range minutes {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		m, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s should be a number of minutes, got %q", name, v)
+		}
+		d.Duration = time.Duration(m) * time.Minute
+	}
+
+	c.SetDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,385 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubeflow/kubeflow/components/common/routing"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		check   func(t *testing.T, c *NotebookControllerConfig)
+		err     bool
+	}{
+		{
+			name: "defaults",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+`,
+			check: func(t *testing.T, c *NotebookControllerConfig) {
+				if c.Routing.Mode != routing.ModeNone || c.Routing.Gateway != DefaultGateway ||
+					c.ClusterDomain != DefaultClusterDomain || !*c.AddFSGroup || !*c.EnableWebhooks ||
+					c.Culling.IdleTime.Duration != DefaultCullIdleTime ||
+					c.Culling.CheckPeriod.Duration != DefaultCullCheckPeriod ||
+					c.Culling.MaxConcurrentChecks != DefaultMaxConcurrentChecks ||
+					c.Culling.ProbeTimeout.Duration != DefaultProbeTimeout ||
+					c.NetworkPolicy.ControllerNamespace != DefaultControllerNamespace ||
+					c.NetworkPolicy.ControllerPodLabels["app"] != "notebook-controller" {
+					t.Errorf("Got the configuration %+v", c)
+				}
+			},
+		},
+		{
+			name: "settings",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+routing:
+  mode: Istio
+  gateway: istio-system/gateway
+addFSGroup: false
+culling:
+  enabled: true
+  idleTime: 30m
+  gracePeriod: 5m
+  prometheusURL: http://prometheus.monitoring:9090
+`,
+			check: func(t *testing.T, c *NotebookControllerConfig) {
+				if c.Routing.Mode != routing.ModeIstio || c.Routing.Gateway != "istio-system/gateway" ||
+					*c.AddFSGroup || !c.Culling.Enabled || c.Culling.IdleTime.Duration != 30*time.Minute ||
+					c.Culling.GracePeriod.Duration != 5*time.Minute {
+					t.Errorf("Got the configuration %+v", c)
+				}
+			},
+		},
+		{
+			name: "unknown field",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+culling:
+  idleTimeout: 30m
+`,
+			err: true,
+		},
+		{
+			name: "wrong kind",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: TensorboardControllerConfig
+`,
+			err: true,
+		},
+		{
+			name: "unknown routing mode",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+routing:
+  mode: nginx
+`,
+			err: true,
+		},
+		{
+			name: "relative Prometheus URL",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+culling:
+  prometheusURL: prometheus:9090
+`,
+			err: true,
+		},
+		{
+			name: "invalid ingress gateway namespace",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+networkPolicy:
+  ingressGatewayNamespaces: [istio_system]
+`,
+			err: true,
+		},
+		{
+			name: "remote access gateway ports",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+remoteAccess:
+  gatewayHost: kubeflow.example.com
+  firstGatewayPort: 2200
+  lastGatewayPort: 2299
+`,
+			check: func(t *testing.T, c *NotebookControllerConfig) {
+				if !c.RemoteAccess.GatewayRoutingEnabled() || c.RemoteAccess.User != DefaultRemoteAccessUser ||
+					c.RemoteAccess.Image != DefaultRemoteAccessImage {
+					t.Errorf("Got the configuration %+v", c.RemoteAccess)
+				}
+			},
+		},
+		{
+			name: "remote access gateway ports without host",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+remoteAccess:
+  firstGatewayPort: 2299
+  lastGatewayPort: 2200
+`,
+			err: true,
+		},
+		{
+			name: "empty pod metadata pattern",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+podMetadata:
+  annotations:
+    deny: [""]
+`,
+			err: true,
+		},
+		{
+			name: "events",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+events:
+  qps: 0.5
+  cacheSize: 500
+`,
+			check: func(t *testing.T, c *NotebookControllerConfig) {
+				if c.Events.QPS != 0.5 || c.Events.Burst != DefaultEventBurst || c.Events.CacheSize != 500 {
+					t.Errorf("Got the configuration %+v", c.Events)
+				}
+			},
+		},
+		{
+			name: "negative event burst",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+events:
+  burst: -1
+`,
+			err: true,
+		},
+		{
+			name: "negative grace period",
+			content: `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+culling:
+  gracePeriod: -1m
+`,
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			writeConfig(t, path, test.content)
+			c, err := Load(path)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			test.check(t, c)
+		})
+	}
+}
+
+// TestShippedConfig loads the configuration files of the manifests
+func TestShippedConfig(t *testing.T) {
+	testCases := map[string]routing.Mode{
+		"../../config/manager/config.yaml":             routing.ModeIstio,
+		"../../config/overlays/standalone/config.yaml": routing.ModeNone,
+	}
+	for path, mode := range testCases {
+		c, err := Load(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.Routing.Mode != mode || c.Culling.Enabled {
+			t.Errorf("Got the configuration %+v from %s", c, path)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		expectedMode routing.Mode
+		expectErr    bool
+	}{
+		{
+			name:         "no routing by default",
+			env:          map[string]string{},
+			expectedMode: routing.ModeNone,
+		},
+		{
+			name:         "USE_ISTIO enables the VirtualService",
+			env:          map[string]string{"USE_ISTIO": "true"},
+			expectedMode: routing.ModeIstio,
+		},
+		{
+			name:         "ROUTING_MODE takes precedence over USE_ISTIO",
+			env:          map[string]string{"USE_ISTIO": "true", "ROUTING_MODE": "gateway-api"},
+			expectedMode: routing.ModeGatewayAPI,
+		},
+		{
+			name:      "unknown ROUTING_MODE",
+			env:       map[string]string{"ROUTING_MODE": "nginx"},
+			expectErr: true,
+		},
+		{
+			name:      "CULL_IDLE_TIME is not a number",
+			env:       map[string]string{"CULL_IDLE_TIME": "1h"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, k := range []string{"USE_ISTIO", "ROUTING_MODE", "CULL_IDLE_TIME"} {
+				t.Setenv(k, test.env[k])
+			}
+			c, err := FromEnv()
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if c.Routing.Mode != test.expectedMode {
+				t.Errorf("Got mode %v, Expected %v", c.Routing.Mode, test.expectedMode)
+			}
+		})
+	}
+
+	t.Setenv("ENABLE_CULLING", "true")
+	t.Setenv("CULL_IDLE_TIME", "30")
+	t.Setenv("ADD_FSGROUP", "false")
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !c.Culling.Enabled || c.Culling.IdleTime.Duration != 30*time.Minute || *c.AddFSGroup {
+		t.Errorf("Got the configuration %+v", c)
+	}
+}
+
+func TestCheckLegacySettings(t *testing.T) {
+	for _, k := range LegacyEnv {
+		t.Setenv(k, "")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeConfig(t, path, "culling:\n  enabled: true\n")
+
+	if err := CheckLegacySettings(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A literal merged into the ConfigMap by an overlay
+	writeConfig(t, filepath.Join(dir, "ENABLE_CULLING"), "true")
+	err := CheckLegacySettings(path)
+	if err == nil || !strings.Contains(err.Error(), "ENABLE_CULLING") {
+		t.Errorf("Got the error %v, Expected ENABLE_CULLING to be reported", err)
+	}
+	os.Remove(filepath.Join(dir, "ENABLE_CULLING"))
+
+	t.Setenv("USE_ISTIO", "true")
+	err = CheckLegacySettings(path)
+	if err == nil || !strings.Contains(err.Error(), "USE_ISTIO") {
+		t.Errorf("Got the error %v, Expected USE_ISTIO to be reported", err)
+	}
+}
+
+func TestProviderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+culling:
+  enabled: true
+  idleTime: 1h
+  maxConcurrentChecks: 20
+`)
+	p, err := NewFileProvider(path, logr.Discard())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Only the culling settings are reloaded, and the culler can't be
+	// disabled or get more workers without a restart
+	writeConfig(t, path, `apiVersion: config.kubeflow.org/v1alpha1
+kind: NotebookControllerConfig
+clusterDomain: example.com
+culling:
+  enabled: false
+  idleTime: 2h
+  maxConcurrentChecks: 50
+  probeTimeout: 5s
+`)
+	if err := p.reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := p.Get()
+	if c.Culling.IdleTime.Duration != 2*time.Hour || c.Culling.ProbeTimeout.Duration != 5*time.Second ||
+		!c.Culling.Enabled || c.Culling.MaxConcurrentChecks != 20 || c.ClusterDomain != DefaultClusterDomain {
+		t.Errorf("Got the configuration %+v", c)
+	}
+
+	// An invalid file keeps the current configuration
+	writeConfig(t, path, "kind: [")
+	if err := p.reload(); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if p.Get() != c {
+		t.Errorf("Expected the configuration to be kept")
+	}
+}
+
+func TestNilProvider(t *testing.T) {
+	var p *Provider
+	if c := p.Get(); c.Culling.IdleTime.Duration != DefaultCullIdleTime {
+		t.Errorf("Expected the default configuration, got %+v", c)
+	}
+}
+
+func TestMetadataFilter(t *testing.T) {
+	f := &MetadataFilter{
+		Allow: []string{"*.example.com/*", "team"},
+		Deny:  []string{"secret.example.com/*"},
+	}
+	tests := map[string]bool{
+		"mynotebook-team.example.com/owner": true,
+		"team":                              true,
+		"teams":                             false,
+		"secret.example.com/token":          false,
+		"sidecar.istio.io/inject":           false,
+	}
+	for key, expected := range tests {
+		if got := f.Propagates(key); got != expected {
+			t.Errorf("Got %v for %s, Expected %v", got, key, expected)
+		}
+	}
+
+	// Without allow patterns every key that isn't denied is propagated
+	f.Allow = nil
+	if !f.Propagates("sidecar.istio.io/inject") || f.Propagates("secret.example.com/token") {
+		t.Errorf("Expected only the denied keys to be dropped")
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ReloadPeriod is how often a Provider checks its configuration file for
+// changes. Mounted ConfigMaps are updated by the kubelet, so there are no
+// file events to rely on.
+var ReloadPeriod = 30 * time.Second
+
+// Provider hands the current configuration to the reconcilers. It is safe for
+// concurrent use. A nil Provider provides the default configuration, so the
+// reconcilers can be created without one in tests.
+type Provider struct {
+	mu     sync.RWMutex
+	config *NotebookControllerConfig
+
+	// path and data are the configuration file and its last read content
+	path string
+	data []byte
+	log  logr.Logger
+}
+
+// NewProvider returns a Provider of a fixed configuration
+func NewProvider(c *NotebookControllerConfig) *Provider {
+	return &Provider{config: c}
+}
+
+// NewFileProvider returns a Provider of the configuration file at path. Once
+// started, it reloads the settings that can be changed safely when the file
+// changes.
+func NewFileProvider(path string, log logr.Logger) (*Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{config: c, path: path, data: data, log: log}, nil
+}
+
+// Get returns the current configuration, which must not be modified
+func (p *Provider) Get() *NotebookControllerConfig {
+	if p == nil {
+		return Default()
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
+}
+
+// Start reloads the configuration file until the context is done. It
+// implements manager.Runnable.
+func (p *Provider) Start(ctx context.Context) error {
+	if p.path == "" {
+		return nil
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.reload(); err != nil {
+			p.log.Error(err, "Could not reload the configuration, keeping the current one")
+		}
+	}, ReloadPeriod)
+	return nil
+}
+
+// reload applies the changes of the configuration file to the culling
+// settings. The other settings are only read at startup, since they decide
+// which controllers and watches are set up, how many workers they have, or
+// would restart all the Notebooks.
+func (p *Provider) reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, p.data) {
+		return nil
+	}
+	loaded, err := Load(p.path)
+	if err != nil {
+		return err
+	}
+	p.data = data
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	updated := *p.config
+	updated.Culling = loaded.Culling
+	updated.Culling.Enabled = p.config.Culling.Enabled
+	updated.Culling.MaxConcurrentChecks = p.config.Culling.MaxConcurrentChecks
+	p.config = &updated
+	p.log.Info("Reloaded the culling configuration", "culling", updated.Culling)
+	if !reflect.DeepEqual(&updated, loaded) {
+		p.log.Info("The configuration file has changes that require a restart of the controller")
+	}
+	return nil
+}
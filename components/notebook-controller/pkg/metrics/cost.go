@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// PriceTable is the price per hour of a unit of each resource: a CPU core, a
+// GiB of memory or a GPU.
+type PriceTable map[corev1.ResourceName]float64
+
+// ParsePriceTable parses a price table in the format
+// "cpu=0.03,memory=0.004,nvidia.com/gpu=2.5". An empty string is an empty
+// table.
+func ParsePriceTable(s string) (PriceTable, error) {
+	prices := PriceTable{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid price %q, expected <resource>=<price per hour>", entry)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("invalid price of %s: %q", parts[0], parts[1])
+		}
+		prices[corev1.ResourceName(strings.TrimSpace(parts[0]))] = price
+	}
+	return prices, nil
+}
+
+// HourlyCost returns the estimated cost per hour of the resources
+func (p PriceTable) HourlyCost(resources corev1.ResourceList) float64 {
+	cost := 0.0
+	for name, price := range p {
+		if quantity, ok := resources[name]; ok {
+			cost += resourceUnits(name, quantity) * price
+		}
+	}
+	return cost
+}
+
+// resourceUnits returns the quantity in the unit it's priced in: cores for
+// CPU, GiB for memory and the plain value for everything else.
+func resourceUnits(name corev1.ResourceName, quantity resource.Quantity) float64 {
+	switch name {
+	case corev1.ResourceCPU:
+		return float64(quantity.MilliValue()) / 1000
+	case corev1.ResourceMemory:
+		return float64(quantity.Value()) / (1 << 30)
+	default:
+		return float64(quantity.Value())
+	}
+}
+
+// podRequests returns the resources requested by a pod spec, the way the
+// scheduler accounts for them: the sum of the containers, or the largest
+// init container if it requests more, plus the overhead. Limits are used for
+// the resources without requests, the same way the API server defaults them.
+func podRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, c := range spec.Containers {
+		for name, quantity := range containerRequests(c) {
+			sum := total[name]
+			sum.Add(quantity)
+			total[name] = sum
+		}
+	}
+	for _, c := range spec.InitContainers {
+		for name, quantity := range containerRequests(c) {
+			if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+				total[name] = quantity
+			}
+		}
+	}
+	for name, quantity := range spec.Overhead {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+	return total
+}
+
+// containerRequests returns the requests of the container, defaulted to its
+// limits
+func containerRequests(c corev1.Container) corev1.ResourceList {
+	requests := c.Resources.Requests.DeepCopy()
+	if requests == nil {
+		requests = corev1.ResourceList{}
+	}
+	for name, limit := range c.Resources.Limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = limit
+		}
+	}
+	return requests
+}
+
+// gpuCount returns the number of GPUs in the resources, which are the
+// extended resources named <vendor>/gpu, e.g. nvidia.com/gpu.
+func gpuCount(resources corev1.ResourceList) float64 {
+	count := 0.0
+	for name, quantity := range resources {
+		if strings.HasSuffix(string(name), "/gpu") {
+			count += float64(quantity.Value())
+		}
+	}
+	return count
+}
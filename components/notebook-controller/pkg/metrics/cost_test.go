@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func TestParsePriceTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected PriceTable
+		err      bool
+	}{
+		{name: "empty", value: "", expected: PriceTable{}},
+		{
+			name:  "prices",
+			value: "cpu=0.03, memory=0.004,nvidia.com/gpu=2.5",
+			expected: PriceTable{
+				corev1.ResourceCPU:    0.03,
+				corev1.ResourceMemory: 0.004,
+				"nvidia.com/gpu":      2.5,
+			},
+		},
+		{name: "missing price", value: "cpu", err: true},
+		{name: "invalid price", value: "cpu=cheap", err: true},
+		{name: "negative price", value: "cpu=-1", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParsePriceTable(test.value)
+			if test.err {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(got) != len(test.expected) {
+				t.Fatalf("Got %v, Expected %v", got, test.expected)
+			}
+			for name, price := range test.expected {
+				if got[name] != price {
+					t.Errorf("Got price %v for %s, Expected %v", got[name], name, price)
+				}
+			}
+		})
+	}
+}
+
+func TestHourlyCost(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("2Gi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("2"),
+						"nvidia.com/gpu":   resource.MustParse("1"),
+					},
+				},
+			},
+			{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("500m"),
+					},
+				},
+			},
+		},
+	}
+	prices := PriceTable{
+		corev1.ResourceCPU:    0.04,
+		corev1.ResourceMemory: 0.005,
+		"nvidia.com/gpu":      2.5,
+	}
+
+	requests := podRequests(spec)
+	if gpus := gpuCount(requests); gpus != 1 {
+		t.Errorf("Got %v GPUs, Expected the GPU limit to be used as request", gpus)
+	}
+	// 1 core, 2 GiB and a GPU
+	expected := 0.04 + 2*0.005 + 2.5
+	if got := prices.HourlyCost(requests); math.Abs(got-expected) > 1e-9 {
+		t.Errorf("Got cost %v, Expected %v", got, expected)
+	}
+}
+
+func TestNotebookRequests(t *testing.T) {
+	nb := &v1beta1.Notebook{
+		Spec: v1beta1.NotebookSpec{
+			Template: v1beta1.NotebookTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				}}},
+			}},
+			Workers: &v1beta1.NotebookWorkersSpec{
+				Replicas: 3,
+				Template: v1beta1.NotebookTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+					}}},
+				}},
+			},
+		},
+	}
+
+	requests := notebookRequests(nb)
+	if cpu := requests.Cpu(); cpu.MilliValue() != 2500 {
+		t.Errorf("Got %s CPU, Expected the requests of the workers to be included", cpu)
+	}
+}
+
+func TestPodRequestsInitContainers(t *testing.T) {
+	spec := &corev1.PodSpec{
+		InitContainers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+		}}},
+		Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+		}}},
+		Overhead: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+	}
+
+	requests := podRequests(spec)
+	if cpu := requests.Cpu(); cpu.MilliValue() != 2250 {
+		t.Errorf("Got %s CPU, Expected the init container and the overhead", cpu)
+	}
+	if memory := requests.Memory(); memory.String() != "4Gi" {
+		t.Errorf("Got %s memory, Expected the containers", memory)
+	}
+}
@@ -2,33 +2,100 @@ package metrics
 
 import (
 	"context"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+// The phases Notebooks are reported in
+const (
+	PhaseRunning = "running"
+	PhaseStopped = "stopped"
+	PhasePending = "pending"
+	PhaseFailed  = "failed"
+)
+
+var (
+	runningNotebooksDesc = prometheus.NewDesc(
+		"notebook_running",
+		"Current running notebooks in the cluster",
+		[]string{"namespace"}, nil,
+	)
+	notebooksDesc = prometheus.NewDesc(
+		"notebooks",
+		"Current notebooks in the cluster by phase, image and namespace",
+		[]string{"namespace", "phase", "image"}, nil,
+	)
+	requestedCPUDesc = prometheus.NewDesc(
+		"notebook_requested_cpu_cores",
+		"CPU cores requested by the Pods of notebooks that aren't stopped",
+		[]string{"namespace", "name"}, nil,
+	)
+	requestedMemoryDesc = prometheus.NewDesc(
+		"notebook_requested_memory_bytes",
+		"Memory requested by the Pods of notebooks that aren't stopped",
+		[]string{"namespace", "name"}, nil,
+	)
+	requestedGPUsDesc = prometheus.NewDesc(
+		"notebook_requested_gpus",
+		"GPUs requested by the Pods of notebooks that aren't stopped",
+		[]string{"namespace", "name"}, nil,
+	)
+	uptimeDesc = prometheus.NewDesc(
+		"notebook_uptime_seconds",
+		"Time since notebooks that aren't stopped were created or last started",
+		[]string{"namespace", "name"}, nil,
+	)
+	stoppedDurationDesc = prometheus.NewDesc(
+		"notebook_stopped_seconds",
+		"Time since stopped notebooks were stopped",
+		[]string{"namespace", "name"}, nil,
+	)
+	estimatedCostDesc = prometheus.NewDesc(
+		"notebook_estimated_cost_per_hour",
+		"Estimated cost per hour of the resources requested by notebooks that aren't stopped",
+		[]string{"namespace", "name"}, nil,
+	)
 )
 
-// Metrics includes metrics used in notebook controller
+// Metrics includes metrics used in notebook controller. The gauges that
+// describe the current Notebooks are computed from the Notebooks in the
+// informer cache of the manager whenever the metrics are collected, so that
+// scrapes don't hit the API server.
 type Metrics struct {
-	cli                      client.Client
-	runningNotebooks         *prometheus.GaugeVec
-	NotebookCreation         *prometheus.CounterVec
-	NotebookFailCreation     *prometheus.CounterVec
-	NotebookCullingCount     *prometheus.CounterVec
-	NotebookCullingTimestamp *prometheus.GaugeVec
+	reader                    client.Reader
+	prices                    PriceTable
+	NotebookCreation          *prometheus.CounterVec
+	NotebookFailCreation      *prometheus.CounterVec
+	NotebookCullingCount      *prometheus.CounterVec
+	NotebookCullingTimestamp  *prometheus.GaugeVec
+	NotebookTimeToReady       *prometheus.HistogramVec
+	NotebookImagePullFailures *prometheus.CounterVec
+	NotebookProbeDuration     *prometheus.HistogramVec
+	NotebookProbeFailures     *prometheus.CounterVec
+	NotebookCullingCheckDelay *prometheus.HistogramVec
 }
 
-func NewMetrics(cli client.Client) *Metrics {
-	m := &Metrics{
-		cli: cli,
-		runningNotebooks: prometheus.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "notebook_running",
-				Help: "Current running notebooks in the cluster",
-			},
-			[]string{"namespace"},
-		),
+// NewMetrics creates and registers the metrics of the notebook controller.
+// The reader should be the cache of the manager. The estimated cost of the
+// Notebooks is only reported if prices are set.
+func NewMetrics(reader client.Reader, prices PriceTable) *Metrics {
+	m := newMetrics(reader, prices)
+	metrics.Registry.MustRegister(m)
+	return m
+}
+
+func newMetrics(reader client.Reader, prices PriceTable) *Metrics {
+	return &Metrics{
+		reader: reader,
+		prices: prices,
 		NotebookCreation: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "notebook_create_total",
@@ -57,43 +124,221 @@ func NewMetrics(cli client.Client) *Metrics {
 			},
 			[]string{"namespace", "name"},
 		),
+		NotebookTimeToReady: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "notebook_time_to_ready_seconds",
+				Help:    "Time it took notebooks to become ready after they were created or started",
+				Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+			},
+			[]string{"namespace"},
+		),
+		NotebookImagePullFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "notebook_image_pull_failures_total",
+				Help: "Total times notebooks failed to pull their image",
+			},
+			[]string{"namespace", "name"},
+		),
+		NotebookProbeDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "notebook_idleness_probe_duration_seconds",
+				Help:    "Time it took the idleness probes of the culler to respond, or to fail",
+				Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+			},
+			[]string{"namespace", "probe"},
+		),
+		NotebookProbeFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "notebook_idleness_probe_failures_total",
+				Help: "Total times the idleness probes of the culler failed",
+			},
+			[]string{"namespace", "probe"},
+		),
+		NotebookCullingCheckDelay: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "notebook_culling_check_delay_seconds",
+				Help:    "Time the idleness checks of the culler started after they were due",
+				Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+			},
+			[]string{"namespace"},
+		),
 	}
-
-	metrics.Registry.MustRegister(m)
-	return m
 }
 
 // Describe implements the prometheus.Collector interface.
 func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
-	m.runningNotebooks.Describe(ch)
 	m.NotebookCreation.Describe(ch)
 	m.NotebookFailCreation.Describe(ch)
+	m.NotebookCullingCount.Describe(ch)
+	m.NotebookCullingTimestamp.Describe(ch)
+	m.NotebookTimeToReady.Describe(ch)
+	m.NotebookImagePullFailures.Describe(ch)
+	m.NotebookProbeDuration.Describe(ch)
+	m.NotebookProbeFailures.Describe(ch)
+	m.NotebookCullingCheckDelay.Describe(ch)
+	ch <- runningNotebooksDesc
+	ch <- notebooksDesc
+	ch <- requestedCPUDesc
+	ch <- requestedMemoryDesc
+	ch <- requestedGPUsDesc
+	ch <- uptimeDesc
+	ch <- stoppedDurationDesc
+	ch <- estimatedCostDesc
 }
 
 // Collect implements the prometheus.Collector interface.
 func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
-	m.scrape()
-	m.runningNotebooks.Collect(ch)
 	m.NotebookCreation.Collect(ch)
 	m.NotebookFailCreation.Collect(ch)
+	m.NotebookCullingCount.Collect(ch)
+	m.NotebookCullingTimestamp.Collect(ch)
+	m.NotebookTimeToReady.Collect(ch)
+	m.NotebookImagePullFailures.Collect(ch)
+	m.NotebookProbeDuration.Collect(ch)
+	m.NotebookProbeFailures.Collect(ch)
+	m.NotebookCullingCheckDelay.Collect(ch)
+	m.collectNotebooks(ch, time.Now())
+}
+
+// notebookCount is the key of the notebooks gauge
+type notebookCount struct {
+	namespace, phase, image string
 }
 
-// scrape gets current running notebook statefulsets.
-func (m *Metrics) scrape() {
-	stsList := &appsv1.StatefulSetList{}
-	err := m.cli.List(context.TODO(), stsList)
-	if err != nil {
+// collectNotebooks computes the gauges of the Notebooks in the cache
+func (m *Metrics) collectNotebooks(ch chan<- prometheus.Metric, now time.Time) {
+	nbList := &v1beta1.NotebookList{}
+	if err := m.reader.List(context.TODO(), nbList); err != nil {
 		return
 	}
-	stsCache := make(map[string]float64)
-	for _, v := range stsList.Items {
-		name, ok := v.Spec.Template.GetLabels()["notebook-name"]
-		if ok && name == v.Name {
-			stsCache[v.Namespace] += 1
+
+	requestsByNotebook := m.podRequestsByNotebook()
+	running := map[string]int{}
+	counts := map[notebookCount]int{}
+	for i := range nbList.Items {
+		nb := &nbList.Items[i]
+		phase := NotebookPhase(nb)
+		counts[notebookCount{nb.Namespace, phase, notebookImage(nb)}]++
+		if phase == PhaseRunning {
+			running[nb.Namespace]++
+		}
+
+		gauge := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, nb.Namespace, nb.Name)
+		}
+
+		if phase == PhaseStopped {
+			if nb.Status.StoppedAt != nil {
+				gauge(stoppedDurationDesc, now.Sub(nb.Status.StoppedAt.Time).Seconds())
+			}
+			continue
+		}
+
+		// The Stopped condition turned False when the Notebook was last
+		// started
+		startTime := nb.CreationTimestamp.Time
+		if stopped := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionStopped); stopped != nil {
+			startTime = stopped.LastTransitionTime.Time
+		}
+		gauge(uptimeDesc, now.Sub(startTime).Seconds())
+
+		// The Pods also have what was injected into them, e.g. by
+		// PodDefaults and LimitRanges, but don't exist yet while pending
+		requests, ok := requestsByNotebook[types.NamespacedName{Namespace: nb.Namespace, Name: nb.Name}]
+		if !ok {
+			requests = notebookRequests(nb)
+		}
+		cpu, memory := requests.Cpu(), requests.Memory()
+		gauge(requestedCPUDesc, float64(cpu.MilliValue())/1000)
+		gauge(requestedMemoryDesc, float64(memory.Value()))
+		gauge(requestedGPUsDesc, gpuCount(requests))
+		if len(m.prices) > 0 {
+			gauge(estimatedCostDesc, m.prices.HourlyCost(requests))
+		}
+	}
+
+	for ns, count := range running {
+		ch <- prometheus.MustNewConstMetric(runningNotebooksDesc, prometheus.GaugeValue, float64(count), ns)
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(notebooksDesc, prometheus.GaugeValue, float64(count),
+			key.namespace, key.phase, key.image)
+	}
+}
+
+// podRequestsByNotebook returns the resources requested by the Pods in the
+// cache, i.e. the notebook Pods and their workers, by Notebook. Pods that
+// terminated don't request anything anymore.
+func (m *Metrics) podRequestsByNotebook() map[types.NamespacedName]corev1.ResourceList {
+	requests := map[types.NamespacedName]corev1.ResourceList{}
+	pods := &corev1.PodList{}
+	if err := m.reader.List(context.TODO(), pods, client.HasLabels{"notebook-name"}); err != nil {
+		return requests
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels["notebook-name"]}
+		if requests[key] == nil {
+			requests[key] = corev1.ResourceList{}
+		}
+		for name, quantity := range podRequests(&pod.Spec) {
+			sum := requests[key][name]
+			sum.Add(quantity)
+			requests[key][name] = sum
+		}
+	}
+	return requests
+}
+
+// notebookRequests returns the resources requested by the Notebook's Pod and
+// its workers according to their templates
+func notebookRequests(nb *v1beta1.Notebook) corev1.ResourceList {
+	requests := podRequests(&nb.Spec.Template.Spec)
+	if nb.Spec.Workers == nil {
+		return requests
+	}
+	for name, quantity := range podRequests(&nb.Spec.Workers.Template.Spec) {
+		sum := requests[name]
+		for i := int32(0); i < nb.Spec.Workers.Replicas; i++ {
+			sum.Add(quantity)
 		}
+		requests[name] = sum
+	}
+	return requests
+}
+
+// NotebookPhase returns the phase of a Notebook according to its conditions:
+// stopped, failed if it is degraded, running if it is ready and pending
+// otherwise.
+func NotebookPhase(nb *v1beta1.Notebook) string {
+	conditions := nb.Status.Conditions
+	switch {
+	case meta.IsStatusConditionTrue(conditions, v1beta1.NotebookConditionStopped) ||
+		nb.Spec.State == v1beta1.NotebookStateStopped:
+		return PhaseStopped
+	case meta.IsStatusConditionTrue(conditions, v1beta1.NotebookConditionDegraded):
+		return PhaseFailed
+	case meta.IsStatusConditionTrue(conditions, v1beta1.NotebookConditionReady):
+		return PhaseRunning
+	default:
+		return PhasePending
 	}
+}
 
-	for ns, v := range stsCache {
-		m.runningNotebooks.WithLabelValues(ns).Set(v)
+// notebookImage returns the image of the Notebook's container, which is the
+// one named after the Notebook or, failing that, the first one.
+func notebookImage(nb *v1beta1.Notebook) string {
+	containers := nb.Spec.Template.Spec.Containers
+	for _, c := range containers {
+		if c.Name == nb.Name {
+			return c.Image
+		}
+	}
+	if len(containers) > 0 {
+		return containers[0].Image
 	}
+	return ""
 }
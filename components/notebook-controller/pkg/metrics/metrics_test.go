@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubeflow/kubeflow/components/notebook-controller/api/v1beta1"
+)
+
+func newTestNotebook(name, image string, conditions ...metav1.Condition) *v1beta1.Notebook {
+	return &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		Spec: v1beta1.NotebookSpec{
+			Template: v1beta1.NotebookTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: name, Image: image}}},
+			},
+		},
+		Status: v1beta1.NotebookStatus{Conditions: conditions},
+	}
+}
+
+func TestCollectNotebooks(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+
+	condition := func(conditionType string) metav1.Condition {
+		return metav1.Condition{Type: conditionType, Status: metav1.ConditionTrue}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newTestNotebook("running-1", "jupyter", condition(v1beta1.NotebookConditionReady)),
+		newTestNotebook("running-2", "jupyter", condition(v1beta1.NotebookConditionReady)),
+		newTestNotebook("stopped", "jupyter", condition(v1beta1.NotebookConditionStopped)),
+		newTestNotebook("failed", "codeserver", condition(v1beta1.NotebookConditionDegraded)),
+		newTestNotebook("pending", "codeserver"),
+	).Build()
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(newMetrics(c, nil))
+
+	expected := `
+# HELP notebook_running Current running notebooks in the cluster
+# TYPE notebook_running gauge
+notebook_running{namespace="test-namespace"} 2
+# HELP notebooks Current notebooks in the cluster by phase, image and namespace
+# TYPE notebooks gauge
+notebooks{image="codeserver",namespace="test-namespace",phase="failed"} 1
+notebooks{image="codeserver",namespace="test-namespace",phase="pending"} 1
+notebooks{image="jupyter",namespace="test-namespace",phase="running"} 2
+notebooks{image="jupyter",namespace="test-namespace",phase="stopped"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"notebook_running", "notebooks"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectNotebookRequests(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	cpu := func(quantity string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(quantity)},
+		}
+	}
+	pod := func(name string, phase corev1.PodPhase, containers ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "test-namespace",
+				Labels:    map[string]string{"notebook-name": "running"},
+			},
+			Spec:   corev1.PodSpec{Containers: containers},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	running := newTestNotebook("running", "jupyter",
+		metav1.Condition{Type: v1beta1.NotebookConditionReady, Status: metav1.ConditionTrue})
+	running.Spec.Template.Spec.Containers[0].Resources = cpu("1")
+	pending := newTestNotebook("pending", "jupyter")
+	pending.Spec.Template.Spec.Containers[0].Resources = cpu("2")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		running,
+		pending,
+		// The sidecar was injected into the Pod
+		pod("running-0", corev1.PodRunning,
+			corev1.Container{Name: "running", Resources: cpu("1")},
+			corev1.Container{Name: "istio-proxy", Resources: cpu("500m")}),
+		pod("running-worker-0", corev1.PodSucceeded, corev1.Container{Name: "worker", Resources: cpu("4")}),
+	).Build()
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(newMetrics(c, nil))
+
+	expected := `
+# HELP notebook_requested_cpu_cores CPU cores requested by the Pods of notebooks that aren't stopped
+# TYPE notebook_requested_cpu_cores gauge
+notebook_requested_cpu_cores{name="pending",namespace="test-namespace"} 2
+notebook_requested_cpu_cores{name="running",namespace="test-namespace"} 1.5
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"notebook_requested_cpu_cores"); err != nil {
+		t.Error(err)
+	}
+}
@@ -25,7 +25,6 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	"github.com/kubeflow/kubeflow/components/common/routing"
 	kubefloworgv1alpha1 "github.com/kubeflow/kubeflow/components/pvc-viewer/api/v1alpha1"
 )
 
@@ -40,6 +40,9 @@ import (
 type PVCViewerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Set up from the environment by SetupWithManager
+	routingConfig routing.Config
 }
 
 const (
@@ -51,16 +54,15 @@ const (
 	partOfLabelKey   = "app.kubernetes.io/part-of"
 	partOfLabelValue = "pvc-viewer"
 
-	servicePort  = int32(80)
-	istioGateway = "kubeflow/kubeflow-gateway"
+	servicePort = int32(80)
 )
 
 var (
-	virtualServiceTemplate = &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "networking.istio.io/v1alpha3",
-			"kind":       "VirtualService",
-		},
+	// Viewers are exposed through an Istio VirtualService unless
+	// ROUTING_MODE says otherwise
+	routingDefaults = routing.Config{
+		Mode:    routing.ModeIstio,
+		Gateway: "kubeflow/kubeflow-gateway",
 	}
 )
 
@@ -73,6 +75,7 @@ var (
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update
 
 // Add permissions to read external resources
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
@@ -80,13 +83,20 @@ var (
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PVCViewerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	var err error
+	if r.routingConfig, err = routing.ConfigFromEnv(routingDefaults); err != nil {
+		return err
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&kubefloworgv1alpha1.PVCViewer{}).
 		// This controller manages, i.e. creates these kinds for a PVCViewer
 		Owns(&appsv1.Deployment{}).
-		Owns(&corev1.Service{}).
-		Owns(virtualServiceTemplate).
-		Complete(r)
+		Owns(&corev1.Service{})
+	if r.routingConfig.Enabled() {
+		builder = builder.Owns(r.routingConfig.Object())
+	}
+	return builder.Complete(r)
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -130,8 +140,8 @@ func (r *PVCViewerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
-	if err := r.reconcileVirtualService(ctx, log, instance, commonLabels); err != nil {
-		log.Error(err, "Error while reconciling virtual service")
+	if err := r.reconcileRoute(ctx, log, instance, commonLabels); err != nil {
+		log.Error(err, "Error while reconciling route")
 		return ctrl.Result{}, err
 	}
 
@@ -247,83 +257,37 @@ func (r *PVCViewerReconciler) reconcileService(ctx context.Context, log logr.Log
 	return r.Update(ctx, service)
 }
 
-func (r *PVCViewerReconciler) reconcileVirtualService(ctx context.Context, log logr.Logger, viewer *kubefloworgv1alpha1.PVCViewer, commonLabels map[string]string) error {
-	if viewer.Spec.Networking == (kubefloworgv1alpha1.Networking{}) {
+// Reconciles the VirtualService or HTTPRoute exposing the viewer, depending on the routing mode
+func (r *PVCViewerReconciler) reconcileRoute(ctx context.Context, log logr.Logger, viewer *kubefloworgv1alpha1.PVCViewer, commonLabels map[string]string) error {
+	if viewer.Spec.Networking == (kubefloworgv1alpha1.Networking{}) || !r.routingConfig.Enabled() {
 		return nil
 	}
 
-	virtualService := &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "networking.istio.io/v1alpha3",
-			"kind":       "VirtualService",
-			"metadata": map[string]interface{}{
-				"name":      resourcePrefix + viewer.Name,
-				"namespace": viewer.Namespace,
-				"labels":    commonLabels,
-			},
-		},
-	}
-	createVirtualService := false
-	if err := r.Get(ctx, types.NamespacedName{Name: virtualService.GetName(), Namespace: virtualService.GetNamespace()}, virtualService); err != nil {
-		if !apierrs.IsNotFound(err) {
-			return err
-		}
-		createVirtualService = true
-	}
-
 	prefix := fmt.Sprintf("%s/%s/%s/", viewer.Spec.Networking.BasePrefix, viewer.Namespace, viewer.Name)
 	rewrite := prefix
 	if viewer.Spec.Networking.Rewrite != "" {
 		rewrite = viewer.Spec.Networking.Rewrite
 	}
-	service := fmt.Sprintf("%s%s.%s.svc.cluster.local", resourcePrefix, viewer.Name, viewer.Namespace)
-	var timeout *string = nil
-	if viewer.Spec.Networking.Timeout != "" {
-		timeout = &viewer.Spec.Networking.Timeout
-	}
 
-	virtualService.Object["spec"] = map[string]interface{}{
-		"hosts": []string{"*"},
-		"gateways": []string{
-			istioGateway,
-		},
-		"http": []interface{}{
-			map[string]interface{}{
-				"match": []interface{}{
-					map[string]interface{}{
-						"uri": map[string]interface{}{
-							"prefix": prefix,
-						},
-					},
-				},
-				"rewrite": map[string]interface{}{
-					"uri": rewrite,
-				},
-				"route": []interface{}{
-					map[string]interface{}{
-						"destination": map[string]interface{}{
-							"host": service,
-							"port": map[string]interface{}{
-								"number": int64(servicePort),
-							},
-						},
-					},
-				},
-				"timeout": timeout,
-			},
-		},
+	route, err := routing.Generate(r.routingConfig, routing.Route{
+		Name:        resourcePrefix + viewer.Name,
+		Namespace:   viewer.Namespace,
+		Labels:      commonLabels,
+		Prefix:      prefix,
+		Rewrite:     rewrite,
+		Timeout:     viewer.Spec.Networking.Timeout,
+		ServiceName: resourcePrefix + viewer.Name,
+		ServicePort: servicePort,
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := ctrl.SetControllerReference(viewer, virtualService, r.Scheme); err != nil {
+	if err := ctrl.SetControllerReference(viewer, route, r.Scheme); err != nil {
 		return err
 	}
 
-	if createVirtualService {
-		log.Info("Creating Virtual Service")
-		return r.Create(ctx, virtualService)
-	}
-	log.Info("Updating Virtual Service")
-	return r.Update(ctx, virtualService)
+	return routing.Reconcile(ctx, r.Client, route, log)
 }
 
 // Computes and updates the status of the PVCViewer
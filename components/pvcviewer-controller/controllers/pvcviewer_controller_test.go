@@ -58,7 +58,7 @@ var _ = Describe("PVCViewer controller", func() {
 			&appsv1.Deployment{},
 			&corev1.Service{},
 			&corev1.Pod{},
-			virtualServiceTemplate.DeepCopy(),
+			routingDefaults.Object(),
 		}
 		for _, object := range objectsToDelete {
 			Expect(k8sClient.DeleteAllOf(ctx, object, client.InNamespace(testHelper.namespace))).Should(Succeed())
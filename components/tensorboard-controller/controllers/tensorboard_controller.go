@@ -30,7 +30,6 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -38,6 +37,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	reconcilehelper "github.com/kubeflow/kubeflow/components/common/reconcilehelper"
+	"github.com/kubeflow/kubeflow/components/common/routing"
 	tensorboardv1alpha1 "github.com/kubeflow/kubeflow/components/tensorboard-controller/api/v1alpha1"
 )
 
@@ -45,6 +45,9 @@ import (
 type TensorboardReconciler struct {
 	client.Client
 	Log logr.Logger
+
+	// Set up from the environment by SetupWithManager
+	routingConfig routing.Config
 }
 
 //+kubebuilder:rbac:groups=tensorboard.kubeflow.org,resources=tensorboards,verbs=get;list;watch;create;update;patch;delete
@@ -53,6 +56,7 @@ type TensorboardReconciler struct {
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
 
@@ -109,13 +113,18 @@ func (r *TensorboardReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	// Reconcile istio virtual service.
-	virtualService, err := generateVirtualService(instance)
-	if err := ctrl.SetControllerReference(instance, virtualService, r.Scheme()); err != nil {
-		return ctrl.Result{}, err
-	}
-	if err := reconcilehelper.VirtualService(ctx, r, virtualService.GetName(), virtualService.GetNamespace(), virtualService, logger); err != nil {
-		return ctrl.Result{}, err
+	// Reconcile istio virtual service or gateway api http route.
+	if r.routingConfig.Enabled() {
+		route, err := routing.Generate(r.routingConfig, generateRoute(instance))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := ctrl.SetControllerReference(instance, route, r.Scheme()); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := routing.Reconcile(ctx, r, route, logger); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	foundDeployment := &appsv1.Deployment{}
@@ -158,6 +167,11 @@ func (r *TensorboardReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TensorboardReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	var err error
+	if r.routingConfig, err = routing.ConfigFromEnv(routing.Config{Mode: routing.ModeIstio}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&tensorboardv1alpha1.Tensorboard{}).
 		Owns(&appsv1.Deployment{}).
@@ -318,58 +332,16 @@ func generateService(tb *tensorboardv1alpha1.Tensorboard) *corev1.Service {
 	}
 }
 
-func generateVirtualService(tb *tensorboardv1alpha1.Tensorboard) (*unstructured.Unstructured, error) {
-	prefix := fmt.Sprintf("/tensorboard/%s/%s/", tb.Namespace, tb.Name)
-	rewrite := "/"
-	service := fmt.Sprintf("%s.%s.svc.cluster.local", tb.Name, tb.Namespace)
-	istioGateway, err := getEnvVariable("ISTIO_GATEWAY")
-	if err != nil {
-		return nil, err
-	}
-
-	vsvc := &unstructured.Unstructured{}
-	vsvc.SetAPIVersion("networking.istio.io/v1alpha3")
-	vsvc.SetKind("VirtualService")
-	vsvc.SetName(tb.Name)
-	vsvc.SetNamespace(tb.Namespace)
-	if err := unstructured.SetNestedStringSlice(vsvc.Object, []string{"*"}, "spec", "hosts"); err != nil {
-		return nil, fmt.Errorf("Set .spec.hosts error: %v", err)
-	}
-	if err := unstructured.SetNestedStringSlice(vsvc.Object, []string{istioGateway},
-		"spec", "gateways"); err != nil {
-		return nil, fmt.Errorf("Set .spec.gateways error: %v", err)
+func generateRoute(tb *tensorboardv1alpha1.Tensorboard) routing.Route {
+	return routing.Route{
+		Name:        tb.Name,
+		Namespace:   tb.Namespace,
+		Prefix:      fmt.Sprintf("/tensorboard/%s/%s/", tb.Namespace, tb.Name),
+		Rewrite:     "/",
+		Timeout:     "300s",
+		ServiceName: tb.Name,
+		ServicePort: 80,
 	}
-
-	http := []interface{}{
-		map[string]interface{}{
-			"match": []interface{}{
-				map[string]interface{}{
-					"uri": map[string]interface{}{
-						"prefix": prefix,
-					},
-				},
-			},
-			"rewrite": map[string]interface{}{
-				"uri": rewrite,
-			},
-			"route": []interface{}{
-				map[string]interface{}{
-					"destination": map[string]interface{}{
-						"host": service,
-						"port": map[string]interface{}{
-							"number": int64(80),
-						},
-					},
-				},
-			},
-			"timeout": "300s",
-		},
-	}
-	if err := unstructured.SetNestedSlice(vsvc.Object, http, "spec", "http"); err != nil {
-		return nil, fmt.Errorf("Set .spec.http error: %v", err)
-	}
-
-	return vsvc, nil
 }
 
 func isCloudPath(path string) bool {